@@ -0,0 +1,299 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// a tiny subset of starlark, enough to find the rules of BUILD files and the labels and files they refer to
+
+type starlarkToken struct {
+	kind  byte // 's' string, 'i' identifier or number, or the punctuation itself
+	value string
+	line  int
+}
+
+func tokenizeStarlark(src string) ([]starlarkToken, error) {
+	var tokens []starlarkToken
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\\':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote := string(c)
+			if strings.HasPrefix(src[i:], strings.Repeat(quote, 3)) {
+				quote = strings.Repeat(quote, 3)
+			}
+			// raw, byte and format prefixes are part of the identifier before, they do not matter here
+			end := i + len(quote)
+			s := strings.Builder{}
+			for ; ; end++ {
+				if end >= len(src) || (len(quote) == 1 && src[end] == '\n') {
+					return nil, fmt.Errorf("line %d: unterminated string", line)
+				}
+				if strings.HasPrefix(src[end:], quote) {
+					break
+				}
+				if src[end] == '\\' && end+1 < len(src) {
+					end++
+				}
+				if src[end] == '\n' {
+					line++
+				}
+				s.WriteByte(src[end])
+			}
+			tokens = append(tokens, starlarkToken{kind: 's', value: s.String(), line: line})
+			i = end + len(quote)
+		case c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] == '.' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			if i < len(src) && (src[i] == '"' || src[i] == '\'') && (src[start:i] == "r" || src[start:i] == "b" || src[start:i] == "f") {
+				continue // string prefix
+			}
+			tokens = append(tokens, starlarkToken{kind: 'i', value: src[start:i], line: line})
+		default:
+			tokens = append(tokens, starlarkToken{kind: c, value: string(c), line: line})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// starlarkValue is an evaluated expression, only strings and what contains them are kept
+type starlarkValue struct {
+	strings []string        // strings of a string, list or concatenation, values of dicts, e.g. branches of select()
+	call    string          // name of the called function
+	args    []starlarkValue // positional arguments of a call
+	kwargs  map[string]starlarkValue
+}
+
+// starlarkRule is a top level call with a name argument, e.g. cc_library(name = "foo", ...)
+type starlarkRule struct {
+	kind   string
+	kwargs map[string]starlarkValue
+	line   int
+}
+
+type starlarkParser struct {
+	tokens    []starlarkToken
+	pos       int
+	variables map[string]starlarkValue
+	glob      func(include, exclude []string) []string
+	onCall    func(call starlarkValue, line int) // optional, sees every evaluated call, nested ones first
+}
+
+// parseBuildFile returns the rules of a BUILD file, glob expands the patterns of glob() relative to the package
+func parseBuildFile(src string, glob func(include, exclude []string) []string) ([]starlarkRule, error) {
+	tokens, err := tokenizeStarlark(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &starlarkParser{tokens: tokens, variables: make(map[string]starlarkValue), glob: glob}
+	return p.parse(), nil
+}
+
+// parse evaluates top level statements, calls with a name argument are returned as rules
+func (p *starlarkParser) parse() []starlarkRule {
+	var rules []starlarkRule
+	for p.pos < len(p.tokens) {
+		token := p.tokens[p.pos]
+		switch {
+		case token.kind == 'i' && p.peek(1) == '(':
+			value := p.expression()
+			if name, ok := value.kwargs["name"]; ok && len(name.strings) == 1 {
+				rules = append(rules, starlarkRule{kind: value.call, kwargs: value.kwargs, line: token.line})
+			}
+		case token.kind == 'i' && p.peek(1) == '=' && p.peek(2) != '=':
+			p.pos += 2
+			p.variables[token.value] = p.expression()
+		default:
+			// def, if, for and the like are not evaluated
+			p.pos++
+		}
+	}
+	return rules
+}
+
+func (p *starlarkParser) peek(offset int) byte {
+	if p.pos+offset >= len(p.tokens) {
+		return 0
+	}
+	return p.tokens[p.pos+offset].kind
+}
+
+func (p *starlarkParser) accept(kind byte) bool {
+	if p.peek(0) == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expression evaluates operands joined by binary operators, only + keeps strings of both sides
+func (p *starlarkParser) expression() starlarkValue {
+	value := p.primary()
+	for {
+		switch p.peek(0) {
+		case '+':
+			p.pos++
+			value = starlarkValue{strings: append(value.strings, p.primary().strings...)}
+		case '-', '*', '/', '%', '|':
+			p.pos++
+			p.primary()
+		case 'i':
+			// conditional expressions and comprehensions, e.g. x if cond else y, [f for f in files]
+			switch p.tokens[p.pos].value {
+			case "if", "else", "for", "in", "and", "or", "not":
+				p.pos++
+				value.strings = append(value.strings, p.primary().strings...)
+				continue
+			}
+			return value
+		default:
+			return value
+		}
+	}
+}
+
+func (p *starlarkParser) primary() starlarkValue {
+	if p.pos >= len(p.tokens) {
+		return starlarkValue{}
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	switch token.kind {
+	case 's':
+		value := starlarkValue{strings: []string{token.value}}
+		// implicit concatenation of adjacent strings
+		for p.peek(0) == 's' {
+			value.strings[0] += p.tokens[p.pos].value
+			p.pos++
+		}
+		return p.trailer(value)
+	case '[', '(':
+		closing := byte(']')
+		if token.kind == '(' {
+			closing = ')'
+		}
+		value := starlarkValue{}
+		for p.pos < len(p.tokens) && !p.accept(closing) {
+			value.strings = append(value.strings, p.expression().strings...)
+			if !p.accept(',') && p.peek(0) != closing {
+				p.pos++ // skip what is not understood
+			}
+		}
+		return p.trailer(value)
+	case '{':
+		value := starlarkValue{}
+		for p.pos < len(p.tokens) && !p.accept('}') {
+			p.expression()
+			if p.accept(':') {
+				value.strings = append(value.strings, p.expression().strings...)
+			}
+			if !p.accept(',') && p.peek(0) != '}' {
+				p.pos++
+			}
+		}
+		return p.trailer(value)
+	case 'i':
+		if p.peek(0) == '(' {
+			p.pos++
+			return p.trailer(p.call(token.value))
+		}
+		return p.trailer(p.variables[token.value])
+	case '-', '+':
+		return p.primary()
+	default:
+		return starlarkValue{}
+	}
+}
+
+// trailer skips indexing and method calls after an operand, e.g. "a,b".split(",")
+func (p *starlarkParser) trailer(value starlarkValue) starlarkValue {
+	for {
+		switch {
+		case p.peek(0) == '[':
+			p.primary()
+		case p.peek(0) == '.':
+			p.pos++
+			p.accept('i')
+			if p.accept('(') {
+				p.call("")
+			}
+		default:
+			return value
+		}
+	}
+}
+
+// call evaluates the arguments of a call to name after the opening parenthesis,
+// keyword arguments are written as key = value, key: value is taken as well
+func (p *starlarkParser) call(name string) starlarkValue {
+	line := p.tokens[p.pos-1].line
+	value := starlarkValue{call: name, kwargs: make(map[string]starlarkValue)}
+	for p.pos < len(p.tokens) && !p.accept(')') {
+		if p.peek(0) == 'i' && (p.peek(1) == ':' || p.peek(1) == '=' && p.peek(2) != '=') {
+			key := p.tokens[p.pos].value
+			p.pos += 2
+			value.kwargs[key] = p.expression()
+		} else {
+			p.accept('*')
+			p.accept('*')
+			value.args = append(value.args, p.expression())
+		}
+		if !p.accept(',') && p.peek(0) != ')' {
+			p.pos++
+		}
+	}
+	switch name {
+	case "glob":
+		if p.glob == nil {
+			break
+		}
+		var include, exclude []string
+		if len(value.args) > 0 {
+			include = value.args[0].strings
+		}
+		include = append(include, value.kwargs["include"].strings...)
+		exclude = value.kwargs["exclude"].strings
+		if len(value.args) > 1 {
+			exclude = append(exclude, value.args[1].strings...)
+		}
+		value.strings = p.glob(include, exclude)
+	case "select":
+		if len(value.args) > 0 {
+			value.strings = value.args[0].strings
+		}
+	default:
+		// e.g. the list built by a macro, strings of its arguments are the best guess
+		for _, arg := range value.args {
+			value.strings = append(value.strings, arg.strings...)
+		}
+	}
+	if p.onCall != nil {
+		p.onCall(value, line)
+	}
+	return value
+}
+
+// String is for error messages, e.g. cc_library(name = "foo") at line 3
+func (rule *starlarkRule) String() string {
+	return rule.kind + "(name = " + strconv.Quote(rule.name()) + ") at line " + strconv.Itoa(rule.line)
+}
+
+func (rule *starlarkRule) name() string {
+	return rule.kwargs["name"].strings[0]
+}
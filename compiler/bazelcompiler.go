@@ -0,0 +1,123 @@
+package compiler
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/report"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// BazelCompiler pretends to run `bazel build //...`, actions run once their inputs are built, and some of them
+// hit the remote cache, which finish at once and are shown as fresh tasks
+type BazelCompiler struct {
+	workspace *bazelWorkspace
+	bar       progressbar.ProgressBar
+	threads   int
+
+	recorder *report.Recorder
+}
+
+// bounds of the rate of remote cache hits, picked at random for every build
+const (
+	bazelCacheHitMin = 0.2
+	bazelCacheHitMax = 0.8
+)
+
+func NewBazelCompiler(path string, config *util.Config, sourceType SourceType, threads int) (*BazelCompiler, error) {
+	if threads <= 0 {
+		return nil, errors.New("BazelCompiler: threads should be a positive number")
+	}
+	workspace, err := newBazelWorkspace(path, config, sourceType)
+	if err != nil {
+		return nil, err
+	}
+	return &BazelCompiler{
+		workspace: workspace,
+		threads:   threads,
+	}, nil
+}
+
+func (compiler *BazelCompiler) start(action *bazelAction, slot int) {
+	if action.cached {
+		if asFresh, ok := compiler.bar.(progressbar.FreshTaskHandler); ok {
+			asFresh.TaskFresh(action.String())
+		}
+		return
+	}
+	compiler.recorder.Start(action, action.String(), slot)
+	compiler.bar.TaskStart(action.String())
+	ms := max(util.GetRandomFromDistribution(action.ms, action.ms/4), 5)
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	compiler.recorder.Complete(action)
+}
+
+func (compiler *BazelCompiler) finish(action *bazelAction) {
+	if !action.cached {
+		compiler.bar.TaskComplete(action.String())
+	}
+}
+
+func (compiler *BazelCompiler) Run() {
+	compiler.workspace.resetCache(util.GetRandomUniformDistribution(bazelCacheHitMin, bazelCacheHitMax))
+
+	compiler.bar.Prologue()
+
+	compiler.recorder.Begin(compiler.threads)
+	err := compiler.workspace.schedule(func(action *bazelAction) {
+		if !action.cached {
+			compiler.recorder.Ready(action)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = compiler.workspace.run(compiler.threads, compiler.start, compiler.finish)
+	if err != nil {
+		log.Fatal(err)
+	}
+	compiler.recorder.Finish()
+
+	compiler.bar.Epilogue()
+}
+
+func (compiler *BazelCompiler) SetRecorder(recorder *report.Recorder) {
+	compiler.recorder = recorder
+}
+
+func (compiler *BazelCompiler) SetProgressBar(bar progressbar.ProgressBar) {
+	compiler.bar = bar
+
+	var totalTasks []string
+	for _, action := range compiler.workspace.actions {
+		totalTasks = append(totalTasks, action.String())
+	}
+	compiler.bar.SetTotalTasks(totalTasks)
+
+	if asBazel, ok := compiler.bar.(*progressbar.BazelProgressBar); ok {
+		var targets []string
+		for _, target := range compiler.workspace.targets {
+			targets = append(targets, target.String())
+		}
+		asBazel.SetTargets(targets)
+	}
+}
+
+func (compiler *BazelCompiler) DumpConfig(path string, compression util.Compression) error {
+	b, err := compiler.workspace.dumpConfig()
+	if err != nil {
+		return err
+	}
+	return util.DumpConfigFile(path, &util.Config{
+		CompilerType:        "bazel",
+		Compression:         compression,
+		UncompressedContent: b,
+		Metadata: util.ConfigMetadata{
+			Source: compiler.workspace.name,
+			Tasks:  len(compiler.workspace.actions),
+		},
+	})
+}
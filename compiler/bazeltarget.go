@@ -0,0 +1,568 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// bazelTarget is a rule of a BUILD file
+type bazelTarget struct {
+	pkg          string // package path relative to the workspace root, "" for the root package
+	name         string
+	kind         string   // rule kind, e.g. cc_library
+	srcs         []string // source files, relative to the workspace root
+	sizes        []int64
+	dependencies []*bazelTarget
+	requiredBy   []*bazelTarget
+}
+
+// String returns the label of target, e.g. //src/main:app
+func (target *bazelTarget) String() string {
+	return "//" + target.pkg + ":" + target.name
+}
+
+func (target *bazelTarget) dependsOn(dep *bazelTarget) {
+	if dep == target || slices.Contains(target.dependencies, dep) {
+		return
+	}
+	target.dependencies = append(target.dependencies, dep)
+	dep.requiredBy = append(dep.requiredBy, target)
+}
+
+// language returns the rule set of target, e.g. cc for cc_library, kt for kt_jvm_library
+func (target *bazelTarget) language() string {
+	kind := strings.TrimPrefix(target.kind, "native.")
+	if kind == "genrule" {
+		return kind
+	}
+	language, _, _ := strings.Cut(kind, "_")
+	return language
+}
+
+// executable reports whether target is a binary or a test, which are linked
+func (target *bazelTarget) executable() bool {
+	return strings.HasSuffix(target.kind, "_binary") || strings.HasSuffix(target.kind, "_test")
+}
+
+// sources returns the number and total size of srcs ending with one of extensions
+func (target *bazelTarget) sources(extensions ...string) (count int, size int64) {
+	for i, src := range target.srcs {
+		if slices.Contains(extensions, path.Ext(src)) {
+			count++
+			size += target.sizes[i]
+		}
+	}
+	return
+}
+
+// bazelAction is an action spawned by a target, named by its progress message, e.g. Compiling src/foo.cc
+type bazelAction struct {
+	target       *bazelTarget
+	message      string
+	ms           float64 // expected time
+	cached       bool    // a remote cache hit in this build
+	dependencies []*bazelAction
+	requiredBy   []*bazelAction
+}
+
+func (action *bazelAction) String() string {
+	return action.message
+}
+
+func (action *bazelAction) dependsOn(dep *bazelAction) {
+	if slices.Contains(action.dependencies, dep) {
+		return
+	}
+	action.dependencies = append(action.dependencies, dep)
+	dep.requiredBy = append(dep.requiredBy, action)
+}
+
+// bazelWorkspace defines targets of a bazel workspace and the actions to build them
+type bazelWorkspace struct {
+	name        string
+	targets     []*bazelTarget
+	actions     []*bazelAction
+	jobs        *jobQueue[*bazelAction]
+	constructed bool
+}
+
+type configBazelTarget struct {
+	Package      string   `json:"pkg"`
+	Name         string   `json:"name"`
+	Kind         string   `json:"kind"`
+	Srcs         []string `json:"srcs,omitempty"`
+	Sizes        []int64  `json:"sizes,omitempty"`
+	Dependencies []int    `json:"dep"` // index in `Targets` array
+}
+type configBazelWorkspace struct {
+	Name    string              `json:"name"`
+	Targets []configBazelTarget `json:"targets"`
+}
+
+var (
+	bazelCxxExtensions    = []string{".c", ".cc", ".cpp", ".cxx", ".c++", ".C", ".S", ".s"}
+	bazelWorkspaceFiles   = []string{"MODULE.bazel", "WORKSPACE.bazel", "WORKSPACE"}
+	bazelWorkspaceNameRef = regexp.MustCompile(`\b(?:module|workspace)\s*\(\s*name\s*=\s*["']([^"']+)["']`)
+)
+
+func newBazelWorkspace(path string, config *util.Config, sourceType SourceType) (*bazelWorkspace, error) {
+	workspace := &bazelWorkspace{}
+	switch sourceType {
+	case SourceTypeDir:
+		err := workspace.parseDirectory(path)
+		if err != nil {
+			return nil, err
+		}
+	case SourceTypeConfig:
+		err := workspace.parseConfig(config)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("bazelWorkspace: unknown sourceType " + strconv.Itoa(int(sourceType)))
+	}
+	workspace.createActions()
+	if len(workspace.actions) == 0 {
+		return nil, errors.New("no actions to run, only cc, java, kt, go, rust, proto and genrule targets have actions")
+	}
+	workspace.constructed = true
+	return workspace, nil
+}
+
+// parseDirectory reads every BUILD.bazel or BUILD file under root, which must have MODULE.bazel or WORKSPACE
+func (workspace *bazelWorkspace) parseDirectory(root string) error {
+	found := false
+	for _, file := range bazelWorkspaceFiles {
+		b, err := os.ReadFile(filepath.Join(root, file))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		if match := bazelWorkspaceNameRef.FindSubmatch(b); match != nil {
+			workspace.name = string(match[1])
+		}
+		break
+	}
+	if !found {
+		return fmt.Errorf("no MODULE.bazel or WORKSPACE found in %s", root)
+	}
+	if workspace.name == "" {
+		workspace.name = filepath.Base(root)
+		if abs, err := filepath.Abs(root); err == nil {
+			workspace.name = filepath.Base(abs)
+		}
+	}
+
+	// packages are directories with a BUILD file, a file belongs to the closest package above it
+	buildFiles := make(map[string]string)
+	var files []string
+	sizes := make(map[string]int64)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel != "." && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "bazel-")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		dir := path.Dir(rel)
+		if dir == "." {
+			dir = ""
+		}
+		switch d.Name() {
+		case "BUILD.bazel":
+			buildFiles[dir] = p
+		case "BUILD":
+			if _, ok := buildFiles[dir]; !ok {
+				buildFiles[dir] = p
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		sizes[rel] = info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(buildFiles) == 0 {
+		return fmt.Errorf("no BUILD or BUILD.bazel files found in %s", root)
+	}
+	packageFiles := make(map[string][]string) // relative to the package
+	for _, file := range files {
+		for dir := path.Dir(file); ; dir = path.Dir(dir) {
+			if dir == "." {
+				dir = ""
+			}
+			if _, ok := buildFiles[dir]; ok {
+				packageFiles[dir] = append(packageFiles[dir], strings.TrimPrefix(file[len(dir):], "/"))
+				break
+			}
+			if dir == "" {
+				break
+			}
+		}
+	}
+
+	packages := make([]string, 0, len(buildFiles))
+	for pkg := range buildFiles {
+		packages = append(packages, pkg)
+	}
+	slices.Sort(packages)
+	rules := make(map[*bazelTarget]starlarkRule)
+	byLabel := make(map[string]*bazelTarget)
+	for _, pkg := range packages {
+		b, err := os.ReadFile(buildFiles[pkg])
+		if err != nil {
+			return err
+		}
+		glob := func(include, exclude []string) []string {
+			var matched []string
+			for _, file := range packageFiles[pkg] {
+				if slices.ContainsFunc(include, func(pattern string) bool { return util.MatchGlob(pattern, file) }) &&
+					!slices.ContainsFunc(exclude, func(pattern string) bool { return util.MatchGlob(pattern, file) }) {
+					matched = append(matched, file)
+				}
+			}
+			return matched
+		}
+		pkgRules, err := parseBuildFile(string(b), glob)
+		if err != nil {
+			return fmt.Errorf("%s: %w", buildFiles[pkg], err)
+		}
+		for _, rule := range pkgRules {
+			target := &bazelTarget{pkg: pkg, name: rule.name(), kind: rule.kind}
+			if byLabel[target.String()] != nil {
+				return fmt.Errorf("%s: %s: target %s is defined more than once", buildFiles[pkg], rule.String(), target)
+			}
+			byLabel[target.String()] = target
+			rules[target] = rule
+			workspace.targets = append(workspace.targets, target)
+		}
+	}
+
+	for _, target := range workspace.targets {
+		rule := rules[target]
+		for _, src := range rule.kwargs["srcs"].strings {
+			if dep := byLabel[bazelLabel(target.pkg, src)]; dep != nil {
+				target.dependsOn(dep) // generated sources
+				continue
+			}
+			file := path.Join(target.pkg, src)
+			if size, ok := sizes[file]; ok && !strings.HasPrefix(src, "//") && !strings.HasPrefix(src, ":") {
+				target.srcs = append(target.srcs, file)
+				target.sizes = append(target.sizes, size)
+			}
+		}
+		for _, attr := range []string{"deps", "exports", "runtime_deps", "implementation_deps"} {
+			for _, label := range rule.kwargs[attr].strings {
+				if dep := byLabel[bazelLabel(target.pkg, label)]; dep != nil {
+					target.dependsOn(dep)
+				}
+			}
+		}
+	}
+	breakCycles(workspace.targets, func(target *bazelTarget) (*[]*bazelTarget, *[]*bazelTarget) {
+		return &target.dependencies, &target.requiredBy
+	})
+	return nil
+}
+
+// bazelLabel returns the canonical form of label referred from package pkg, e.g. :foo -> //pkg:foo,
+// or "" if it is in an external repository
+func bazelLabel(pkg, label string) string {
+	label = strings.TrimPrefix(strings.TrimPrefix(label, "@@"), "@")
+	switch {
+	case strings.HasPrefix(label, "//"):
+		p, name, found := strings.Cut(label[2:], ":")
+		if !found {
+			name = path.Base("/" + p)
+		}
+		return "//" + p + ":" + name
+	case strings.HasPrefix(label, ":"):
+		return "//" + pkg + label
+	case strings.Contains(label, "//"):
+		return "" // @repo//pkg:name
+	default:
+		return "//" + pkg + ":" + label
+	}
+}
+
+// createActions creates the action graph of targets: a compiling action waits for outputs of the targets it depends on,
+// except that c++ sources only need headers, it is the linking of executables that waits for all c++ libraries below
+func (workspace *bazelWorkspace) createActions() {
+	workspace.actions = nil
+	first := make(map[*bazelTarget][]*bazelAction)
+	output := make(map[*bazelTarget]*bazelAction)
+
+	add := func(target *bazelTarget, message string, ms float64, dependencies ...*bazelAction) *bazelAction {
+		action := &bazelAction{target: target, message: message, ms: ms}
+		for _, dep := range dependencies {
+			action.dependsOn(dep)
+		}
+		workspace.actions = append(workspace.actions, action)
+		if len(dependencies) == 0 {
+			first[target] = append(first[target], action)
+		}
+		output[target] = action
+		return action
+	}
+	plural := func(n int, word string) string {
+		if n == 1 {
+			return "1 " + word
+		}
+		return strconv.Itoa(n) + " " + word + "s"
+	}
+
+	for _, t := range workspace.targets {
+		base := path.Join(t.pkg, t.name)
+		lib := path.Join(t.pkg, "lib"+t.name)
+		switch t.language() {
+		case "cc":
+			var objects []*bazelAction
+			for i, src := range t.srcs {
+				if slices.Contains(bazelCxxExtensions, path.Ext(src)) {
+					objects = append(objects, add(t, "Compiling "+src, 42*4.2+float64(t.sizes[i])/10))
+				}
+			}
+			switch {
+			case t.executable():
+				add(t, "Linking "+base, 300+20*float64(len(objects)), objects...)
+			case len(objects) > 0:
+				add(t, "Linking "+lib+".a", 80+10*float64(len(objects)), objects...)
+			}
+		case "java":
+			n, size := t.sources(".java")
+			jar := lib + ".jar"
+			if t.executable() {
+				jar = base + ".jar"
+			}
+			add(t, fmt.Sprintf("Building %s (%s)", jar, plural(n, "source file")), 500+float64(size)/100)
+		case "kt":
+			kt, size := t.sources(".kt")
+			java, javaSize := t.sources(".java")
+			add(t, fmt.Sprintf("Compiling Kotlin to JVM %s { kt: %d, java: %d, srcjars: 0 } for k8-fastbuild", t, kt, java), 1500+float64(size)/40+float64(javaSize)/100)
+		case "go":
+			_, size := t.sources(".go")
+			compile := add(t, "GoCompilePkg "+base+".a", 200+float64(size)/50)
+			if t.executable() {
+				add(t, "GoLink "+path.Join(t.pkg, t.name+"_", t.name), 400, compile)
+			}
+		case "rust":
+			n, size := t.sources(".rs")
+			crate := "rlib"
+			if t.executable() {
+				crate = "bin"
+			}
+			add(t, fmt.Sprintf("Compiling Rust %s %s (%s)", crate, t.name, plural(n, "file")), 500+float64(size)/20)
+		case "proto":
+			_, size := t.sources(".proto")
+			add(t, "Generating Descriptor Set proto_library "+t.String(), 100+float64(size)/100)
+		case "genrule":
+			add(t, "Executing genrule "+t.String(), 300)
+		}
+	}
+
+	// dependencies without actions, e.g. filegroup or py_library, pass their dependencies through
+	var effective func(target *bazelTarget, visited map[*bazelTarget]bool) []*bazelTarget
+	effective = func(target *bazelTarget, visited map[*bazelTarget]bool) []*bazelTarget {
+		var deps []*bazelTarget
+		for _, dep := range target.dependencies {
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+			if output[dep] != nil {
+				deps = append(deps, dep)
+			} else {
+				deps = append(deps, effective(dep, visited)...)
+			}
+		}
+		return deps
+	}
+	for _, t := range workspace.targets {
+		if output[t] == nil {
+			continue
+		}
+		visited := make(map[*bazelTarget]bool)
+		var walk func(target *bazelTarget, transitive bool)
+		walk = func(target *bazelTarget, transitive bool) {
+			for _, dep := range effective(target, visited) {
+				switch {
+				case t.language() == "cc" && dep.language() == "cc":
+					if t.executable() {
+						output[t].dependsOn(output[dep])
+						walk(dep, true)
+					}
+				case !transitive:
+					for _, action := range first[t] {
+						action.dependsOn(output[dep])
+					}
+				}
+			}
+		}
+		walk(t, false)
+	}
+}
+
+// resetCache picks the actions that hit the remote cache in the next build, by rate
+func (workspace *bazelWorkspace) resetCache(rate float64) {
+	for _, action := range workspace.actions {
+		action.cached = rand.Float64() < rate
+	}
+}
+
+func (workspace *bazelWorkspace) parseConfig(config *util.Config) error {
+	w := configBazelWorkspace{}
+	err := config.Decode(&w)
+	if err != nil {
+		return err
+	}
+	err = w.validate()
+	if err != nil {
+		return err
+	}
+
+	workspace.name = w.Name
+	for _, cTarget := range w.Targets {
+		workspace.targets = append(workspace.targets, &bazelTarget{
+			pkg:   cTarget.Package,
+			name:  cTarget.Name,
+			kind:  cTarget.Kind,
+			srcs:  cTarget.Srcs,
+			sizes: cTarget.Sizes,
+		})
+	}
+	for i, target := range workspace.targets {
+		for _, dep := range w.Targets[i].Dependencies {
+			target.dependsOn(workspace.targets[dep])
+		}
+	}
+	return nil
+}
+
+// validate checks that labels are unique, sources have sizes, every index is in range and the dependency graph is acyclic
+func (w *configBazelWorkspace) validate() error {
+	if len(w.Targets) == 0 {
+		return errors.New("malformed config: no targets")
+	}
+	labels := make(map[string]int)
+	label := func(idx int) string {
+		return "//" + w.Targets[idx].Package + ":" + w.Targets[idx].Name
+	}
+	for i, target := range w.Targets {
+		switch {
+		case target.Name == "":
+			return fmt.Errorf("malformed config: target %d has no name", i)
+		case target.Kind == "":
+			return fmt.Errorf("malformed config: target %s has no kind", label(i))
+		case len(target.Srcs) != len(target.Sizes):
+			return fmt.Errorf("malformed config: target %s has %d srcs but %d sizes", label(i), len(target.Srcs), len(target.Sizes))
+		case slices.ContainsFunc(target.Sizes, func(size int64) bool { return size < 0 }):
+			return fmt.Errorf("malformed config: target %s has a source of negative size", label(i))
+		}
+		if j, ok := labels[label(i)]; ok {
+			return fmt.Errorf("malformed config: targets %d and %d have the same label %s", j, i, label(i))
+		}
+		labels[label(i)] = i
+		seen := make(map[int]bool)
+		for _, dep := range target.Dependencies {
+			switch {
+			case dep < 0 || dep >= len(w.Targets):
+				return fmt.Errorf("malformed config: target %s depends on target %d, out of range [0, %d)", label(i), dep, len(w.Targets))
+			case dep == i:
+				return fmt.Errorf("malformed config: target %s depends on itself", label(i))
+			case seen[dep]:
+				return fmt.Errorf("malformed config: target %s depends on %s more than once", label(i), label(dep))
+			}
+			seen[dep] = true
+		}
+	}
+	if cycle := findCycle(len(w.Targets), func(i int) []int { return w.Targets[i].Dependencies }); cycle != nil {
+		labels := make([]string, 0, len(cycle))
+		for _, idx := range cycle {
+			labels = append(labels, label(idx))
+		}
+		return fmt.Errorf("malformed config: dependency cycle: %s", strings.Join(labels, " -> "))
+	}
+	return nil
+}
+
+func (workspace *bazelWorkspace) dumpConfig() ([]byte, error) {
+	if !workspace.constructed {
+		return nil, errNotConstructed
+	}
+
+	// {ptr: index} mapping
+	mapping := make(map[*bazelTarget]int)
+	for i, target := range workspace.targets {
+		mapping[target] = i
+	}
+	w := configBazelWorkspace{Name: workspace.name}
+	for _, target := range workspace.targets {
+		cTarget := configBazelTarget{
+			Package: target.pkg,
+			Name:    target.name,
+			Kind:    target.kind,
+			Srcs:    target.srcs,
+			Sizes:   target.sizes,
+		}
+		for _, dep := range target.dependencies {
+			cTarget.Dependencies = append(cTarget.Dependencies, mapping[dep])
+		}
+		w.Targets = append(w.Targets, cTarget)
+	}
+	return json.Marshal(w)
+}
+
+// schedule starts a new round of build, onReady is invoked when an action becomes ready to run
+func (workspace *bazelWorkspace) schedule(onReady func(action *bazelAction)) error {
+	if !workspace.constructed {
+		return errNotConstructed
+	}
+	workspace.jobs = newJobQueue(workspace.actions,
+		func(action *bazelAction) []*bazelAction {
+			return action.dependencies
+		},
+		func(action *bazelAction) []*bazelAction {
+			return action.requiredBy
+		}, onReady)
+	return nil
+}
+
+// run executes actions on threads workers once all of their inputs are built,
+// the one heading the longest remaining chain first, see jobQueue.run
+func (workspace *bazelWorkspace) run(threads int, start func(action *bazelAction, slot int), finish func(action *bazelAction)) error {
+	if workspace.jobs == nil {
+		return errNotConstructed
+	}
+	return workspace.jobs.run(threads, start, finish)
+}
@@ -0,0 +1,161 @@
+package compiler
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/report"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// BundleCompiler pretends to run a bundler like webpack or vite over modules under src/ of a frontend project,
+// modules are transformed one by one as they are discovered, then emitted as chunks by the progress bar
+type BundleCompiler struct {
+	project   *bundleProject
+	taskIssue chan *bundleModule
+	commit    chan *bundleModule
+	wg        *sync.WaitGroup
+	bar       progressbar.ProgressBar
+	threads   int
+
+	recorder *report.Recorder
+}
+
+// expected values of the random distributions used by transform, in milliseconds, see also Estimate
+const (
+	bundleTransformMs = 20 // parse and transform a module
+	bundleBytesPerMs  = 60
+)
+
+// options: how the directory is traversed, only used by SourceTypeDir
+func NewBundleCompiler(path string, config *util.Config, sourceType SourceType, threads int, options util.TraverseOptions) (*BundleCompiler, error) {
+	if threads <= 0 {
+		return nil, errors.New("BundleCompiler: threads should be a positive number")
+	}
+	project, err := newBundleProject(path, config, sourceType, options)
+	if err != nil {
+		return nil, err
+	}
+	return &BundleCompiler{
+		project:   project,
+		taskIssue: make(chan *bundleModule),
+		commit:    make(chan *bundleModule),
+		wg:        new(sync.WaitGroup),
+		threads:   threads,
+	}, nil
+}
+
+func (compiler *BundleCompiler) handleCommit() {
+	for {
+		module, ok := <-compiler.commit
+		if !ok {
+			break
+		}
+		compiler.bar.TaskComplete(module.String())
+		compiler.wg.Done()
+	}
+}
+
+func (compiler *BundleCompiler) workerRun(slot int) {
+	for {
+		module, ok := <-compiler.taskIssue
+		if !ok {
+			break
+		}
+		compiler.recorder.Start(module, module.String(), slot)
+		compiler.bar.TaskStart(module.String())
+		compiler.transform(module)
+		compiler.recorder.Complete(module)
+		compiler.commit <- module
+	}
+}
+
+func (compiler *BundleCompiler) transform(module *bundleModule) {
+	mean := bundleTransformMs + float64(module.Size)/bundleBytesPerMs
+	ms := max(util.GetRandomFromDistribution(mean, 8), 5)
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+}
+
+func (compiler *BundleCompiler) Run() {
+	for i := range compiler.threads {
+		go compiler.workerRun(i)
+	}
+	go compiler.handleCommit()
+
+	compiler.bar.Prologue()
+	compiler.recorder.Begin(compiler.threads)
+
+	for {
+		module, err := compiler.project.next()
+		if err != nil {
+			if !errors.Is(err, errEOF) {
+				log.Fatal(err)
+			}
+			break
+		}
+		compiler.wg.Add(1)
+		compiler.taskIssue <- module
+		time.Sleep(time.Millisecond)
+	}
+
+	compiler.wg.Wait()
+	compiler.recorder.Finish()
+	close(compiler.taskIssue)
+	close(compiler.commit)
+
+	compiler.bar.Epilogue()
+}
+
+func (compiler *BundleCompiler) SetProgressBar(bar progressbar.ProgressBar) {
+	compiler.bar = bar
+	compiler.setTotalTasks()
+
+	// every module ends up in the emitted assets, including those that are not rebuilt
+	if asBundle, ok := compiler.bar.(progressbar.BundleBar); ok {
+		var modules []progressbar.Module
+		for _, module := range compiler.project.modules {
+			modules = append(modules, progressbar.Module{Path: module.String(), Size: module.Size})
+		}
+		asBundle.SetModules(modules)
+	}
+}
+
+func (compiler *BundleCompiler) setTotalTasks() {
+	var totalTasks []string
+	for _, module := range compiler.project.build {
+		totalTasks = append(totalTasks, module.String())
+	}
+	compiler.bar.SetTotalTasks(totalTasks)
+}
+
+// SetChangedFiles only transforms modules that are listed in files, the others are taken from the cache
+func (compiler *BundleCompiler) SetChangedFiles(files []string) error {
+	compiler.project.retain(files)
+	if compiler.bar != nil {
+		compiler.setTotalTasks()
+	}
+	return nil
+}
+
+func (compiler *BundleCompiler) SetRecorder(recorder *report.Recorder) {
+	compiler.recorder = recorder
+}
+
+func (compiler *BundleCompiler) DumpConfig(path string, compression util.Compression) error {
+	b, err := compiler.project.dumpConfig()
+	if err != nil {
+		return err
+	}
+	return util.DumpConfigFile(path, &util.Config{
+		CompilerType:        "bundle",
+		Compression:         compression,
+		UncompressedContent: b,
+		Metadata: util.ConfigMetadata{
+			Source: compiler.project.name,
+			Tasks:  len(compiler.project.modules),
+		},
+	})
+}
@@ -0,0 +1,195 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// bundleModule is a source module of a frontend project, Path is relative to the project root, e.g. src/components
+type bundleModule struct {
+	Path string
+	Name string
+	Size int64
+}
+
+func (module *bundleModule) String() string {
+	return module.Path + "/" + module.Name
+}
+
+// bundleProject stores modules under src/ of a frontend project, in the order a bundler discovers them from the entry
+type bundleProject struct {
+	name        string
+	modules     []*bundleModule
+	build       []*bundleModule // modules to build, all of them unless retained
+	cursor      int
+	constructed bool
+}
+
+// content of bundle config, modules are stored in a file table like cxx config
+//
+//	{"name": "app", "dirs": ["src", "src/components", ...], "files": {"dir": [0, 1, ...], "name": ["main.ts", ...], "size": [512, ...]}}
+type configBundleProject struct {
+	Name  string     `json:"name"`
+	Dirs  []string   `json:"dirs"`
+	Files *fileTable `json:"files"`
+}
+
+// bundleSourceFilter matches modules of a bundle
+const bundleSourceFilter = "^.*\\.(ts|tsx|js|jsx|vue)$"
+
+func newBundleProject(path string, config *util.Config, sourceType SourceType, options util.TraverseOptions) (*bundleProject, error) {
+	project := new(bundleProject)
+	switch sourceType {
+	case SourceTypeDir:
+		err := project.parseDirectory(path, options)
+		if err != nil {
+			return nil, err
+		}
+	case SourceTypeConfig:
+		err := project.parseConfig(config)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("bundleProject: unknown sourceType " + strconv.Itoa(int(sourceType)))
+	}
+	return project, nil
+}
+
+func (project *bundleProject) parseDirectory(path string, options util.TraverseOptions) error {
+	info, err := os.Stat(path + "src")
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("no src/ directory found in %s", path)
+	}
+	srcDir, err := util.NewDirectory(path+"src", bundleSourceFilter, true)
+	if err != nil {
+		return err
+	}
+	err = srcDir.SetOptions(options)
+	if err != nil {
+		return err
+	}
+	errs, err := srcDir.Traverse()
+	if err != nil {
+		return err
+	}
+	// unreadable paths are skipped, but never silently
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "warning: skipped %s\n", e)
+	}
+
+	project.name = packageName(path)
+
+	// breadth first, modules close to the entry are discovered first
+	queue := []*util.Directory{srcDir}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		rel, _ := strings.CutPrefix(d.Path, path)
+		for _, file := range d.Files {
+			project.modules = append(project.modules, &bundleModule{Path: rel, Name: file.Name, Size: file.Size})
+		}
+		queue = append(queue, d.SubDirs...)
+	}
+	if len(project.modules) == 0 {
+		return fmt.Errorf("no .ts, .tsx, .js, .jsx or .vue modules found in %ssrc", path)
+	}
+	project.build = project.modules
+	project.constructed = true
+	return nil
+}
+
+func (project *bundleProject) parseConfig(config *util.Config) error {
+	if config == nil {
+		return errors.New("bundleProject: config is nil")
+	}
+	p := configBundleProject{}
+	err := config.Decode(&p)
+	if err != nil {
+		return err
+	}
+	err = p.validate()
+	if err != nil {
+		return err
+	}
+
+	project.name = p.Name
+	for i, dir := range p.Files.Dir {
+		project.modules = append(project.modules, &bundleModule{Path: p.Dirs[dir], Name: p.Files.Name[i], Size: p.Files.Size[i]})
+	}
+	project.build = project.modules
+	project.constructed = true
+	return nil
+}
+
+// validate checks that the file table is consistent, and every module has a name and a valid size, and appears only once
+func (p *configBundleProject) validate() error {
+	if p.Name == "" {
+		return errors.New("malformed config: empty project name")
+	}
+	if p.Files == nil || len(p.Files.Dir) == 0 {
+		return errors.New("malformed config: no modules")
+	}
+	err := p.Files.validate(p.Dirs)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for i, dir := range p.Files.Dir {
+		name := util.CleanRelativePath(p.Dirs[dir] + "/" + p.Files.Name[i])
+		switch {
+		case p.Files.Name[i] == "":
+			return fmt.Errorf("malformed config: module %d has no name", i)
+		case p.Files.Size[i] < 0:
+			return fmt.Errorf("malformed config: module %d (%s) has negative size %d", i, name, p.Files.Size[i])
+		case seen[name]:
+			return fmt.Errorf("malformed config: module %d (%s) is listed more than once", i, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+func (project *bundleProject) dumpConfig() ([]byte, error) {
+	if !project.constructed {
+		return nil, errNotConstructed
+	}
+	p := configBundleProject{
+		Name:  project.name,
+		Files: new(fileTable),
+	}
+	dirs := make(map[string]int)
+	for _, module := range project.modules {
+		p.Dirs = p.Files.add(p.Dirs, dirs, module.Path, module.Name, module.Size)
+	}
+	return json.Marshal(p)
+}
+
+func (project *bundleProject) next() (*bundleModule, error) {
+	if !project.constructed {
+		return nil, errNotConstructed
+	}
+	if project.cursor == len(project.build) {
+		return nil, errEOF
+	}
+	project.cursor++
+	return project.build[project.cursor-1], nil
+}
+
+// retain only builds modules that are listed in files, the others are taken from the cache
+func (project *bundleProject) retain(files []string) {
+	changed := make(map[string]bool)
+	for _, f := range files {
+		changed[f] = true
+	}
+	project.build = slices.DeleteFunc(slices.Clone(project.modules), func(module *bundleModule) bool {
+		return !changed[util.CleanRelativePath(module.String())]
+	})
+}
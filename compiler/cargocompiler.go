@@ -2,22 +2,28 @@ package compiler
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"math"
-	"sync"
+	"os"
+	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/report"
 	"github.com/rizutazu/fake-compiler/util"
 )
 
 type CargoCompiler struct {
 	// compiler function
-	project   *cargoProject
-	taskIssue chan *cargoPackage
-	commit    chan *cargoPackage
-	wg        *sync.WaitGroup
-	bar       progressbar.ProgressBar
-	threads   int
+	project *cargoProject
+	bar     progressbar.ProgressBar
+	threads int
+
+	// timing report
+	recorder    *report.Recorder
+	timingsPath string // --timings
 
 	// rng related
 
@@ -33,41 +39,36 @@ type CargoCompiler struct {
 }
 
 func NewCargoCompiler(path string, config *util.Config, sourceType SourceType, threads int) (*CargoCompiler, error) {
+	if threads <= 0 {
+		return nil, errors.New("CargoCompiler: threads should be a positive number")
+	}
 	project, err := newCargoProject(path, config, sourceType)
 	if err != nil {
 		return nil, err
 	}
 
 	return &CargoCompiler{
-		project:   project,
-		taskIssue: make(chan *cargoPackage),
-		commit:    make(chan *cargoPackage),
-		wg:        new(sync.WaitGroup),
-		threads:   threads,
+		project: project,
+		threads: threads,
 	}, nil
 }
 
-func (compiler *CargoCompiler) handleCommit() {
-	for {
-		pack, ok := <-compiler.commit
-		if !ok {
-			break
+func (compiler *CargoCompiler) start(pack *cargoPackage, slot int) {
+	if pack.fresh {
+		if asFresh, ok := compiler.bar.(progressbar.FreshTaskHandler); ok {
+			asFresh.TaskFresh(pack.String())
 		}
-		compiler.project.commit(pack)
-		compiler.bar.TaskComplete(pack.String())
-		compiler.wg.Done()
+		return
 	}
+	compiler.recorder.Start(pack, pack.String(), slot)
+	compiler.bar.TaskStart(pack.String())
+	compiler.compile(pack)
+	compiler.recorder.Complete(pack)
 }
 
-func (compiler *CargoCompiler) workerRun() {
-	for {
-		pack, ok := <-compiler.taskIssue
-		if !ok {
-			break
-		}
-		compiler.bar.TaskStart(pack.String())
-		compiler.compile(pack)
-		compiler.commit <- pack
+func (compiler *CargoCompiler) finish(pack *cargoPackage) {
+	if !pack.fresh {
+		compiler.bar.TaskComplete(pack.String())
 	}
 }
 
@@ -85,7 +86,7 @@ func (compiler *CargoCompiler) compile(pack *cargoPackage) {
 	oReq := compiler.hReq * math.Pow(math.E, -compiler.aReq*math.Pow(float64(len(pack.requiredBy))-compiler.r, 2)/math.Pow(compiler.r, 2))
 
 	// overhead by complete package num
-	c := float64(compiler.project.complete)
+	c := float64(compiler.project.complete())
 	t := float64(len(compiler.project.packages))
 	oNum := compiler.hNum * math.Pow(math.E, -compiler.aNum*math.Pow(c-t, 2)/math.Pow(t, 2))
 	timeMs *= oDep * oNum * oReq
@@ -136,33 +137,88 @@ func (compiler *CargoCompiler) Run() {
 
 	compiler.initRNGParameters()
 
-	for range compiler.threads {
-		go compiler.workerRun()
+	compiler.bar.Prologue()
+
+	compiler.recorder.Begin(compiler.threads)
+	err := compiler.project.schedule(func(pack *cargoPackage) {
+		compiler.recorder.Ready(pack)
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
-	go compiler.handleCommit()
 
-	compiler.bar.Prologue()
+	err = compiler.project.run(compiler.threads, compiler.start, compiler.finish)
+	if err != nil {
+		log.Fatal(err)
+	}
+	compiler.recorder.Finish()
 
-	for {
-		packs, err := compiler.project.next()
-		if errors.Is(err, errEOF) {
-			break
-		}
-		for _, pack := range packs {
-			compiler.wg.Add(1)
-			compiler.taskIssue <- pack
-			t := util.GetRandomFromDistribution(42, 10)
-			t = max(t, 20)
-			time.Sleep(time.Millisecond * time.Duration(t))
+	compiler.bar.Epilogue()
+
+	if compiler.timingsPath != "" {
+		err := compiler.writeTimings()
+		if err != nil {
+			log.Fatal(err)
 		}
 	}
+}
 
-	compiler.wg.Wait()
+// SetChangedFiles only recompiles workspace members touched by files and packages that depend on them,
+// the others are fresh
+func (compiler *CargoCompiler) SetChangedFiles(files []string) error {
+	compiler.project.markFresh(files)
+	return nil
+}
 
-	close(compiler.taskIssue)
-	close(compiler.commit)
+func (compiler *CargoCompiler) SetRecorder(recorder *report.Recorder) {
+	compiler.recorder = recorder
+}
 
-	compiler.bar.Epilogue()
+// SetTimings makes the compiler write a cargo-timing.html style report to path after the build
+func (compiler *CargoCompiler) SetTimings(path string) {
+	compiler.timingsPath = path
+	if compiler.recorder == nil {
+		compiler.recorder = report.NewRecorder()
+	}
+}
+
+func (compiler *CargoCompiler) writeTimings() error {
+	f, err := os.Create(compiler.timingsPath)
+	if err != nil {
+		return err
+	}
+
+	var targets []string
+	for pack := range compiler.project.targetPackages {
+		targets = append(targets, pack.String())
+	}
+	slices.Sort(targets)
+	fresh := 0
+	for _, pack := range compiler.project.packages {
+		if pack.fresh {
+			fresh++
+		}
+	}
+	err = report.WriteCargoTimings(f, compiler.recorder, report.CargoTimingInfo{
+		Targets:    targets,
+		FreshUnits: fresh,
+		Rustc:      "rustc 1.86.0 (05f9846f8 2025-03-31)",
+	})
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	path, err := filepath.Abs(compiler.timingsPath)
+	if err != nil {
+		path = compiler.timingsPath
+	}
+	fmt.Printf("\u001B[2K\u001B[1;36m      Timing\u001B[0m report saved to %s\n", path)
+	return nil
 }
 
 func (compiler *CargoCompiler) SetProgressBar(bar progressbar.ProgressBar) {
@@ -186,12 +242,20 @@ func (compiler *CargoCompiler) SetProgressBar(bar progressbar.ProgressBar) {
 
 }
 
-func (compiler *CargoCompiler) DumpConfig(path string) error {
+func (compiler *CargoCompiler) DumpConfig(path string, compression util.Compression) error {
 	b, err := compiler.project.dumpConfig()
 	if err != nil {
 		return err
 	}
-	err = util.DumpConfigFile(path, []byte("cargo"), b)
+	err = util.DumpConfigFile(path, &util.Config{
+		CompilerType:        "cargo",
+		Compression:         compression,
+		UncompressedContent: b,
+		Metadata: util.ConfigMetadata{
+			Source: compiler.project.name(),
+			Tasks:  len(compiler.project.packages),
+		},
+	})
 	if err != nil {
 		return err
 	}
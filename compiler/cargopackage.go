@@ -6,10 +6,10 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/BurntSushi/toml"
 	"github.com/rizutazu/fake-compiler/util"
@@ -23,6 +23,7 @@ type cargoPackage struct {
 	numDependencies    int
 	dependencies       []*cargoPackage
 	requiredBy         []*cargoPackage
+	fresh              bool // up-to-date, no need to recompile
 }
 
 func (pack *cargoPackage) String() string {
@@ -40,7 +41,6 @@ func (pack *cargoPackage) String() string {
 func newCargoProject(path string, config *util.Config, sourceType SourceType) (*cargoProject, error) {
 	project := new(cargoProject)
 	project.targetPackages = make(map[*cargoPackage]string)
-	project.lock = new(sync.Mutex)
 	switch sourceType {
 	case SourceTypeDir:
 		err := project.parseDirectory(path)
@@ -62,10 +62,8 @@ func newCargoProject(path string, config *util.Config, sourceType SourceType) (*
 type cargoProject struct {
 	packages       []*cargoPackage          // all cargo packages, include targets and dependencies (from Cargo.lock)
 	targetPackages map[*cargoPackage]string // packages that are compiling targets, either root package or workspace members
-	queue          []*cargoPackage          // packages that can be started to compile immediately (dependency satisfied)
-	lock           *sync.Mutex              // lock that protects complete
-	constructed    bool                     // whether first batch of packages is already placed in queue
-	complete       int                      // commited package count
+	jobs           *jobQueue[*cargoPackage] // packages that can be started to compile immediately (dependency satisfied)
+	constructed    bool                     // whether the dependency graph is constructed
 }
 
 type configCargoPackage struct {
@@ -308,13 +306,6 @@ func (project *cargoProject) parseDirectory(path string) error {
 		project.packages[i], project.packages[j] = project.packages[j], project.packages[i]
 	})
 
-	for _, parsedPack := range project.packages {
-		// packages without dependencies are append to queue
-		if parsedPack.numDependencies == 0 {
-			project.queue = append(project.queue, parsedPack)
-		}
-	}
-
 	project.constructed = true
 
 	return nil
@@ -322,7 +313,11 @@ func (project *cargoProject) parseDirectory(path string) error {
 
 func (project *cargoProject) parseConfig(config *util.Config) error {
 	p := configCargoProject{}
-	err := json.Unmarshal(config.UncompressedContent, &p)
+	err := config.Decode(&p)
+	if err != nil {
+		return err
+	}
+	err = p.validate()
 	if err != nil {
 		return err
 	}
@@ -338,13 +333,9 @@ func (project *cargoProject) parseConfig(config *util.Config) error {
 			requiredBy:         nil,
 		}
 		project.packages = append(project.packages, &parsedPack)
-		if len(cPack.Dependencies) == 0 {
-			project.queue = append(project.queue, &parsedPack)
-		}
 	}
 
 	// restore dependency graph
-	// we assume the config is not malformed
 	for i, parsedPack := range project.packages {
 		for _, dep := range p.Packages[i].Dependencies {
 			parsedPack.dependencies = append(parsedPack.dependencies, project.packages[dep])
@@ -368,6 +359,83 @@ func (project *cargoProject) parseConfig(config *util.Config) error {
 	return nil
 }
 
+// validate checks that every index is in range and the dependency graph is consistent and acyclic,
+// so that a hand-edited or corrupted config never makes parseConfig panic or the compilation deadlock
+func (p *configCargoProject) validate() error {
+	if len(p.Packages) == 0 {
+		return errors.New("malformed config: no packages")
+	}
+	inRange := func(idx int) bool {
+		return idx >= 0 && idx < len(p.Packages)
+	}
+	describe := func(idx int) string {
+		pack := p.Packages[idx]
+		return fmt.Sprintf("package %d (%s v%s)", idx, pack.Name, pack.Version)
+	}
+
+	for i, pack := range p.Packages {
+		if pack.Name == "" {
+			return fmt.Errorf("malformed config: package %d has no name", i)
+		}
+		seen := make(map[int]bool)
+		for _, dep := range pack.Dependencies {
+			switch {
+			case !inRange(dep):
+				return fmt.Errorf("malformed config: %s depends on package %d, out of range [0, %d)", describe(i), dep, len(p.Packages))
+			case dep == i:
+				return fmt.Errorf("malformed config: %s depends on itself", describe(i))
+			case seen[dep]:
+				return fmt.Errorf("malformed config: %s depends on %s more than once", describe(i), describe(dep))
+			case !slices.Contains(p.Packages[dep].RequiredBy, i):
+				return fmt.Errorf("malformed config: %s depends on %s, but it is not in its \"req\"", describe(i), describe(dep))
+			}
+			seen[dep] = true
+		}
+		clear(seen)
+		for _, req := range pack.RequiredBy {
+			switch {
+			case !inRange(req):
+				return fmt.Errorf("malformed config: %s is required by package %d, out of range [0, %d)", describe(i), req, len(p.Packages))
+			case req == i:
+				return fmt.Errorf("malformed config: %s is required by itself", describe(i))
+			case seen[req]:
+				return fmt.Errorf("malformed config: %s is required by %s more than once", describe(i), describe(req))
+			case !slices.Contains(p.Packages[req].Dependencies, i):
+				return fmt.Errorf("malformed config: %s is required by %s, but it is not in its \"dep\"", describe(i), describe(req))
+			}
+			seen[req] = true
+		}
+	}
+
+	if len(p.TargetPackages) == 0 {
+		return errors.New("malformed config: no target packages")
+	}
+	if len(p.Paths) != len(p.TargetPackages) {
+		return fmt.Errorf("malformed config: %d target packages but %d paths", len(p.TargetPackages), len(p.Paths))
+	}
+	targets := make(map[int]bool)
+	for i, idx := range p.TargetPackages {
+		switch {
+		case !inRange(idx):
+			return fmt.Errorf("malformed config: target package %d out of range [0, %d)", idx, len(p.Packages))
+		case targets[idx]:
+			return fmt.Errorf("malformed config: %s is listed as target more than once", describe(idx))
+		case p.Paths[i] == "":
+			return fmt.Errorf("malformed config: target %s has empty path", describe(idx))
+		}
+		targets[idx] = true
+	}
+
+	if cycle := findCycle(len(p.Packages), func(i int) []int { return p.Packages[i].Dependencies }); cycle != nil {
+		names := make([]string, 0, len(cycle))
+		for _, idx := range cycle {
+			names = append(names, p.Packages[idx].Name+" v"+p.Packages[idx].Version)
+		}
+		return fmt.Errorf("malformed config: dependency cycle: %s", strings.Join(names, " -> "))
+	}
+	return nil
+}
+
 func (project *cargoProject) dumpConfig() ([]byte, error) {
 	if !project.constructed {
 		return nil, errNotConstructed
@@ -410,38 +478,94 @@ func (project *cargoProject) dumpConfig() ([]byte, error) {
 	return b, nil
 }
 
-// get batch of packages that can be started to compile immediately
-func (project *cargoProject) next() (p []*cargoPackage, err error) {
+// root returns the common directory of all target packages, i.e. the workspace root
+func (project *cargoProject) root() string {
+	var root string
+	first := true
+	for _, path := range project.targetPackages {
+		path = filepath.ToSlash(filepath.Clean(path))
+		if first {
+			root = path
+			first = false
+			continue
+		}
+		for !util.IsPathWithin(path, root) && root != "/" && root != "." {
+			root = filepath.ToSlash(filepath.Dir(root))
+		}
+	}
+	return root
+}
+
+// name returns the directory name of the workspace root
+func (project *cargoProject) name() string {
+	return filepath.Base(project.root())
+}
+
+// markFresh marks every package as fresh, except workspace members touched by files and their reverse-dependency closure,
+// files are slash-separated paths relative to the workspace root
+func (project *cargoProject) markFresh(files []string) {
+	root := project.root()
+	members := make(map[*cargoPackage]string)
+	for pack, path := range project.targetPackages {
+		rel, _ := strings.CutPrefix(filepath.ToSlash(filepath.Clean(path)), root)
+		members[pack] = util.CleanRelativePath(rel)
+	}
+
+	// every file belongs to the member with the longest matching directory
+	var dirty []*cargoPackage
+	for _, f := range files {
+		var owner *cargoPackage
+		for pack, dir := range members {
+			if util.IsPathWithin(f, dir) && (owner == nil || len(dir) > len(members[owner])) {
+				owner = pack
+			}
+		}
+		if owner != nil {
+			dirty = append(dirty, owner)
+		}
+	}
+
+	for _, pack := range project.packages {
+		pack.fresh = true
+	}
+	for len(dirty) > 0 {
+		pack := dirty[len(dirty)-1]
+		dirty = dirty[:len(dirty)-1]
+		if !pack.fresh {
+			continue
+		}
+		pack.fresh = false
+		dirty = append(dirty, pack.requiredBy...)
+	}
+}
+
+// schedule starts a new round of compilation, onReady is invoked when a package becomes ready to compile
+func (project *cargoProject) schedule(onReady func(pack *cargoPackage)) error {
 	if !project.constructed {
-		return nil, errNotConstructed
+		return errNotConstructed
 	}
-	project.lock.Lock()
-	if project.complete == len(project.packages) {
-		project.lock.Unlock()
-		return nil, errEOF
+	project.jobs = newJobQueue(project.packages,
+		func(pack *cargoPackage) []*cargoPackage {
+			return pack.dependencies
+		},
+		func(pack *cargoPackage) []*cargoPackage {
+			return pack.requiredBy
+		}, onReady)
+	return nil
+}
+
+// run compiles packages on threads workers, the one on the longest remaining dependency chain first, see jobQueue.run
+func (project *cargoProject) run(threads int, start func(pack *cargoPackage, slot int), finish func(pack *cargoPackage)) error {
+	if project.jobs == nil {
+		return errNotConstructed
 	}
-	p = project.queue
-	rand.Shuffle(len(p), func(i, j int) {
-		p[i], p[j] = p[j], p[i]
-	})
-	project.queue = []*cargoPackage{}
-	project.lock.Unlock()
-	return
+	return project.jobs.run(threads, start, finish)
 }
 
-// commit finished package, then compute next batch of available packages
-func (project *cargoProject) commit(pack *cargoPackage) {
-	project.lock.Lock()
-	project.complete++
-	for _, p := range pack.requiredBy {
-		// hash table may have a smaller complexity here, but why not make it run slower
-		p.dependencies = slices.DeleteFunc(p.dependencies, func(c *cargoPackage) bool {
-			return c == pack
-		})
-		if len(p.dependencies) == 0 {
-			project.queue = append(project.queue, p)
-		}
+// number of commited packages
+func (project *cargoProject) complete() int {
+	if project.jobs == nil {
+		return 0
 	}
-	project.lock.Unlock()
-	return
+	return project.jobs.completed()
 }
@@ -5,3 +5,5 @@ import "errors"
 var errEOF = errors.New("EOF")
 
 var errNotConstructed = errors.New("not constructed")
+
+var errDeadlock = errors.New("deadlock: remaining tasks wait for each other")
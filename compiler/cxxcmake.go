@@ -0,0 +1,639 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rizutazu/fake-compiler/progressbar"
+)
+
+// cmakeProject is what `cmake` reports while configuring a project: the compilers of its languages, then the
+// packages found and checks performed, in the order of CMakeLists.txt
+type cmakeProject struct {
+	name      string
+	version   string
+	languages []string // e.g. C, CXX, ASM
+	probes    []cmakeProbe
+}
+
+type cmakeProbe struct {
+	kind     string   // package, pkgconfig, include, symbol, size or compiles, see cmakeProbeKinds
+	name     string   // the package, the prefix of pkg_check_modules, or the result variable of a check
+	subjects []string // components of package, modules of pkgconfig, headers, the symbol, type or flag checked
+	versions []string // the found version of package, or one per module of pkgconfig
+	found    bool
+}
+
+var cmakeProbeKinds = []string{"package", "pkgconfig", "include", "symbol", "size", "compiles"}
+
+// versions of packages found by find_package(), versions of the others are made up, threads have no version
+var cmakePackageVersions = map[string]string{
+	"Threads":   "",
+	"OpenMP":    "4.5",
+	"PkgConfig": "1.8.1",
+	"OpenSSL":   "3.0.13",
+	"ZLIB":      "1.3",
+	"CURL":      "8.5.0",
+	"Boost":     "1.83.0",
+	"GTest":     "1.14.0",
+	"Python":    "3.12.3",
+	"Python3":   "3.12.3",
+	"PNG":       "1.6.43",
+	"JPEG":      "80",
+	"SQLite3":   "3.45.1",
+	"Protobuf":  "3.21.12",
+	"LibXml2":   "2.9.14",
+	"BZip2":     "1.0.8",
+	"LibLZMA":   "5.4.5",
+	"fmt":       "10.1.1",
+	"spdlog":    "1.12.0",
+	"Eigen3":    "3.4.0",
+	"Qt5":       "5.15.13",
+	"Qt6":       "6.4.2",
+	"Git":       "2.43.0",
+	"Doxygen":   "1.9.8",
+	"Perl":      "5.38.2",
+	"BISON":     "3.8.2",
+	"FLEX":      "2.6.4",
+}
+
+// headers and symbols of other platforms, checking them fails on linux
+var cmakeMissing = []string{"windows.h", "io.h", "direct.h", "winsock2.h", "malloc/malloc.h", "sys/filio.h", "mach/mach_time.h"}
+
+// keywords of find_package() that end a list of components
+var cmakeFindPackageKeywords = []string{"EXACT", "QUIET", "MODULE", "CONFIG", "NO_MODULE", "REQUIRED", "COMPONENTS",
+	"OPTIONAL_COMPONENTS", "GLOBAL", "NO_POLICY_SCOPE", "BYPASS_PROVIDER", "NAMES", "CONFIGS", "HINTS", "PATHS", "PATH_SUFFIXES",
+	"NO_DEFAULT_PATH", "REGISTRY_VIEW"}
+
+// cmakeCommand is an invocation of a command, e.g. find_package(OpenSSL 3 REQUIRED), arguments are not expanded yet
+type cmakeCommand struct {
+	name string // lower case, commands are case-insensitive
+	args []cmakeArgument
+	line int
+}
+
+type cmakeArgument struct {
+	value  string
+	quoted bool // quoted and bracket arguments are never split by ;
+}
+
+// parseCMakeLists splits src into commands, control flow like if() is not evaluated, all branches are taken
+func parseCMakeLists(src, file string) ([]cmakeCommand, error) {
+	var commands []cmakeCommand
+	line := 1
+	i := 0
+	// bracket returns the content of [[...]] or [=[...]=] at i, ok is false if there is none
+	bracket := func() (content string, ok bool) {
+		if i >= len(src) || src[i] != '[' {
+			return "", false
+		}
+		j := i + 1
+		for j < len(src) && src[j] == '=' {
+			j++
+		}
+		if j >= len(src) || src[j] != '[' {
+			return "", false
+		}
+		closing := "]" + src[i+1:j] + "]"
+		end := strings.Index(src[j+1:], closing)
+		if end < 0 {
+			return "", false
+		}
+		content = src[j+1 : j+1+end]
+		line += strings.Count(content, "\n")
+		i = j + 1 + end + len(closing)
+		return content, true
+	}
+	comment := func() {
+		i++
+		if _, ok := bracket(); ok {
+			return
+		}
+		for i < len(src) && src[i] != '\n' {
+			i++
+		}
+	}
+
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == '#':
+			comment()
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			command := cmakeCommand{name: strings.ToLower(src[start:i]), line: line}
+			for i < len(src) && (src[i] == ' ' || src[i] == '\t') {
+				i++
+			}
+			if i >= len(src) || src[i] != '(' {
+				return nil, fmt.Errorf("%s:%d: expected ( after %s", file, line, command.name)
+			}
+			i++
+			depth := 1
+			for depth > 0 {
+				if i >= len(src) {
+					return nil, fmt.Errorf("%s:%d: unterminated %s()", file, command.line, command.name)
+				}
+				switch src[i] {
+				case '\n':
+					line++
+					i++
+				case ' ', '\t', '\r':
+					i++
+				case '#':
+					comment()
+				case '(':
+					depth++
+					i++
+				case ')':
+					depth--
+					i++
+				case '"':
+					s := strings.Builder{}
+					for i++; i < len(src) && src[i] != '"'; i++ {
+						if src[i] == '\\' && i+1 < len(src) {
+							i++
+							if src[i] == '\n' {
+								line++
+								continue // line continuation
+							}
+						}
+						if src[i] == '\n' {
+							line++
+						}
+						s.WriteByte(src[i])
+					}
+					i++
+					command.args = append(command.args, cmakeArgument{value: s.String(), quoted: true})
+				default:
+					if content, ok := bracket(); ok {
+						command.args = append(command.args, cmakeArgument{value: strings.TrimPrefix(content, "\n"), quoted: true})
+						continue
+					}
+					start := i
+					for i < len(src) && !strings.ContainsRune(" \t\r\n()#\"", rune(src[i])) {
+						if src[i] == '\\' && i+1 < len(src) {
+							i++
+						}
+						i++
+					}
+					command.args = append(command.args, cmakeArgument{value: src[start:min(i, len(src))]})
+				}
+			}
+			commands = append(commands, command)
+		default:
+			i++
+		}
+	}
+	return commands, nil
+}
+
+var cmakeVariableRegexp = regexp.MustCompile(`\$\{([A-Za-z0-9_.+-]*)\}`)
+
+// cmakeReader evaluates commands of CMakeLists.txt files, variables set by set() are expanded
+type cmakeReader struct {
+	root      string
+	project   *cmakeProject
+	variables map[string]string
+	tests     []cmakeTest // added by add_test(), in the order ctest runs them
+}
+
+type cmakeTest struct {
+	name     string
+	file     string // CMakeLists.txt that adds the test, relative to root
+	line     int
+	disabled bool // by set_tests_properties(... PROPERTIES DISABLED ON)
+}
+
+// parseCMakeProject reads CMakeLists.txt within root and the directories added by add_subdirectory()
+func parseCMakeProject(root string) (*cmakeProject, error) {
+	reader := &cmakeReader{root: root, project: new(cmakeProject), variables: make(map[string]string)}
+	err := reader.read(".")
+	if err != nil {
+		return nil, err
+	}
+	if reader.project.name == "" {
+		return nil, errors.New("CMakeLists.txt: project() is not called")
+	}
+	return reader.project, nil
+}
+
+// ReadCmakeProject reads the project configured by CMakeLists.txt within root, see CmakeProgressBar.ConfigureLog
+func ReadCmakeProject(root string) (progressbar.CmakeProject, error) {
+	project, err := parseCMakeProject(root)
+	if err != nil {
+		return progressbar.CmakeProject{}, err
+	}
+	return project.info(), nil
+}
+
+func (project *cmakeProject) info() progressbar.CmakeProject {
+	info := progressbar.CmakeProject{Name: project.name, Version: project.version, Languages: project.languages}
+	for _, probe := range project.probes {
+		info.Probes = append(info.Probes, progressbar.CmakeProbe{
+			Kind:     probe.kind,
+			Name:     probe.name,
+			Subjects: probe.subjects,
+			Versions: probe.versions,
+			Found:    probe.found,
+		})
+	}
+	return info
+}
+
+// parseCMakeTests reads tests added within root, and the name of the project if there is one
+func parseCMakeTests(root string) (string, []cmakeTest, error) {
+	reader := &cmakeReader{root: root, project: new(cmakeProject), variables: make(map[string]string)}
+	err := reader.read(".")
+	if err != nil {
+		return "", nil, err
+	}
+	return reader.project.name, reader.tests, nil
+}
+
+func (reader *cmakeReader) read(dir string) error {
+	file := filepath.Join(reader.root, dir, "CMakeLists.txt")
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	commands, err := parseCMakeLists(string(b), file)
+	if err != nil {
+		return err
+	}
+	// ctest runs tests of a directory before those of its subdirectories
+	tests := reader.tests
+	reader.tests = nil
+	var subdirTests []cmakeTest
+	err = reader.run(commands, dir, &subdirTests)
+	reader.tests = append(append(tests, reader.tests...), subdirTests...)
+	return err
+}
+
+// run evaluates commands of CMakeLists.txt of dir, tests of subdirectories are added to subdirTests
+func (reader *cmakeReader) run(commands []cmakeCommand, dir string, subdirTests *[]cmakeTest) error {
+	for i := 0; i < len(commands); i++ {
+		command := commands[i]
+		args := reader.expand(command.args)
+		switch command.name {
+		case "add_subdirectory":
+			// a missing directory is an error of cmake, but it does not matter here
+			if len(args) > 0 {
+				tests := reader.tests
+				reader.tests = nil
+				err := reader.read(filepath.Join(dir, args[0]))
+				*subdirTests = append(*subdirTests, reader.tests...)
+				reader.tests = tests
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			}
+		case "foreach":
+			// the body up to the matching endforeach() runs once for each item
+			end, depth := i, 1
+			for depth > 0 && end+1 < len(commands) {
+				end++
+				switch commands[end].name {
+				case "foreach":
+					depth++
+				case "endforeach":
+					depth--
+				}
+			}
+			if depth > 0 {
+				end = len(commands) // not closed, the body runs to the end of file
+			}
+			body := commands[i+1 : min(end, len(commands))]
+			i = end
+			if len(args) == 0 {
+				continue
+			}
+			for _, item := range reader.foreachItems(args[1:]) {
+				reader.variables[args[0]] = item
+				err := reader.run(body, dir, subdirTests)
+				if err != nil {
+					return err
+				}
+			}
+		case "add_test", "set_tests_properties":
+			reader.addTest(command.name, args, filepath.ToSlash(filepath.Join(dir, "CMakeLists.txt")), command.line)
+		default:
+			reader.evaluate(command.name, args)
+		}
+	}
+	return nil
+}
+
+// foreachItems returns items that foreach() iterates over: items listed, IN LISTS and ITEMS, or a RANGE
+func (reader *cmakeReader) foreachItems(args []string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	switch args[0] {
+	case "RANGE":
+		var bounds []int
+		for _, arg := range args[1:] {
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return nil
+			}
+			bounds = append(bounds, n)
+		}
+		start, stop, step := 0, 0, 1
+		switch len(bounds) {
+		case 1:
+			stop = bounds[0]
+		case 2:
+			start, stop = bounds[0], bounds[1]
+		case 3:
+			start, stop, step = bounds[0], bounds[1], max(bounds[2], 1)
+		default:
+			return nil
+		}
+		var items []string
+		for n := start; n <= stop; n += step {
+			items = append(items, strconv.Itoa(n))
+		}
+		return items
+	case "IN":
+		var items []string
+		keyword := ""
+		for _, arg := range args[1:] {
+			switch {
+			case arg == "LISTS" || arg == "ITEMS" || arg == "ZIP_LISTS":
+				keyword = arg
+			case keyword == "LISTS":
+				items = append(items, strings.Split(reader.variables[arg], ";")...)
+			case keyword == "ITEMS":
+				items = append(items, arg)
+			}
+		}
+		return slices.DeleteFunc(items, func(item string) bool { return item == "" })
+	default:
+		return args
+	}
+}
+
+// expand substitutes variables, unquoted arguments are split into lists by ;
+func (reader *cmakeReader) expand(args []cmakeArgument) []string {
+	var expanded []string
+	for _, arg := range args {
+		value := arg.value
+		// inner variables first, e.g. ${${PROJECT_NAME}_SOURCES}
+		for range 8 {
+			replaced := cmakeVariableRegexp.ReplaceAllStringFunc(value, func(s string) string {
+				return reader.variables[s[2:len(s)-1]]
+			})
+			if replaced == value {
+				break
+			}
+			value = replaced
+		}
+		if arg.quoted {
+			expanded = append(expanded, value)
+			continue
+		}
+		for _, item := range strings.Split(value, ";") {
+			if item != "" {
+				expanded = append(expanded, item)
+			}
+		}
+	}
+	return expanded
+}
+
+// addTest evaluates add_test(NAME name COMMAND ...) or its older form add_test(name command ...),
+// and set_tests_properties() that disables tests
+func (reader *cmakeReader) addTest(command string, args []string, file string, line int) {
+	if command == "add_test" {
+		switch {
+		case len(args) >= 2 && args[0] == "NAME":
+			reader.tests = append(reader.tests, cmakeTest{name: args[1], file: file, line: line})
+		case len(args) >= 1 && args[0] != "NAME":
+			reader.tests = append(reader.tests, cmakeTest{name: args[0], file: file, line: line})
+		}
+		return
+	}
+	i := slices.Index(args, "PROPERTIES")
+	if i < 0 {
+		return
+	}
+	for j := i + 1; j+1 < len(args); j += 2 {
+		if args[j] != "DISABLED" || !slices.Contains([]string{"ON", "TRUE", "YES", "Y", "1"}, strings.ToUpper(args[j+1])) {
+			continue
+		}
+		for k := range reader.tests {
+			if slices.Contains(args[:i], reader.tests[k].name) {
+				reader.tests[k].disabled = true
+			}
+		}
+	}
+}
+
+func (reader *cmakeReader) evaluate(name string, args []string) {
+	project := reader.project
+	arg := func(i int) string {
+		if i >= 0 && i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	check := func(kind, variable string, subjects ...string) {
+		if variable == "" {
+			return
+		}
+		found := !slices.ContainsFunc(subjects, func(s string) bool {
+			return slices.Contains(cmakeMissing, s) || strings.HasPrefix(s, "_")
+		})
+		if kind == "compiles" {
+			upper := strings.ToUpper(variable)
+			found = !strings.Contains(upper, "WIN32") && !strings.Contains(upper, "MSVC") && !strings.Contains(upper, "APPLE")
+		}
+		project.probes = append(project.probes, cmakeProbe{kind: kind, name: variable, subjects: subjects, found: found})
+	}
+
+	switch name {
+	case "set":
+		if len(args) > 0 {
+			values := args[1:]
+			if i := slices.Index(args, "CACHE"); i > 0 {
+				values = args[1:i] // followed by the type and docstring
+			}
+			values = slices.DeleteFunc(slices.Clone(values), func(s string) bool { return s == "PARENT_SCOPE" })
+			reader.variables[args[0]] = strings.Join(values, ";")
+		}
+	case "project":
+		if project.name != "" || len(args) == 0 {
+			return // projects of subdirectories
+		}
+		project.name = args[0]
+		var languages []string
+		keyword := "LANGUAGES" // languages may follow the name without the keyword
+		for _, a := range args[1:] {
+			switch a {
+			case "VERSION", "DESCRIPTION", "HOMEPAGE_URL", "LANGUAGES":
+				keyword = a
+			default:
+				switch keyword {
+				case "VERSION":
+					project.version = a
+				case "LANGUAGES":
+					languages = append(languages, a)
+				}
+			}
+		}
+		switch {
+		case len(languages) == 0:
+			languages = []string{"C", "CXX"}
+		case slices.Equal(languages, []string{"NONE"}):
+			languages = nil
+		}
+		project.languages = languages
+		reader.variables["PROJECT_NAME"] = project.name
+		reader.variables["CMAKE_PROJECT_NAME"] = project.name
+		reader.variables["PROJECT_VERSION"] = project.version
+		reader.variables[project.name+"_VERSION"] = project.version
+	case "enable_language":
+		for _, language := range args {
+			if language != "OPTIONAL" && !slices.Contains(project.languages, language) {
+				project.languages = append(project.languages, language)
+			}
+		}
+	case "find_package":
+		packageName := arg(0)
+		if packageName == "" || slices.Contains(args, "QUIET") || slices.ContainsFunc(project.probes, func(probe cmakeProbe) bool {
+			return probe.kind == "package" && probe.name == packageName
+		}) {
+			return
+		}
+		var constraints, components []string
+		if version := arg(1); version != "" && unicode.IsDigit(rune(version[0])) {
+			if slices.Contains(args, "EXACT") {
+				constraints = append(constraints, "=="+version)
+			} else {
+				constraints = append(constraints, ">="+version)
+			}
+		}
+		inComponents := false
+		for _, a := range args[1:] {
+			switch {
+			case a == "COMPONENTS" || a == "REQUIRED":
+				inComponents = true // components may follow REQUIRED without the keyword
+			case slices.Contains(cmakeFindPackageKeywords, a):
+				inComponents = false
+			case inComponents:
+				components = append(components, a)
+			}
+		}
+		project.probes = append(project.probes, cmakeProbe{
+			kind:     "package",
+			name:     packageName,
+			subjects: components,
+			versions: []string{foundVersion(cmakePackageVersions, packageName, constraints)},
+			found:    true,
+		})
+	case "pkg_check_modules", "pkg_search_module":
+		probe := cmakeProbe{kind: "pkgconfig", name: arg(0), found: true}
+		for _, a := range args[min(len(args), 1):] {
+			switch a {
+			case "REQUIRED", "QUIET", "NO_CMAKE_PATH", "NO_CMAKE_ENVIRONMENT_PATH", "IMPORTED_TARGET", "GLOBAL":
+				continue
+			}
+			// e.g. glib-2.0>=2.56
+			module := a
+			var constraints []string
+			if i := strings.IndexAny(a, "<>="); i > 0 {
+				module, constraints = a[:i], []string{a[i:]}
+			}
+			probe.subjects = append(probe.subjects, module)
+			probe.versions = append(probe.versions, foundVersion(pkgConfigVersions, module, constraints))
+		}
+		if probe.name != "" && len(probe.subjects) > 0 {
+			project.probes = append(project.probes, probe)
+		}
+	case "check_include_file", "check_include_file_cxx":
+		check("include", arg(1), arg(0))
+	case "check_include_files":
+		check("include", arg(1), strings.Split(arg(0), ";")...)
+	case "check_function_exists", "check_symbol_exists", "check_cxx_symbol_exists":
+		check("symbol", arg(len(args)-1), arg(0))
+	case "check_library_exists":
+		check("symbol", arg(3), arg(1), arg(0))
+	case "check_type_size":
+		check("size", arg(1), arg(0))
+	case "check_c_source_compiles", "check_cxx_source_compiles", "check_c_source_runs", "check_cxx_source_runs",
+		"check_c_compiler_flag", "check_cxx_compiler_flag":
+		check("compiles", arg(1))
+	case "check_compiler_flag", "check_linker_flag", "check_source_compiles", "check_source_runs":
+		check("compiles", arg(2))
+	}
+}
+
+// content of cmake section of cxx config
+//
+//	{"name": "foo", "version": "1.2", "languages": ["C", "CXX"], "probes": [{"kind": "package", "name": "OpenSSL", "vers": ["3.0.13"], "found": true},
+//	 {"kind": "include", "name": "HAVE_PTHREAD_H", "subjects": ["pthread.h"], "found": true}, ...]}
+type configCmakeProject struct {
+	Name      string             `json:"name"`
+	Version   string             `json:"version,omitempty"`
+	Languages []string           `json:"languages"`
+	Probes    []configCmakeProbe `json:"probes,omitempty"`
+}
+
+type configCmakeProbe struct {
+	Kind     string   `json:"kind"`
+	Name     string   `json:"name"`
+	Subjects []string `json:"subjects,omitempty"`
+	Versions []string `json:"vers,omitempty"`
+	Found    bool     `json:"found"`
+}
+
+func (raw *configCmakeProject) validate() error {
+	if raw.Name == "" {
+		return errors.New("malformed config: empty cmake project name")
+	}
+	for i, probe := range raw.Probes {
+		switch {
+		case !slices.Contains(cmakeProbeKinds, probe.Kind):
+			return fmt.Errorf("malformed config: cmake probe %d has unknown kind %q", i, probe.Kind)
+		case probe.Name == "":
+			return fmt.Errorf("malformed config: cmake probe %d has no name", i)
+		case probe.Kind == "package" && len(probe.Versions) != 1:
+			return fmt.Errorf("malformed config: package %s should have 1 version, but there are %d", probe.Name, len(probe.Versions))
+		case probe.Kind == "pkgconfig" && len(probe.Versions) != len(probe.Subjects):
+			return fmt.Errorf("malformed config: pkg-config %s has %d modules but %d versions", probe.Name, len(probe.Subjects), len(probe.Versions))
+		case probe.Kind == "pkgconfig" && len(probe.Subjects) == 0:
+			return fmt.Errorf("malformed config: pkg-config %s has no modules", probe.Name)
+		}
+	}
+	return nil
+}
+
+func (raw *configCmakeProject) toProject() *cmakeProject {
+	project := &cmakeProject{name: raw.Name, version: raw.Version, languages: raw.Languages}
+	for _, probe := range raw.Probes {
+		project.probes = append(project.probes, cmakeProbe{kind: probe.Kind, name: probe.Name, subjects: probe.Subjects, versions: probe.Versions, found: probe.Found})
+	}
+	return project
+}
+
+func (project *cmakeProject) toRaw() *configCmakeProject {
+	raw := &configCmakeProject{Name: project.name, Version: project.version, Languages: project.languages}
+	for _, probe := range project.probes {
+		raw.Probes = append(raw.Probes, configCmakeProbe{Kind: probe.kind, Name: probe.name, Subjects: probe.subjects, Versions: probe.versions, Found: probe.found})
+	}
+	return raw
+}
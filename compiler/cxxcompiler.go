@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/report"
 	"github.com/rizutazu/fake-compiler/util"
 )
 
@@ -21,27 +22,37 @@ type CXXCompiler struct {
 	// progress bar
 	bar             progressbar.ProgressBar
 	useFullTaskName bool
+
+	incremental bool // set by SetChangedFiles
+
+	recorder *report.Recorder
 }
 
-func NewCXXCompiler(path string, config *util.Config, sourceType SourceType, threads int) (*CXXCompiler, error) {
+// options: how the directory is traversed, only used by SourceTypeDir
+func NewCXXCompiler(path string, config *util.Config, sourceType SourceType, threads int, options util.TraverseOptions) (*CXXCompiler, error) {
 	if threads <= 0 {
 		return nil, errors.New("CXXCompiler: threads should be a positive number")
 	}
-	dep, err := newCXXDep(path, config, sourceType)
+	dep, err := newCXXDep(path, config, sourceType, options)
 	if err != nil {
 		return nil, err
 	}
+	return newCXXCompiler(dep, threads), nil
+}
+
+func newCXXCompiler(dep *cxxDependency, threads int) *CXXCompiler {
 	return &CXXCompiler{
 		dependency: dep,
 		taskIssue:  make(chan *cxxSource),
 		commit:     make(chan *cxxSource),
 		wg:         new(sync.WaitGroup),
 		threads:    threads,
-	}, nil
+	}
 }
 
 func (compiler *CXXCompiler) issue(source *cxxSource) {
 
+	compiler.recorder.Ready(source)
 	compiler.wg.Add(1)
 	compiler.taskIssue <- source
 }
@@ -62,19 +73,21 @@ func (compiler *CXXCompiler) handleCommit() {
 	}
 }
 
-func (compiler *CXXCompiler) workerRun() {
+func (compiler *CXXCompiler) workerRun(slot int) {
 
 	for {
 		source, ok := <-compiler.taskIssue
 		if !ok {
 			break
 		}
+		compiler.recorder.Start(source, source.GetObjectNameWithPath(), slot)
 		if compiler.useFullTaskName {
 			compiler.bar.TaskStart(source.Path + "/" + source.Name + ".o")
 		} else {
 			compiler.bar.TaskStart(source.Name)
 		}
 		compiler.compileCode(source)
+		compiler.recorder.Complete(source)
 
 		compiler.commit <- source
 	}
@@ -111,12 +124,13 @@ func (compiler *CXXCompiler) Run() {
 	// wait all tasks finish ──> terminate: close chan                    ║
 	//                                     ╚══════════════════════════════╝
 
-	for range compiler.threads {
-		go compiler.workerRun()
+	for i := range compiler.threads {
+		go compiler.workerRun(i)
 	}
 	go compiler.handleCommit()
 
 	compiler.bar.Prologue()
+	compiler.recorder.Begin(compiler.threads)
 
 	for {
 		source, err := compiler.dependency.next()
@@ -131,37 +145,80 @@ func (compiler *CXXCompiler) Run() {
 	}
 
 	compiler.wg.Wait()
+	compiler.recorder.Finish()
 	close(compiler.taskIssue) // exit worker threads
 	close(compiler.commit)    // exit handleCommit thread
 
+	// an incremental build relinks the target, unless nothing is rebuilt
+	asCmake, ok := compiler.bar.(*progressbar.CmakeProgressBar)
+	if ok && compiler.incremental && compiler.dependency.len() > 0 {
+		asCmake.Link()
+	}
 	compiler.bar.Epilogue()
 }
 
 func (compiler *CXXCompiler) SetProgressBar(bar progressbar.ProgressBar) {
 	compiler.bar = bar
-	var totalTasks []string
-	for _, src := range compiler.dependency.sources {
-		totalTasks = append(totalTasks, src.Name)
-	}
-	bar.SetTotalTasks(totalTasks)
+	compiler.setTotalTasks()
 	asCmake, ok := compiler.bar.(*progressbar.CmakeProgressBar)
 	if ok {
 		asCmake.SetTargetName(compiler.dependency.targetName)
+		if project := compiler.dependency.cmake; project != nil {
+			asCmake.SetProject(project.info())
+		}
+		compiler.useFullTaskName = true
+	}
+	if asMeson, ok := compiler.bar.(*progressbar.MesonProgressBar); ok {
+		asMeson.SetProject(progressbar.MesonProject{
+			Name:      compiler.dependency.targetName,
+			Languages: compiler.dependency.languages(),
+			Targets:   []progressbar.MesonTarget{{Kind: "executable", Name: compiler.dependency.targetName}},
+		})
 		compiler.useFullTaskName = true
 	}
 
 }
 
+func (compiler *CXXCompiler) setTotalTasks() {
+	var totalTasks []string
+	for _, src := range compiler.dependency.sources {
+		totalTasks = append(totalTasks, src.Name)
+	}
+	compiler.bar.SetTotalTasks(totalTasks)
+}
+
+// SetChangedFiles only rebuilds sources that are listed in files, the target is relinked if any of them is rebuilt
+func (compiler *CXXCompiler) SetChangedFiles(files []string) error {
+	compiler.dependency.retain(files)
+	compiler.incremental = true
+	if compiler.bar != nil {
+		compiler.setTotalTasks()
+	}
+	return nil
+}
+
+func (compiler *CXXCompiler) SetRecorder(recorder *report.Recorder) {
+	compiler.recorder = recorder
+}
+
 func (compiler *CXXCompiler) getTargetName() string {
 	return compiler.dependency.targetName
 }
 
-func (compiler *CXXCompiler) DumpConfig(path string) error {
+func (compiler *CXXCompiler) DumpConfig(path string, compression util.Compression) error {
 	uncompressedContent, err := compiler.dependency.dumpConfig()
 	if err != nil {
 		return err
 	}
-	err = util.DumpConfigFile(path, []byte("cxx"), uncompressedContent)
+	err = util.DumpConfigFile(path, &util.Config{
+		CompilerType:        "cxx",
+		Compression:         compression,
+		UncompressedContent: uncompressedContent,
+		Metadata: util.ConfigMetadata{
+			Source: compiler.dependency.targetName,
+			Tasks:  compiler.dependency.len(),
+		},
+	})
 	if err != nil {
 		return err
 	}
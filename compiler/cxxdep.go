@@ -3,7 +3,11 @@ package compiler
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -32,15 +36,33 @@ type cxxDependency struct {
 	constructed bool
 	sources     []*cxxSource
 	targetName  string
+	cmake       *cmakeProject // nil if there is no CMakeLists.txt
 	cursor      int
 }
 
+// content of cxx config
+//
+// format 1: every source carries its directory
+//
+//	{"target_name": "linux", "sources": [{"path": "arch/x86/boot", "name": "a20.c", "size": 4096}, ...]}
+//
+// format 2: directories are stored once, files refer to them by index, the table is stored by columns
+//
+//	{"format": 2, "target_name": "linux", "dirs": ["arch/x86/boot", ...], "files": {"dir": [0, ...], "name": ["a20.c", ...], "size": [4096, ...]}}
+//
+// both of them may have the project read from CMakeLists.txt, see configCmakeProject
 type rawFakeCXXDepJson struct {
-	TargetName string      `json:"target_name"`
-	Sources    []cxxSource `json:"sources"`
+	Format     int                 `json:"format,omitempty"` // 0 means 1
+	TargetName string              `json:"target_name"`
+	Sources    []cxxSource         `json:"sources,omitempty"` // format 1
+	Dirs       []string            `json:"dirs,omitempty"`    // format 2
+	Files      *fileTable          `json:"files,omitempty"`   // format 2
+	Cmake      *configCmakeProject `json:"cmake,omitempty"`
 }
 
-func newCXXDep(path string, config *util.Config, sourceType SourceType) (*cxxDependency, error) {
+const cxxConfigFormat = 2 // format written by dumpConfig
+
+func newCXXDep(path string, config *util.Config, sourceType SourceType, options util.TraverseOptions) (*cxxDependency, error) {
 
 	f := new(cxxDependency)
 	f.constructed = false
@@ -52,7 +74,7 @@ func newCXXDep(path string, config *util.Config, sourceType SourceType) (*cxxDep
 			return nil, err
 		}
 	case SourceTypeDir:
-		err := f.parseDirectory(path)
+		err := f.parseDirectory(path, options)
 		if err != nil {
 			return nil, err
 		}
@@ -68,34 +90,114 @@ func (dep *cxxDependency) parseConfig(config *util.Config) error {
 		return errors.New("cxxDep: config is nil")
 	}
 	raw := new(rawFakeCXXDepJson)
-	err := json.Unmarshal(config.UncompressedContent, raw)
+	err := config.Decode(raw)
+	if err != nil {
+		return err
+	}
+	err = raw.validate()
 	if err != nil {
 		return err
 	}
+	dep.fromRaw(raw)
+	return nil
+}
 
+// fromRaw takes sources of a validated config
+func (dep *cxxDependency) fromRaw(raw *rawFakeCXXDepJson) {
 	dep.targetName = raw.TargetName
+	if raw.Cmake != nil {
+		dep.cmake = raw.Cmake.toProject()
+	}
 	for _, src := range raw.Sources {
 		dep.sources = append(dep.sources, &src)
 	}
 	dep.constructed = true
+}
+
+// validate checks that every source has a name and a valid size, and appears only once,
+// the file table of format 2 is expanded to `Sources`
+func (raw *rawFakeCXXDepJson) validate() error {
+	if raw.TargetName == "" {
+		return errors.New("malformed config: empty target name")
+	}
+	switch raw.Format {
+	case 0, 1:
+	case 2:
+		err := raw.expand()
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("malformed config: unknown cxx format %d, please upgrade fake-compiler", raw.Format)
+	}
+	if raw.Cmake != nil {
+		err := raw.Cmake.validate()
+		if err != nil {
+			return err
+		}
+	}
+	seen := make(map[string]bool)
+	for i, src := range raw.Sources {
+		name := util.CleanRelativePath(src.Path + "/" + src.Name)
+		switch {
+		case src.Name == "":
+			return fmt.Errorf("malformed config: source %d has no name", i)
+		case src.Size < 0:
+			return fmt.Errorf("malformed config: source %d (%s) has negative size %d", i, name, src.Size)
+		case seen[name]:
+			return fmt.Errorf("malformed config: source %d (%s) is listed more than once", i, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// expand converts the file table of format 2 to sources of format 1
+func (raw *rawFakeCXXDepJson) expand() error {
+	if raw.Files == nil {
+		return errors.New("malformed config: no file table")
+	}
+	files := raw.Files
+	err := files.validate(raw.Dirs)
+	if err != nil {
+		return err
+	}
+	raw.Sources = make([]cxxSource, 0, len(files.Dir))
+	for i, dir := range files.Dir {
+		raw.Sources = append(raw.Sources, cxxSource{Path: raw.Dirs[dir], Name: files.Name[i], Size: files.Size[i]})
+	}
 	return nil
 }
 
-func (dep *cxxDependency) parseDirectory(path string) error {
+func (dep *cxxDependency) parseDirectory(path string, options util.TraverseOptions) error {
 
-	rootDir, err := util.NewDirectory(path, "^.*\\.(c|cpp|S)$", true)
+	rootDir, err := util.NewDirectory(path, "^.*\\.(c|cc|cpp|cxx|S)$", true)
+	if err != nil {
+		return err
+	}
+	err = rootDir.SetOptions(options)
 	if err != nil {
 		return err
 	}
 	if !rootDir.Complete {
-		err := rootDir.Traverse()
+		errs, err := rootDir.Traverse()
 		if err != nil {
 			return err
 		}
+		// unreadable paths are skipped, but never silently
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "warning: skipped %s\n", e)
+		}
 	}
 
 	dep.targetName = filepath.Base(path)
 
+	// the configure log of cmake is made up of the project, which is not required
+	dep.cmake, err = parseCMakeProject(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "warning: skipped CMakeLists.txt: %s\n", err)
+	}
+
 	// https://stackoverflow.com/questions/4664050/iterative-depth-first-tree-traversal-with-pre-and-post-visit-at-each-node
 	// result sort by dir
 	pre := stack.New()
@@ -136,26 +238,69 @@ func (dep *cxxDependency) next() (*cxxSource, error) {
 	}
 }
 
+// retain drops sources that are not listed in files
+func (dep *cxxDependency) retain(files []string) {
+	changed := make(map[string]bool)
+	for _, f := range files {
+		changed[f] = true
+	}
+	dep.sources = slices.DeleteFunc(dep.sources, func(src *cxxSource) bool {
+		return !changed[util.CleanRelativePath(src.Path+"/"+src.Name)]
+	})
+}
+
 func (dep *cxxDependency) len() int {
 
 	return len(dep.sources)
 }
 
+// languages returns languages of the sources by their extensions, in meson's names: c (for .c and .S) and cpp (for .cpp, .cc and .cxx)
+func (dep *cxxDependency) languages() []string {
+	var c, cpp bool
+	for _, src := range dep.sources {
+		switch path.Ext(src.Name) {
+		case ".cpp", ".cc", ".cxx":
+			cpp = true
+		default:
+			c = true
+		}
+	}
+	var languages []string
+	if c {
+		languages = append(languages, "c")
+	}
+	if cpp {
+		languages = append(languages, "cpp")
+	}
+	return languages
+}
+
 func (dep *cxxDependency) dumpConfig() ([]byte, error) {
 
 	if !dep.constructed {
 		return nil, errNotConstructed
 	}
 
-	r := new(rawFakeCXXDepJson)
-	r.TargetName = dep.targetName
-	for _, src := range dep.sources {
-		r.Sources = append(r.Sources, *src)
-	}
-	data, err := json.Marshal(r)
+	data, err := json.Marshal(dep.toRaw())
 	if err != nil {
 		return nil, err
 	}
 
 	return data, err
 }
+
+// toRaw stores sources in the latest format
+func (dep *cxxDependency) toRaw() *rawFakeCXXDepJson {
+	r := new(rawFakeCXXDepJson)
+	r.Format = cxxConfigFormat
+	r.TargetName = dep.targetName
+	if dep.cmake != nil {
+		r.Cmake = dep.cmake.toRaw()
+	}
+	r.Files = new(fileTable)
+	dirs := make(map[string]int)
+	for _, src := range dep.sources {
+		r.Dirs = r.Files.add(r.Dirs, dirs, src.Path, src.Name, src.Size)
+	}
+	return r
+}
@@ -0,0 +1,754 @@
+package compiler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// dockerStage is a stage of a Dockerfile, started by FROM
+type dockerStage struct {
+	index  int
+	name   string       // declared by AS in lower case, "" if unnamed
+	base   string       // fully qualified image, "" for scratch or a stage
+	parent *dockerStage // the stage it is based on
+	steps  []*dockerStep
+}
+
+// String returns the name of stage shown by BuildKit, e.g. builder, or stage-1 if unnamed
+func (stage *dockerStage) String() string {
+	if stage.name != "" {
+		return stage.name
+	}
+	return "stage-" + strconv.Itoa(stage.index)
+}
+
+// dockerStep is an instruction of a stage that BuildKit runs: RUN, COPY, ADD or WORKDIR,
+// the others only change the image config
+type dockerStep struct {
+	instruction string
+	args        string       // as shown, e.g. --from=builder /app/target/release/app /usr/local/bin/
+	from        *dockerStage // COPY --from a stage
+	fromImage   string       // COPY --from an image, fully qualified
+	context     bool         // reads the build context
+	heredoc     []string     // lines of the heredoc of RUN, which is the script run
+	nested      *util.Config // the build run by RUN, nil for a made-up command
+}
+
+// command returns the shell command of RUN without its flags, e.g. cargo build --release, or its heredoc
+func (step *dockerStep) command() string {
+	if len(step.heredoc) > 0 {
+		return strings.Join(step.heredoc, "\n")
+	}
+	_, command := dockerFlags(step.args)
+	return command
+}
+
+// dockerVertex is a vertex of the build graph, named as shown by BuildKit, e.g. [builder 4/9] RUN cargo build --release
+type dockerVertex struct {
+	name         string
+	kind         string      // internal, from, step or export
+	step         *dockerStep // of kind step
+	image        string      // of kind from, fully qualified
+	ms           float64     // expected time
+	cached       bool        // a cache hit in this build, internal vertices and exporting always run
+	dependencies []*dockerVertex
+	requiredBy   []*dockerVertex
+}
+
+func (vertex *dockerVertex) String() string {
+	return vertex.name
+}
+
+func (vertex *dockerVertex) dependsOn(dep *dockerVertex) {
+	if dep == nil || slices.Contains(vertex.dependencies, dep) {
+		return
+	}
+	vertex.dependencies = append(vertex.dependencies, dep)
+	dep.requiredBy = append(dep.requiredBy, vertex)
+}
+
+// dockerBuild is the build of the last stage of a Dockerfile, BuildKit skips the stages it does not depend on
+type dockerBuild struct {
+	name        string // repository of the image, e.g. app
+	dockerfile  int64  // size of the Dockerfile
+	context     int64  // size of the build context
+	stages      []*dockerStage
+	vertices    []*dockerVertex
+	jobs        *jobQueue[*dockerVertex]
+	constructed bool
+}
+
+// content of docker config, stages refer to stages before them by index
+//
+//	{"name": "app", "dockerfile": 812, "context": 45670, "stages": [
+//	 {"name": "builder", "base": "docker.io/library/rust:1.77", "steps": [{"instruction": "RUN", "args": "cargo build --release"}]},
+//	 {"base": "docker.io/library/debian:bookworm-slim", "steps": [{"instruction": "COPY", "args": "--from=builder /app/app /", "from": 0}]}]}
+type configDockerBuild struct {
+	Name       string              `json:"name"`
+	Dockerfile int64               `json:"dockerfile"`
+	Context    int64               `json:"context"`
+	Stages     []configDockerStage `json:"stages"`
+}
+
+type configDockerStage struct {
+	Name   string             `json:"name,omitempty"`
+	Base   string             `json:"base,omitempty"`   // image, empty for scratch or a stage
+	Parent *int               `json:"parent,omitempty"` // index of the stage it is based on
+	Steps  []configDockerStep `json:"steps"`
+}
+
+type configDockerStep struct {
+	Instruction string               `json:"instruction"`
+	Args        string               `json:"args"`
+	From        *int                 `json:"from,omitempty"` // index of the stage copied from
+	FromImage   string               `json:"fromImage,omitempty"`
+	Context     bool                 `json:"context,omitempty"`
+	Heredoc     []string             `json:"heredoc,omitempty"`
+	Nested      *util.ConfigDocument `json:"nested,omitempty"` // the build run by RUN
+}
+
+var (
+	dockerFiles = []string{"Dockerfile", "Containerfile", "dockerfile"}
+
+	// expected time of RUN commands containing the words, the first match wins
+	dockerRunTimes = []struct {
+		commands []string
+		ms       float64
+	}{
+		{[]string{"cargo build", "go build", "make", "cmake", "ninja", "gradle", "gradlew", "mvn", "mvnw", "npm run build", "yarn build",
+			"pnpm build", "pnpm run build", "dotnet publish", "dotnet build", "meson compile", "bazel build"}, 20000},
+		{[]string{"apt-get install", "apt install", "apk add", "yum install", "dnf install", "microdnf install"}, 9000},
+		{[]string{"pip install", "npm ci", "npm install", "yarn install", "pnpm install", "go mod download", "cargo fetch",
+			"bundle install", "poetry install", "uv sync", "composer install"}, 6000},
+		{[]string{"apt-get update", "apk update"}, 3000},
+	}
+)
+
+// expected time of other vertices in milliseconds
+const (
+	dockerRunMs      = 700
+	dockerPullMs     = 6000 // pulling a base image that is not cached
+	dockerMetadataMs = 900
+	dockerExportMs   = 800
+	dockerPushMs     = 4000
+)
+
+func newDockerBuild(path string, config *util.Config, sourceType SourceType) (*dockerBuild, error) {
+	build := &dockerBuild{}
+	switch sourceType {
+	case SourceTypeDir:
+		err := build.parseDirectory(path)
+		if err != nil {
+			return nil, err
+		}
+	case SourceTypeConfig:
+		err := build.parseConfig(config)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("dockerBuild: unknown sourceType " + strconv.Itoa(int(sourceType)))
+	}
+	build.createVertices()
+	build.constructed = true
+	return build, nil
+}
+
+// parseDirectory reads the Dockerfile within root, which is the build context
+func (build *dockerBuild) parseDirectory(root string) error {
+	var src []byte
+	var file string
+	for _, name := range dockerFiles {
+		b, err := os.ReadFile(filepath.Join(root, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		src, file = b, name
+		break
+	}
+	if src == nil {
+		return fmt.Errorf("no Dockerfile found in %s", root)
+	}
+	build.dockerfile = int64(len(src))
+	build.name = filepath.Base(root)
+	if abs, err := filepath.Abs(root); err == nil {
+		build.name = filepath.Base(abs)
+	}
+	build.name = dockerRepository(build.name)
+
+	err := build.parseDockerfile(string(src))
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	build.context, err = dockerContextSize(root)
+	return err
+}
+
+// dockerRepository turns name into a valid repository name, e.g. My_App -> my_app
+func dockerRepository(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', '0' <= r && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case 'A' <= r && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, name)
+	name = strings.Trim(name, ".-_")
+	if name == "" {
+		return "app"
+	}
+	return name
+}
+
+// dockerContextSize sums the sizes of files within root, except .git and those excluded by .dockerignore
+func dockerContextSize(root string) (int64, error) {
+	type rule struct {
+		pattern string
+		exclude bool // false for exceptions starting with !
+	}
+	var rules []rule
+	b, err := os.ReadFile(filepath.Join(root, ".dockerignore"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		exception := strings.HasPrefix(line, "!")
+		pattern := path.Clean(strings.TrimPrefix(strings.TrimPrefix(line, "!"), "/"))
+		rules = append(rules, rule{pattern: pattern, exclude: !exception})
+	}
+	// the last matching rule decides, a pattern matching a directory matches everything below it
+	ignored := func(rel string) bool {
+		result := false
+		for _, r := range rules {
+			for p := rel; p != "."; p = path.Dir(p) {
+				if util.MatchGlob(r.pattern, p) {
+					result = r.exclude
+					break
+				}
+			}
+		}
+		return result
+	}
+
+	var size int64
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || ignored(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// parseDockerfile reads stages and their steps from src, variables of ARG and ENV are expanded in FROM and COPY --from
+func (build *dockerBuild) parseDockerfile(src string) error {
+	instructions, err := parseDockerfile(src)
+	if err != nil {
+		return err
+	}
+	global := make(map[string]string) // ARG before the first FROM
+	var stage *dockerStage
+	var variables map[string]string
+	lookup := func(name string) *dockerStage {
+		if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(build.stages) {
+			return build.stages[i]
+		}
+		for _, s := range build.stages {
+			if s.name != "" && s.name == strings.ToLower(name) {
+				return s
+			}
+		}
+		return nil
+	}
+
+	for _, instruction := range instructions {
+		switch instruction.keyword {
+		case "ARG", "ENV":
+			for name, value := range dockerAssignments(instruction.args, instruction.keyword == "ENV") {
+				switch {
+				case stage == nil:
+					global[name] = value
+				case value == "" && instruction.keyword == "ARG":
+					variables[name] = global[name] // declared again to be used within the stage
+				default:
+					variables[name] = value
+				}
+			}
+		case "FROM":
+			_, rest := dockerFlags(instruction.args)
+			fields := strings.Fields(rest)
+			if len(fields) == 0 {
+				return fmt.Errorf("line %d: FROM requires an image", instruction.line)
+			}
+			stage = &dockerStage{index: len(build.stages)}
+			if len(fields) >= 3 && strings.EqualFold(fields[1], "AS") {
+				stage.name = strings.ToLower(fields[2])
+				if slices.ContainsFunc(build.stages, func(s *dockerStage) bool { return s.name == stage.name }) {
+					return fmt.Errorf("line %d: duplicate stage name %q", instruction.line, stage.name)
+				}
+			}
+			image := expandDockerVariables(fields[0], global)
+			switch parent := lookup(image); {
+			case parent != nil && !strings.ContainsAny(image, "/:@"):
+				stage.parent = parent
+			case image == "scratch":
+			case image == "":
+				return fmt.Errorf("line %d: FROM %s is an empty image", instruction.line, fields[0])
+			default:
+				stage.base = dockerImage(image)
+			}
+			build.stages = append(build.stages, stage)
+			variables = make(map[string]string)
+		case "RUN", "COPY", "ADD", "WORKDIR":
+			if stage == nil {
+				return fmt.Errorf("line %d: %s before FROM", instruction.line, instruction.keyword)
+			}
+			step := &dockerStep{
+				instruction: instruction.keyword,
+				args:        strings.TrimPrefix(instruction.display(), instruction.keyword+" "),
+			}
+			if step.instruction == "RUN" {
+				step.heredoc = instruction.heredoc
+			}
+			if step.instruction == "COPY" || step.instruction == "ADD" {
+				flags, rest := dockerFlags(instruction.args)
+				from, ok := flags["from"]
+				switch {
+				case ok && step.instruction == "COPY":
+					scope := maps.Clone(global)
+					maps.Copy(scope, variables)
+					expanded := expandDockerVariables(from, scope)
+					if source := lookup(expanded); source != nil && source != stage {
+						step.from = source
+					} else {
+						step.fromImage = dockerImage(expanded)
+					}
+				case len(instruction.heredoc) == 0:
+					// ADD downloads remote sources instead
+					step.context = slices.ContainsFunc(dockerSources(rest), func(source string) bool {
+						return !strings.Contains(source, "://") && !strings.HasPrefix(source, "git@")
+					})
+				}
+			}
+			stage.steps = append(stage.steps, step)
+		}
+	}
+	if len(build.stages) == 0 {
+		return errors.New("no FROM instruction")
+	}
+	return nil
+}
+
+// dockerAssignments parses NAME=value pairs of ARG or ENV, also the legacy ENV NAME value form. Quotes are removed
+func dockerAssignments(args string, env bool) map[string]string {
+	assignments := make(map[string]string)
+	if name, value, found := strings.Cut(args, " "); env && found && !strings.Contains(name, "=") {
+		assignments[name] = strings.Trim(strings.TrimSpace(value), `"'`)
+		return assignments
+	}
+	for _, word := range strings.Fields(args) {
+		name, value, _ := strings.Cut(word, "=")
+		assignments[name] = strings.Trim(value, `"'`)
+	}
+	return assignments
+}
+
+// target returns the stage built, which is the last one
+func (build *dockerBuild) target() *dockerStage {
+	return build.stages[len(build.stages)-1]
+}
+
+// reachable returns stages the target depends on, in order
+func (build *dockerBuild) reachable() []*dockerStage {
+	needed := make(map[*dockerStage]bool)
+	var visit func(stage *dockerStage)
+	visit = func(stage *dockerStage) {
+		if stage == nil || needed[stage] {
+			return
+		}
+		needed[stage] = true
+		visit(stage.parent)
+		for _, step := range stage.steps {
+			visit(step.from)
+		}
+	}
+	visit(build.target())
+	var stages []*dockerStage
+	for _, stage := range build.stages {
+		if needed[stage] {
+			stages = append(stages, stage)
+		}
+	}
+	return stages
+}
+
+// dockerDigest makes up the digest an image resolves to, the same for the same image
+func dockerDigest(image string) string {
+	if _, digest, found := strings.Cut(image, "@"); found {
+		return digest
+	}
+	sum := sha256.Sum256([]byte(image))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// createVertices creates the build graph of the stages the target depends on: steps of a stage run one after another
+// from its base, while stages wait only for the stages they copy from, so independent stages run in parallel
+func (build *dockerBuild) createVertices() {
+	build.vertices = nil
+	add := func(name, kind string, ms float64, dependencies ...*dockerVertex) *dockerVertex {
+		vertex := &dockerVertex{name: name, kind: kind, ms: ms}
+		for _, dep := range dependencies {
+			vertex.dependsOn(dep)
+		}
+		build.vertices = append(build.vertices, vertex)
+		return vertex
+	}
+
+	definition := add("[internal] load build definition from Dockerfile", "internal", 30)
+	metadata := make(map[string]*dockerVertex)
+	loadMetadata := func(image string) *dockerVertex {
+		if metadata[image] == nil {
+			metadata[image] = add("[internal] load metadata for "+image, "internal", dockerMetadataMs, definition)
+		}
+		return metadata[image]
+	}
+	stages := build.reachable()
+	for _, stage := range stages {
+		if stage.base != "" {
+			loadMetadata(stage.base)
+		}
+	}
+	ignore := add("[internal] load .dockerignore", "internal", 20, definition)
+	var context *dockerVertex
+	images := make(map[string]*dockerVertex) // images copied from
+	last := make(map[*dockerStage]*dockerVertex)
+	prefix := func(stage *dockerStage) string {
+		if len(build.stages) == 1 {
+			return ""
+		}
+		return stage.String() + " "
+	}
+
+	for _, stage := range stages {
+		total := len(stage.steps) + 1
+		var previous *dockerVertex
+		switch {
+		case stage.parent != nil:
+			previous = last[stage.parent]
+		case stage.base != "":
+			previous = add(fmt.Sprintf("[%s1/%d] FROM %s@%s", prefix(stage), total, strings.Split(stage.base, "@")[0], dockerDigest(stage.base)),
+				"from", dockerPullMs, metadata[stage.base])
+			previous.image = stage.base
+		}
+		for i, step := range stage.steps {
+			vertex := add(fmt.Sprintf("[%s%d/%d] %s %s", prefix(stage), i+2, total, step.instruction, step.args), "step", 0, previous)
+			vertex.step = step
+			vertex.ms = build.stepMs(step)
+			if step.from != nil {
+				vertex.dependsOn(last[step.from])
+			}
+			if step.fromImage != "" {
+				if images[step.fromImage] == nil {
+					images[step.fromImage] = add(fmt.Sprintf("FROM %s@%s", strings.Split(step.fromImage, "@")[0], dockerDigest(step.fromImage)),
+						"from", dockerPullMs, loadMetadata(step.fromImage))
+					images[step.fromImage].image = step.fromImage
+				}
+				vertex.dependsOn(images[step.fromImage])
+			}
+			if step.context {
+				if context == nil {
+					context = add("[internal] load build context", "internal", 100+float64(build.context)/20000, ignore)
+				}
+				vertex.dependsOn(context)
+			}
+			previous = vertex
+		}
+		last[stage] = previous
+	}
+	export := add("exporting to image", "export", dockerExportMs, last[build.target()])
+	if last[build.target()] == nil {
+		export.dependsOn(ignore) // an empty image from scratch
+	}
+}
+
+// stepMs returns the expected time of step
+func (build *dockerBuild) stepMs(step *dockerStep) float64 {
+	switch step.instruction {
+	case "WORKDIR":
+		return 40
+	case "COPY", "ADD":
+		switch {
+		case step.context:
+			return 150 + float64(build.context)/100000
+		case step.from != nil || step.fromImage != "":
+			return 300
+		default:
+			return 1500 // remote sources or heredocs
+		}
+	}
+	var words []string
+	for _, word := range strings.Fields(step.command()) {
+		words = append(words, path.Base(word))
+	}
+	command := " " + strings.Join(words, " ") + " "
+	for _, times := range dockerRunTimes {
+		for _, c := range times.commands {
+			if strings.Contains(command, " "+c+" ") {
+				return times.ms
+			}
+		}
+	}
+	return dockerRunMs
+}
+
+// resetCache picks the vertices that hit the cache in the next build, by rate. A step is only cached if the steps it
+// depends on are, and steps reading the build context miss more often, as it changes between builds
+func (build *dockerBuild) resetCache(rate float64) {
+	for _, vertex := range build.vertices {
+		vertex.cached = false
+		switch vertex.kind {
+		case "from":
+			vertex.cached = rand.Float64() < rate
+		case "step":
+			r := rate
+			if vertex.step.context {
+				r /= 2
+			}
+			vertex.cached = rand.Float64() < r
+			for _, dep := range vertex.dependencies {
+				if dep.kind != "internal" && !dep.cached {
+					vertex.cached = false
+				}
+			}
+		}
+	}
+}
+
+// setNested makes RUN steps whose command contains text run the build of config, returns the number of them
+func (build *dockerBuild) setNested(text string, config *util.Config) (int, error) {
+	switch config.CompilerType {
+	case "docker", util.CompilerTypeMulti:
+		return 0, fmt.Errorf("a %s build can not run within a RUN step", config.CompilerType)
+	}
+	n := 0
+	for _, stage := range build.stages {
+		for _, step := range stage.steps {
+			if step.instruction == "RUN" && strings.Contains(step.command(), text) {
+				step.nested = config
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+func (build *dockerBuild) parseConfig(config *util.Config) error {
+	b := configDockerBuild{}
+	err := config.Decode(&b)
+	if err != nil {
+		return err
+	}
+	err = b.validate()
+	if err != nil {
+		return err
+	}
+
+	build.name = b.Name
+	build.dockerfile = b.Dockerfile
+	build.context = b.Context
+	for i, cStage := range b.Stages {
+		stage := &dockerStage{index: i, name: cStage.Name, base: cStage.Base}
+		if cStage.Parent != nil {
+			stage.parent = build.stages[*cStage.Parent]
+		}
+		for _, cStep := range cStage.Steps {
+			step := &dockerStep{
+				instruction: cStep.Instruction,
+				args:        cStep.Args,
+				fromImage:   cStep.FromImage,
+				context:     cStep.Context,
+				heredoc:     cStep.Heredoc,
+			}
+			if cStep.From != nil {
+				step.from = build.stages[*cStep.From]
+			}
+			if cStep.Nested != nil {
+				step.nested = dockerNestedConfig(cStep.Nested, config)
+				_, err := ValidateConfig(step.nested)
+				if err != nil {
+					return fmt.Errorf("malformed config: nested build of %s %s: %w", step.instruction, step.args, err)
+				}
+			}
+			stage.steps = append(stage.steps, step)
+		}
+		build.stages = append(build.stages, stage)
+	}
+	return nil
+}
+
+// dockerNestedConfig converts a nested build back to config, which has the format version of the docker config
+func dockerNestedConfig(doc *util.ConfigDocument, config *util.Config) *util.Config {
+	nested := &util.Config{
+		Version:             1,
+		CompilerType:        doc.CompilerType,
+		Compression:         config.Compression,
+		UncompressedContent: doc.Content,
+	}
+	if doc.Metadata != nil {
+		nested.Version = config.Version
+		nested.Metadata = *doc.Metadata
+	}
+	return nested
+}
+
+// validate checks that stages refer to stages before them, steps are known instructions,
+// and nested builds are run by RUN, their content is validated once they are loaded
+func (b *configDockerBuild) validate() error {
+	if len(b.Stages) == 0 {
+		return errors.New("malformed config: no stages")
+	}
+	if b.Dockerfile < 0 || b.Context < 0 {
+		return errors.New("malformed config: negative size of Dockerfile or build context")
+	}
+	names := make(map[string]int)
+	for i, stage := range b.Stages {
+		switch {
+		case stage.Parent != nil && (*stage.Parent < 0 || *stage.Parent >= i):
+			return fmt.Errorf("malformed config: stage %d is based on stage %d, which is not before it", i, *stage.Parent)
+		case stage.Parent != nil && stage.Base != "":
+			return fmt.Errorf("malformed config: stage %d is based on both stage %d and image %s", i, *stage.Parent, stage.Base)
+		}
+		if stage.Name != "" {
+			if j, ok := names[stage.Name]; ok {
+				return fmt.Errorf("malformed config: stages %d and %d have the same name %s", j, i, stage.Name)
+			}
+			names[stage.Name] = i
+		}
+		for j, step := range stage.Steps {
+			switch {
+			case !slices.Contains([]string{"RUN", "COPY", "ADD", "WORKDIR"}, step.Instruction):
+				return fmt.Errorf("malformed config: step %d of stage %d has unknown instruction %q", j, i, step.Instruction)
+			case step.From != nil && (*step.From < 0 || *step.From >= i):
+				return fmt.Errorf("malformed config: step %d of stage %d copies from stage %d, which is not before it", j, i, *step.From)
+			case (step.From != nil || step.FromImage != "") && step.Instruction != "COPY":
+				return fmt.Errorf("malformed config: step %d of stage %d copies from another stage or image, but it is %s", j, i, step.Instruction)
+			case (step.Nested != nil || len(step.Heredoc) > 0) && step.Instruction != "RUN":
+				return fmt.Errorf("malformed config: step %d of stage %d runs a nested build or a heredoc, but it is %s", j, i, step.Instruction)
+			}
+			if step.Nested != nil && (step.Nested.CompilerType == "docker" || step.Nested.CompilerType == util.CompilerTypeMulti) {
+				return fmt.Errorf("malformed config: step %d of stage %d runs a nested build of type %s", j, i, step.Nested.CompilerType)
+			}
+		}
+	}
+	return nil
+}
+
+func (build *dockerBuild) dumpConfig() ([]byte, error) {
+	if !build.constructed {
+		return nil, errNotConstructed
+	}
+	b := configDockerBuild{
+		Name:       build.name,
+		Dockerfile: build.dockerfile,
+		Context:    build.context,
+	}
+	for _, stage := range build.stages {
+		cStage := configDockerStage{Name: stage.name, Base: stage.base, Steps: []configDockerStep{}}
+		if stage.parent != nil {
+			cStage.Parent = &stage.parent.index
+		}
+		for _, step := range stage.steps {
+			cStep := configDockerStep{
+				Instruction: step.instruction,
+				Args:        step.args,
+				FromImage:   step.fromImage,
+				Context:     step.context,
+				Heredoc:     step.heredoc,
+			}
+			if step.from != nil {
+				cStep.From = &step.from.index
+			}
+			if step.nested != nil {
+				content, err := step.nested.Content()
+				if err != nil {
+					return nil, err
+				}
+				cStep.Nested = &util.ConfigDocument{CompilerType: step.nested.CompilerType, Content: content}
+				if step.nested.Version >= 2 {
+					metadata := step.nested.Metadata
+					cStep.Nested.Metadata = &metadata
+				}
+			}
+			cStage.Steps = append(cStage.Steps, cStep)
+		}
+		b.Stages = append(b.Stages, cStage)
+	}
+	return json.Marshal(b)
+}
+
+// schedule starts a new round of build, onReady is invoked when a vertex becomes ready to run
+func (build *dockerBuild) schedule(onReady func(vertex *dockerVertex)) error {
+	if !build.constructed {
+		return errNotConstructed
+	}
+	build.jobs = newJobQueue(build.vertices,
+		func(vertex *dockerVertex) []*dockerVertex {
+			return vertex.dependencies
+		},
+		func(vertex *dockerVertex) []*dockerVertex {
+			return vertex.requiredBy
+		}, onReady)
+	return nil
+}
+
+// run solves vertices on threads workers once all of their dependencies are done,
+// the one heading the longest remaining chain first, see jobQueue.run
+func (build *dockerBuild) run(threads int, start func(vertex *dockerVertex, slot int), finish func(vertex *dockerVertex)) error {
+	if build.jobs == nil {
+		return errNotConstructed
+	}
+	return build.jobs.run(threads, start, finish)
+}
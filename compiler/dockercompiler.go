@@ -0,0 +1,296 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/report"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// DockerCompiler pretends to run `docker build .` with BuildKit: steps of a stage run one after another, while stages
+// that do not depend on each other run in parallel. Some steps hit the cache, which finish at once and are shown as
+// CACHED, and RUN steps may run a nested build of another compiler, whose output is shown below the step
+type DockerCompiler struct {
+	build   *dockerBuild
+	bar     progressbar.ProgressBar
+	threads int
+	image   string // fully qualified tag of the image built
+	push    bool
+
+	recorder *report.Recorder
+}
+
+// bounds of the rate of cache hits, picked at random for every build
+const (
+	dockerCacheHitMin = 0.5
+	dockerCacheHitMax = 0.95
+)
+
+func NewDockerCompiler(path string, config *util.Config, sourceType SourceType, threads int) (*DockerCompiler, error) {
+	if threads <= 0 {
+		return nil, errors.New("DockerCompiler: threads should be a positive number")
+	}
+	build, err := newDockerBuild(path, config, sourceType)
+	if err != nil {
+		return nil, err
+	}
+	return &DockerCompiler{
+		build:   build,
+		threads: threads,
+		image:   dockerImage(build.name),
+	}, nil
+}
+
+// SetNested makes RUN steps whose command contains text run the build of config instead of a made-up command,
+// e.g. "cargo build" with a config of cargo. Docker and multi configs can not be nested
+func (compiler *DockerCompiler) SetNested(text string, config *util.Config) error {
+	n, err := compiler.build.setNested(text, config)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no RUN step runs %q", text)
+	}
+	// loaded once to report a broken config early
+	_, err = New(config.CompilerType, "", config, SourceTypeConfig, compiler.threads, util.TraverseOptions{})
+	return err
+}
+
+// SetImage sets the tag of the image built, e.g. user/app:1.0, empty to keep the name of the directory,
+// and whether it is pushed after it is exported
+func (compiler *DockerCompiler) SetImage(tag string, push bool) {
+	if tag != "" {
+		compiler.image = dockerImage(tag)
+	}
+	compiler.push = push
+	if asDocker, ok := compiler.bar.(*progressbar.DockerProgressBar); ok {
+		asDocker.SetBuild(compiler.describeBuild())
+	}
+}
+
+func (compiler *DockerCompiler) describeBuild() progressbar.DockerBuild {
+	return progressbar.DockerBuild{
+		Dockerfile: compiler.build.dockerfile,
+		Context:    compiler.build.context,
+		Image:      compiler.image,
+		Push:       compiler.push,
+	}
+}
+
+func (compiler *DockerCompiler) start(vertex *dockerVertex, slot int) {
+	if vertex.cached {
+		if asFresh, ok := compiler.bar.(progressbar.FreshTaskHandler); ok {
+			asFresh.TaskFresh(vertex.String())
+		}
+		return
+	}
+	compiler.recorder.Start(vertex, vertex.String(), slot)
+	compiler.bar.TaskStart(vertex.String())
+	if vertex.step != nil && vertex.step.nested != nil {
+		compiler.runNested(vertex)
+	} else {
+		ms := vertex.ms
+		if vertex.kind == "export" && compiler.push {
+			ms += dockerPushMs
+		}
+		ms = max(util.GetRandomFromDistribution(ms, ms/4), 5)
+		compiler.runCommand(vertex, time.Duration(ms)*time.Millisecond)
+	}
+	compiler.recorder.Complete(vertex)
+}
+
+func (compiler *DockerCompiler) finish(vertex *dockerVertex) {
+	if !vertex.cached {
+		compiler.bar.TaskComplete(vertex.String())
+	}
+}
+
+// taskLog returns the function that adds output lines of vertex to the bar, nil if the bar does not show them
+func (compiler *DockerCompiler) taskLog(vertex *dockerVertex) func(line string) {
+	asDocker, ok := compiler.bar.(*progressbar.DockerProgressBar)
+	if !ok {
+		return nil
+	}
+	return func(line string) {
+		asDocker.TaskLog(vertex.String(), line)
+	}
+}
+
+// runCommand waits for d, while the made-up output of a RUN step is written evenly
+func (compiler *DockerCompiler) runCommand(vertex *dockerVertex, d time.Duration) {
+	taskLog := compiler.taskLog(vertex)
+	var lines []string
+	if vertex.step != nil && vertex.step.instruction == "RUN" && taskLog != nil {
+		lines = dockerRunOutput(vertex.step.command(), d)
+	}
+	interval := d / time.Duration(len(lines)+1)
+	for _, line := range lines {
+		time.Sleep(interval)
+		taskLog(line)
+	}
+	time.Sleep(interval)
+}
+
+// runNested runs the nested build of a RUN step, its output is written in the style of its compiler
+func (compiler *DockerCompiler) runNested(vertex *dockerVertex) {
+	config := vertex.step.nested
+	nested, err := New(config.CompilerType, "", config, SourceTypeConfig, compiler.threads, util.TraverseOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	nested.SetProgressBar(progressbar.NewLogProgressBar(config.CompilerType, config.Metadata.Source, compiler.taskLog(vertex)))
+	nested.Run()
+}
+
+func (compiler *DockerCompiler) Run() {
+	compiler.build.resetCache(util.GetRandomUniformDistribution(dockerCacheHitMin, dockerCacheHitMax))
+
+	compiler.bar.Prologue()
+
+	compiler.recorder.Begin(compiler.threads)
+	err := compiler.build.schedule(func(vertex *dockerVertex) {
+		if !vertex.cached {
+			compiler.recorder.Ready(vertex)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = compiler.build.run(compiler.threads, compiler.start, compiler.finish)
+	if err != nil {
+		log.Fatal(err)
+	}
+	compiler.recorder.Finish()
+
+	compiler.bar.Epilogue()
+}
+
+func (compiler *DockerCompiler) SetRecorder(recorder *report.Recorder) {
+	compiler.recorder = recorder
+}
+
+func (compiler *DockerCompiler) SetProgressBar(bar progressbar.ProgressBar) {
+	compiler.bar = bar
+
+	var totalTasks []string
+	for _, vertex := range compiler.build.vertices {
+		totalTasks = append(totalTasks, vertex.String())
+	}
+	compiler.bar.SetTotalTasks(totalTasks)
+
+	if asDocker, ok := compiler.bar.(*progressbar.DockerProgressBar); ok {
+		asDocker.SetBuild(compiler.describeBuild())
+	}
+}
+
+func (compiler *DockerCompiler) DumpConfig(path string, compression util.Compression) error {
+	b, err := compiler.build.dumpConfig()
+	if err != nil {
+		return err
+	}
+	return util.DumpConfigFile(path, &util.Config{
+		CompilerType:        "docker",
+		Compression:         compression,
+		UncompressedContent: b,
+		Metadata: util.ConfigMetadata{
+			Source: compiler.build.name,
+			Tasks:  len(compiler.build.vertices),
+		},
+	})
+}
+
+// crates compiled by a made-up `cargo build`
+var dockerCrates = []string{"proc-macro2", "unicode-ident", "libc", "cfg-if", "quote", "syn", "serde", "memchr", "once_cell",
+	"log", "bytes", "itoa", "pin-project-lite", "smallvec", "tokio", "serde_json", "anyhow", "tracing", "hyper", "clap"}
+
+// dockerRunOutput makes up the output of a RUN command by the tools it runs: apt-get, apk, pip, npm and cargo,
+// d is how long the command runs
+func dockerRunOutput(command string, d time.Duration) []string {
+	version := func() string {
+		return fmt.Sprintf("%d.%d.%d", rand.Intn(3), rand.Intn(30), rand.Intn(20))
+	}
+	// packages are the words after the subcommand, except options and variables
+	packages := func(words []string) []string {
+		var names []string
+		for _, word := range words {
+			if !strings.HasPrefix(word, "-") && !strings.HasPrefix(word, "$") {
+				names = append(names, strings.Trim(word, `"'`))
+			}
+		}
+		return names
+	}
+
+	var lines []string
+	replacer := strings.NewReplacer("&&", ";", "||", ";", "\n", ";")
+	for _, segment := range strings.Split(replacer.Replace(command), ";") {
+		words := strings.Fields(segment)
+		if len(words) > 0 && words[0] == "sudo" {
+			words = words[1:]
+		}
+		if len(words) < 2 {
+			continue
+		}
+		tool, subcommand := path.Base(words[0]), words[1]
+		switch {
+		case (tool == "apt-get" || tool == "apt") && subcommand == "update":
+			lines = append(lines,
+				"Get:1 http://deb.debian.org/debian bookworm InRelease [151 kB]",
+				"Get:2 http://deb.debian.org/debian bookworm-updates InRelease [55.4 kB]",
+				"Get:3 http://deb.debian.org/debian-security bookworm-security InRelease [48.0 kB]",
+				"Get:4 http://deb.debian.org/debian bookworm/main amd64 Packages [8792 kB]",
+				fmt.Sprintf("Fetched 9047 kB in %ds (%d kB/s)", rand.Intn(3)+1, rand.Intn(4000)+2000),
+				"Reading package lists...")
+		case (tool == "apt-get" || tool == "apt") && subcommand == "install":
+			names := packages(words[2:])
+			lines = append(lines, "Reading package lists...", "Building dependency tree...", "Reading state information...",
+				"The following NEW packages will be installed:", "  "+strings.Join(names, " "),
+				fmt.Sprintf("0 upgraded, %d newly installed, 0 to remove and 0 not upgraded.", len(names)))
+			for i, name := range names {
+				lines = append(lines, fmt.Sprintf("Get:%d http://deb.debian.org/debian bookworm/main amd64 %s amd64 %s [%d kB]", i+1, name, version(), rand.Intn(2000)+20))
+			}
+			for _, name := range names {
+				lines = append(lines, "Selecting previously unselected package "+name+".", fmt.Sprintf("Setting up %s (%s) ...", name, version()))
+			}
+		case tool == "apk" && subcommand == "add":
+			names := packages(words[2:])
+			lines = append(lines, "fetch https://dl-cdn.alpinelinux.org/alpine/v3.19/main/x86_64/APKINDEX.tar.gz",
+				"fetch https://dl-cdn.alpinelinux.org/alpine/v3.19/community/x86_64/APKINDEX.tar.gz")
+			for i, name := range names {
+				lines = append(lines, fmt.Sprintf("(%d/%d) Installing %s (%s-r0)", i+1, len(names), name, version()))
+			}
+			lines = append(lines, fmt.Sprintf("OK: %d MiB in %d packages", rand.Intn(200)+20, len(names)+15))
+		case strings.HasPrefix(tool, "pip") && subcommand == "install":
+			names := packages(words[2:])
+			if strings.Contains(segment, "-r ") || len(names) == 0 {
+				names = []string{"requests", "charset-normalizer", "idna", "urllib3", "certifi"}
+			}
+			var installed []string
+			for _, name := range names {
+				name, _, _ = strings.Cut(name, "=")
+				v := version()
+				lines = append(lines, "Collecting "+name, fmt.Sprintf("  Downloading %s-%s-py3-none-any.whl (%d kB)", strings.ReplaceAll(name, "-", "_"), v, rand.Intn(500)+10))
+				installed = append(installed, name+"-"+v)
+			}
+			lines = append(lines, "Installing collected packages: "+strings.Join(names, ", "), "Successfully installed "+strings.Join(installed, " "))
+		case tool == "npm" && (subcommand == "ci" || subcommand == "install" || subcommand == "i"):
+			n := rand.Intn(800) + 50
+			lines = append(lines, fmt.Sprintf("added %d packages, and audited %d packages in %ds", n, n+1, rand.Intn(20)+3), "",
+				fmt.Sprintf("%d packages are looking for funding", n/6), "  run `npm fund` for details", "", "found 0 vulnerabilities")
+		case tool == "cargo" && subcommand == "build":
+			lines = append(lines, "    Updating crates.io index", " Downloading crates ...")
+			for _, name := range dockerCrates {
+				lines = append(lines, "   Compiling "+name+" v"+version())
+			}
+			lines = append(lines, fmt.Sprintf("    Finished `release` profile [optimized] target(s) in %.2fs", d.Seconds()))
+		}
+	}
+	return lines
+}
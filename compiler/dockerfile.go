@@ -0,0 +1,225 @@
+package compiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// dockerInstruction is an instruction of a Dockerfile, with continuation lines joined
+type dockerInstruction struct {
+	line    int    // 1-based line number where it starts
+	keyword string // upper case, e.g. RUN
+	args    string // as written, continuations joined without the escape character and newline
+	heredoc []string
+}
+
+var (
+	dockerDirective = regexp.MustCompile(`^#\s*([a-zA-Z]+)\s*=\s*(\S+)\s*$`)
+	dockerHeredoc   = regexp.MustCompile(`<<(-?)(["']?)([A-Za-z_][A-Za-z0-9_]*)(["']?)`)
+)
+
+// parseDockerfile splits src into instructions, comments and empty lines are dropped.
+// The escape parser directive is honoured, and the bodies of heredocs (<<EOF) are read into instructions
+func parseDockerfile(src string) ([]dockerInstruction, error) {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	escape := `\`
+
+	// parser directives are comments at the very beginning
+	i := 0
+	for ; i < len(lines); i++ {
+		match := dockerDirective.FindStringSubmatch(lines[i])
+		if match == nil {
+			break
+		}
+		if strings.EqualFold(match[1], "escape") {
+			if match[2] != `\` && match[2] != "`" {
+				return nil, fmt.Errorf("line %d: invalid escape character %q, should be \\ or `", i+1, match[2])
+			}
+			escape = match[2]
+		}
+	}
+
+	var instructions []dockerInstruction
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		start := i
+		text := strings.TrimLeft(lines[i], " \t")
+		// comments and empty lines within continuations are skipped
+		for strings.HasSuffix(strings.TrimRight(text, " \t"), escape) && i+1 < len(lines) {
+			text = strings.TrimSuffix(strings.TrimRight(text, " \t"), escape)
+			i++
+			for i+1 < len(lines) && (strings.TrimSpace(lines[i]) == "" || strings.HasPrefix(strings.TrimSpace(lines[i]), "#")) {
+				i++
+			}
+			text += lines[i]
+		}
+		text = strings.TrimSuffix(strings.TrimRight(text, " \t"), escape)
+
+		keyword, args, _ := strings.Cut(text, " ")
+		if tab := strings.IndexByte(keyword, '\t'); tab >= 0 {
+			keyword, args = keyword[:tab], keyword[tab+1:]+" "+args
+		}
+		instruction := dockerInstruction{
+			line:    start + 1,
+			keyword: strings.ToUpper(keyword),
+			args:    strings.TrimSpace(args),
+		}
+		if !isDockerKeyword(instruction.keyword) {
+			return nil, fmt.Errorf("line %d: unknown instruction: %s", start+1, keyword)
+		}
+
+		// heredocs follow the instruction, one after another
+		if instruction.keyword == "RUN" || instruction.keyword == "COPY" || instruction.keyword == "ADD" {
+			for _, match := range dockerHeredoc.FindAllStringSubmatch(instruction.args, -1) {
+				strip, word := match[1] == "-", match[3]
+				closed := false
+				for i+1 < len(lines) {
+					i++
+					line := lines[i]
+					if strip {
+						line = strings.TrimLeft(line, "\t")
+					}
+					if line == word {
+						closed = true
+						break
+					}
+					instruction.heredoc = append(instruction.heredoc, line)
+				}
+				if !closed {
+					return nil, fmt.Errorf("line %d: unterminated heredoc %s", start+1, word)
+				}
+			}
+		}
+		instructions = append(instructions, instruction)
+	}
+	return instructions, nil
+}
+
+func isDockerKeyword(keyword string) bool {
+	switch keyword {
+	case "FROM", "RUN", "CMD", "LABEL", "MAINTAINER", "EXPOSE", "ENV", "ADD", "COPY", "ENTRYPOINT", "VOLUME",
+		"USER", "WORKDIR", "ARG", "ONBUILD", "STOPSIGNAL", "HEALTHCHECK", "SHELL":
+		return true
+	}
+	return false
+}
+
+// display returns the instruction as shown by BuildKit, a heredoc is shown by its first line, e.g. RUN <<EOF (apt-get update)...
+func (instruction *dockerInstruction) display() string {
+	s := instruction.keyword + " " + instruction.args
+	if len(instruction.heredoc) > 0 {
+		s += " (" + strings.TrimSpace(instruction.heredoc[0]) + ")"
+		if len(instruction.heredoc) > 1 {
+			s += "..."
+		}
+	}
+	return s
+}
+
+// dockerFlags splits the leading --name=value or --name flags of args from the rest
+func dockerFlags(args string) (flags map[string]string, rest string) {
+	flags = make(map[string]string)
+	rest = args
+	for strings.HasPrefix(rest, "--") {
+		word, after, _ := strings.Cut(rest, " ")
+		name, value, _ := strings.Cut(strings.TrimPrefix(word, "--"), "=")
+		flags[name] = value
+		rest = strings.TrimLeft(after, " \t")
+	}
+	return flags, rest
+}
+
+// dockerSources returns the sources of COPY or ADD arguments without flags, the last word is the destination
+func dockerSources(args string) []string {
+	var words []string
+	if strings.HasPrefix(args, "[") {
+		// json form: ["src", "dest"]
+		for _, word := range strings.Split(strings.Trim(args, "[] "), ",") {
+			words = append(words, strings.Trim(strings.TrimSpace(word), `"`))
+		}
+	} else {
+		words = strings.Fields(args)
+	}
+	if len(words) < 2 {
+		return nil
+	}
+	return words[:len(words)-1]
+}
+
+// expandDockerVariables expands $NAME, ${NAME}, ${NAME:-default} and ${NAME:+value} with variables,
+// unknown variables are empty
+func expandDockerVariables(s string, variables map[string]string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		if s[i+1] == '{' {
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				b.WriteString(s[i:])
+				break
+			}
+			expr := s[i+2 : i+end]
+			name, word, modifier := expr, "", ""
+			if j := strings.Index(expr, ":"); j >= 0 && j+1 < len(expr) {
+				name, modifier, word = expr[:j], expr[j+1:j+2], expr[j+2:]
+			}
+			value, ok := variables[name]
+			switch {
+			case modifier == "-" && (!ok || value == ""):
+				value = word
+			case modifier == "+":
+				if ok && value != "" {
+					value = word
+				}
+			}
+			b.WriteString(value)
+			i += end
+			continue
+		}
+		j := i + 1
+		for j < len(s) && (s[j] == '_' || 'a' <= s[j] && s[j] <= 'z' || 'A' <= s[j] && s[j] <= 'Z' || '0' <= s[j] && s[j] <= '9') {
+			j++
+		}
+		if j == i+1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		b.WriteString(variables[s[i+1:j]])
+		i = j - 1
+	}
+	return b.String()
+}
+
+// dockerImage returns the fully qualified reference of image, e.g. rust:1.77 -> docker.io/library/rust:1.77,
+// ghcr.io/foo/bar -> ghcr.io/foo/bar:latest
+func dockerImage(image string) string {
+	name, digest, _ := strings.Cut(image, "@")
+	tag := ""
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	first, _, found := strings.Cut(name, "/")
+	switch {
+	case !found:
+		name = "docker.io/library/" + name
+	case !strings.ContainsAny(first, ".:") && first != "localhost":
+		name = "docker.io/" + name
+	}
+	if tag == "" && digest == "" {
+		tag = "latest"
+	}
+	if tag != "" {
+		name += ":" + tag
+	}
+	if digest != "" {
+		name += "@" + digest
+	}
+	return name
+}
@@ -0,0 +1,244 @@
+package compiler
+
+import (
+	"math"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// Estimator is implemented by compilers that can estimate how long `Run()` takes, by expected values of
+// the random distributions they use
+type Estimator interface {
+	Estimate() time.Duration
+}
+
+func (compiler *CXXCompiler) Estimate() time.Duration {
+	// see compileCode
+	var totalMs float64
+	for _, src := range compiler.dependency.sources {
+		totalMs += 42*4.2 + max(float64(src.Size)/10, 42)
+	}
+	// tasks are issued one by one every 5ms
+	issueMs := float64(compiler.dependency.len()) * 5
+	return time.Duration(max(totalMs/float64(compiler.threads), issueMs)) * time.Millisecond
+}
+
+func (compiler *CargoCompiler) Estimate() time.Duration {
+	// see initRNGParameters and compile, uniform distributions are replaced by their means
+	packages := compiler.project.packages
+	x, r := 0, 0
+	for _, pack := range packages {
+		x = max(x, pack.numDependencies)
+		r = max(r, len(pack.requiredBy))
+	}
+	h := (math.E + math.Pi) / 2
+	l := (math.SqrtE + math.SqrtPi) / 2
+	hDep := h * (1 - math.Pow(math.E, -0.5*(float64(x)+1)))
+	hReq := h * (1 - math.Pow(math.E, -0.5*(float64(r)+1)))
+
+	var totalMs float64
+	t := float64(len(packages))
+	for i, pack := range packages {
+		ms := 102 / 0.42
+		ms *= expectedOverhead(hDep, l, float64(pack.numDependencies), float64(x))
+		ms *= expectedOverhead(hReq, l, float64(len(pack.requiredBy)), float64(r))
+		ms *= expectedOverhead(h, l, float64(i), t)
+		totalMs += ms
+	}
+
+	// packages on the longest dependency chain can not be compiled in parallel
+	depth := 0
+	for _, d := range criticalPath(packages, func(pack *cargoPackage) []*cargoPackage {
+		return pack.dependencies
+	}) {
+		depth = max(depth, d)
+	}
+	chainMs := totalMs / t * float64(depth)
+	return time.Duration(max(totalMs/float64(compiler.threads), chainMs)) * time.Millisecond
+}
+
+func (compiler *NodeCompiler) Estimate() time.Duration {
+	// see install, the cache hit rate is replaced by its mean
+	packages := compiler.project.packages
+	packMs := nodeCacheHitAvg*nodeCacheMs + (1-nodeCacheHitAvg)*nodeFetchMs + nodeLinkMs
+	totalMs := packMs * float64(len(packages))
+
+	// packages on the longest dependency chain can not be linked in parallel
+	depth := 0
+	for _, d := range criticalPath(packages, func(pack *nodePackage) []*nodePackage {
+		return pack.dependencies
+	}) {
+		depth = max(depth, d)
+	}
+	return time.Duration(max(totalMs/float64(compiler.threads), packMs*float64(depth))) * time.Millisecond
+}
+
+func (compiler *BundleCompiler) Estimate() time.Duration {
+	// see transform, modules are issued one by one every 1ms
+	var totalMs float64
+	for _, module := range compiler.project.build {
+		totalMs += max(bundleTransformMs+float64(module.Size)/bundleBytesPerMs, 5)
+	}
+	issueMs := float64(len(compiler.project.build))
+	return time.Duration(max(totalMs/float64(compiler.threads), issueMs)) * time.Millisecond
+}
+
+func (compiler *PipCompiler) Estimate() time.Duration {
+	// see collect, building wheels of sdists afterwards is not included
+	packages := compiler.project.packages
+	var totalMs float64
+	for _, pack := range packages {
+		totalMs += pipIndexMs + float64(pack.size)/pipBandwidthAvg
+		if pack.sdist() {
+			totalMs += pipPrepareMs
+		}
+	}
+
+	// packages on the longest requirement chain can not be collected in parallel
+	depth := 0
+	for _, d := range criticalPath(packages, func(pack *pipPackage) []*pipPackage {
+		return pack.dependencies
+	}) {
+		depth = max(depth, d)
+	}
+	chainMs := totalMs / float64(len(packages)) * float64(depth)
+	return time.Duration(max(totalMs/float64(compiler.threads), chainMs)) * time.Millisecond
+}
+
+func (compiler *JvmCompiler) Estimate() time.Duration {
+	tasks := compiler.project.tasks
+	var totalMs float64
+	for _, task := range tasks {
+		totalMs += task.ms
+	}
+	// the longest chain of tasks weighted by their time, e.g. compiling a module after its dependencies
+	chainMs := longestChain(tasks, func(task *jvmTask) []*jvmTask {
+		return task.dependencies
+	}, func(task *jvmTask) float64 {
+		return task.ms
+	})
+	return time.Duration(max(totalMs/float64(compiler.threads), chainMs)) * time.Millisecond
+}
+
+func (compiler *BazelCompiler) Estimate() time.Duration {
+	// remote cache hits are not known until Run, the average rate is assumed
+	hitRate := (bazelCacheHitMin + bazelCacheHitMax) / 2
+	actions := compiler.workspace.actions
+	var totalMs float64
+	for _, action := range actions {
+		totalMs += action.ms * (1 - hitRate)
+	}
+	chainMs := longestChain(actions, func(action *bazelAction) []*bazelAction {
+		return action.dependencies
+	}, func(action *bazelAction) float64 {
+		return action.ms * (1 - hitRate)
+	})
+	return time.Duration(max(totalMs/float64(compiler.threads), chainMs)) * time.Millisecond
+}
+
+func (compiler *TestCompiler) Estimate() time.Duration {
+	threads := float64(compiler.threads)
+	// the time of tests run one after another, and that of tests run in parallel
+	sequential := func(tests []*testCase) float64 {
+		var ms float64
+		for _, test := range tests {
+			ms += test.ms
+		}
+		return ms
+	}
+	parallel := func(tests []*testCase) float64 {
+		var longest float64
+		for _, test := range tests {
+			longest = max(longest, test.ms)
+		}
+		return max(sequential(tests)/threads, longest)
+	}
+
+	project := compiler.project
+	var totalMs float64
+	switch project.runner {
+	case "cargo":
+		for _, suite := range project.suites {
+			totalMs += parallel(suite.tests)
+		}
+	case "go":
+		// packages run in parallel, the longest one ends last
+		var longest float64
+		for _, suite := range project.suites {
+			longest = max(longest, sequential(suite.tests))
+		}
+		totalMs = max(sequential(project.tests())/threads, longest)
+	case "pytest":
+		totalMs = sequential(project.tests())
+	default:
+		totalMs = parallel(project.tests())
+	}
+	return time.Duration(totalMs * float64(time.Millisecond))
+}
+
+func (compiler *DockerCompiler) Estimate() time.Duration {
+	// cache hits are not known until Run, the average rate is assumed for steps and base images
+	hitRate := (dockerCacheHitMin + dockerCacheHitMax) / 2
+	ms := func(vertex *dockerVertex) float64 {
+		switch {
+		case vertex.kind == "export" && compiler.push:
+			return vertex.ms + dockerPushMs
+		case vertex.kind == "internal" || vertex.kind == "export":
+			return vertex.ms
+		case vertex.step != nil && vertex.step.nested != nil:
+			nested, err := New(vertex.step.nested.CompilerType, "", vertex.step.nested, SourceTypeConfig, compiler.threads, util.TraverseOptions{})
+			if asEstimator, ok := nested.(Estimator); err == nil && ok {
+				return float64(asEstimator.Estimate().Milliseconds()) * (1 - hitRate)
+			}
+		}
+		return vertex.ms * (1 - hitRate)
+	}
+	// stages run in parallel, so the build takes as long as its longest chain, unless there are few threads
+	var totalMs float64
+	for _, vertex := range compiler.build.vertices {
+		totalMs += ms(vertex)
+	}
+	chainMs := longestChain(compiler.build.vertices, func(vertex *dockerVertex) []*dockerVertex {
+		return vertex.dependencies
+	}, ms)
+	return time.Duration(max(totalMs/float64(compiler.threads), chainMs)) * time.Millisecond
+}
+
+func (compiler *LatexCompiler) Estimate() time.Duration {
+	// runs are not known until NewLatexCompiler rolls the dice for a rerun, the average of both plans is assumed
+	runMs := func(rerun bool) float64 {
+		var ms float64
+		for _, run := range compiler.plan(rerun) {
+			for _, task := range run.tasks {
+				ms += latexTaskMs(task)
+				if run.program == "pdflatex" {
+					ms += float64(task.file.pages) * latexPageMs
+				}
+			}
+		}
+		return ms
+	}
+	totalMs := runMs(false)*(1-latexRerunRate) + runMs(true)*latexRerunRate
+	return time.Duration(totalMs * float64(time.Millisecond))
+}
+
+// expectedOverhead is the gaussian-shaped overhead of cargo compiler, which peaks at h when n == center,
+// and decays to l when n == 0
+func expectedOverhead(h, l, n, center float64) float64 {
+	if center == 0 {
+		return h
+	}
+	return h * math.Pow(math.E, -math.Log(h/l)*math.Pow(n-center, 2)/math.Pow(center, 2))
+}
+
+// Estimate sums up estimations of all stages
+func (compiler *MultiCompiler) Estimate() time.Duration {
+	var total time.Duration
+	for _, stage := range compiler.stages {
+		if asEstimator, ok := stage.(Estimator); ok {
+			total += asEstimator.Estimate()
+		}
+	}
+	return total
+}
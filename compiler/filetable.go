@@ -0,0 +1,39 @@
+package compiler
+
+import "fmt"
+
+// fileTable lists files by columns, the directory of each file is an index in a table of directories,
+// so that every directory is stored only once
+type fileTable struct {
+	Dir  []int    `json:"dir"` // index in the directory table
+	Name []string `json:"name"`
+	Size []int64  `json:"size"`
+}
+
+// add appends a file within dir, dir is appended to dirs on first appearance, index maps dirs to their indices.
+// Returns the updated dirs
+func (files *fileTable) add(dirs []string, index map[string]int, dir, name string, size int64) []string {
+	idx, ok := index[dir]
+	if !ok {
+		idx = len(dirs)
+		index[dir] = idx
+		dirs = append(dirs, dir)
+	}
+	files.Dir = append(files.Dir, idx)
+	files.Name = append(files.Name, name)
+	files.Size = append(files.Size, size)
+	return dirs
+}
+
+// validate checks that the columns are of the same length, and every file refers to a directory within dirs
+func (files *fileTable) validate(dirs []string) error {
+	if len(files.Name) != len(files.Dir) || len(files.Size) != len(files.Dir) {
+		return fmt.Errorf("malformed config: file table has %d dirs, %d names and %d sizes", len(files.Dir), len(files.Name), len(files.Size))
+	}
+	for i, dir := range files.Dir {
+		if dir < 0 || dir >= len(dirs) {
+			return fmt.Errorf("malformed config: file %d (%s) refers to directory %d, out of range [0, %d)", i, files.Name[i], dir, len(dirs))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,579 @@
+package compiler
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// Inspector is implemented by compilers that can summarize what they are going to compile
+type Inspector interface {
+	// Describe returns a human-readable summary of the compiling tasks, ends with newline
+	Describe() string
+}
+
+// TreeInspector is implemented by compilers whose tasks are files, which can be shown as a directory tree
+type TreeInspector interface {
+	SourceTree() *util.Directory
+}
+
+// Describe shows the size distribution of the sources
+func (compiler *CXXCompiler) Describe() string {
+	sources := compiler.dependency.sources
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "target:   %s\n", compiler.dependency.targetName)
+	if project := compiler.dependency.cmake; project != nil {
+		fmt.Fprintf(&s, "cmake:    project %s %s, languages %s\n", project.name, project.version, strings.Join(project.languages, ", "))
+		var packages []string
+		checks := 0
+		for _, probe := range project.probes {
+			switch probe.kind {
+			case "package", "pkgconfig":
+				packages = append(packages, probe.name)
+			default:
+				checks++
+			}
+		}
+		fmt.Fprintf(&s, "          %d packages, %d checks\n", len(packages), checks)
+		if len(packages) > 0 {
+			fmt.Fprintf(&s, "          %s\n", strings.Join(packages, ", "))
+		}
+	}
+	fmt.Fprintf(&s, "sources:  %d\n", len(sources))
+	if len(sources) == 0 {
+		return s.String()
+	}
+
+	sizes := make([]int64, 0, len(sources))
+	var total int64
+	for _, src := range sources {
+		sizes = append(sizes, src.Size)
+		total += src.Size
+	}
+	slices.Sort(sizes)
+	percentile := func(p float64) int64 {
+		return sizes[int(math.Ceil(p*float64(len(sizes))))-1]
+	}
+	fmt.Fprintf(&s, "size:     %s in total, %s on average\n", formatSize(total), formatSize(total/int64(len(sizes))))
+	fmt.Fprintf(&s, "          min %s, p50 %s, p90 %s, p99 %s, max %s\n",
+		formatSize(sizes[0]), formatSize(percentile(0.5)), formatSize(percentile(0.9)),
+		formatSize(percentile(0.99)), formatSize(sizes[len(sizes)-1]))
+
+	// histogram, buckets grow by power of 4 from 1 KiB
+	var buckets []int
+	for _, size := range sizes {
+		i := 0
+		for limit := int64(1024); size >= limit; limit *= 4 {
+			i++
+		}
+		for len(buckets) <= i {
+			buckets = append(buckets, 0)
+		}
+		buckets[i]++
+	}
+	most := slices.Max(buckets)
+	s.WriteString("histogram:\n")
+	for i, count := range buckets {
+		lower := "0 B"
+		if i > 0 {
+			lower = formatSize(1024 << (2 * (i - 1)))
+		}
+		width := count * 40 / most
+		if count > 0 && width == 0 {
+			width = 1
+		}
+		fmt.Fprintf(&s, "  %9s - %-9s %6d %s\n", lower, formatSize(1024<<(2*i)), count, strings.Repeat("█", width))
+	}
+	return s.String()
+}
+
+// Describe shows what is found by configuring the project, then the sources like cxx
+func (compiler *MesonCompiler) Describe() string {
+	project := compiler.project
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "project:  %s %s\n", project.name, project.version)
+	fmt.Fprintf(&s, "lang:     %s\n", strings.Join(project.languages, ", "))
+	if len(project.dependencies) > 0 {
+		s.WriteString("dependencies:\n")
+		for _, dep := range project.dependencies {
+			optional := ""
+			if !dep.required {
+				optional = " (optional)"
+			}
+			s.WriteString(strings.TrimRight(fmt.Sprintf("  %-24s %s%s", dep.name, dep.version, optional), " ") + "\n")
+		}
+	}
+	if len(project.programs) > 0 {
+		fmt.Fprintf(&s, "programs: %s\n", strings.Join(project.programs, ", "))
+	}
+	if len(project.targets) > 0 {
+		s.WriteString("targets:\n")
+		for _, target := range project.targets {
+			fmt.Fprintf(&s, "  %-24s %s\n", target.name, target.kind)
+		}
+	}
+	s.WriteString(compiler.CXXCompiler.Describe())
+	return s.String()
+}
+
+// SourceTree returns the sources as a directory tree rooted at the target
+func (compiler *CXXCompiler) SourceTree() *util.Directory {
+	var files []string
+	var sizes []int64
+	for _, src := range compiler.dependency.sources {
+		files = append(files, src.Path+"/"+src.Name)
+		sizes = append(sizes, src.Size)
+	}
+	return util.NewDirectoryFromFiles(compiler.dependency.targetName, files, sizes)
+}
+
+// Describe shows the workspace members and the shape of the dependency graph
+func (compiler *CargoCompiler) Describe() string {
+	project := compiler.project
+	edges := 0
+	for _, pack := range project.packages {
+		edges += len(pack.dependencies)
+	}
+	depth := 0
+	for _, d := range criticalPath(project.packages, func(pack *cargoPackage) []*cargoPackage {
+		return pack.dependencies
+	}) {
+		depth = max(depth, d)
+	}
+
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "workspace: %s\n", project.root())
+	fmt.Fprintf(&s, "packages:  %d\n", len(project.packages))
+	fmt.Fprintf(&s, "edges:     %d\n", edges)
+	fmt.Fprintf(&s, "depth:     %d\n", depth)
+	fmt.Fprintf(&s, "members:   %d\n", len(project.targetPackages))
+	for _, member := range project.members() {
+		fmt.Fprintf(&s, "  %s (%s)\n", member, project.targetPackages[member])
+	}
+	return s.String()
+}
+
+// DependencyGraph renders the dependencies of every workspace member like `cargo tree`,
+// packages whose dependencies are already shown are marked with "(*)"
+func (compiler *CargoCompiler) DependencyGraph() string {
+	project := compiler.project
+	s := strings.Builder{}
+	shown := make(map[*cargoPackage]bool)
+	var walk func(pack *cargoPackage, prefix string)
+	walk = func(pack *cargoPackage, prefix string) {
+		deps := slices.Clone(pack.dependencies)
+		slices.SortFunc(deps, func(a, b *cargoPackage) int {
+			return strings.Compare(a.String(), b.String())
+		})
+		for i, dep := range deps {
+			branch, indent := "├── ", "│   "
+			if i == len(deps)-1 {
+				branch, indent = "└── ", "    "
+			}
+			s.WriteString(prefix + branch + dep.String())
+			if shown[dep] && len(dep.dependencies) > 0 {
+				s.WriteString(" (*)\n")
+				continue
+			}
+			s.WriteString("\n")
+			shown[dep] = true
+			walk(dep, prefix+indent)
+		}
+	}
+	for i, member := range project.members() {
+		if i > 0 {
+			s.WriteString("\n")
+		}
+		fmt.Fprintf(&s, "%s (%s)\n", member, project.targetPackages[member])
+		shown[member] = true
+		walk(member, "")
+	}
+	return s.String()
+}
+
+// Describe shows the lockfile and the shape of the dependency graph, along with the most required packages
+func (compiler *NodeCompiler) Describe() string {
+	project := compiler.project
+	edges := 0
+	for _, pack := range project.packages {
+		edges += len(pack.dependencies)
+	}
+	depth := 0
+	for _, d := range criticalPath(project.packages, func(pack *nodePackage) []*nodePackage {
+		return pack.dependencies
+	}) {
+		depth = max(depth, d)
+	}
+
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "project:   %s\n", project.rootName)
+	fmt.Fprintf(&s, "lockfile:  %s\n", project.lockfile)
+	fmt.Fprintf(&s, "packages:  %d\n", len(project.packages))
+	fmt.Fprintf(&s, "edges:     %d\n", edges)
+	fmt.Fprintf(&s, "depth:     %d\n", depth)
+
+	popular := slices.Clone(project.packages)
+	slices.SortFunc(popular, func(a, b *nodePackage) int {
+		if n := len(b.requiredBy) - len(a.requiredBy); n != 0 {
+			return n
+		}
+		return strings.Compare(a.String(), b.String())
+	})
+	s.WriteString("most required:\n")
+	for _, pack := range popular[:min(len(popular), 5)] {
+		fmt.Fprintf(&s, "  %s (%d)\n", pack, len(pack.requiredBy))
+	}
+	return s.String()
+}
+
+// Describe shows the modules by extension and the largest directories
+func (compiler *BundleCompiler) Describe() string {
+	project := compiler.project
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "project:  %s\n", project.name)
+	fmt.Fprintf(&s, "modules:  %d\n", len(project.modules))
+
+	var total int64
+	extensions := make(map[string]int)
+	dirs := make(map[string]int64)
+	for _, module := range project.modules {
+		total += module.Size
+		extensions[path.Ext(module.Name)]++
+		dirs[module.Path] += module.Size
+	}
+	fmt.Fprintf(&s, "size:     %s in total\n", formatSize(total))
+	s.WriteString("extensions:\n")
+	for _, ext := range slices.Sorted(maps.Keys(extensions)) {
+		fmt.Fprintf(&s, "  %-5s %d\n", ext, extensions[ext])
+	}
+
+	largest := slices.Collect(maps.Keys(dirs))
+	slices.SortFunc(largest, func(a, b string) int {
+		if dirs[a] != dirs[b] {
+			return cmp.Compare(dirs[b], dirs[a])
+		}
+		return strings.Compare(a, b)
+	})
+	s.WriteString("largest directories:\n")
+	for _, dir := range largest[:min(len(largest), 5)] {
+		fmt.Fprintf(&s, "  %s (%s)\n", dir, formatSize(dirs[dir]))
+	}
+	return s.String()
+}
+
+// SourceTree returns the modules as a directory tree rooted at the project
+func (compiler *BundleCompiler) SourceTree() *util.Directory {
+	var files []string
+	var sizes []int64
+	for _, module := range compiler.project.modules {
+		files = append(files, module.String())
+		sizes = append(sizes, module.Size)
+	}
+	return util.NewDirectoryFromFiles(compiler.project.name, files, sizes)
+}
+
+// Describe shows where packages come from, the shape of the dependency graph, and the largest downloads
+func (compiler *PipCompiler) Describe() string {
+	project := compiler.project
+	edges, sdists := 0, 0
+	var total int64
+	for _, pack := range project.packages {
+		edges += len(pack.dependencies)
+		total += pack.size
+		if pack.sdist() {
+			sdists++
+		}
+	}
+	depth := 0
+	for _, d := range criticalPath(project.packages, func(pack *pipPackage) []*pipPackage {
+		return pack.dependencies
+	}) {
+		depth = max(depth, d)
+	}
+
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "project:   %s\n", project.name)
+	fmt.Fprintf(&s, "source:    %s\n", project.source)
+	fmt.Fprintf(&s, "packages:  %d, %d of them built from sdist\n", len(project.packages), sdists)
+	fmt.Fprintf(&s, "download:  %s in total\n", formatSize(total))
+	fmt.Fprintf(&s, "edges:     %d\n", edges)
+	fmt.Fprintf(&s, "depth:     %d\n", depth)
+
+	largest := slices.Clone(project.packages)
+	slices.SortFunc(largest, func(a, b *pipPackage) int {
+		if a.size != b.size {
+			return cmp.Compare(b.size, a.size)
+		}
+		return strings.Compare(a.String(), b.String())
+	})
+	s.WriteString("largest downloads:\n")
+	for _, pack := range largest[:min(len(largest), 5)] {
+		fmt.Fprintf(&s, "  %s (%s)\n", pack.file, formatSize(pack.size))
+	}
+	return s.String()
+}
+
+func (compiler *JvmCompiler) Describe() string {
+	project := compiler.project
+	edges, sources, tests := 0, 0, 0
+	var size int64
+	for _, module := range project.modules {
+		edges += len(module.dependencies)
+		sources += module.sources
+		tests += module.testSources
+		size += module.sourceSize
+	}
+	depth := 0
+	for _, d := range criticalPath(project.modules, func(module *jvmModule) []*jvmModule {
+		return module.requiredBy
+	}) {
+		depth = max(depth, d)
+	}
+
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "project:   %s (%s)\n", project.name, project.tool)
+	fmt.Fprintf(&s, "modules:   %d\n", len(project.modules))
+	fmt.Fprintf(&s, "tasks:     %d\n", len(project.tasks))
+	fmt.Fprintf(&s, "sources:   %d files, %s, and %d test files\n", sources, formatSize(size), tests)
+	fmt.Fprintf(&s, "edges:     %d\n", edges)
+	fmt.Fprintf(&s, "depth:     %d\n", depth)
+	s.WriteString("build order:\n")
+	for _, module := range project.buildOrder() {
+		fmt.Fprintf(&s, "  %s [%s]", module.path, module.packaging)
+		if module.kotlin {
+			s.WriteString(" kotlin")
+		}
+		fmt.Fprintf(&s, ", %d sources", module.sources)
+		if len(module.dependencies) > 0 {
+			var deps []string
+			for _, dep := range module.dependencies {
+				deps = append(deps, dep.path)
+			}
+			fmt.Fprintf(&s, ", depends on %s", strings.Join(deps, ", "))
+		}
+		s.WriteString("\n")
+	}
+	return s.String()
+}
+
+func (compiler *BazelCompiler) Describe() string {
+	workspace := compiler.workspace
+	edges, sources := 0, 0
+	var size int64
+	packages := make(map[string]bool)
+	kinds := make(map[string]int)
+	for _, target := range workspace.targets {
+		edges += len(target.dependencies)
+		sources += len(target.srcs)
+		for _, s := range target.sizes {
+			size += s
+		}
+		packages[target.pkg] = true
+		kinds[target.kind]++
+	}
+	depth := 0
+	for _, d := range criticalPath(workspace.actions, func(action *bazelAction) []*bazelAction {
+		return action.requiredBy
+	}) {
+		depth = max(depth, d)
+	}
+
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "workspace: %s\n", workspace.name)
+	fmt.Fprintf(&s, "packages:  %d\n", len(packages))
+	fmt.Fprintf(&s, "targets:   %d, with %d dependency edges\n", len(workspace.targets), edges)
+	fmt.Fprintf(&s, "sources:   %d files, %s\n", sources, formatSize(size))
+	fmt.Fprintf(&s, "actions:   %d\n", len(workspace.actions))
+	fmt.Fprintf(&s, "depth:     %d\n", depth)
+	s.WriteString("rule kinds:\n")
+	for _, kind := range slices.SortedFunc(maps.Keys(kinds), func(a, b string) int {
+		if kinds[a] != kinds[b] {
+			return cmp.Compare(kinds[b], kinds[a])
+		}
+		return strings.Compare(a, b)
+	}) {
+		fmt.Fprintf(&s, "  %-20s %d\n", kind, kinds[kind])
+	}
+	return s.String()
+}
+
+// Describe shows the stages of the Dockerfile, which of them are built, and the nested builds run by RUN
+func (compiler *DockerCompiler) Describe() string {
+	build := compiler.build
+	built := build.reachable()
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "image:      %s\n", compiler.image)
+	fmt.Fprintf(&s, "dockerfile: %s\n", formatSize(build.dockerfile))
+	fmt.Fprintf(&s, "context:    %s\n", formatSize(build.context))
+	fmt.Fprintf(&s, "stages:     %d, %d of them built\n", len(build.stages), len(built))
+	for _, stage := range build.stages {
+		base := stage.base
+		switch {
+		case stage.parent != nil:
+			base = stage.parent.String()
+		case base == "":
+			base = "scratch"
+		}
+		mark := " "
+		if !slices.Contains(built, stage) {
+			mark = "-"
+		}
+		fmt.Fprintf(&s, " %s %-12s from %-45s %d steps\n", mark, stage, base, len(stage.steps))
+	}
+	fmt.Fprintf(&s, "vertices:   %d\n", len(build.vertices))
+	nested := false
+	for _, stage := range build.stages {
+		for _, step := range stage.steps {
+			if step.nested == nil {
+				continue
+			}
+			if !nested {
+				s.WriteString("nested builds:\n")
+				nested = true
+			}
+			fmt.Fprintf(&s, "  [%s] RUN %s: %s\n", stage, step.command(), step.nested.CompilerType)
+		}
+	}
+	return s.String()
+}
+
+// Describe shows the runner, how tests are grouped into suites, and the slowest tests
+func (compiler *TestCompiler) Describe() string {
+	project := compiler.project
+	ignored := 0
+	for _, test := range project.tests() {
+		if test.ignored {
+			ignored++
+		}
+	}
+	groups := map[string]string{"cargo": "binaries", "go": "packages", "ctest": "suites", "pytest": "files"}
+
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "project:  %s\n", project.name)
+	fmt.Fprintf(&s, "runner:   %s\n", project.runner)
+	fmt.Fprintf(&s, "tests:    %d, %d of them ignored\n", project.len(), ignored)
+	fmt.Fprintf(&s, "%-9s %d\n", groups[project.runner]+":", len(project.suites))
+	if project.runner != "ctest" {
+		for _, suite := range project.suites {
+			name := suite.name
+			if suite.pkg != "" {
+				name = suite.pkg + " " + name
+			}
+			fmt.Fprintf(&s, "  %-40s %d\n", name, len(suite.tests))
+		}
+	}
+
+	slowest := slices.Clone(project.tests())
+	slices.SortStableFunc(slowest, func(a, b *testCase) int {
+		return cmp.Compare(b.ms, a.ms)
+	})
+	s.WriteString("slowest tests:\n")
+	for _, test := range slowest[:min(len(slowest), 5)] {
+		fmt.Fprintf(&s, "  %s (%.1fms)\n", test, test.ms)
+	}
+	return s.String()
+}
+
+// Describe shows the files in the order pdflatex reads them, the bibliography, and the runs planned by latexmk
+func (compiler *LatexCompiler) Describe() string {
+	document := compiler.document
+	var images int
+	var imageSize int64
+	var references []string
+	for _, file := range document.files {
+		for _, image := range file.images {
+			images++
+			imageSize += image.size
+		}
+		for _, r := range file.references {
+			if !slices.Contains(references, r.key) {
+				references = append(references, r.key)
+			}
+		}
+	}
+
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "document:     %s.tex, class %s\n", document.name, document.class)
+	fmt.Fprintf(&s, "packages:     %s\n", strings.Join(document.packages, ", "))
+	fmt.Fprintf(&s, "pages:        %d\n", document.pages())
+	fmt.Fprintf(&s, "images:       %d, %s\n", images, formatSize(imageSize))
+	s.WriteString("files:\n")
+	for _, file := range document.files {
+		fmt.Fprintf(&s, "  %s%-*s %s, %d pages\n", strings.Repeat("  ", file.depth), 40-2*file.depth, file.path, formatSize(file.size), file.pages)
+	}
+	if len(document.bibliography) > 0 {
+		program, style := "bibtex", document.bibStyle
+		if document.biber {
+			program = "biber"
+		}
+		if style != "" {
+			program += ", style " + style
+		}
+		fmt.Fprintf(&s, "bibliography: %s\n", program)
+		for _, file := range document.bibliography {
+			fmt.Fprintf(&s, "  %-40s %d entries\n", file.path, len(file.entries))
+		}
+	}
+	var undefined []string
+	for _, key := range document.cited() {
+		if !document.defined(key) {
+			undefined = append(undefined, key)
+		}
+	}
+	fmt.Fprintf(&s, "citations:    %d, %d of them undefined %v\n", len(document.cited()), len(undefined), undefined)
+	undefined = nil
+	for _, key := range references {
+		if !slices.Contains(document.labels, key) {
+			undefined = append(undefined, key)
+		}
+	}
+	fmt.Fprintf(&s, "labels:       %d\n", len(document.labels))
+	fmt.Fprintf(&s, "references:   %d, %d of them undefined %v\n", len(references), len(undefined), undefined)
+	fmt.Fprintf(&s, "runs:         %s\n", strings.Join(document.plan(false), ", "))
+	return s.String()
+}
+
+// Describe shows every stage in order
+func (compiler *MultiCompiler) Describe() string {
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "stages:   %d\n", len(compiler.stages))
+	for i, stage := range compiler.stages {
+		fmt.Fprintf(&s, "\nstage %d: %s\n", i, compiler.types[i])
+		if asInspector, ok := stage.(Inspector); ok {
+			s.WriteString(asInspector.Describe())
+		}
+	}
+	return s.String()
+}
+
+// members returns the workspace members sorted by name
+func (project *cargoProject) members() []*cargoPackage {
+	var members []*cargoPackage
+	for pack := range project.targetPackages {
+		members = append(members, pack)
+	}
+	slices.SortFunc(members, func(a, b *cargoPackage) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	return members
+}
+
+func formatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	value := float64(size)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
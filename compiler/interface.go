@@ -1,6 +1,10 @@
 package compiler
 
-import "github.com/rizutazu/fake-compiler/progressbar"
+import (
+	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/report"
+	"github.com/rizutazu/fake-compiler/util"
+)
 
 type SourceType uint16
 
@@ -10,5 +14,21 @@ const SourceTypeConfig SourceType = 514
 type Compiler interface {
 	Run()
 	SetProgressBar(bar progressbar.ProgressBar)
-	DumpConfig(path string) error
+	SetRecorder(recorder *report.Recorder) // record timing of every task, nil to disable
+	DumpConfig(path string, compression util.Compression) error
+}
+
+// IncrementalCompiler is implemented by compilers that can simulate an incremental rebuild
+type IncrementalCompiler interface {
+	// SetChangedFiles restricts the build to what is affected by files,
+	// which are slash-separated paths relative to the root of the compiled directory
+	SetChangedFiles(files []string) error
+}
+
+// Tester is implemented by compilers that run tests, which fail as configured
+type Tester interface {
+	// SetFailures makes tests matching any glob of failing fail, and those matching flaky fail at random
+	SetFailures(failing, flaky []string) error
+	// ExitCode returns the exit status of the test runner of the last run, 0 if all tests passed
+	ExitCode() int
 }
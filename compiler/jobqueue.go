@@ -0,0 +1,303 @@
+package compiler
+
+import (
+	"container/heap"
+	"errors"
+	"math/rand"
+	"slices"
+	"sync"
+
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// jobQueue hands out nodes of a dependency graph once all of their dependencies are committed
+//
+// it mimics cargo's job queue: among the ready nodes, the one that heads the longest remaining
+// dependency chain is issued first, so that the critical path of the build never waits behind leaf nodes
+type jobQueue[T comparable] struct {
+	lock       *sync.Mutex
+	cond       *sync.Cond
+	ready      *readyHeap[T]
+	pending    map[T]int // number of uncommitted dependencies
+	priority   map[T]int // length of the longest chain of dependents starting from the node, itself included
+	requiredBy func(node T) []T
+	onReady    func(node T) // optional, invoked with the lock held
+	total      int
+	issued     int
+	complete   int
+}
+
+func newJobQueue[T comparable](nodes []T, dependencies, requiredBy func(node T) []T, onReady func(node T)) *jobQueue[T] {
+	queue := &jobQueue[T]{
+		lock:       new(sync.Mutex),
+		ready:      new(readyHeap[T]),
+		pending:    make(map[T]int),
+		priority:   criticalPath(nodes, requiredBy),
+		requiredBy: requiredBy,
+		onReady:    onReady,
+		total:      len(nodes),
+	}
+	queue.cond = sync.NewCond(queue.lock)
+	for _, node := range nodes {
+		queue.pending[node] = len(dependencies(node))
+		if queue.pending[node] == 0 {
+			queue.push(node)
+		}
+	}
+	return queue
+}
+
+// criticalPath computes the length of the longest chain of dependents of each node,
+// nodes within a cycle are never reached and get 0
+func criticalPath[T comparable](nodes []T, requiredBy func(node T) []T) map[T]int {
+	// reversed Kahn's algorithm: start from nodes that nobody requires
+	priority := make(map[T]int)
+	remaining := make(map[T]int)
+	var stack []T
+	for _, node := range nodes {
+		remaining[node] = len(requiredBy(node))
+		if remaining[node] == 0 {
+			stack = append(stack, node)
+		}
+	}
+	// inverse of requiredBy
+	dependencies := make(map[T][]T)
+	for _, node := range nodes {
+		for _, req := range requiredBy(node) {
+			dependencies[req] = append(dependencies[req], node)
+		}
+	}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		longest := 0
+		for _, req := range requiredBy(node) {
+			longest = max(longest, priority[req])
+		}
+		priority[node] = longest + 1
+		for _, dep := range dependencies[node] {
+			remaining[dep]--
+			if remaining[dep] == 0 {
+				stack = append(stack, dep)
+			}
+		}
+	}
+	return priority
+}
+
+// findCycle returns indices of nodes on a dependency cycle of a graph of n nodes, the first one is repeated at the end,
+// nil if the graph is acyclic. Indices returned by dependencies are assumed to be in range
+func findCycle(n int, dependencies func(i int) []int) []int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, n)
+	var path []int
+	// iterative dfs, dependency chains can be long
+	type frame struct {
+		node int
+		next int // next dependency to visit
+	}
+	for root := range n {
+		if state[root] != unvisited {
+			continue
+		}
+		stack := []frame{{node: root}}
+		state[root] = visiting
+		path = append(path[:0], root)
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			deps := dependencies(top.node)
+			if top.next == len(deps) {
+				state[top.node] = visited
+				stack = stack[:len(stack)-1]
+				path = path[:len(path)-1]
+				continue
+			}
+			dep := deps[top.next]
+			top.next++
+			switch state[dep] {
+			case visiting:
+				start := slices.Index(path, dep)
+				return append(slices.Clone(path[start:]), dep)
+			case unvisited:
+				state[dep] = visiting
+				stack = append(stack, frame{node: dep})
+				path = append(path, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// longestChain returns the largest sum of weights along a chain of dependencies, the graph must be acyclic
+func longestChain[T comparable](nodes []T, dependencies func(node T) []T, weight func(node T) float64) float64 {
+	chain := make(map[T]float64)
+	var visit func(node T) float64
+	visit = func(node T) float64 {
+		if w, ok := chain[node]; ok {
+			return w
+		}
+		longest := 0.0
+		for _, dep := range dependencies(node) {
+			longest = max(longest, visit(dep))
+		}
+		chain[node] = longest + weight(node)
+		return chain[node]
+	}
+	longest := 0.0
+	for _, node := range nodes {
+		longest = max(longest, visit(node))
+	}
+	return longest
+}
+
+// breakCycles drops edges between members of every dependency cycle, so that they are built together,
+// edges returns pointers to the dependencies and dependents of a node
+func breakCycles[T comparable](nodes []T, edges func(node T) (dependencies, requiredBy *[]T)) {
+	for _, component := range util.Kosaraju(nodes,
+		func(node T) []T {
+			_, requiredBy := edges(node)
+			return *requiredBy
+		},
+		func(node T) []T {
+			dependencies, _ := edges(node)
+			return *dependencies
+		}) {
+		inComponent := func(other T) bool {
+			return slices.Contains(component, other)
+		}
+		for _, node := range component {
+			dependencies, requiredBy := edges(node)
+			*dependencies = slices.DeleteFunc(*dependencies, inComponent)
+			*requiredBy = slices.DeleteFunc(*requiredBy, inComponent)
+		}
+	}
+}
+
+func (queue *jobQueue[T]) push(node T) {
+	if queue.onReady != nil {
+		queue.onReady(node)
+	}
+	// random tie-breaker, otherwise nodes of the same priority always come in the same order
+	heap.Push(queue.ready, readyItem[T]{node: node, priority: queue.priority[node], tie: rand.Int()})
+}
+
+// next blocks until a node is ready, returns errEOF if every node has been issued
+func (queue *jobQueue[T]) next() (node T, err error) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	for queue.ready.Len() == 0 {
+		if queue.issued == queue.total {
+			return node, errEOF
+		}
+		if queue.issued == queue.complete {
+			// nothing is running, so nothing will ever become ready
+			return node, errDeadlock
+		}
+		queue.cond.Wait()
+	}
+	node = heap.Pop(queue.ready).(readyItem[T]).node
+	queue.issued++
+	return node, nil
+}
+
+// commit marks the node as finished, dependents whose dependencies are all committed become ready
+func (queue *jobQueue[T]) commit(node T) {
+	queue.lock.Lock()
+	queue.complete++
+	for _, req := range queue.requiredBy(node) {
+		queue.pending[req]--
+		if queue.pending[req] == 0 {
+			queue.push(req)
+		}
+	}
+	queue.cond.Broadcast()
+	queue.lock.Unlock()
+}
+
+// run issues ready nodes to threads workers until every node is committed, start runs the node on the worker
+// numbered slot, finish is called one node at a time after the node is committed.
+// A worker is only handed a node when a job token is available, the token is released after finish,
+// so that nodes that become ready by the commit are taken into account
+func (queue *jobQueue[T]) run(threads int, start func(node T, slot int), finish func(node T)) error {
+	issue := make(chan T)
+	done := make(chan T)
+	slots := make(chan struct{}, threads) // job tokens
+	wg := new(sync.WaitGroup)
+
+	for slot := range threads {
+		go func() {
+			for node := range issue {
+				start(node, slot)
+				done <- node
+			}
+		}()
+	}
+	go func() {
+		for node := range done {
+			queue.commit(node)
+			finish(node)
+			<-slots
+			wg.Done()
+		}
+	}()
+
+	var err error
+	for {
+		slots <- struct{}{} // wait for a free job slot
+		var node T
+		node, err = queue.next()
+		if err != nil {
+			break
+		}
+		wg.Add(1)
+		issue <- node
+	}
+
+	wg.Wait()
+	close(issue)
+	close(done)
+	if errors.Is(err, errEOF) {
+		return nil
+	}
+	return err
+}
+
+// completed returns the number of committed nodes
+func (queue *jobQueue[T]) completed() int {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	return queue.complete
+}
+
+type readyItem[T comparable] struct {
+	node     T
+	priority int
+	tie      int
+}
+
+// readyHeap is a max-heap of readyItem, implements heap.Interface
+type readyHeap[T comparable] []readyItem[T]
+
+func (h readyHeap[T]) Len() int { return len(h) }
+
+func (h readyHeap[T]) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].tie < h[j].tie
+}
+
+func (h readyHeap[T]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *readyHeap[T]) Push(x any) { *h = append(*h, x.(readyItem[T])) }
+
+func (h *readyHeap[T]) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,117 @@
+package compiler
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/report"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// JvmCompiler pretends to run `gradle assemble` or `mvn install` on a multi-project build, tasks of modules run once
+// the tasks they depend on are done, which are the outputs of dependency modules for gradle, and whole modules for maven
+type JvmCompiler struct {
+	project *jvmProject
+	bar     progressbar.ProgressBar
+	threads int
+
+	recorder *report.Recorder
+}
+
+// NewJvmCompiler creates a compiler of tool gradle or maven, which reads settings.gradle(.kts) or pom.xml under path
+func NewJvmCompiler(tool, path string, config *util.Config, sourceType SourceType, threads int) (*JvmCompiler, error) {
+	if threads <= 0 {
+		return nil, errors.New("JvmCompiler: threads should be a positive number")
+	}
+	project, err := newJvmProject(tool, path, config, sourceType)
+	if err != nil {
+		return nil, err
+	}
+	return &JvmCompiler{
+		project: project,
+		threads: threads,
+	}, nil
+}
+
+func (compiler *JvmCompiler) start(task *jvmTask, slot int) {
+	compiler.recorder.Start(task, task.String(), slot)
+	compiler.bar.TaskStart(task.String())
+	ms := max(util.GetRandomFromDistribution(task.ms, task.ms/4), 5)
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	compiler.recorder.Complete(task)
+}
+
+func (compiler *JvmCompiler) finish(task *jvmTask) {
+	compiler.bar.TaskComplete(task.String())
+}
+
+func (compiler *JvmCompiler) Run() {
+	compiler.bar.Prologue()
+
+	compiler.recorder.Begin(compiler.threads)
+	err := compiler.project.schedule(func(task *jvmTask) {
+		compiler.recorder.Ready(task)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = compiler.project.run(compiler.threads, compiler.start, compiler.finish)
+	if err != nil {
+		log.Fatal(err)
+	}
+	compiler.recorder.Finish()
+
+	compiler.bar.Epilogue()
+}
+
+func (compiler *JvmCompiler) SetRecorder(recorder *report.Recorder) {
+	compiler.recorder = recorder
+}
+
+func (compiler *JvmCompiler) SetProgressBar(bar progressbar.ProgressBar) {
+	compiler.bar = bar
+
+	var totalTasks []string
+	for _, task := range compiler.project.tasks {
+		totalTasks = append(totalTasks, task.String())
+	}
+	compiler.bar.SetTotalTasks(totalTasks)
+
+	if asJvm, ok := compiler.bar.(progressbar.JvmBar); ok {
+		var modules []progressbar.JvmModule
+		for _, module := range compiler.project.buildOrder() {
+			modules = append(modules, progressbar.JvmModule{
+				Path:        module.path,
+				Name:        module.name,
+				Group:       module.group,
+				Version:     module.version,
+				Packaging:   module.packaging,
+				Dir:         module.dir,
+				Kotlin:      module.kotlin,
+				Sources:     module.sources,
+				TestSources: module.testSources,
+				Resources:   module.resources,
+			})
+		}
+		asJvm.SetModules(modules)
+	}
+}
+
+func (compiler *JvmCompiler) DumpConfig(path string, compression util.Compression) error {
+	b, err := compiler.project.dumpConfig()
+	if err != nil {
+		return err
+	}
+	return util.DumpConfigFile(path, &util.Config{
+		CompilerType:        compiler.project.tool,
+		Compression:         compression,
+		UncompressedContent: b,
+		Metadata: util.ConfigMetadata{
+			Source: compiler.project.name,
+			Tasks:  len(compiler.project.tasks),
+		},
+	})
+}
@@ -0,0 +1,208 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	gradleBlockComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	gradleLineComment  = regexp.MustCompile(`(?m)(^|\s)//.*$`)
+	gradleRootName     = regexp.MustCompile(`rootProject\.name\s*=\s*["']([^"']+)["']`)
+	gradleInclude      = regexp.MustCompile(`\binclude\b`)
+	gradleQuoted       = regexp.MustCompile(`["']([^"']+)["']`)
+	gradleProjectDep   = regexp.MustCompile(`\bproject\s*\(\s*(?:path\s*[:=]\s*)?["']([^"']+)["']`)
+	gradleAccessorDep  = regexp.MustCompile(`\bprojects\.([A-Za-z0-9_.]+)`)
+	gradleGroup        = regexp.MustCompile(`(?m)^\s*group\s*=\s*["']([^"']+)["']`)
+	gradleVersion      = regexp.MustCompile(`(?m)^\s*version\s*=\s*["']([^"']+)["']`)
+)
+
+// readGradleScript reads the groovy or kotlin script name(.kts) in dir with comments stripped,
+// returns "" if neither exists
+func readGradleScript(dir, name string) (string, error) {
+	for _, file := range []string{name + ".kts", name} {
+		b, err := os.ReadFile(filepath.Join(dir, file))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		s := gradleBlockComment.ReplaceAllString(string(b), "")
+		return gradleLineComment.ReplaceAllString(s, "$1"), nil
+	}
+	return "", nil
+}
+
+// gradleIncludes returns project paths of include statements of settings script, e.g. include ':a', ':b:c'
+// or include("a", "b"), arguments may span lines
+func gradleIncludes(settings string) []string {
+	var paths []string
+	for _, loc := range gradleInclude.FindAllStringIndex(settings, -1) {
+		rest := strings.TrimLeft(settings[loc[1]:], " \t")
+		var args string
+		if strings.HasPrefix(rest, "(") {
+			args, _, _ = strings.Cut(rest[1:], ")")
+		} else {
+			// groovy style, continues while a line ends with a comma
+			for {
+				line, remaining, found := strings.Cut(rest, "\n")
+				args += line + " "
+				if !found || !strings.HasSuffix(strings.TrimSpace(line), ",") {
+					break
+				}
+				rest = remaining
+			}
+		}
+		for _, match := range gradleQuoted.FindAllStringSubmatch(args, -1) {
+			p := match[1]
+			if !strings.HasPrefix(p, ":") {
+				p = ":" + p
+			}
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// gradleAccessor returns the type-safe project accessor of a project path, e.g. :core:data-source -> core.dataSource
+func gradleAccessor(projectPath string) string {
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(projectPath, ":"), ":") {
+		s := strings.Builder{}
+		upper := false
+		for i, r := range segment {
+			switch {
+			case r == '-' || r == '_':
+				upper = i > 0
+			case upper:
+				s.WriteRune(unicode.ToUpper(r))
+				upper = false
+			default:
+				s.WriteRune(r)
+			}
+		}
+		segments = append(segments, s.String())
+	}
+	return strings.Join(segments, ".")
+}
+
+// gradlePackaging tells the kind of module by the plugins applied by its build script
+func gradlePackaging(script string) (packaging string, kotlin bool) {
+	kotlin = strings.Contains(script, "kotlin(") || strings.Contains(script, "org.jetbrains.kotlin") ||
+		strings.Contains(script, "kotlin-android") || strings.Contains(script, "plugins.kotlin")
+	switch {
+	case strings.Contains(script, "com.android.application") || strings.Contains(script, "android.application"):
+		return "apk", kotlin
+	case strings.Contains(script, "com.android.library") || strings.Contains(script, "android.library"):
+		return "aar", kotlin
+	default:
+		return "jar", kotlin
+	}
+}
+
+// parseGradle reads settings.gradle(.kts) in path for included projects, and their build.gradle(.kts) for plugins and
+// dependencies on other projects. Projects without a build script and sources, like the parent of :core:data, are skipped
+func (project *jvmProject) parseGradle(root string) error {
+	settings, err := readGradleScript(root, "settings.gradle")
+	if err != nil {
+		return err
+	}
+	rootScript, err := readGradleScript(root, "build.gradle")
+	if err != nil {
+		return err
+	}
+	if settings == "" && rootScript == "" {
+		return fmt.Errorf("no settings.gradle(.kts) or build.gradle(.kts) found in %s", root)
+	}
+	project.name = filepath.Base(root)
+	if abs, err := filepath.Abs(root); err == nil {
+		project.name = filepath.Base(abs)
+	}
+	if match := gradleRootName.FindStringSubmatch(settings); match != nil {
+		project.name = match[1]
+	}
+	group, version := "", "unspecified"
+	if match := gradleGroup.FindStringSubmatch(rootScript); match != nil {
+		group = match[1]
+	}
+	if match := gradleVersion.FindStringSubmatch(rootScript); match != nil {
+		version = match[1]
+	}
+
+	paths := append([]string{":"}, gradleIncludes(settings)...)
+	scripts := make(map[*jvmModule]string)
+	byPath := make(map[string]*jvmModule)
+	byAccessor := make(map[string]*jvmModule)
+	for _, projectPath := range paths {
+		if byPath[projectPath] != nil {
+			continue
+		}
+		dir := strings.ReplaceAll(strings.Trim(projectPath, ":"), ":", "/")
+		script := rootScript
+		if projectPath != ":" {
+			script, err = readGradleScript(filepath.Join(root, filepath.FromSlash(dir)), "build.gradle")
+			if err != nil {
+				return err
+			}
+		}
+		module := &jvmModule{
+			path:    projectPath,
+			name:    path.Base("/" + dir),
+			group:   group,
+			version: version,
+			dir:     dir,
+		}
+		if projectPath == ":" {
+			module.name, module.dir = project.name, "."
+		}
+		module.packaging, module.kotlin = gradlePackaging(script)
+		err = module.countSources(filepath.Join(root, filepath.FromSlash(module.dir)))
+		if err != nil {
+			return err
+		}
+		// the root project and grouping projects usually build nothing
+		if module.sources == 0 && (script == "" || projectPath == ":") {
+			continue
+		}
+		if match := gradleVersion.FindStringSubmatch(script); match != nil {
+			module.version = match[1]
+		}
+		project.modules = append(project.modules, module)
+		scripts[module] = script
+		byPath[projectPath] = module
+		if projectPath != ":" {
+			byAccessor[gradleAccessor(projectPath)] = module
+		}
+	}
+	if len(project.modules) == 0 {
+		return fmt.Errorf("no projects with sources found in %s", root)
+	}
+
+	for _, module := range project.modules {
+		for _, match := range gradleProjectDep.FindAllStringSubmatch(scripts[module], -1) {
+			p := match[1]
+			if !strings.HasPrefix(p, ":") {
+				p = ":" + p
+			}
+			if dep := byPath[p]; dep != nil {
+				module.dependsOn(dep)
+			}
+		}
+		for _, match := range gradleAccessorDep.FindAllStringSubmatch(scripts[module], -1) {
+			if dep := byAccessor[match[1]]; dep != nil {
+				module.dependsOn(dep)
+			}
+		}
+	}
+	breakCycles(project.modules, func(module *jvmModule) (*[]*jvmModule, *[]*jvmModule) {
+		return &module.dependencies, &module.requiredBy
+	})
+	return nil
+}
@@ -0,0 +1,211 @@
+package compiler
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type pomCoordinates struct {
+	GroupId    string `xml:"groupId"`
+	ArtifactId string `xml:"artifactId"`
+	Version    string `xml:"version"`
+}
+
+// pomProperties collects elements of <properties> as a map
+type pomProperties map[string]string
+
+func (p *pomProperties) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	*p = make(pomProperties)
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			var value string
+			if err := d.DecodeElement(&value, &t); err != nil {
+				return err
+			}
+			(*p)[t.Name.Local] = strings.TrimSpace(value)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+type pom struct {
+	pomCoordinates
+	Parent       *pomCoordinates  `xml:"parent"`
+	Name         string           `xml:"name"`
+	Packaging    string           `xml:"packaging"`
+	Modules      []string         `xml:"modules>module"`
+	Properties   pomProperties    `xml:"properties"`
+	Dependencies []pomCoordinates `xml:"dependencies>dependency"`
+	Plugins      []pomCoordinates `xml:"build>plugins>plugin"`
+}
+
+var pomProperty = regexp.MustCompile(`\$\{([^}]+)}`)
+
+// readPom reads dir/pom.xml, coordinates and properties are inherited from the aggregator pom,
+// which is usually the parent as well
+func readPom(root, dir string, aggregator *pom) (*pom, error) {
+	file := filepath.Join(root, filepath.FromSlash(dir), "pom.xml")
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := &pom{}
+	err = xml.Unmarshal(b, p)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if p.ArtifactId == "" {
+		return nil, fmt.Errorf("%s: no artifactId", file)
+	}
+	if p.Properties == nil {
+		p.Properties = make(pomProperties)
+	}
+	if aggregator != nil {
+		for key, value := range aggregator.Properties {
+			if _, ok := p.Properties[key]; !ok {
+				p.Properties[key] = value
+			}
+		}
+	}
+	if p.Parent != nil {
+		if p.GroupId == "" {
+			p.GroupId = p.Parent.GroupId
+		}
+		if p.Version == "" {
+			p.Version = p.Parent.Version
+		}
+	}
+	if aggregator != nil {
+		if p.GroupId == "" {
+			p.GroupId = aggregator.GroupId
+		}
+		if p.Version == "" {
+			p.Version = aggregator.Version
+		}
+	}
+	if p.Packaging == "" {
+		p.Packaging = "jar"
+	}
+	p.Version = p.resolve(p.Version)
+	p.GroupId = p.resolve(p.GroupId)
+	return p, nil
+}
+
+// resolve expands ${project.version}, ${project.groupId} and properties in s, unknown ones are kept
+func (p *pom) resolve(s string) string {
+	return pomProperty.ReplaceAllStringFunc(s, func(match string) string {
+		key := match[2 : len(match)-1]
+		switch key {
+		case "project.version", "pom.version", "version", "project.parent.version":
+			if p.Version != match {
+				return p.Version
+			}
+		case "project.groupId", "pom.groupId", "groupId", "project.parent.groupId":
+			return p.GroupId
+		case "project.artifactId":
+			return p.ArtifactId
+		}
+		if value, ok := p.Properties[key]; ok && !strings.Contains(value, match) {
+			return value
+		}
+		return match
+	})
+}
+
+// parseMaven walks the <modules> of pom.xml in path recursively, dependencies on other modules of the reactor, and
+// parents within it, are the edges
+func (project *jvmProject) parseMaven(root string) error {
+	type entry struct {
+		dir string
+		pom *pom
+	}
+	var entries []entry
+	visited := make(map[string]bool)
+	var walk func(dir string, aggregator *pom) error
+	walk = func(dir string, aggregator *pom) error {
+		dir = path.Clean(dir)
+		if visited[dir] {
+			return nil
+		}
+		visited[dir] = true
+		p, err := readPom(root, dir, aggregator)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{dir, p})
+		for _, module := range p.Modules {
+			module = strings.TrimSuffix(strings.TrimSpace(module), "/pom.xml")
+			err = walk(path.Join(dir, module), p)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := walk(".", nil)
+	if err != nil {
+		return err
+	}
+
+	project.name = entries[0].pom.ArtifactId
+	byCoordinates := make(map[string]*jvmModule)
+	for _, e := range entries {
+		module := &jvmModule{
+			path:      e.pom.ArtifactId,
+			name:      e.pom.resolve(e.pom.Name),
+			group:     e.pom.GroupId,
+			version:   e.pom.Version,
+			packaging: e.pom.Packaging,
+			dir:       e.dir,
+		}
+		if module.name == "" {
+			module.name = module.path
+		}
+		if module.packaging != "jar" && module.packaging != "war" && module.packaging != "pom" {
+			module.packaging = "jar" // bundle, maven-plugin and others are built like jars
+		}
+		for _, plugin := range e.pom.Plugins {
+			module.kotlin = module.kotlin || plugin.ArtifactId == "kotlin-maven-plugin"
+		}
+		if module.packaging != "pom" {
+			err = module.countSources(filepath.Join(root, filepath.FromSlash(e.dir)))
+			if err != nil {
+				return err
+			}
+		}
+		key := module.group + ":" + module.path
+		if byCoordinates[key] != nil {
+			return fmt.Errorf("%s/pom.xml: duplicate module %s", e.dir, key)
+		}
+		byCoordinates[key] = module
+		project.modules = append(project.modules, module)
+	}
+	for i, e := range entries {
+		module := project.modules[i]
+		if e.pom.Parent != nil {
+			if parent := byCoordinates[e.pom.resolve(e.pom.Parent.GroupId)+":"+e.pom.Parent.ArtifactId]; parent != nil {
+				module.dependsOn(parent)
+			}
+		}
+		for _, dep := range e.pom.Dependencies {
+			if other := byCoordinates[e.pom.resolve(dep.GroupId)+":"+e.pom.resolve(dep.ArtifactId)]; other != nil {
+				module.dependsOn(other)
+			}
+		}
+	}
+	breakCycles(project.modules, func(module *jvmModule) (*[]*jvmModule, *[]*jvmModule) {
+		return &module.dependencies, &module.requiredBy
+	})
+	return nil
+}
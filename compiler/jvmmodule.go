@@ -0,0 +1,445 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// jvmModule is a gradle project or a maven module of a multi-project build
+type jvmModule struct {
+	path         string // gradle project path like :core:data, or maven artifactId
+	name         string // display name
+	group        string
+	version      string
+	packaging    string // jar, war, pom, or apk and aar for android modules
+	dir          string // slash-separated, relative to the root
+	kotlin       bool
+	sources      int // number of .java and .kt files under src/main
+	sourceSize   int64
+	testSources  int // under src/test
+	testSize     int64
+	resources    int // number of files under src/main/resources, or src/main/res for android
+	dependencies []*jvmModule
+	requiredBy   []*jvmModule
+}
+
+func (module *jvmModule) String() string {
+	return module.path
+}
+
+// dependsOn adds the edge module -> dep, self and duplicate edges are dropped
+func (module *jvmModule) dependsOn(dep *jvmModule) {
+	if dep == module || slices.Contains(module.dependencies, dep) {
+		return
+	}
+	module.dependencies = append(module.dependencies, dep)
+	dep.requiredBy = append(dep.requiredBy, module)
+}
+
+func (module *jvmModule) android() bool {
+	return module.packaging == "apk" || module.packaging == "aar"
+}
+
+// jvmTask is a gradle task, or a maven mojo execution, of a module
+type jvmTask struct {
+	module       *jvmModule
+	name         string  // e.g. compileKotlin, or compile for maven
+	ms           float64 // expected time
+	dependencies []*jvmTask
+	requiredBy   []*jvmTask
+}
+
+// String returns the path of the task, e.g. :app:compileKotlin, or core:compile for maven
+func (task *jvmTask) String() string {
+	if task.module.path == ":" {
+		return ":" + task.name
+	}
+	return task.module.path + ":" + task.name
+}
+
+func (task *jvmTask) dependsOn(dep *jvmTask) {
+	task.dependencies = append(task.dependencies, dep)
+	dep.requiredBy = append(dep.requiredBy, task)
+}
+
+// jvmProject defines modules of a gradle or maven build, and the tasks to build them
+type jvmProject struct {
+	tool        string // gradle or maven
+	name        string // root project name, or the artifactId of the root pom
+	modules     []*jvmModule
+	tasks       []*jvmTask
+	jobs        *jobQueue[*jvmTask]
+	constructed bool
+}
+
+type configJvmModule struct {
+	Path         string `json:"path"`
+	Name         string `json:"name,omitempty"`
+	Group        string `json:"group,omitempty"`
+	Version      string `json:"ver,omitempty"`
+	Packaging    string `json:"packaging"`
+	Dir          string `json:"dir"`
+	Kotlin       bool   `json:"kotlin,omitempty"`
+	Sources      int    `json:"sources"`
+	SourceSize   int64  `json:"size"`
+	TestSources  int    `json:"tests"`
+	TestSize     int64  `json:"testSize"`
+	Resources    int    `json:"resources"`
+	Dependencies []int  `json:"dep"` // index in `Modules` array
+}
+type configJvmProject struct {
+	Name    string            `json:"name"`
+	Modules []configJvmModule `json:"modules"`
+}
+
+func newJvmProject(tool, path string, config *util.Config, sourceType SourceType) (*jvmProject, error) {
+	project := &jvmProject{tool: tool}
+	switch sourceType {
+	case SourceTypeDir:
+		var err error
+		switch tool {
+		case "gradle":
+			err = project.parseGradle(path)
+		case "maven":
+			err = project.parseMaven(path)
+		default:
+			err = errors.New("jvmProject: unknown tool " + tool)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case SourceTypeConfig:
+		err := project.parseConfig(config)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("jvmProject: unknown sourceType " + strconv.Itoa(int(sourceType)))
+	}
+	project.createTasks()
+	project.constructed = true
+	return project, nil
+}
+
+// countSources counts files under dir whose name ends with one of extensions, nothing if dir does not exist
+func countSources(dir string, extensions ...string) (count int, size int64, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if strings.HasPrefix(d.Name(), ".") && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(extensions) > 0 && !slices.ContainsFunc(extensions, func(ext string) bool {
+			return strings.HasSuffix(d.Name(), ext)
+		}) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		count++
+		size += info.Size()
+		return nil
+	})
+	return
+}
+
+// countSources fills numbers of sources, tests and resources of module in dir
+func (module *jvmModule) countSources(dir string) error {
+	var err error
+	module.sources, module.sourceSize, err = countSources(filepath.Join(dir, "src", "main"), ".java", ".kt")
+	if err != nil {
+		return err
+	}
+	module.testSources, module.testSize, err = countSources(filepath.Join(dir, "src", "test"), ".java", ".kt")
+	if err != nil {
+		return err
+	}
+	resources := filepath.Join(dir, "src", "main", "resources")
+	if module.android() {
+		resources = filepath.Join(dir, "src", "main", "res")
+	}
+	module.resources, _, err = countSources(resources)
+	if err != nil {
+		return err
+	}
+	if !module.kotlin {
+		kotlin, _, err := countSources(filepath.Join(dir, "src"), ".kt")
+		if err != nil {
+			return err
+		}
+		module.kotlin = kotlin > 0
+	}
+	return nil
+}
+
+// createTasks creates the task graph of modules. Gradle tasks are wired by their inputs, so that compilation of a module
+// only waits for the classes of its dependencies, while maven builds a module after all of its dependencies are installed
+func (project *jvmProject) createTasks() {
+	project.tasks = nil
+	output := make(map[*jvmModule]*jvmTask) // the task that dependents of a module wait for
+	input := make(map[*jvmModule]*jvmTask)  // the task of a module that waits for its dependencies
+
+	add := func(module *jvmModule, name string, ms float64, dependencies ...*jvmTask) *jvmTask {
+		task := &jvmTask{module: module, name: name, ms: ms}
+		for _, dep := range dependencies {
+			if dep != nil {
+				task.dependsOn(dep)
+			}
+		}
+		project.tasks = append(project.tasks, task)
+		return task
+	}
+	// kotlinc is much slower than javac, javac still runs on a kotlin module, for its few java files
+	compileMs := func(size int64, kotlin bool) (kotlinMs, javaMs float64) {
+		javaMs = 250 + float64(size)/100
+		if !kotlin {
+			return 0, javaMs
+		}
+		return 600 + float64(size)/40, javaMs / 4
+	}
+
+	for _, m := range project.modules {
+		kotlinMs, javaMs := compileMs(m.sourceSize, m.kotlin)
+		switch {
+		case project.tool == "maven":
+			var last *jvmTask
+			if m.packaging != "pom" {
+				last = add(m, "resources", 40+float64(m.resources)*3)
+				input[m] = last
+				if m.kotlin {
+					last = add(m, "kotlin-compile", kotlinMs, last)
+				}
+				last = add(m, "compile", javaMs, last)
+				last = add(m, "testResources", 20, last)
+				testKotlinMs, testJavaMs := compileMs(m.testSize, m.kotlin)
+				if m.kotlin {
+					last = add(m, "kotlin-test-compile", testKotlinMs, last)
+				}
+				last = add(m, "testCompile", testJavaMs, last)
+				last = add(m, "test", 30, last)
+				last = add(m, m.packaging, 150+float64(m.sourceSize)/500, last)
+			}
+			output[m] = add(m, "install", 60, last)
+			if input[m] == nil {
+				input[m] = output[m]
+			}
+
+		case m.android():
+			preBuild := add(m, "preBuild", 5)
+			resources := add(m, "mergeDebugResources", 200+float64(m.resources)*8, preBuild)
+			processResources := add(m, "processDebugResources", 300+float64(m.resources)*4, resources)
+			var compile *jvmTask
+			if m.kotlin {
+				compile = add(m, "compileDebugKotlin", kotlinMs, processResources)
+				input[m] = compile
+			}
+			compile = add(m, "compileDebugJavaWithJavac", javaMs, processResources, compile)
+			if input[m] == nil {
+				input[m] = compile
+			}
+			if m.packaging == "aar" {
+				output[m] = add(m, "bundleLibCompileToJarDebug", 60+float64(m.sourceSize)/400, compile)
+				add(m, "assembleDebug", 5, add(m, "bundleDebugAar", 150+float64(m.sourceSize)/300, output[m]))
+			} else {
+				dex := add(m, "dexBuilderDebug", 400+float64(m.sourceSize)/60, compile)
+				merge := add(m, "mergeDexDebug", 500, dex)
+				add(m, "assembleDebug", 5, add(m, "packageDebug", 700+float64(m.sourceSize)/200, merge, processResources))
+			}
+
+		default:
+			var compile *jvmTask
+			if m.kotlin {
+				compile = add(m, "compileKotlin", kotlinMs)
+				input[m] = compile
+			}
+			compile = add(m, "compileJava", javaMs, compile)
+			if input[m] == nil {
+				input[m] = compile
+			}
+			resources := add(m, "processResources", 30+float64(m.resources)*3)
+			output[m] = add(m, "classes", 5, compile, resources)
+			add(m, "jar", 80+float64(m.sourceSize)/400, output[m])
+		}
+	}
+	for _, m := range project.modules {
+		for _, dep := range m.dependencies {
+			if output[dep] != nil { // android applications can not be depended on
+				input[m].dependsOn(output[dep])
+			}
+		}
+	}
+}
+
+// buildOrder returns modules in the order maven's reactor builds them: dependencies first, otherwise in declaration order
+func (project *jvmProject) buildOrder() []*jvmModule {
+	var order []*jvmModule
+	done := make(map[*jvmModule]bool)
+	for len(order) < len(project.modules) {
+		for _, m := range project.modules {
+			if !done[m] && !slices.ContainsFunc(m.dependencies, func(dep *jvmModule) bool { return !done[dep] }) {
+				done[m] = true
+				order = append(order, m)
+				break
+			}
+		}
+	}
+	return order
+}
+
+func (project *jvmProject) parseConfig(config *util.Config) error {
+	p := configJvmProject{}
+	err := config.Decode(&p)
+	if err != nil {
+		return err
+	}
+	err = p.validate(project.tool)
+	if err != nil {
+		return err
+	}
+
+	project.name = p.Name
+	for _, cModule := range p.Modules {
+		project.modules = append(project.modules, &jvmModule{
+			path:        cModule.Path,
+			name:        cModule.Name,
+			group:       cModule.Group,
+			version:     cModule.Version,
+			packaging:   cModule.Packaging,
+			dir:         cModule.Dir,
+			kotlin:      cModule.Kotlin,
+			sources:     cModule.Sources,
+			sourceSize:  cModule.SourceSize,
+			testSources: cModule.TestSources,
+			testSize:    cModule.TestSize,
+			resources:   cModule.Resources,
+		})
+	}
+	for i, module := range project.modules {
+		for _, dep := range p.Modules[i].Dependencies {
+			module.dependsOn(project.modules[dep])
+		}
+	}
+	return nil
+}
+
+// validate checks that module paths are unique, every index is in range and the dependency graph is acyclic
+func (p *configJvmProject) validate(tool string) error {
+	if len(p.Modules) == 0 {
+		return errors.New("malformed config: no modules")
+	}
+	packagings := []string{"jar", "war", "pom"}
+	if tool == "gradle" {
+		packagings = []string{"jar", "apk", "aar"}
+	}
+	paths := make(map[string]int)
+	for i, module := range p.Modules {
+		if module.Path == "" {
+			return fmt.Errorf("malformed config: module %d has no path", i)
+		}
+		if j, ok := paths[module.Path]; ok {
+			return fmt.Errorf("malformed config: modules %d and %d have the same path %s", j, i, module.Path)
+		}
+		paths[module.Path] = i
+		switch {
+		case !slices.Contains(packagings, module.Packaging):
+			return fmt.Errorf("malformed config: module %s has unknown packaging %q for %s", module.Path, module.Packaging, tool)
+		case module.Sources < 0 || module.SourceSize < 0 || module.TestSources < 0 || module.TestSize < 0 || module.Resources < 0:
+			return fmt.Errorf("malformed config: module %s has negative number of files or size", module.Path)
+		}
+		seen := make(map[int]bool)
+		for _, dep := range module.Dependencies {
+			switch {
+			case dep < 0 || dep >= len(p.Modules):
+				return fmt.Errorf("malformed config: module %s depends on module %d, out of range [0, %d)", module.Path, dep, len(p.Modules))
+			case dep == i:
+				return fmt.Errorf("malformed config: module %s depends on itself", module.Path)
+			case seen[dep]:
+				return fmt.Errorf("malformed config: module %s depends on %s more than once", module.Path, p.Modules[dep].Path)
+			}
+			seen[dep] = true
+		}
+	}
+	if cycle := findCycle(len(p.Modules), func(i int) []int { return p.Modules[i].Dependencies }); cycle != nil {
+		paths := make([]string, 0, len(cycle))
+		for _, idx := range cycle {
+			paths = append(paths, p.Modules[idx].Path)
+		}
+		return fmt.Errorf("malformed config: dependency cycle: %s", strings.Join(paths, " -> "))
+	}
+	return nil
+}
+
+func (project *jvmProject) dumpConfig() ([]byte, error) {
+	if !project.constructed {
+		return nil, errNotConstructed
+	}
+
+	// {ptr: index} mapping
+	mapping := make(map[*jvmModule]int)
+	for i, module := range project.modules {
+		mapping[module] = i
+	}
+	p := configJvmProject{Name: project.name}
+	for _, module := range project.modules {
+		cModule := configJvmModule{
+			Path:        module.path,
+			Name:        module.name,
+			Group:       module.group,
+			Version:     module.version,
+			Packaging:   module.packaging,
+			Dir:         module.dir,
+			Kotlin:      module.kotlin,
+			Sources:     module.sources,
+			SourceSize:  module.sourceSize,
+			TestSources: module.testSources,
+			TestSize:    module.testSize,
+			Resources:   module.resources,
+		}
+		for _, dep := range module.dependencies {
+			cModule.Dependencies = append(cModule.Dependencies, mapping[dep])
+		}
+		p.Modules = append(p.Modules, cModule)
+	}
+	return json.Marshal(p)
+}
+
+// schedule starts a new round of build, onReady is invoked when a task becomes ready to run
+func (project *jvmProject) schedule(onReady func(task *jvmTask)) error {
+	if !project.constructed {
+		return errNotConstructed
+	}
+	project.jobs = newJobQueue(project.tasks,
+		func(task *jvmTask) []*jvmTask {
+			return task.dependencies
+		},
+		func(task *jvmTask) []*jvmTask {
+			return task.requiredBy
+		}, onReady)
+	return nil
+}
+
+// run executes tasks on threads workers once all of their dependencies are done,
+// the one heading the longest remaining chain first, see jobQueue.run
+func (project *jvmProject) run(threads int, start func(task *jvmTask, slot int), finish func(task *jvmTask)) error {
+	if project.jobs == nil {
+		return errNotConstructed
+	}
+	return project.jobs.run(threads, start, finish)
+}
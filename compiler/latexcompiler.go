@@ -0,0 +1,225 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/report"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// LatexCompiler pretends to run `latexmk -pdf` over a document: pdflatex reads the files of the document one after
+// another and ships out their pages, bibtex or biber processes the bibliography, and pdflatex runs again until
+// cross-references are settled. TeX is single threaded, so are the tasks
+type LatexCompiler struct {
+	document *latexDocument
+	runs     []*latexRun
+	bar      progressbar.ProgressBar
+	threads  int
+
+	recorder *report.Recorder
+}
+
+// latexRun is a run of a program by latexmk
+type latexRun struct {
+	program string // pdflatex, bibtex or biber
+	number  int    // 1-based among runs of the same program
+	tasks   []*latexTask
+}
+
+// latexTask is a file read by a run, named like `pdflatex 2: chapters/intro.tex`
+type latexTask struct {
+	run  *latexRun
+	file *latexFile
+}
+
+func (task *latexTask) String() string {
+	if task.run.program == "pdflatex" {
+		return fmt.Sprintf("pdflatex %d: %s", task.run.number, task.file.path)
+	}
+	return task.run.program + ": " + task.file.path
+}
+
+// expected values of the random distributions used by typeset, in milliseconds, see also Estimate
+const (
+	latexStartMs         = 300 // load the format, once per run of pdflatex
+	latexFileMs          = 30
+	latexBytesPerMs      = 40
+	latexPageMs          = 50 // ship out a page
+	latexImageBytesPerMs = 20000
+	latexBibEntryMs      = 4
+)
+
+// probability of one more run of pdflatex, see latexDocument.plan
+const latexRerunRate = 0.3
+
+// options: how the directory is traversed, only used by SourceTypeDir
+func NewLatexCompiler(path string, config *util.Config, sourceType SourceType, threads int, options util.TraverseOptions) (*LatexCompiler, error) {
+	if threads <= 0 {
+		return nil, errors.New("LatexCompiler: threads should be a positive number")
+	}
+	document, err := newLatexDocument(path, config, sourceType, options)
+	if err != nil {
+		return nil, err
+	}
+	compiler := &LatexCompiler{
+		document: document,
+		threads:  threads,
+	}
+	compiler.runs = compiler.plan(rand.Float64() < latexRerunRate)
+	return compiler, nil
+}
+
+// plan creates the runs of the document, every run of pdflatex reads all files, bibtex reads the databases
+func (compiler *LatexCompiler) plan(rerun bool) []*latexRun {
+	var runs []*latexRun
+	numbers := make(map[string]int)
+	for _, program := range compiler.document.plan(rerun) {
+		numbers[program]++
+		run := &latexRun{program: program, number: numbers[program]}
+		files := compiler.document.files
+		if program != "pdflatex" {
+			files = compiler.document.bibliography
+		}
+		for _, file := range files {
+			run.tasks = append(run.tasks, &latexTask{run: run, file: file})
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// latexTaskMs returns the expected time of task, excluding pages shipped out
+func latexTaskMs(task *latexTask) float64 {
+	file := task.file
+	if task.run.program != "pdflatex" {
+		return latexFileMs + float64(len(file.entries))*latexBibEntryMs
+	}
+	ms := latexFileMs + float64(file.size)/latexBytesPerMs
+	for _, image := range file.images {
+		ms += float64(image.size) / latexImageBytesPerMs
+	}
+	if file.depth == 0 {
+		ms += latexStartMs
+	}
+	return ms
+}
+
+// typeset reads the file of task, pages are shipped out one by one while it is read
+func (compiler *LatexCompiler) typeset(task *latexTask) {
+	ms := latexTaskMs(task)
+	ms = max(util.GetRandomFromDistribution(ms, ms/8), 5)
+	pages := 0
+	if task.run.program == "pdflatex" {
+		pages = task.file.pages
+	}
+	interval := time.Duration(ms/float64(pages+1)) * time.Millisecond
+	asLatex, ok := compiler.bar.(*progressbar.LatexProgressBar)
+	for range pages {
+		time.Sleep(interval)
+		time.Sleep(time.Duration(max(util.GetRandomFromDistribution(latexPageMs, latexPageMs/4), 1)) * time.Millisecond)
+		if ok {
+			asLatex.ShipOut(task.String())
+		}
+	}
+	time.Sleep(interval)
+}
+
+func (compiler *LatexCompiler) Run() {
+	compiler.bar.Prologue()
+	compiler.recorder.Begin(1)
+
+	for _, run := range compiler.runs {
+		for _, task := range run.tasks {
+			compiler.recorder.Start(task, task.String(), 0)
+			compiler.bar.TaskStart(task.String())
+			compiler.typeset(task)
+			compiler.recorder.Complete(task)
+			compiler.bar.TaskComplete(task.String())
+		}
+	}
+
+	compiler.recorder.Finish()
+	compiler.bar.Epilogue()
+}
+
+func (compiler *LatexCompiler) SetProgressBar(bar progressbar.ProgressBar) {
+	compiler.bar = bar
+	var totalTasks []string
+	for _, run := range compiler.runs {
+		for _, task := range run.tasks {
+			totalTasks = append(totalTasks, task.String())
+		}
+	}
+	compiler.bar.SetTotalTasks(totalTasks)
+
+	if asLatex, ok := compiler.bar.(*progressbar.LatexProgressBar); ok {
+		asLatex.SetDocument(compiler.describeDocument())
+	}
+}
+
+func (compiler *LatexCompiler) describeDocument() progressbar.LatexDocument {
+	document := compiler.document
+	info := progressbar.LatexDocument{
+		Name:     document.name,
+		Class:    document.class,
+		Packages: document.packages,
+		BibStyle: document.bibStyle,
+		Toc:      document.toc,
+	}
+	reference := func(r latexReference, defined bool) progressbar.LatexReference {
+		return progressbar.LatexReference{Key: r.key, Line: r.line, Defined: defined}
+	}
+	for _, run := range compiler.runs {
+		infoRun := progressbar.LatexRun{Program: run.program}
+		for _, task := range run.tasks {
+			file := task.file
+			infoFile := progressbar.LatexFile{
+				Path:    file.path,
+				Kind:    file.kind,
+				Size:    file.size,
+				Lines:   file.lines,
+				Depth:   file.depth,
+				Pages:   file.pages,
+				Entries: len(file.entries),
+			}
+			for _, image := range file.images {
+				infoFile.Images = append(infoFile.Images, progressbar.LatexImage{Path: image.path, Size: image.size})
+			}
+			for _, citation := range file.citations {
+				infoFile.Citations = append(infoFile.Citations, reference(citation, document.defined(citation.key)))
+			}
+			for _, r := range file.references {
+				infoFile.References = append(infoFile.References, reference(r, slices.Contains(document.labels, r.key)))
+			}
+			infoRun.Tasks = append(infoRun.Tasks, task.String())
+			infoRun.Files = append(infoRun.Files, infoFile)
+		}
+		info.Runs = append(info.Runs, infoRun)
+	}
+	return info
+}
+
+func (compiler *LatexCompiler) SetRecorder(recorder *report.Recorder) {
+	compiler.recorder = recorder
+}
+
+func (compiler *LatexCompiler) DumpConfig(path string, compression util.Compression) error {
+	b, err := compiler.document.dumpConfig()
+	if err != nil {
+		return err
+	}
+	return util.DumpConfigFile(path, &util.Config{
+		CompilerType:        "latex",
+		Compression:         compression,
+		UncompressedContent: b,
+		Metadata: util.ConfigMetadata{
+			Source: compiler.document.name,
+			Tasks:  len(compiler.document.files) + len(compiler.document.bibliography),
+		},
+	})
+}
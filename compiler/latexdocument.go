@@ -0,0 +1,682 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// latexFile is a file read while typesetting a document: the main file, files it \input or \include,
+// local packages and classes, or a .bib database read by bibtex
+type latexFile struct {
+	path       string // relative to the root, e.g. chapters/intro.tex
+	kind       string // tex, sty, cls or bib
+	size       int64
+	lines      int
+	depth      int // how deep it is read by \input, the main file is 0
+	pages      int // pages shipped out while reading its own lines
+	images     []*latexImage
+	citations  []latexReference // \cite
+	references []latexReference // \ref and the like
+	entries    []string         // keys of a .bib database
+}
+
+// latexReference is a key cited or referenced at line of a file
+type latexReference struct {
+	key  string
+	line int
+}
+
+// latexImage is a figure by \includegraphics, path is relative to the root
+type latexImage struct {
+	path string
+	size int64
+}
+
+// latexDocument is a document typeset by pdflatex, files are in the order pdflatex reads them
+type latexDocument struct {
+	name         string   // job name, the main file without .tex, e.g. main
+	class        string   // \documentclass
+	packages     []string // packages of TeX Live, local ones are files
+	files        []*latexFile
+	bibliography []*latexFile
+	bibStyle     string // \bibliographystyle, empty with biblatex
+	biber        bool   // biblatex processes the bibliography by biber instead of bibtex
+	labels       []string
+	toc          bool // \tableofcontents or lists of figures and tables, which are read from the previous run
+	constructed  bool
+}
+
+// content of latex config
+//
+//	{"name": "main", "class": "book", "packages": ["amsmath", "graphicx"], "files": [{"path": "main.tex", "kind": "tex",
+//	 "size": 2345, "lines": 80, "pages": 1, "cites": [{"key": "knuth84", "line": 42}]}, {"path": "chapters/intro.tex",
+//	 "kind": "tex", "size": 34567, "lines": 400, "depth": 1, "pages": 12, "images": [{"path": "figures/plot.png", "size": 45678}]}],
+//	 "bib": [{"path": "refs.bib", "kind": "bib", "size": 4567, "lines": 120, "entries": ["knuth84"]}], "bibstyle": "plain", "labels": ["fig:plot"], "toc": true}
+type configLatexDocument struct {
+	Name         string            `json:"name"`
+	Class        string            `json:"class"`
+	Packages     []string          `json:"packages,omitempty"`
+	Files        []configLatexFile `json:"files"`
+	Bibliography []configLatexFile `json:"bib,omitempty"`
+	BibStyle     string            `json:"bibstyle,omitempty"`
+	Biber        bool              `json:"biber,omitempty"`
+	Labels       []string          `json:"labels,omitempty"`
+	Toc          bool              `json:"toc,omitempty"`
+}
+
+type configLatexFile struct {
+	Path       string                 `json:"path"`
+	Kind       string                 `json:"kind"`
+	Size       int64                  `json:"size"`
+	Lines      int                    `json:"lines"`
+	Depth      int                    `json:"depth,omitempty"`
+	Pages      int                    `json:"pages,omitempty"`
+	Images     []configLatexImage     `json:"images,omitempty"`
+	Citations  []configLatexReference `json:"cites,omitempty"`
+	References []configLatexReference `json:"refs,omitempty"`
+	Entries    []string               `json:"entries,omitempty"`
+}
+
+type configLatexImage struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+type configLatexReference struct {
+	Key  string `json:"key"`
+	Line int    `json:"line"`
+}
+
+// latexSourceFilter matches files a document is made of
+const latexSourceFilter = "^.*\\.(tex|bib|sty|cls|png|jpe?g|pdf|eps)$"
+
+// amounts of a page taken by parts of a document
+const (
+	latexBytesPerPage = 3000
+	latexImagePage    = 0.35
+)
+
+var (
+	// a command with its optional and first mandatory argument, includegraphics is listed before include as
+	// alternatives are tried in order
+	latexCommand = regexp.MustCompile(`\\(documentclass|usepackage|RequirePackage|includegraphics|include|input|subfile|` +
+		`bibliographystyle|bibliography|addbibresource|(?:no|paren|text|auto|foot)?cite[a-zA-Z]*|(?:eq|auto|page|name|c|C)?ref|label|` +
+		`tableofcontents|listoffigures|listoftables|chapter|part|clearpage|newpage|begin|graphicspath)\*?((?:\[[^\]]*\])*)(?:\{([^}]*)\})?`)
+	latexGraphicsPath = regexp.MustCompile(`\{([^{}]*)\}`)
+	latexBibEntry     = regexp.MustCompile(`(?m)^\s*@([a-zA-Z]+)\s*[{(]\s*([^,\s]+)\s*,`)
+)
+
+// extensions tried for \includegraphics without one, in the order of pdflatex
+var latexImageExtensions = []string{".pdf", ".png", ".jpg", ".jpeg", ".eps"}
+
+func newLatexDocument(path string, config *util.Config, sourceType SourceType, options util.TraverseOptions) (*latexDocument, error) {
+	document := new(latexDocument)
+	switch sourceType {
+	case SourceTypeDir:
+		err := document.parseDirectory(path, options)
+		if err != nil {
+			return nil, err
+		}
+	case SourceTypeConfig:
+		err := document.parseConfig(config)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("latexDocument: unknown sourceType " + strconv.Itoa(int(sourceType)))
+	}
+	return document, nil
+}
+
+// latexReader follows \input and \include from the main file, files are read at most once
+type latexReader struct {
+	root         string
+	found        map[string]int64 // sizes of files found, by path relative to root
+	document     *latexDocument
+	visited      map[string]bool
+	graphicsPath []string
+	inDocument   bool       // after \begin{document}, text before it takes no pages
+	cursor       float64    // pages typeset so far
+	last         *latexFile // the file which typeset the current page
+}
+
+func (document *latexDocument) parseDirectory(root string, options util.TraverseOptions) error {
+	dir, err := util.NewDirectory(root, latexSourceFilter, true)
+	if err != nil {
+		return err
+	}
+	err = dir.SetOptions(options)
+	if err != nil {
+		return err
+	}
+	errs, err := dir.Traverse()
+	if err != nil {
+		return err
+	}
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "warning: skipped %s\n", e)
+	}
+
+	found := make(map[string]int64)
+	queue := []*util.Directory{dir}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		rel, _ := strings.CutPrefix(d.Path, root)
+		for _, file := range d.Files {
+			found[util.CleanRelativePath(rel+"/"+file.Name)] = file.Size
+		}
+		queue = append(queue, d.SubDirs...)
+	}
+
+	main, err := latexMain(root, found)
+	if err != nil {
+		return err
+	}
+	document.name = strings.TrimSuffix(main, ".tex")
+	reader := &latexReader{
+		root:     root,
+		found:    found,
+		document: document,
+		visited:  make(map[string]bool),
+	}
+	err = reader.read(main, "tex", 0)
+	if err != nil {
+		return err
+	}
+	// \end{document} ships out the last page
+	if reader.cursor > float64(int(reader.cursor)) || reader.cursor == 0 {
+		if reader.last == nil {
+			reader.last = document.files[0]
+		}
+		reader.last.pages++
+	}
+	if document.class == "" {
+		return fmt.Errorf("%s: \\documentclass is not found", main)
+	}
+	document.constructed = true
+	return nil
+}
+
+// latexMain finds the main file of a document within the root: a .tex file with \documentclass,
+// main.tex is preferred if there are several of them
+func latexMain(root string, found map[string]int64) (string, error) {
+	var candidates []string
+	for name := range found {
+		if strings.Contains(name, "/") || path.Ext(name) != ".tex" {
+			continue
+		}
+		b, err := os.ReadFile(root + name)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(stripLatexComments(string(b)), `\documentclass`) {
+			candidates = append(candidates, name)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no .tex file with \\documentclass found in %s", root)
+	}
+	if slices.Contains(candidates, "main.tex") {
+		return "main.tex", nil
+	}
+	slices.Sort(candidates)
+	return candidates[0], nil
+}
+
+// stripLatexComments removes comments, which start at % that is not escaped, and keeps lines
+func stripLatexComments(src string) string {
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		for j := 0; j < len(line); j++ {
+			if line[j] == '\\' {
+				j++
+			} else if line[j] == '%' {
+				lines[i] = line[:j]
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// read reads the file at rel, then the files it loads in the order they appear
+func (reader *latexReader) read(rel, kind string, depth int) error {
+	reader.visited[rel] = true
+	b, err := os.ReadFile(reader.root + rel)
+	if err != nil {
+		return err
+	}
+	file := &latexFile{
+		path:  rel,
+		kind:  kind,
+		size:  int64(len(b)),
+		lines: strings.Count(string(b), "\n") + 1,
+		depth: depth,
+	}
+	if kind == "bib" {
+		for _, match := range latexBibEntry.FindAllStringSubmatch(string(b), -1) {
+			switch strings.ToLower(match[1]) {
+			case "string", "comment", "preamble":
+			default:
+				file.entries = append(file.entries, match[2])
+			}
+		}
+		reader.document.bibliography = append(reader.document.bibliography, file)
+		return nil
+	}
+	document := reader.document
+	document.files = append(document.files, file)
+
+	for i, line := range strings.Split(stripLatexComments(string(b)), "\n") {
+		number := i + 1
+		last := 0
+		for _, match := range latexCommand.FindAllStringSubmatchIndex(line, -1) {
+			reader.typeset(file, line[last:match[0]])
+			last = match[1]
+			command, options, arg := line[match[2]:match[3]], line[match[4]:match[5]], ""
+			if match[6] >= 0 {
+				arg = strings.TrimSpace(line[match[6]:match[7]])
+			}
+			err = reader.command(file, number, command, options, arg, line[match[0]:])
+			if err != nil {
+				return err
+			}
+		}
+		reader.typeset(file, line[last:])
+	}
+	return nil
+}
+
+// typeset moves the cursor by text, pages filled by it are shipped out while reading file
+func (reader *latexReader) typeset(file *latexFile, text string) {
+	if reader.inDocument && file.kind == "tex" {
+		reader.advance(file, float64(len(strings.TrimSpace(text)))/latexBytesPerPage)
+	}
+}
+
+func (reader *latexReader) advance(file *latexFile, pages float64) {
+	if pages <= 0 {
+		return
+	}
+	before := int(reader.cursor)
+	reader.cursor += pages
+	file.pages += int(reader.cursor) - before
+	reader.last = file
+}
+
+// clearPage starts a new page, unless the current one is empty, which is shipped out by the file that filled it
+func (reader *latexReader) clearPage() {
+	if reader.inDocument && reader.last != nil && reader.cursor > float64(int(reader.cursor)) {
+		reader.advance(reader.last, float64(int(reader.cursor)+1)-reader.cursor)
+	}
+}
+
+// command handles a command at line of file with its options and first argument, text is the rest of the line
+func (reader *latexReader) command(file *latexFile, line int, command, options, arg, text string) error {
+	document := reader.document
+	switch {
+	case command == "documentclass":
+		if arg == "" || document.class != "" {
+			return nil
+		}
+		document.class = arg
+		if _, ok := reader.found[arg+".cls"]; ok && !reader.visited[arg+".cls"] {
+			return reader.read(arg+".cls", "cls", file.depth+1)
+		}
+	case command == "usepackage" || command == "RequirePackage":
+		for _, name := range strings.Split(arg, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "biblatex" {
+				document.biber = !strings.Contains(options, "backend=bibtex")
+			}
+			if local := reader.lookup(name + ".sty"); local != "" {
+				if !reader.visited[local] {
+					err := reader.read(local, "sty", file.depth+1)
+					if err != nil {
+						return err
+					}
+				}
+			} else if !slices.Contains(document.packages, name) {
+				document.packages = append(document.packages, name)
+			}
+		}
+	case command == "input" || command == "include" || command == "subfile":
+		if arg == "" {
+			return nil
+		}
+		if command == "include" {
+			reader.clearPage()
+		}
+		rel := reader.resolve(arg, []string{"", ".tex"})
+		switch {
+		case rel == "":
+			fmt.Fprintf(os.Stderr, "warning: %s:%d: %s is not found, skipped\n", file.path, line, arg)
+		case !reader.visited[rel]:
+			err := reader.read(rel, "tex", file.depth+1)
+			if err != nil {
+				return err
+			}
+		}
+		if command == "include" {
+			reader.clearPage()
+		}
+	case command == "includegraphics":
+		rel := ""
+		for _, dir := range append([]string{""}, reader.graphicsPath...) {
+			if rel = reader.resolve(dir+arg, append([]string{""}, latexImageExtensions...)); rel != "" {
+				break
+			}
+		}
+		if rel == "" {
+			fmt.Fprintf(os.Stderr, "warning: %s:%d: %s is not found, skipped\n", file.path, line, arg)
+			return nil
+		}
+		file.images = append(file.images, &latexImage{path: rel, size: reader.found[rel]})
+		if reader.inDocument {
+			reader.advance(file, latexImagePage)
+		}
+	case command == "graphicspath":
+		for _, match := range latexGraphicsPath.FindAllStringSubmatch(strings.TrimPrefix(text, `\graphicspath{`), -1) {
+			dir := util.CleanRelativePath(match[1])
+			if dir != "" {
+				reader.graphicsPath = append(reader.graphicsPath, dir+"/")
+			}
+		}
+	case command == "bibliography" || command == "addbibresource":
+		for _, name := range strings.Split(arg, ",") {
+			rel := reader.resolve(strings.TrimSpace(name), []string{".bib", ""})
+			if rel == "" {
+				fmt.Fprintf(os.Stderr, "warning: %s:%d: %s is not found, skipped\n", file.path, line, name)
+			} else if !reader.visited[rel] {
+				err := reader.read(rel, "bib", file.depth+1)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case command == "bibliographystyle":
+		document.bibStyle = arg
+	case strings.HasSuffix(command, "ref"):
+		for _, key := range strings.Split(arg, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				file.references = append(file.references, latexReference{key: key, line: line})
+			}
+		}
+	case strings.Contains(command, "cite"):
+		for _, key := range strings.Split(arg, ",") {
+			if key = strings.TrimSpace(key); key != "" && key != "*" {
+				file.citations = append(file.citations, latexReference{key: key, line: line})
+			}
+		}
+	case command == "label":
+		if arg != "" && !slices.Contains(document.labels, arg) {
+			document.labels = append(document.labels, arg)
+		}
+	case command == "tableofcontents" || command == "listoffigures" || command == "listoftables":
+		document.toc = true
+		reader.clearPage()
+		reader.advance(file, 1)
+	case command == "chapter" || command == "part" || command == "clearpage" || command == "newpage":
+		if command == "clearpage" || command == "newpage" || arg != "" {
+			reader.clearPage()
+		}
+	case command == "begin":
+		if arg == "document" {
+			reader.inDocument = true
+		}
+	}
+	return nil
+}
+
+// resolve returns the path of name with one of extensions that exists, relative to the root, "" if none of them exists
+func (reader *latexReader) resolve(name string, extensions []string) string {
+	for _, ext := range extensions {
+		rel := util.CleanRelativePath(name + ext)
+		if _, ok := reader.found[rel]; ok {
+			return rel
+		}
+	}
+	return ""
+}
+
+// lookup returns the path of a local package or class by its file name, like kpathsea within the root
+func (reader *latexReader) lookup(name string) string {
+	if _, ok := reader.found[name]; ok {
+		return name
+	}
+	var matches []string
+	for rel := range reader.found {
+		if path.Base(rel) == name {
+			matches = append(matches, rel)
+		}
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+	slices.Sort(matches)
+	return matches[0]
+}
+
+func (document *latexDocument) parseConfig(config *util.Config) error {
+	if config == nil {
+		return errors.New("latexDocument: config is nil")
+	}
+	d := configLatexDocument{}
+	err := config.Decode(&d)
+	if err != nil {
+		return err
+	}
+	err = d.validate()
+	if err != nil {
+		return err
+	}
+
+	document.name = d.Name
+	document.class = d.Class
+	document.packages = d.Packages
+	document.bibStyle = d.BibStyle
+	document.biber = d.Biber
+	document.labels = d.Labels
+	document.toc = d.Toc
+	for _, f := range d.Files {
+		document.files = append(document.files, f.file())
+	}
+	for _, f := range d.Bibliography {
+		document.bibliography = append(document.bibliography, f.file())
+	}
+	document.constructed = true
+	return nil
+}
+
+func (f *configLatexFile) file() *latexFile {
+	file := &latexFile{
+		path:    f.Path,
+		kind:    f.Kind,
+		size:    f.Size,
+		lines:   f.Lines,
+		depth:   f.Depth,
+		pages:   f.Pages,
+		entries: f.Entries,
+	}
+	for _, image := range f.Images {
+		file.images = append(file.images, &latexImage{path: image.Path, size: image.Size})
+	}
+	for _, citation := range f.Citations {
+		file.citations = append(file.citations, latexReference{key: citation.Key, line: citation.Line})
+	}
+	for _, reference := range f.References {
+		file.references = append(file.references, latexReference{key: reference.Key, line: reference.Line})
+	}
+	return file
+}
+
+// validate checks that the main file comes first, files are listed once with known kinds and valid sizes,
+// every file is read by the one before it or one of its parents, and keys are at lines within their files
+func (d *configLatexDocument) validate() error {
+	switch {
+	case d.Name == "":
+		return errors.New("malformed config: empty job name")
+	case d.Class == "":
+		return errors.New("malformed config: empty document class")
+	case len(d.Files) == 0:
+		return errors.New("malformed config: no files")
+	case d.Files[0].Kind != "tex" || d.Files[0].Depth != 0:
+		return fmt.Errorf("malformed config: the main file %s is not a .tex file read at depth 0", d.Files[0].Path)
+	}
+	seen := make(map[string]bool)
+	check := func(i int, f *configLatexFile, kinds []string) error {
+		switch {
+		case f.Path == "":
+			return fmt.Errorf("malformed config: file %d has no path", i)
+		case seen[f.Path]:
+			return fmt.Errorf("malformed config: file %d (%s) is listed more than once", i, f.Path)
+		case !slices.Contains(kinds, f.Kind):
+			return fmt.Errorf("malformed config: file %d (%s) has kind %q, should be one of %s", i, f.Path, f.Kind, strings.Join(kinds, ", "))
+		case f.Size < 0 || f.Lines < 0 || f.Pages < 0:
+			return fmt.Errorf("malformed config: file %d (%s) has negative size, lines or pages", i, f.Path)
+		}
+		seen[f.Path] = true
+		for _, image := range f.Images {
+			if image.Path == "" || image.Size < 0 {
+				return fmt.Errorf("malformed config: file %d (%s) includes an image without path or with negative size", i, f.Path)
+			}
+		}
+		for _, reference := range slices.Concat(f.Citations, f.References) {
+			if reference.Key == "" || reference.Line < 1 || reference.Line > f.Lines {
+				return fmt.Errorf("malformed config: file %d (%s) refers to %q at line %d, which is not within 1..%d", i, f.Path, reference.Key, reference.Line, f.Lines)
+			}
+		}
+		return nil
+	}
+	for i := range d.Files {
+		f := &d.Files[i]
+		err := check(i, f, []string{"tex", "sty", "cls"})
+		if err != nil {
+			return err
+		}
+		if i > 0 && (f.Depth < 1 || f.Depth > d.Files[i-1].Depth+1) {
+			return fmt.Errorf("malformed config: file %d (%s) is read at depth %d after a file at depth %d", i, f.Path, f.Depth, d.Files[i-1].Depth)
+		}
+	}
+	for i := range d.Bibliography {
+		err := check(i, &d.Bibliography[i], []string{"bib"})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (document *latexDocument) dumpConfig() ([]byte, error) {
+	if !document.constructed {
+		return nil, errNotConstructed
+	}
+	d := configLatexDocument{
+		Name:     document.name,
+		Class:    document.class,
+		Packages: document.packages,
+		BibStyle: document.bibStyle,
+		Biber:    document.biber,
+		Labels:   document.labels,
+		Toc:      document.toc,
+	}
+	for _, file := range document.files {
+		d.Files = append(d.Files, file.config())
+	}
+	for _, file := range document.bibliography {
+		d.Bibliography = append(d.Bibliography, file.config())
+	}
+	return json.Marshal(d)
+}
+
+func (file *latexFile) config() configLatexFile {
+	f := configLatexFile{
+		Path:    file.path,
+		Kind:    file.kind,
+		Size:    file.size,
+		Lines:   file.lines,
+		Depth:   file.depth,
+		Pages:   file.pages,
+		Entries: file.entries,
+	}
+	for _, image := range file.images {
+		f.Images = append(f.Images, configLatexImage{Path: image.path, Size: image.size})
+	}
+	for _, citation := range file.citations {
+		f.Citations = append(f.Citations, configLatexReference{Key: citation.key, Line: citation.line})
+	}
+	for _, reference := range file.references {
+		f.References = append(f.References, configLatexReference{Key: reference.key, Line: reference.line})
+	}
+	return f
+}
+
+// pages returns the number of pages of the document
+func (document *latexDocument) pages() int {
+	n := 0
+	for _, file := range document.files {
+		n += file.pages
+	}
+	return n
+}
+
+// cited returns the keys cited by the document, in the order they are first cited
+func (document *latexDocument) cited() []string {
+	var keys []string
+	for _, file := range document.files {
+		for _, citation := range file.citations {
+			if !slices.Contains(keys, citation.key) {
+				keys = append(keys, citation.key)
+			}
+		}
+	}
+	return keys
+}
+
+// defined reports whether key is an entry of the bibliography
+func (document *latexDocument) defined(key string) bool {
+	for _, file := range document.bibliography {
+		if slices.Contains(file.entries, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// plan returns the programs run by latexmk in order: pdflatex, then bibtex (or biber) if anything is cited, and pdflatex
+// again until cross-references are settled. rerun adds one more run of pdflatex when there are several of them,
+// for labels that moved once the bibliography or the table of contents is typeset
+func (document *latexDocument) plan(rerun bool) []string {
+	runs := []string{"pdflatex"}
+	references := false
+	for _, file := range document.files {
+		references = references || len(file.references) > 0
+	}
+	switch {
+	case len(document.bibliography) > 0 && len(document.cited()) > 0:
+		program := "bibtex"
+		if document.biber {
+			program = "biber"
+		}
+		runs = append(runs, program, "pdflatex", "pdflatex")
+	case references || document.toc:
+		runs = append(runs, "pdflatex")
+	}
+	if rerun && len(runs) > 1 {
+		runs = append(runs, "pdflatex")
+	}
+	return runs
+}
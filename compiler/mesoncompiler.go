@@ -0,0 +1,67 @@
+package compiler
+
+import (
+	"errors"
+
+	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// MesonCompiler pretends to run `meson setup builddir` and `meson compile -C builddir`, the project is read from
+// meson.build, and the build is the one of CXXCompiler over the same sources
+type MesonCompiler struct {
+	*CXXCompiler
+	project *mesonProject
+}
+
+// options: how the directory is traversed for sources, only used by SourceTypeDir
+func NewMesonCompiler(path string, config *util.Config, sourceType SourceType, threads int, options util.TraverseOptions) (*MesonCompiler, error) {
+	if threads <= 0 {
+		return nil, errors.New("MesonCompiler: threads should be a positive number")
+	}
+	project, err := newMesonProject(path, config, sourceType, options)
+	if err != nil {
+		return nil, err
+	}
+	return &MesonCompiler{
+		CXXCompiler: newCXXCompiler(project.sources, threads),
+		project:     project,
+	}, nil
+}
+
+func (compiler *MesonCompiler) SetProgressBar(bar progressbar.ProgressBar) {
+	compiler.CXXCompiler.SetProgressBar(bar)
+
+	if asMeson, ok := bar.(*progressbar.MesonProgressBar); ok {
+		project := compiler.project
+		info := progressbar.MesonProject{
+			Name:      project.name,
+			Version:   project.version,
+			Languages: project.languages,
+			Programs:  project.programs,
+		}
+		for _, dep := range project.dependencies {
+			info.Dependencies = append(info.Dependencies, progressbar.MesonDependency{Name: dep.name, Version: dep.version, Required: dep.required})
+		}
+		for _, target := range project.targets {
+			info.Targets = append(info.Targets, progressbar.MesonTarget{Kind: target.kind, Name: target.name})
+		}
+		asMeson.SetProject(info)
+	}
+}
+
+func (compiler *MesonCompiler) DumpConfig(path string, compression util.Compression) error {
+	b, err := compiler.project.dumpConfig()
+	if err != nil {
+		return err
+	}
+	return util.DumpConfigFile(path, &util.Config{
+		CompilerType:        "meson",
+		Compression:         compression,
+		UncompressedContent: b,
+		Metadata: util.ConfigMetadata{
+			Source: compiler.project.name,
+			Tasks:  compiler.project.sources.len(),
+		},
+	})
+}
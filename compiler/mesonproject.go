@@ -0,0 +1,340 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// mesonProject is what `meson setup` reports of a project, the sources are found like cxx and compiled into the
+// first build target
+type mesonProject struct {
+	name         string
+	version      string
+	languages    []string
+	dependencies []mesonDependency
+	programs     []string
+	targets      []mesonTarget
+	sources      *cxxDependency
+}
+
+type mesonDependency struct {
+	name     string
+	version  string // the version found, empty for dependencies without one, e.g. threads
+	required bool
+}
+
+type mesonTarget struct {
+	kind string // executable, library, shared_library, static_library, both_libraries or shared_module
+	name string
+}
+
+// build target functions of meson
+var mesonTargetKinds = []string{"executable", "library", "shared_library", "static_library", "both_libraries", "shared_module"}
+
+// versions of common modules found by pkg-config, versions of the others are made up
+var pkgConfigVersions = map[string]string{
+	"glib-2.0":       "2.80.0",
+	"gobject-2.0":    "2.80.0",
+	"gio-2.0":        "2.80.0",
+	"gtk4":           "4.14.2",
+	"gtk+-3.0":       "3.24.41",
+	"zlib":           "1.3",
+	"libcurl":        "8.5.0",
+	"openssl":        "3.0.13",
+	"libssl":         "3.0.13",
+	"libcrypto":      "3.0.13",
+	"sqlite3":        "3.45.1",
+	"libxml-2.0":     "2.9.14",
+	"json-glib-1.0":  "1.8.0",
+	"libsystemd":     "255",
+	"dbus-1":         "1.14.10",
+	"x11":            "1.8.7",
+	"wayland-client": "1.22.0",
+	"libpng":         "1.6.43",
+	"fmt":            "10.2.1",
+	"gtest":          "1.14.0",
+	"threads":        "",
+	"dl":             "",
+	"openmp":         "",
+}
+
+// content of meson config, sources are stored in the same way as cxx config, whose target name is the first build target
+//
+//	{"project": {"name": "foo", "version": "0.1", "languages": ["c"], "deps": [{"name": "glib-2.0", "ver": "2.80.0", "required": true}],
+//	 "programs": ["python3"], "targets": [{"kind": "executable", "name": "foo"}]}, "format": 2, "target_name": "foo", ...}
+type configMesonProject struct {
+	Project configMesonInfo `json:"project"`
+	rawFakeCXXDepJson
+}
+
+type configMesonInfo struct {
+	Name         string                  `json:"name"`
+	Version      string                  `json:"version,omitempty"`
+	Languages    []string                `json:"languages"`
+	Dependencies []configMesonDependency `json:"deps,omitempty"`
+	Programs     []string                `json:"programs,omitempty"`
+	Targets      []configMesonTarget     `json:"targets,omitempty"`
+}
+
+type configMesonDependency struct {
+	Name     string `json:"name"`
+	Version  string `json:"ver,omitempty"`
+	Required bool   `json:"required"`
+}
+
+type configMesonTarget struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+func newMesonProject(path string, config *util.Config, sourceType SourceType, options util.TraverseOptions) (*mesonProject, error) {
+	project := new(mesonProject)
+	switch sourceType {
+	case SourceTypeConfig:
+		err := project.parseConfig(config)
+		if err != nil {
+			return nil, err
+		}
+	case SourceTypeDir:
+		err := project.parseDirectory(path, options)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("mesonProject: unknown sourceType " + strconv.Itoa(int(sourceType)))
+	}
+	return project, nil
+}
+
+// parseDirectory reads meson.build within root and the subdirs it enters, then walks root for sources like cxx
+func (project *mesonProject) parseDirectory(root string, options util.TraverseOptions) error {
+	err := project.parseBuild(root, ".")
+	if err != nil {
+		return err
+	}
+	if project.name == "" {
+		return errors.New("meson.build: project() is not called")
+	}
+	project.sources, err = newCXXDep(root, nil, SourceTypeDir, options)
+	if err != nil {
+		return err
+	}
+	project.sources.targetName = project.mainTarget()
+	return nil
+}
+
+// parseBuild reads meson.build of dir, which is relative to root, and those of subdir() calls within it
+func (project *mesonProject) parseBuild(root, dir string) error {
+	file := filepath.Join(root, dir, "meson.build")
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	// the syntax of meson.build is close enough to starlark to be read by the parser of BUILD files
+	tokens, err := tokenizeStarlark(string(b))
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	var subdirs []string
+	p := &starlarkParser{tokens: tokens, variables: map[string]starlarkValue{
+		"true":  {strings: []string{"true"}},
+		"false": {strings: []string{"false"}},
+	}}
+	// the first positional argument, e.g. the name of dependency('glib-2.0')
+	first := func(call starlarkValue) string {
+		if len(call.args) == 0 || len(call.args[0].strings) == 0 {
+			return ""
+		}
+		return call.args[0].strings[0]
+	}
+	p.onCall = func(call starlarkValue, line int) {
+		switch {
+		case call.call == "project":
+			project.name = first(call)
+			for _, arg := range call.args[min(len(call.args), 1):] {
+				project.languages = append(project.languages, arg.strings...)
+			}
+			if version := call.kwargs["version"].strings; len(version) > 0 {
+				project.version = version[0]
+			}
+		case call.call == "add_languages":
+			for _, arg := range call.args {
+				for _, language := range arg.strings {
+					if !slices.Contains(project.languages, language) {
+						project.languages = append(project.languages, language)
+					}
+				}
+			}
+		case call.call == "dependency":
+			name := first(call)
+			if name == "" || slices.ContainsFunc(project.dependencies, func(dep mesonDependency) bool { return dep.name == name }) {
+				return
+			}
+			required, ok := call.kwargs["required"]
+			project.dependencies = append(project.dependencies, mesonDependency{
+				name:     name,
+				version:  foundVersion(pkgConfigVersions, name, call.kwargs["version"].strings),
+				required: !ok || slices.Equal(required.strings, []string{"true"}),
+			})
+		case call.call == "find_program":
+			if name := first(call); name != "" && !slices.Contains(project.programs, name) {
+				project.programs = append(project.programs, name)
+			}
+		case call.call == "subdir":
+			if name := first(call); name != "" {
+				subdirs = append(subdirs, name)
+			}
+		case slices.Contains(mesonTargetKinds, call.call):
+			name := first(call)
+			if name == "" {
+				name = project.name // e.g. executable(meson.project_name(), ...)
+			}
+			project.targets = append(project.targets, mesonTarget{kind: call.call, name: name})
+		}
+	}
+	p.parse()
+
+	for _, subdir := range subdirs {
+		err = project.parseBuild(root, filepath.Join(dir, subdir))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var versionRegexp = regexp.MustCompile(`(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+// foundVersion returns the version of a dependency found on the host, from known versions if it is listed,
+// otherwise a made-up one that satisfies constraints like ">=2.56"
+func foundVersion(known map[string]string, name string, constraints []string) string {
+	if version, ok := known[name]; ok {
+		return version
+	}
+	for _, constraint := range constraints {
+		m := versionRegexp.FindStringSubmatch(constraint)
+		if m == nil {
+			continue
+		}
+		major, _ := strconv.Atoi(m[1])
+		minor, _ := strconv.Atoi(m[2])
+		switch {
+		case strings.HasPrefix(constraint, "=="):
+			return m[0]
+		case strings.HasPrefix(constraint, "<"), strings.HasPrefix(constraint, "!="):
+			continue
+		default:
+			return fmt.Sprintf("%d.%d.%d", major, minor+rand.IntN(4), rand.IntN(10))
+		}
+	}
+	return fmt.Sprintf("%d.%d.%d", 1+rand.IntN(3), rand.IntN(20), rand.IntN(10))
+}
+
+// mainTarget is the target that sources are compiled into, the project itself if it has no build target
+func (project *mesonProject) mainTarget() string {
+	if len(project.targets) > 0 {
+		return project.targets[0].name
+	}
+	return project.name
+}
+
+func (project *mesonProject) parseConfig(config *util.Config) error {
+	if config == nil {
+		return errors.New("mesonProject: config is nil")
+	}
+	raw := new(configMesonProject)
+	err := config.Decode(raw)
+	if err != nil {
+		return err
+	}
+	err = raw.validate()
+	if err != nil {
+		return err
+	}
+
+	info := raw.Project
+	project.name = info.Name
+	project.version = info.Version
+	project.languages = info.Languages
+	project.programs = info.Programs
+	for _, dep := range info.Dependencies {
+		project.dependencies = append(project.dependencies, mesonDependency{name: dep.Name, version: dep.Version, required: dep.Required})
+	}
+	for _, target := range info.Targets {
+		project.targets = append(project.targets, mesonTarget{kind: target.Kind, name: target.Name})
+	}
+	project.sources = new(cxxDependency)
+	project.sources.fromRaw(&raw.rawFakeCXXDepJson)
+	return nil
+}
+
+// validate checks the project and its sources, the target name of sources must be the first build target
+func (raw *configMesonProject) validate() error {
+	info := raw.Project
+	if info.Name == "" {
+		return errors.New("malformed config: empty project name")
+	}
+	for i, dep := range info.Dependencies {
+		if dep.Name == "" {
+			return fmt.Errorf("malformed config: dependency %d has no name", i)
+		}
+	}
+	for i, program := range info.Programs {
+		if program == "" {
+			return fmt.Errorf("malformed config: program %d has no name", i)
+		}
+	}
+	seen := make(map[configMesonTarget]bool)
+	for i, target := range info.Targets {
+		switch {
+		case target.Name == "":
+			return fmt.Errorf("malformed config: target %d has no name", i)
+		case !slices.Contains(mesonTargetKinds, target.Kind):
+			return fmt.Errorf("malformed config: target %s has unknown kind %q", target.Name, target.Kind)
+		case seen[target]:
+			return fmt.Errorf("malformed config: %s %s is listed more than once", target.Kind, target.Name)
+		}
+		seen[target] = true
+	}
+	main := info.Name
+	if len(info.Targets) > 0 {
+		main = info.Targets[0].Name
+	}
+	if raw.TargetName != main {
+		return fmt.Errorf("malformed config: sources are compiled into %s, but the first target is %s", raw.TargetName, main)
+	}
+	return raw.rawFakeCXXDepJson.validate()
+}
+
+func (project *mesonProject) dumpConfig() ([]byte, error) {
+	if !project.sources.constructed {
+		return nil, errNotConstructed
+	}
+	raw := &configMesonProject{
+		Project: configMesonInfo{
+			Name:      project.name,
+			Version:   project.version,
+			Languages: project.languages,
+			Programs:  project.programs,
+		},
+		rawFakeCXXDepJson: *project.sources.toRaw(),
+	}
+	for _, dep := range project.dependencies {
+		raw.Project.Dependencies = append(raw.Project.Dependencies, configMesonDependency{Name: dep.name, Version: dep.version, Required: dep.required})
+	}
+	for _, target := range project.targets {
+		raw.Project.Targets = append(raw.Project.Targets, configMesonTarget{Kind: target.kind, Name: target.name})
+	}
+	return json.Marshal(raw)
+}
@@ -0,0 +1,110 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/report"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// MultiCompiler builds stages of a multi config one after another, e.g. cxx third-party libraries, then a cargo workspace.
+// Each stage is built by the compiler of its type, with its own progress bar
+type MultiCompiler struct {
+	config *util.Config
+	stages []Compiler
+	types  []string // compiler type of each stage
+}
+
+func NewMultiCompiler(config *util.Config, threads int) (*MultiCompiler, error) {
+	if config == nil {
+		return nil, fmt.Errorf("MultiCompiler: config is nil")
+	}
+	stages, err := config.Stages()
+	if err != nil {
+		return nil, err
+	}
+	compiler := &MultiCompiler{config: config}
+	for i, stage := range stages {
+		c, err := New(stage.CompilerType, "", stage, SourceTypeConfig, threads, util.TraverseOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i, err)
+		}
+		compiler.stages = append(compiler.stages, c)
+		compiler.types = append(compiler.types, stage.CompilerType)
+	}
+	// default bars, in the style of each stage
+	err = compiler.SetStageProgressBars(progressbar.New)
+	if err != nil {
+		return nil, err
+	}
+	return compiler, nil
+}
+
+// Run builds stages one after another, until a stage that runs tests has failed ones
+func (compiler *MultiCompiler) Run() {
+	for _, stage := range compiler.stages {
+		stage.Run()
+		if asTester, ok := stage.(Tester); ok && asTester.ExitCode() != 0 {
+			break
+		}
+	}
+}
+
+// SetFailures sets failures of every stage that runs tests
+func (compiler *MultiCompiler) SetFailures(failing, flaky []string) error {
+	found := false
+	for _, stage := range compiler.stages {
+		if asTester, ok := stage.(Tester); ok {
+			found = true
+			err := asTester.SetFailures(failing, flaky)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if !found {
+		return errors.New("no stage runs tests")
+	}
+	return nil
+}
+
+// ExitCode returns the first non-zero exit status of stages that run tests
+func (compiler *MultiCompiler) ExitCode() int {
+	for _, stage := range compiler.stages {
+		if asTester, ok := stage.(Tester); ok && asTester.ExitCode() != 0 {
+			return asTester.ExitCode()
+		}
+	}
+	return 0
+}
+
+// SetProgressBar is a no-op: a bar tracks a single build, so stages can not share one, use SetStageProgressBars instead
+func (compiler *MultiCompiler) SetProgressBar(bar progressbar.ProgressBar) {
+}
+
+// SetStageProgressBars sets the bar of every stage by newBar, which is called with the compiler type of the stage
+func (compiler *MultiCompiler) SetStageProgressBars(newBar func(stageType string) (progressbar.ProgressBar, error)) error {
+	for i, stage := range compiler.stages {
+		bar, err := newBar(compiler.types[i])
+		if err != nil {
+			return err
+		}
+		stage.SetProgressBar(bar)
+	}
+	return nil
+}
+
+// SetRecorder records all stages on the same timeline
+func (compiler *MultiCompiler) SetRecorder(recorder *report.Recorder) {
+	for _, stage := range compiler.stages {
+		stage.SetRecorder(recorder)
+	}
+}
+
+func (compiler *MultiCompiler) DumpConfig(path string, compression util.Compression) error {
+	config := *compiler.config
+	config.Compression = compression
+	return util.DumpConfigFile(path, &config)
+}
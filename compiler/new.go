@@ -0,0 +1,42 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// New creates a compiler of given type: cxx, cargo, node, bundle, pip, gradle, maven, bazel, meson, test, docker, latex, or multi (config only)
+func New(compilerType, path string, config *util.Config, sourceType SourceType, threads int, options util.TraverseOptions) (Compiler, error) {
+	switch compilerType {
+	case "cxx":
+		return NewCXXCompiler(path, config, sourceType, threads, options)
+	case "cargo":
+		return NewCargoCompiler(path, config, sourceType, threads)
+	case "node":
+		return NewNodeCompiler(path, config, sourceType, threads)
+	case "bundle":
+		return NewBundleCompiler(path, config, sourceType, threads, options)
+	case "pip":
+		return NewPipCompiler(path, config, sourceType, threads)
+	case "gradle", "maven":
+		return NewJvmCompiler(compilerType, path, config, sourceType, threads)
+	case "bazel":
+		return NewBazelCompiler(path, config, sourceType, threads)
+	case "meson":
+		return NewMesonCompiler(path, config, sourceType, threads, options)
+	case "test":
+		return NewTestCompiler(path, config, sourceType, threads)
+	case "docker":
+		return NewDockerCompiler(path, config, sourceType, threads)
+	case "latex":
+		return NewLatexCompiler(path, config, sourceType, threads, options)
+	case "multi":
+		if sourceType != SourceTypeConfig {
+			return nil, fmt.Errorf("multi compiler can only run over config files")
+		}
+		return NewMultiCompiler(config, threads)
+	default:
+		return nil, fmt.Errorf("unknown compiler type %s", compilerType)
+	}
+}
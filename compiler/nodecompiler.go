@@ -0,0 +1,122 @@
+package compiler
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/report"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// NodeCompiler pretends to run `npm install`: packages of the lockfile are fetched and linked into node_modules,
+// a package is linked once all of its dependencies are
+type NodeCompiler struct {
+	project *nodeProject
+	bar     progressbar.ProgressBar
+	threads int
+
+	recorder *report.Recorder
+
+	cacheHit float64 // probability that the tarball of a package is in the local cache
+}
+
+// expected values of the random distributions used by install, in milliseconds, see also Estimate
+const (
+	nodeFetchMs     = 220 // download a tarball from the registry
+	nodeCacheMs     = 15  // read a tarball from the local cache
+	nodeLinkMs      = 35  // extract and link into node_modules
+	nodeCacheHitAvg = 0.35
+)
+
+func NewNodeCompiler(path string, config *util.Config, sourceType SourceType, threads int) (*NodeCompiler, error) {
+	if threads <= 0 {
+		return nil, errors.New("NodeCompiler: threads should be a positive number")
+	}
+	project, err := newNodeProject(path, config, sourceType)
+	if err != nil {
+		return nil, err
+	}
+	return &NodeCompiler{
+		project: project,
+		threads: threads,
+	}, nil
+}
+
+func (compiler *NodeCompiler) start(pack *nodePackage, slot int) {
+	compiler.recorder.Start(pack, pack.String(), slot)
+	compiler.bar.TaskStart(pack.String())
+	compiler.install()
+	compiler.recorder.Complete(pack)
+}
+
+func (compiler *NodeCompiler) finish(pack *nodePackage) {
+	compiler.bar.TaskComplete(pack.String())
+}
+
+func (compiler *NodeCompiler) install() {
+	fetchMs := max(util.GetRandomFromDistribution(nodeFetchMs, nodeFetchMs/2), 30)
+	if rand.Float64() < compiler.cacheHit {
+		fetchMs = max(util.GetRandomFromDistribution(nodeCacheMs, nodeCacheMs/2), 2)
+	}
+	linkMs := max(util.GetRandomFromDistribution(nodeLinkMs, nodeLinkMs/2), 5)
+	time.Sleep(time.Duration(fetchMs+linkMs) * time.Millisecond)
+}
+
+func (compiler *NodeCompiler) Run() {
+	compiler.cacheHit = util.GetRandomUniformDistribution(nodeCacheHitAvg-0.25, nodeCacheHitAvg+0.25)
+
+	compiler.bar.Prologue()
+
+	compiler.recorder.Begin(compiler.threads)
+	err := compiler.project.schedule(func(pack *nodePackage) {
+		compiler.recorder.Ready(pack)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = compiler.project.run(compiler.threads, compiler.start, compiler.finish)
+	if err != nil {
+		log.Fatal(err)
+	}
+	compiler.recorder.Finish()
+
+	compiler.bar.Epilogue()
+}
+
+func (compiler *NodeCompiler) SetRecorder(recorder *report.Recorder) {
+	compiler.recorder = recorder
+}
+
+func (compiler *NodeCompiler) SetProgressBar(bar progressbar.ProgressBar) {
+	compiler.bar = bar
+
+	var totalTasks []string
+	for _, pack := range compiler.project.packages {
+		totalTasks = append(totalTasks, pack.String())
+	}
+	compiler.bar.SetTotalTasks(totalTasks)
+
+	if asNpm, ok := compiler.bar.(*progressbar.NpmProgressBar); ok {
+		asNpm.SetProjectName(compiler.project.rootName)
+	}
+}
+
+func (compiler *NodeCompiler) DumpConfig(path string, compression util.Compression) error {
+	b, err := compiler.project.dumpConfig()
+	if err != nil {
+		return err
+	}
+	return util.DumpConfigFile(path, &util.Config{
+		CompilerType:        "node",
+		Compression:         compression,
+		UncompressedContent: b,
+		Metadata: util.ConfigMetadata{
+			Source: compiler.project.rootName,
+			Tasks:  len(compiler.project.packages),
+		},
+	})
+}
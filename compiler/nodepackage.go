@@ -0,0 +1,584 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rizutazu/fake-compiler/util"
+	"gopkg.in/yaml.v3"
+)
+
+// a single package installed into node_modules
+type nodePackage struct {
+	name         string
+	version      string
+	dependencies []*nodePackage
+	requiredBy   []*nodePackage
+}
+
+func (pack *nodePackage) String() string {
+	return pack.name + "@" + pack.version
+}
+
+// dependsOn adds the edge pack -> dep, self and duplicate edges are dropped
+func (pack *nodePackage) dependsOn(dep *nodePackage) {
+	if dep == pack || slices.Contains(pack.dependencies, dep) {
+		return
+	}
+	pack.dependencies = append(pack.dependencies, dep)
+	dep.requiredBy = append(dep.requiredBy, pack)
+}
+
+func newNodeProject(path string, config *util.Config, sourceType SourceType) (*nodeProject, error) {
+	project := new(nodeProject)
+	switch sourceType {
+	case SourceTypeDir:
+		err := project.parseDirectory(path)
+		if err != nil {
+			return nil, err
+		}
+	case SourceTypeConfig:
+		err := project.parseConfig(config)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("nodeProject: unknown sourceType " + strconv.Itoa(int(sourceType)))
+	}
+	return project, nil
+}
+
+// nodeProject defines packages installed by the lockfile of a node project, written by npm, yarn or pnpm
+type nodeProject struct {
+	rootName    string         // name of the root package, from package.json
+	lockfile    string         // file name of the lockfile that packages come from
+	packages    []*nodePackage // all installed packages, the root package is not included
+	jobs        *jobQueue[*nodePackage]
+	constructed bool
+}
+
+type configNodePackage struct {
+	Name         string `json:"name"`
+	Version      string `json:"ver"`
+	Dependencies []int  `json:"dep"` // index in `Packages` array
+}
+type configNodeProject struct {
+	Name     string              `json:"name"`
+	Lockfile string              `json:"lockfile"`
+	Packages []configNodePackage `json:"packages"`
+}
+
+// lockfiles supported by the node compiler, the first one found in the directory is used
+var nodeLockfiles = []struct {
+	name  string
+	parse func(b []byte) ([]*nodePackage, error)
+}{
+	{"package-lock.json", parsePackageLock},
+	{"yarn.lock", parseYarnLock},
+	{"pnpm-lock.yaml", parsePnpmLock},
+}
+
+func (project *nodeProject) parseDirectory(path string) error {
+	for _, lockfile := range nodeLockfiles {
+		b, err := os.ReadFile(path + lockfile.name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		packages, err := lockfile.parse(b)
+		if err != nil {
+			return fmt.Errorf("%s: %w", lockfile.name, err)
+		}
+		if len(packages) == 0 {
+			return fmt.Errorf("%s: no packages installed", lockfile.name)
+		}
+		project.packages = packages
+		project.lockfile = lockfile.name
+		break
+	}
+	if project.lockfile == "" {
+		return fmt.Errorf("no package-lock.json, yarn.lock or pnpm-lock.yaml found in %s", path)
+	}
+
+	project.rootName = packageName(path)
+
+	// node packages may depend on each other, e.g. by peer dependencies, members of a cycle are linked together
+	breakCycles(project.packages, func(pack *nodePackage) (*[]*nodePackage, *[]*nodePackage) {
+		return &pack.dependencies, &pack.requiredBy
+	})
+
+	rand.Shuffle(len(project.packages), func(i, j int) {
+		project.packages[i], project.packages[j] = project.packages[j], project.packages[i]
+	})
+	project.constructed = true
+	return nil
+}
+
+// packageName returns the name in package.json of the node project in path, or the directory name if there is none
+func packageName(path string) string {
+	if b, err := os.ReadFile(path + "package.json"); err == nil {
+		var manifest struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal(b, &manifest) == nil && manifest.Name != "" {
+			return manifest.Name
+		}
+	}
+	return filepath.Base(filepath.Clean(path))
+}
+
+// parsePackageLock parses package-lock.json of lockfileVersion 2 and 3, where every installed package is listed
+// under "packages" by its location, e.g. "node_modules/a/node_modules/b"
+func parsePackageLock(b []byte) ([]*nodePackage, error) {
+	type rawEntry struct {
+		Name                 string            `json:"name"`
+		Version              string            `json:"version"`
+		Link                 bool              `json:"link"`
+		Resolved             string            `json:"resolved"`
+		Dependencies         map[string]string `json:"dependencies"`
+		OptionalDependencies map[string]string `json:"optionalDependencies"`
+		PeerDependencies     map[string]string `json:"peerDependencies"`
+	}
+	var raw struct {
+		LockfileVersion int                 `json:"lockfileVersion"`
+		Packages        map[string]rawEntry `json:"packages"`
+	}
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, err
+	}
+	if raw.LockfileVersion < 2 || raw.Packages == nil {
+		return nil, fmt.Errorf("lockfileVersion %d is written by npm 6 or earlier and not supported, run `npm install` with npm 7 or later to upgrade it", raw.LockfileVersion)
+	}
+
+	locations := slices.Sorted(maps.Keys(raw.Packages))
+	installed := make(map[string]*nodePackage)
+	links := make(map[string]string) // {location: location of link target}, workspaces are linked into node_modules
+	var packages []*nodePackage
+	for _, location := range locations {
+		entry := raw.Packages[location]
+		switch {
+		case location == "":
+			continue // the root package
+		case entry.Link:
+			links[location] = entry.Resolved
+			continue
+		}
+		pack := &nodePackage{name: entry.Name, version: entry.Version}
+		if pack.name == "" {
+			_, pack.name, _ = cutLast(location, "node_modules/")
+		}
+		if pack.version == "" {
+			pack.version = "0.0.0"
+		}
+		installed[location] = pack
+		packages = append(packages, pack)
+	}
+
+	lookup := func(location string) *nodePackage {
+		if target, ok := links[location]; ok {
+			location = target
+		}
+		return installed[location]
+	}
+	// node resolves a dependency from the nearest node_modules, up to the root
+	resolve := func(from, name string) *nodePackage {
+		dir := from
+		for {
+			location := "node_modules/" + name
+			if dir != "" {
+				location = dir + "/" + location
+			}
+			if pack := lookup(location); pack != nil {
+				return pack
+			}
+			if dir == "" {
+				return nil
+			}
+			dir, _, _ = cutLast(dir, "/node_modules/")
+		}
+	}
+	for _, location := range locations {
+		pack, ok := installed[location]
+		if !ok {
+			continue
+		}
+		entry := raw.Packages[location]
+		for _, deps := range []map[string]string{entry.Dependencies, entry.OptionalDependencies, entry.PeerDependencies} {
+			for _, name := range slices.Sorted(maps.Keys(deps)) {
+				// optional and peer dependencies are not necessarily installed
+				if dep := resolve(location, name); dep != nil {
+					pack.dependsOn(dep)
+				}
+			}
+		}
+	}
+	return packages, nil
+}
+
+// cutLast slices s around the last instance of sep, before is empty if not found
+func cutLast(s, sep string) (before, after string, found bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return "", s, false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+// splitSpecifier splits "name@range" into name and range, the name may be scoped like "@babel/core"
+func splitSpecifier(specifier string) (name, version string) {
+	i := strings.Index(specifier[min(1, len(specifier)):], "@")
+	if i < 0 {
+		return specifier, ""
+	}
+	i++
+	return specifier[:i], specifier[i+1:]
+}
+
+// parseYarnLock parses yarn.lock of yarn classic (v1), or yarn berry (v2 and later), which is yaml
+func parseYarnLock(b []byte) ([]*nodePackage, error) {
+	if bytes.HasPrefix(b, []byte("__metadata:")) || bytes.Contains(b, []byte("\n__metadata:")) {
+		return parseYarnBerryLock(b)
+	}
+
+	// every entry is resolved from one or more specifiers:
+	//
+	//	"@babel/code-frame@^7.0.0", "@babel/code-frame@^7.10.4":
+	//	  version "7.12.13"
+	//	  dependencies:
+	//	    "@babel/highlight" "^7.12.13"
+	type rawEntry struct {
+		name         string
+		version      string
+		dependencies []string // specifiers
+	}
+	var entries []*rawEntry
+	specifiers := make(map[string]*rawEntry)
+	var entry *rawEntry
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		switch indent := len(line) - len(trimmed); {
+		case indent == 0:
+			if !strings.HasSuffix(line, ":") {
+				return nil, fmt.Errorf("line %d: expect an entry like \"name@range:\"", n)
+			}
+			entry = new(rawEntry)
+			entries = append(entries, entry)
+			for _, specifier := range strings.Split(strings.TrimSuffix(line, ":"), ", ") {
+				specifier = strings.Trim(specifier, `"`)
+				entry.name, _ = splitSpecifier(specifier)
+				specifiers[specifier] = entry
+			}
+			section = ""
+		case entry == nil:
+			return nil, fmt.Errorf("line %d: field outside of any entry", n)
+		case indent == 2:
+			key, value := splitYarnField(trimmed)
+			section = ""
+			switch {
+			case strings.HasSuffix(trimmed, ":"):
+				section = strings.TrimSuffix(trimmed, ":")
+			case key == "version":
+				entry.version = value
+			}
+		case section == "dependencies" || section == "optionalDependencies":
+			name, value := splitYarnField(trimmed)
+			entry.dependencies = append(entry.dependencies, name+"@"+value)
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	packages := make(map[*rawEntry]*nodePackage)
+	var result []*nodePackage
+	for _, entry := range entries {
+		pack := &nodePackage{name: entry.name, version: entry.version}
+		packages[entry] = pack
+		result = append(result, pack)
+	}
+	for _, entry := range entries {
+		for _, specifier := range entry.dependencies {
+			// optional dependencies of other platforms are not listed
+			if dep, ok := specifiers[specifier]; ok {
+				packages[entry].dependsOn(packages[dep])
+			}
+		}
+	}
+	return result, nil
+}
+
+// splitYarnField splits `key "value"` of yarn classic lockfile, both of them may be quoted
+func splitYarnField(field string) (key, value string) {
+	if strings.HasPrefix(field, `"`) {
+		if i := strings.Index(field[1:], `"`); i >= 0 {
+			key, value = field[1:i+1], field[i+2:]
+		}
+	} else {
+		key, value, _ = strings.Cut(field, " ")
+	}
+	return key, strings.Trim(strings.TrimSpace(value), `"`)
+}
+
+func parseYarnBerryLock(b []byte) ([]*nodePackage, error) {
+	// "@babel/code-frame@npm:^7.0.0, @babel/code-frame@npm:^7.10.4":
+	//   version: 7.12.13
+	//   resolution: "@babel/code-frame@npm:7.12.13"
+	//   dependencies:
+	//     "@babel/highlight": ^7.12.13
+	type rawEntry struct {
+		Version              string            `yaml:"version"`
+		Resolution           string            `yaml:"resolution"`
+		Dependencies         map[string]string `yaml:"dependencies"`
+		OptionalDependencies map[string]string `yaml:"optionalDependencies"`
+	}
+	var raw map[string]rawEntry
+	err := yaml.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptors := make(map[string]*nodePackage)
+	var keys []string
+	var packages []*nodePackage
+	for _, key := range slices.Sorted(maps.Keys(raw)) {
+		entry := raw[key]
+		if key == "__metadata" || strings.HasSuffix(entry.Resolution, "@workspace:.") {
+			continue // the root workspace
+		}
+		name, _ := splitSpecifier(entry.Resolution)
+		pack := &nodePackage{name: name, version: entry.Version}
+		for _, descriptor := range strings.Split(key, ", ") {
+			descriptors[descriptor] = pack
+		}
+		keys = append(keys, key)
+		packages = append(packages, pack)
+	}
+	for i, key := range keys {
+		entry := raw[key]
+		for _, deps := range []map[string]string{entry.Dependencies, entry.OptionalDependencies} {
+			for _, name := range slices.Sorted(maps.Keys(deps)) {
+				// ranges without protocol are resolved from npm
+				descriptor := deps[name]
+				if !strings.Contains(descriptor, ":") {
+					descriptor = "npm:" + descriptor
+				}
+				if dep, ok := descriptors[name+"@"+descriptor]; ok {
+					packages[i].dependsOn(dep)
+				}
+			}
+		}
+	}
+	return packages, nil
+}
+
+// parsePnpmLock parses pnpm-lock.yaml, packages are keyed by "/name/version" before lockfile version 6,
+// "/name@version" since 6, and "name@version" with dependencies under "snapshots" since 9.
+// Peer dependencies are resolved within the key, like "name@version(peer@version)"
+func parsePnpmLock(b []byte) ([]*nodePackage, error) {
+	type rawEntry struct {
+		Dependencies         map[string]string `yaml:"dependencies"`
+		OptionalDependencies map[string]string `yaml:"optionalDependencies"`
+	}
+	var raw struct {
+		LockfileVersion any                 `yaml:"lockfileVersion"`
+		Packages        map[string]rawEntry `yaml:"packages"`
+		Snapshots       map[string]rawEntry `yaml:"snapshots"`
+	}
+	err := yaml.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, err
+	}
+	version := fmt.Sprint(raw.LockfileVersion)
+	major, err := strconv.Atoi(strings.Split(version, ".")[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid lockfileVersion %q", version)
+	}
+	entries := raw.Packages
+	if major >= 9 {
+		entries = raw.Snapshots
+	}
+
+	// key in the form of "name@version(peers)"
+	normalize := func(key string) string {
+		key = strings.TrimPrefix(key, "/")
+		if major < 6 {
+			if name, version, found := cutLast(key, "/"); found {
+				return name + "@" + version
+			}
+		}
+		return key
+	}
+	keys := slices.Sorted(maps.Keys(entries))
+	installed := make(map[string]*nodePackage)
+	var packages []*nodePackage
+	for _, key := range keys {
+		name, version := splitSpecifier(normalize(key))
+		// strip resolved peer dependencies
+		version, _, _ = strings.Cut(version, "(")
+		version, _, _ = strings.Cut(version, "_")
+		pack := &nodePackage{name: name, version: version}
+		installed[normalize(key)] = pack
+		packages = append(packages, pack)
+	}
+	for i, key := range keys {
+		entry := entries[key]
+		for _, deps := range []map[string]string{entry.Dependencies, entry.OptionalDependencies} {
+			for _, name := range slices.Sorted(maps.Keys(deps)) {
+				value := deps[name]
+				var target string
+				switch base, _, _ := strings.Cut(value, "("); {
+				case strings.HasPrefix(value, "link:") || strings.HasPrefix(value, "file:"):
+					continue // local packages are not installed from the registry
+				case strings.HasPrefix(value, "/"):
+					target = normalize(value)
+				case major >= 6 && strings.Contains(base, "@"):
+					target = value // aliased, e.g. "string-width@4.2.3"
+				default:
+					target = name + "@" + value
+				}
+				// optional dependencies of other platforms are not listed
+				if dep, ok := installed[target]; ok {
+					packages[i].dependsOn(dep)
+				}
+			}
+		}
+	}
+	return packages, nil
+}
+
+func (project *nodeProject) parseConfig(config *util.Config) error {
+	p := configNodeProject{}
+	err := config.Decode(&p)
+	if err != nil {
+		return err
+	}
+	err = p.validate()
+	if err != nil {
+		return err
+	}
+
+	project.rootName = p.Name
+	project.lockfile = p.Lockfile
+	for _, cPack := range p.Packages {
+		project.packages = append(project.packages, &nodePackage{name: cPack.Name, version: cPack.Version})
+	}
+	for i, pack := range project.packages {
+		for _, dep := range p.Packages[i].Dependencies {
+			pack.dependsOn(project.packages[dep])
+		}
+	}
+
+	rand.Shuffle(len(project.packages), func(i, j int) {
+		project.packages[i], project.packages[j] = project.packages[j], project.packages[i]
+	})
+	project.constructed = true
+	return nil
+}
+
+// validate checks that every index is in range and the dependency graph is acyclic
+func (p *configNodeProject) validate() error {
+	if len(p.Packages) == 0 {
+		return errors.New("malformed config: no packages")
+	}
+	describe := func(idx int) string {
+		pack := p.Packages[idx]
+		return fmt.Sprintf("package %d (%s@%s)", idx, pack.Name, pack.Version)
+	}
+	for i, pack := range p.Packages {
+		if pack.Name == "" {
+			return fmt.Errorf("malformed config: package %d has no name", i)
+		}
+		seen := make(map[int]bool)
+		for _, dep := range pack.Dependencies {
+			switch {
+			case dep < 0 || dep >= len(p.Packages):
+				return fmt.Errorf("malformed config: %s depends on package %d, out of range [0, %d)", describe(i), dep, len(p.Packages))
+			case dep == i:
+				return fmt.Errorf("malformed config: %s depends on itself", describe(i))
+			case seen[dep]:
+				return fmt.Errorf("malformed config: %s depends on %s more than once", describe(i), describe(dep))
+			}
+			seen[dep] = true
+		}
+	}
+	if cycle := findCycle(len(p.Packages), func(i int) []int { return p.Packages[i].Dependencies }); cycle != nil {
+		names := make([]string, 0, len(cycle))
+		for _, idx := range cycle {
+			names = append(names, p.Packages[idx].Name+"@"+p.Packages[idx].Version)
+		}
+		return fmt.Errorf("malformed config: dependency cycle: %s", strings.Join(names, " -> "))
+	}
+	return nil
+}
+
+func (project *nodeProject) dumpConfig() ([]byte, error) {
+	if !project.constructed {
+		return nil, errNotConstructed
+	}
+
+	// {ptr: index} mapping
+	mapping := make(map[*nodePackage]int)
+	for i, pack := range project.packages {
+		mapping[pack] = i
+	}
+	p := configNodeProject{
+		Name:     project.rootName,
+		Lockfile: project.lockfile,
+	}
+	for _, pack := range project.packages {
+		cPack := configNodePackage{
+			Name:    pack.name,
+			Version: pack.version,
+		}
+		for _, dep := range pack.dependencies {
+			cPack.Dependencies = append(cPack.Dependencies, mapping[dep])
+		}
+		p.Packages = append(p.Packages, cPack)
+	}
+	return json.Marshal(p)
+}
+
+// schedule starts a new round of installation, onReady is invoked when a package becomes ready to install
+func (project *nodeProject) schedule(onReady func(pack *nodePackage)) error {
+	if !project.constructed {
+		return errNotConstructed
+	}
+	project.jobs = newJobQueue(project.packages,
+		func(pack *nodePackage) []*nodePackage {
+			return pack.dependencies
+		},
+		func(pack *nodePackage) []*nodePackage {
+			return pack.requiredBy
+		}, onReady)
+	return nil
+}
+
+// run installs packages on threads workers once all of their dependencies are installed,
+// the one on the longest remaining dependency chain first, see jobQueue.run
+func (project *nodeProject) run(threads int, start func(pack *nodePackage, slot int), finish func(pack *nodePackage)) error {
+	if project.jobs == nil {
+		return errNotConstructed
+	}
+	return project.jobs.run(threads, start, finish)
+}
@@ -0,0 +1,139 @@
+package compiler
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/report"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// PipCompiler pretends to run `pip install`: packages are collected from the top, a package is collected
+// once all packages that require it are, then sdists are built into wheels and everything is installed
+type PipCompiler struct {
+	project *pipProject
+	bar     progressbar.ProgressBar
+	threads int
+
+	recorder *report.Recorder
+
+	bandwidth float64 // bytes per millisecond
+}
+
+// expected values of the random distributions used by start and collect, in milliseconds, see also Estimate
+const (
+	pipIndexMs      = 150 // look up the package on the index
+	pipPrepareMs    = 1500
+	pipBandwidthAvg = 12000 // bytes per millisecond, i.e. 12 MB/s
+)
+
+func NewPipCompiler(path string, config *util.Config, sourceType SourceType, threads int) (*PipCompiler, error) {
+	if threads <= 0 {
+		return nil, errors.New("PipCompiler: threads should be a positive number")
+	}
+	project, err := newPipProject(path, config, sourceType)
+	if err != nil {
+		return nil, err
+	}
+	return &PipCompiler{
+		project: project,
+		threads: threads,
+	}, nil
+}
+
+func (compiler *PipCompiler) start(pack *pipPackage, slot int) {
+	compiler.recorder.Start(pack, pack.String(), slot)
+	// the package is looked up on the index before its download starts
+	indexMs := max(util.GetRandomFromDistribution(pipIndexMs, pipIndexMs/3), 30)
+	time.Sleep(time.Duration(indexMs) * time.Millisecond)
+	compiler.bar.TaskStart(pack.String())
+	compiler.collect(pack)
+	compiler.recorder.Complete(pack)
+}
+
+func (compiler *PipCompiler) finish(pack *pipPackage) {
+	compiler.bar.TaskComplete(pack.String())
+}
+
+// collect downloads the distribution of pack, and prepares the metadata of a sdist
+func (compiler *PipCompiler) collect(pack *pipPackage) {
+	downloadMs := float64(pack.size) / compiler.bandwidth
+	time.Sleep(time.Duration(downloadMs) * time.Millisecond)
+	if !pack.sdist() {
+		return
+	}
+	if asPip, ok := compiler.bar.(*progressbar.PipProgressBar); ok {
+		asPip.TaskDownloaded(pack.String())
+	}
+	prepareMs := max(util.GetRandomFromDistribution(pipPrepareMs, pipPrepareMs/3), 300)
+	time.Sleep(time.Duration(prepareMs) * time.Millisecond)
+}
+
+func (compiler *PipCompiler) Run() {
+	compiler.bandwidth = util.GetRandomUniformDistribution(pipBandwidthAvg-10000, pipBandwidthAvg+10000)
+
+	compiler.bar.Prologue()
+
+	compiler.recorder.Begin(compiler.threads)
+	err := compiler.project.schedule(func(pack *pipPackage) {
+		compiler.recorder.Ready(pack)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = compiler.project.run(compiler.threads, compiler.start, compiler.finish)
+	if err != nil {
+		log.Fatal(err)
+	}
+	compiler.recorder.Finish()
+
+	compiler.bar.Epilogue()
+}
+
+func (compiler *PipCompiler) SetRecorder(recorder *report.Recorder) {
+	compiler.recorder = recorder
+}
+
+func (compiler *PipCompiler) SetProgressBar(bar progressbar.ProgressBar) {
+	compiler.bar = bar
+
+	var totalTasks []string
+	for _, pack := range compiler.project.packages {
+		totalTasks = append(totalTasks, pack.String())
+	}
+	compiler.bar.SetTotalTasks(totalTasks)
+
+	if asPip, ok := compiler.bar.(*progressbar.PipProgressBar); ok {
+		var packages []progressbar.PipPackage
+		for _, pack := range compiler.project.packages {
+			packages = append(packages, progressbar.PipPackage{
+				Name:        pack.name,
+				Version:     pack.version,
+				Requirement: pack.requirement,
+				From:        pack.from(),
+				File:        pack.file,
+				Size:        pack.size,
+			})
+		}
+		asPip.SetPackages(packages)
+	}
+}
+
+func (compiler *PipCompiler) DumpConfig(path string, compression util.Compression) error {
+	b, err := compiler.project.dumpConfig()
+	if err != nil {
+		return err
+	}
+	return util.DumpConfigFile(path, &util.Config{
+		CompilerType:        "pip",
+		Compression:         compression,
+		UncompressedContent: b,
+		Metadata: util.ConfigMetadata{
+			Source: compiler.project.name,
+			Tasks:  len(compiler.project.packages),
+		},
+	})
+}
@@ -0,0 +1,877 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"maps"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// a single distribution installed by pip
+type pipPackage struct {
+	name         string // normalized, e.g. charset-normalizer
+	version      string
+	requirement  string // as written by the user, e.g. requests>=2.31, empty for name==version
+	origin       string // where a top level requirement comes from, e.g. -r requirements.txt (line 4)
+	file         string // file name of the distribution, a wheel or a sdist
+	size         int64
+	dependencies []*pipPackage
+	requiredBy   []*pipPackage
+}
+
+func (pack *pipPackage) String() string {
+	return pack.name + "==" + pack.version
+}
+
+// sdist is built into a wheel before installing
+func (pack *pipPackage) sdist() bool {
+	return !strings.HasSuffix(pack.file, ".whl")
+}
+
+// from returns what pip says requires pack: the origin of a top level requirement, or the package that requires it
+// followed by the origin of that package, e.g. requests==2.31.0->-r requirements.txt (line 4)
+func (pack *pipPackage) from() string {
+	if pack.origin != "" || len(pack.requiredBy) == 0 {
+		return pack.origin
+	}
+	parent := pack.requiredBy[0]
+	// the first top level requirement found upwards, the graph is acyclic
+	top := parent
+	for top.origin == "" && len(top.requiredBy) > 0 {
+		top = top.requiredBy[0]
+	}
+	if top.origin == "" {
+		return parent.String()
+	}
+	return parent.String() + "->" + top.origin
+}
+
+// dependsOn adds the edge pack -> dep, self and duplicate edges are dropped
+func (pack *pipPackage) dependsOn(dep *pipPackage) {
+	if dep == pack || slices.Contains(pack.dependencies, dep) {
+		return
+	}
+	pack.dependencies = append(pack.dependencies, dep)
+	dep.requiredBy = append(dep.requiredBy, pack)
+}
+
+func newPipProject(path string, config *util.Config, sourceType SourceType) (*pipProject, error) {
+	project := new(pipProject)
+	switch sourceType {
+	case SourceTypeDir:
+		err := project.parseDirectory(path)
+		if err != nil {
+			return nil, err
+		}
+	case SourceTypeConfig:
+		err := project.parseConfig(config)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("pipProject: unknown sourceType " + strconv.Itoa(int(sourceType)))
+	}
+	return project, nil
+}
+
+// pipProject defines packages installed from the requirements or the lockfile of a python project
+type pipProject struct {
+	name        string        // name of the project, from pyproject.toml
+	source      string        // file name that packages come from
+	packages    []*pipPackage // all installed packages, the project itself is not included
+	jobs        *jobQueue[*pipPackage]
+	constructed bool
+}
+
+type configPipPackage struct {
+	Name         string `json:"name"`
+	Version      string `json:"ver"`
+	Requirement  string `json:"req,omitempty"`
+	Origin       string `json:"from,omitempty"`
+	File         string `json:"file"`
+	Size         int64  `json:"size"`
+	Dependencies []int  `json:"dep"` // index in `Packages` array
+}
+type configPipProject struct {
+	Name     string             `json:"name"`
+	Source   string             `json:"source"`
+	Packages []configPipPackage `json:"packages"`
+}
+
+// files read by the pip compiler, the first one found in the directory is used. Lockfiles come first,
+// they pin every package and record dependency edges
+var pipSources = []struct {
+	name  string
+	parse func(project *pipProject, path string) ([]*pipPackage, error)
+}{
+	{"uv.lock", parseUvLock},
+	{"poetry.lock", parsePoetryLock},
+	{"requirements.txt", parseRequirements},
+	{"pyproject.toml", parsePyproject},
+}
+
+// pyproject is the part of pyproject.toml used by the pip compiler, either PEP 621 or poetry
+type pyproject struct {
+	Project struct {
+		Name         string   `toml:"name"`
+		Version      string   `toml:"version"`
+		Dependencies []string `toml:"dependencies"`
+	} `toml:"project"`
+	Tool struct {
+		Poetry struct {
+			Name         string         `toml:"name"`
+			Version      string         `toml:"version"`
+			Dependencies map[string]any `toml:"dependencies"`
+		} `toml:"poetry"`
+	} `toml:"tool"`
+}
+
+func (project *pipProject) parseDirectory(path string) error {
+	project.name = filepath.Base(filepath.Clean(path))
+	var p pyproject
+	if b, err := os.ReadFile(path + "pyproject.toml"); err == nil && toml.Unmarshal(b, &p) == nil {
+		switch {
+		case p.Project.Name != "":
+			project.name = p.Project.Name
+		case p.Tool.Poetry.Name != "":
+			project.name = p.Tool.Poetry.Name
+		}
+	}
+
+	for _, source := range pipSources {
+		_, err := os.Stat(path + source.name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		packages, err := source.parse(project, path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source.name, err)
+		}
+		if len(packages) == 0 {
+			return fmt.Errorf("%s: no packages installed", source.name)
+		}
+		project.packages = packages
+		project.source = source.name
+		break
+	}
+	if project.source == "" {
+		return fmt.Errorf("no uv.lock, poetry.lock, requirements.txt or pyproject.toml found in %s", path)
+	}
+
+	// python packages may depend on each other, members of a cycle are collected together
+	breakCycles(project.packages, func(pack *pipPackage) (*[]*pipPackage, *[]*pipPackage) {
+		return &pack.dependencies, &pack.requiredBy
+	})
+
+	rand.Shuffle(len(project.packages), func(i, j int) {
+		project.packages[i], project.packages[j] = project.packages[j], project.packages[i]
+	})
+	project.constructed = true
+	return nil
+}
+
+var pipNameSeparators = regexp.MustCompile("[-_.]+")
+
+// normalizePipName normalizes a package name like PEP 503, e.g. Charset_Normalizer -> charset-normalizer
+func normalizePipName(name string) string {
+	return strings.ToLower(pipNameSeparators.ReplaceAllString(name, "-"))
+}
+
+// newPipPackage creates a package that is downloaded from pypi, the size of its distribution is made up
+func newPipPackage(name, version string, sdist bool) *pipPackage {
+	pack := &pipPackage{name: normalizePipName(name), version: version}
+	// distribution file names use underscores, e.g. charset_normalizer-3.3.2-py3-none-any.whl
+	base := strings.ReplaceAll(pack.name, "-", "_") + "-" + version
+	if sdist {
+		pack.file = base + ".tar.gz"
+	} else {
+		pack.file = base + "-py3-none-any.whl"
+	}
+	// log-normal, mostly tens to hundreds of kB, a few large ones of tens of MB
+	pack.size = int64(math.Exp(util.GetRandomFromDistribution(math.Log(250e3), 1.4)))
+	return pack
+}
+
+// pipSdist tells whether a package without lockfile information is installed from a sdist,
+// about one in ten of them, the same for every run
+func pipSdist(name string) bool {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return h.Sum32()%10 == 0
+}
+
+// pipVersion makes up the version that pip would resolve for an unpinned requirement, the same for every run
+func pipVersion(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	sum := h.Sum32()
+	return fmt.Sprintf("%d.%d.%d", sum%6, sum/6%30, sum/180%12)
+}
+
+// pipAllowedVersion makes up the latest version allowed by clauses of a specifier like >=2.0,<3,!=2.1.0,
+// the same for every run: a few releases above the lower bound, or below the upper bound if there is no room
+func pipAllowedVersion(name string, clauses []string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	sum := int(h.Sum32())
+
+	var candidates [][3]int
+	lower := false
+	for _, clause := range clauses {
+		op, bound := splitPipClause(clause)
+		v := parsePipVersion(bound)
+		switch op {
+		case ">=", ">", "~=":
+			lower = true
+			// newer minor releases first, then patch releases of the same minor
+			for bump := sum%4 + 1; bump > 0; bump-- {
+				candidates = append(candidates, [3]int{v[0], v[1] + bump, sum / 4 % 12})
+			}
+			for bump := sum%3 + 1; bump > 0; bump-- {
+				candidates = append(candidates, [3]int{v[0], v[1], v[2] + bump})
+			}
+			candidates = append(candidates, v)
+		case "<=":
+			candidates = append(candidates, v)
+			fallthrough
+		case "<":
+			switch {
+			case v[2] > 0:
+				candidates = append(candidates, [3]int{v[0], v[1], v[2] - 1})
+			case v[1] > 0:
+				candidates = append(candidates, [3]int{v[0], v[1] - 1, sum % 12})
+			case v[0] > 0:
+				candidates = append(candidates, [3]int{v[0] - 1, sum / 12 % 30, sum % 12})
+			}
+		}
+	}
+	if !lower {
+		v := parsePipVersion(pipVersion(name))
+		candidates = append([][3]int{v}, candidates...)
+	}
+	for _, candidate := range candidates {
+		if pipVersionAllowed(candidate, clauses) {
+			return fmt.Sprintf("%d.%d.%d", candidate[0], candidate[1], candidate[2])
+		}
+	}
+	// conflicting clauses, pip would fail anyway
+	return pipVersion(name)
+}
+
+// splitPipClause splits a clause of specifier into the operator and the version, e.g. ">=2.0" into ">=" and "2.0"
+func splitPipClause(clause string) (op, version string) {
+	i := strings.IndexFunc(clause, func(r rune) bool {
+		return !strings.ContainsRune("<>=!~", r)
+	})
+	if i < 0 {
+		return clause, ""
+	}
+	return clause[:i], strings.TrimSpace(clause[i:])
+}
+
+// parsePipVersion returns major, minor and micro of a version like 2.31.0, 1.0rc1 or 2.*, missing parts are 0
+func parsePipVersion(version string) [3]int {
+	var v [3]int
+	for i, part := range strings.SplitN(version, ".", 4) {
+		if i == 3 {
+			break
+		}
+		digits := part[:len(part)-len(strings.TrimLeft(part, "0123456789"))]
+		v[i], _ = strconv.Atoi(digits)
+	}
+	return v
+}
+
+func comparePipVersion(a, b [3]int) int {
+	return slices.Compare(a[:], b[:])
+}
+
+// pipVersionAllowed tells whether v satisfies every clause, prefix matching with * is ignored
+func pipVersionAllowed(v [3]int, clauses []string) bool {
+	for _, clause := range clauses {
+		op, bound := splitPipClause(clause)
+		if strings.Contains(bound, "*") {
+			continue
+		}
+		b := parsePipVersion(bound)
+		c := comparePipVersion(v, b)
+		var ok bool
+		switch op {
+		case ">=":
+			ok = c >= 0
+		case ">":
+			ok = c > 0
+		case "<=":
+			ok = c <= 0
+		case "<":
+			ok = c < 0
+		case "!=":
+			ok = c != 0
+		case "~=":
+			// ~=2.2 means >=2.2,==2.*, ~=1.4.5 means >=1.4.5,==1.4.*
+			next := [3]int{b[0] + 1}
+			if strings.Count(bound, ".") >= 2 {
+				next = [3]int{b[0], b[1] + 1}
+			}
+			ok = c >= 0 && comparePipVersion(v, next) < 0
+		default:
+			ok = true
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// requirementPattern matches a PEP 508 requirement without markers: name, extras, specifiers or url
+var requirementPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(\[[^\]]*\])?\s*(.*)$`)
+
+// parseRequirement parses a PEP 508 requirement like `requests[socks]>=2.31,<3; python_version >= "3.8"`
+func parseRequirement(requirement string) (*pipPackage, error) {
+	requirement, _, _ = strings.Cut(requirement, ";")
+	requirement = strings.TrimSpace(requirement)
+	match := requirementPattern.FindStringSubmatch(requirement)
+	if match == nil {
+		return nil, fmt.Errorf("invalid requirement %q", requirement)
+	}
+	name, spec := match[1], strings.TrimSpace(match[3])
+	if spec != "" && !strings.ContainsAny(spec[:1], "@<>=!~(") {
+		return nil, fmt.Errorf("invalid requirement %q", requirement)
+	}
+	spec = strings.Trim(spec, "()") // legacy form like name (>=1.0)
+
+	// direct reference, e.g. pkg @ https://example.com/pkg-1.0.tar.gz
+	if url, found := strings.CutPrefix(spec, "@"); found {
+		url = strings.TrimSpace(url)
+		file := url[strings.LastIndex(url, "/")+1:]
+		file, _, _ = strings.Cut(file, "#")
+		file, _, _ = strings.Cut(file, "?")
+		version := "0.0.0"
+		// file names are name-version-..., or name-version.tar.gz
+		if _, rest, found := strings.Cut(file, "-"); found {
+			version = strings.TrimSuffix(strings.TrimSuffix(strings.Split(rest, "-")[0], ".tar.gz"), ".zip")
+		}
+		pack := newPipPackage(name, version, !strings.HasSuffix(file, ".whl"))
+		pack.requirement = requirement
+		if strings.HasSuffix(file, ".whl") || strings.HasSuffix(file, ".tar.gz") || strings.HasSuffix(file, ".zip") {
+			pack.file = file
+		}
+		return pack, nil
+	}
+
+	// pinned versions are installed as is, otherwise pip picks the latest one allowed
+	pinned := ""
+	var clauses []string
+	for _, clause := range strings.Split(spec, ",") {
+		clause = strings.TrimSpace(clause)
+		switch {
+		case strings.HasPrefix(clause, "==="):
+			pinned = strings.TrimSpace(clause[3:])
+		case strings.HasPrefix(clause, "=="):
+			pinned = strings.TrimSpace(clause[2:])
+		case clause != "":
+			clauses = append(clauses, clause)
+		}
+	}
+	version := strings.ReplaceAll(pinned, "*", "0") // prefix matching like ==2.31.*
+	if version == "" {
+		version = pipAllowedVersion(normalizePipName(name), clauses)
+	}
+	pack := newPipPackage(name, version, pipSdist(normalizePipName(name)))
+	if spec != "=="+version || match[2] != "" {
+		pack.requirement = requirement
+	}
+	return pack, nil
+}
+
+// parseRequirements parses requirements.txt, files included by -r are followed. There are no dependency edges,
+// every requirement is a top level one
+func parseRequirements(project *pipProject, path string) ([]*pipPackage, error) {
+	var packages []*pipPackage
+	seen := make(map[string]bool)
+	var parse func(file, display string, depth int) error
+	parse = func(file, display string, depth int) error {
+		if depth > 8 {
+			return fmt.Errorf("%s: too many nested -r", display)
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		lineNumber := 0
+		logical, start := "", 0
+		for scanner.Scan() {
+			lineNumber++
+			line := scanner.Text()
+			if logical == "" {
+				start = lineNumber
+			}
+			// backslash continues the line
+			if strings.HasSuffix(line, "\\") {
+				logical += strings.TrimSuffix(line, "\\") + " "
+				continue
+			}
+			line = logical + line
+			logical = ""
+
+			if i := strings.Index(line, "#"); i == 0 || (i > 0 && (line[i-1] == ' ' || line[i-1] == '\t')) {
+				line = line[:i]
+			}
+			line = strings.TrimSpace(line)
+			switch {
+			case line == "":
+				continue
+			case strings.HasPrefix(line, "-r ") || strings.HasPrefix(line, "--requirement"):
+				included := strings.TrimSpace(strings.TrimLeft(strings.TrimPrefix(strings.TrimPrefix(line, "--requirement"), "-r "), "= "))
+				err := parse(filepath.Join(filepath.Dir(file), included), included, depth+1)
+				if err != nil {
+					return err
+				}
+				continue
+			case strings.HasPrefix(line, "-"):
+				continue // constraints, editables, and index options
+			}
+			// per-requirement options like --hash
+			if i := strings.Index(line, " --"); i >= 0 {
+				line = strings.TrimSpace(line[:i])
+			}
+			pack, err := parseRequirement(line)
+			if err != nil {
+				if depth > 0 {
+					return fmt.Errorf("%s line %d: %w", display, start, err)
+				}
+				return fmt.Errorf("line %d: %w", start, err)
+			}
+			if seen[pack.name] {
+				continue
+			}
+			seen[pack.name] = true
+			pack.origin = fmt.Sprintf("-r %s (line %d)", display, start)
+			packages = append(packages, pack)
+		}
+		return scanner.Err()
+	}
+	err := parse(path+"requirements.txt", "requirements.txt", 0)
+	if err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
+
+// parsePyproject parses dependencies of pyproject.toml, of PEP 621 or poetry. There are no dependency edges,
+// every requirement comes from the project itself
+func parsePyproject(project *pipProject, path string) ([]*pipPackage, error) {
+	b, err := os.ReadFile(path + "pyproject.toml")
+	if err != nil {
+		return nil, err
+	}
+	var p pyproject
+	err = toml.Unmarshal(b, &p)
+	if err != nil {
+		return nil, err
+	}
+	origin, version := project.name, p.Project.Version
+	if version == "" {
+		version = p.Tool.Poetry.Version
+	}
+	if version != "" {
+		origin += "==" + version
+	}
+
+	requirements := p.Project.Dependencies
+	// poetry dependencies are tables of name = "^2.31" or name = {version = "^2.31", ...}
+	for _, name := range slices.Sorted(maps.Keys(p.Tool.Poetry.Dependencies)) {
+		if strings.EqualFold(name, "python") {
+			continue
+		}
+		spec := ""
+		switch v := p.Tool.Poetry.Dependencies[name].(type) {
+		case string:
+			spec = v
+		case map[string]any:
+			spec, _ = v["version"].(string)
+		}
+		// caret and tilde ranges of poetry, the lower bound is enough
+		spec = strings.TrimLeft(spec, "^~")
+		if spec != "" && spec != "*" && !strings.ContainsAny(spec[:1], "<>=!") {
+			spec = ">=" + spec
+		}
+		requirements = append(requirements, name+strings.TrimPrefix(spec, "*"))
+	}
+
+	var packages []*pipPackage
+	seen := make(map[string]bool)
+	for _, requirement := range requirements {
+		pack, err := parseRequirement(requirement)
+		if err != nil {
+			return nil, err
+		}
+		if seen[pack.name] {
+			continue
+		}
+		seen[pack.name] = true
+		pack.origin = origin
+		packages = append(packages, pack)
+	}
+	return packages, nil
+}
+
+// pickDistribution picks the file pip would download among those of a release, pure python wheels first,
+// then manylinux wheels, any other wheel, and the sdist at last. files are urls or file names
+func pickDistribution(files []string) (index int) {
+	rank := func(file string) int {
+		switch {
+		case strings.HasSuffix(file, "-py3-none-any.whl") || strings.HasSuffix(file, "-py2.py3-none-any.whl"):
+			return 0
+		case strings.HasSuffix(file, ".whl") && strings.Contains(file, "manylinux") && strings.Contains(file, "x86_64"):
+			return 1
+		case strings.HasSuffix(file, ".whl"):
+			return 2
+		default:
+			return 3
+		}
+	}
+	index = -1
+	for i, file := range files {
+		if index < 0 || rank(file) < rank(files[index]) {
+			index = i
+		}
+	}
+	return index
+}
+
+// parsePoetryLock parses poetry.lock, dependencies are listed by name under [package.dependencies].
+// Packages that nobody depends on are required by the project itself
+func parsePoetryLock(project *pipProject, path string) ([]*pipPackage, error) {
+	b, err := os.ReadFile(path + "poetry.lock")
+	if err != nil {
+		return nil, err
+	}
+	type rawFile struct {
+		File string `toml:"file"`
+	}
+	var raw struct {
+		Package []struct {
+			Name         string         `toml:"name"`
+			Version      string         `toml:"version"`
+			Files        []rawFile      `toml:"files"`
+			Dependencies map[string]any `toml:"dependencies"`
+		} `toml:"package"`
+		// poetry 1.1 and earlier list files here, by package name
+		Metadata struct {
+			Files map[string][]rawFile `toml:"files"`
+		} `toml:"metadata"`
+	}
+	err = toml.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*pipPackage)
+	var packages []*pipPackage
+	for _, entry := range raw.Package {
+		files := entry.Files
+		if files == nil {
+			files = raw.Metadata.Files[entry.Name]
+		}
+		var names []string
+		for _, f := range files {
+			names = append(names, f.File)
+		}
+		i := pickDistribution(names)
+		pack := newPipPackage(entry.Name, entry.Version, i >= 0 && !strings.HasSuffix(names[i], ".whl"))
+		if i >= 0 {
+			pack.file = names[i]
+		}
+		if byName[pack.name] != nil {
+			return nil, fmt.Errorf("package %s is listed more than once", pack.name)
+		}
+		byName[pack.name] = pack
+		packages = append(packages, pack)
+	}
+	for i, entry := range raw.Package {
+		for _, name := range slices.Sorted(maps.Keys(entry.Dependencies)) {
+			// dependencies excluded by markers of every platform may be missing
+			if dep := byName[normalizePipName(name)]; dep != nil {
+				packages[i].dependsOn(dep)
+			}
+		}
+	}
+	for _, pack := range packages {
+		if len(pack.requiredBy) == 0 {
+			pack.origin = project.name
+		}
+	}
+	return packages, nil
+}
+
+// parseUvLock parses uv.lock, where the project itself is a package with editable or virtual source,
+// dependencies are listed by name, and by version too if there are several versions of the name
+func parseUvLock(project *pipProject, path string) ([]*pipPackage, error) {
+	b, err := os.ReadFile(path + "uv.lock")
+	if err != nil {
+		return nil, err
+	}
+	type rawDist struct {
+		URL  string `toml:"url"`
+		Path string `toml:"path"`
+		Size int64  `toml:"size"`
+	}
+	type rawDependency struct {
+		Name    string `toml:"name"`
+		Version string `toml:"version"`
+	}
+	type rawEntry struct {
+		Name                 string                     `toml:"name"`
+		Version              string                     `toml:"version"`
+		Source               map[string]any             `toml:"source"`
+		Dependencies         []rawDependency            `toml:"dependencies"`
+		OptionalDependencies map[string][]rawDependency `toml:"optional-dependencies"`
+		DevDependencies      map[string][]rawDependency `toml:"dev-dependencies"`
+		Sdist                *rawDist                   `toml:"sdist"`
+		Wheels               []rawDist                  `toml:"wheels"`
+	}
+	var raw struct {
+		Package []rawEntry `toml:"package"`
+	}
+	err = toml.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string][]*pipPackage)
+	installed := make(map[*rawEntry]*pipPackage)
+	var roots []*rawEntry
+	var packages []*pipPackage
+	for i := range raw.Package {
+		entry := &raw.Package[i]
+		if entry.Source["editable"] != nil || entry.Source["virtual"] != nil {
+			roots = append(roots, entry)
+			continue
+		}
+		dists := slices.Clone(entry.Wheels)
+		if entry.Sdist != nil {
+			dists = append(dists, *entry.Sdist)
+		}
+		var names []string
+		for _, dist := range dists {
+			names = append(names, filepath.Base(dist.URL+dist.Path))
+		}
+		version := entry.Version
+		if version == "" {
+			version = "0.0.0"
+		}
+		i := pickDistribution(names)
+		pack := newPipPackage(entry.Name, version, i < 0 || !strings.HasSuffix(names[i], ".whl"))
+		if i >= 0 {
+			pack.file = names[i]
+			if dists[i].Size > 0 {
+				pack.size = dists[i].Size
+			}
+		}
+		byName[pack.name] = append(byName[pack.name], pack)
+		installed[entry] = pack
+		packages = append(packages, pack)
+	}
+
+	resolve := func(dep rawDependency) *pipPackage {
+		candidates := byName[normalizePipName(dep.Name)]
+		for _, candidate := range candidates {
+			if dep.Version == "" || candidate.version == dep.Version {
+				return candidate
+			}
+		}
+		return nil
+	}
+	for entry, pack := range installed {
+		for _, dep := range entry.Dependencies {
+			if target := resolve(dep); target != nil {
+				pack.dependsOn(target)
+			}
+		}
+		for _, extra := range slices.Sorted(maps.Keys(entry.OptionalDependencies)) {
+			for _, dep := range entry.OptionalDependencies[extra] {
+				if target := resolve(dep); target != nil {
+					pack.dependsOn(target)
+				}
+			}
+		}
+	}
+
+	// dependencies of the project, including dev groups that uv installs by default
+	for _, root := range roots {
+		origin := normalizePipName(root.Name)
+		if root.Version != "" {
+			origin += "==" + root.Version
+		}
+		groups := [][]rawDependency{root.Dependencies}
+		for _, name := range slices.Sorted(maps.Keys(root.DevDependencies)) {
+			groups = append(groups, root.DevDependencies[name])
+		}
+		for _, group := range groups {
+			for _, dep := range group {
+				if target := resolve(dep); target != nil && target.origin == "" {
+					target.origin = origin
+				}
+			}
+		}
+	}
+	for _, pack := range packages {
+		if len(pack.requiredBy) == 0 && pack.origin == "" {
+			pack.origin = project.name
+		}
+	}
+	return packages, nil
+}
+
+func (project *pipProject) parseConfig(config *util.Config) error {
+	p := configPipProject{}
+	err := config.Decode(&p)
+	if err != nil {
+		return err
+	}
+	err = p.validate()
+	if err != nil {
+		return err
+	}
+
+	project.name = p.Name
+	project.source = p.Source
+	for _, cPack := range p.Packages {
+		project.packages = append(project.packages, &pipPackage{
+			name:        cPack.Name,
+			version:     cPack.Version,
+			requirement: cPack.Requirement,
+			origin:      cPack.Origin,
+			file:        cPack.File,
+			size:        cPack.Size,
+		})
+	}
+	for i, pack := range project.packages {
+		for _, dep := range p.Packages[i].Dependencies {
+			pack.dependsOn(project.packages[dep])
+		}
+	}
+
+	rand.Shuffle(len(project.packages), func(i, j int) {
+		project.packages[i], project.packages[j] = project.packages[j], project.packages[i]
+	})
+	project.constructed = true
+	return nil
+}
+
+// validate checks that every package has a distribution, every index is in range and the dependency graph is acyclic
+func (p *configPipProject) validate() error {
+	if len(p.Packages) == 0 {
+		return errors.New("malformed config: no packages")
+	}
+	describe := func(idx int) string {
+		pack := p.Packages[idx]
+		return fmt.Sprintf("package %d (%s==%s)", idx, pack.Name, pack.Version)
+	}
+	for i, pack := range p.Packages {
+		switch {
+		case pack.Name == "":
+			return fmt.Errorf("malformed config: package %d has no name", i)
+		case pack.File == "":
+			return fmt.Errorf("malformed config: %s has no file", describe(i))
+		case pack.Size < 0:
+			return fmt.Errorf("malformed config: %s has negative size %d", describe(i), pack.Size)
+		}
+		seen := make(map[int]bool)
+		for _, dep := range pack.Dependencies {
+			switch {
+			case dep < 0 || dep >= len(p.Packages):
+				return fmt.Errorf("malformed config: %s depends on package %d, out of range [0, %d)", describe(i), dep, len(p.Packages))
+			case dep == i:
+				return fmt.Errorf("malformed config: %s depends on itself", describe(i))
+			case seen[dep]:
+				return fmt.Errorf("malformed config: %s depends on %s more than once", describe(i), describe(dep))
+			}
+			seen[dep] = true
+		}
+	}
+	if cycle := findCycle(len(p.Packages), func(i int) []int { return p.Packages[i].Dependencies }); cycle != nil {
+		names := make([]string, 0, len(cycle))
+		for _, idx := range cycle {
+			names = append(names, p.Packages[idx].Name+"=="+p.Packages[idx].Version)
+		}
+		return fmt.Errorf("malformed config: dependency cycle: %s", strings.Join(names, " -> "))
+	}
+	return nil
+}
+
+func (project *pipProject) dumpConfig() ([]byte, error) {
+	if !project.constructed {
+		return nil, errNotConstructed
+	}
+
+	// {ptr: index} mapping
+	mapping := make(map[*pipPackage]int)
+	for i, pack := range project.packages {
+		mapping[pack] = i
+	}
+	p := configPipProject{
+		Name:   project.name,
+		Source: project.source,
+	}
+	for _, pack := range project.packages {
+		cPack := configPipPackage{
+			Name:        pack.name,
+			Version:     pack.version,
+			Requirement: pack.requirement,
+			Origin:      pack.origin,
+			File:        pack.file,
+			Size:        pack.size,
+		}
+		for _, dep := range pack.dependencies {
+			cPack.Dependencies = append(cPack.Dependencies, mapping[dep])
+		}
+		p.Packages = append(p.Packages, cPack)
+	}
+	return json.Marshal(p)
+}
+
+// schedule starts a new round of installation, onReady is invoked when a package becomes ready to collect.
+//
+// pip resolves from the top: a package is collected once every package that requires it is,
+// so the job queue runs over the reversed dependency graph
+func (project *pipProject) schedule(onReady func(pack *pipPackage)) error {
+	if !project.constructed {
+		return errNotConstructed
+	}
+	project.jobs = newJobQueue(project.packages,
+		func(pack *pipPackage) []*pipPackage {
+			return pack.requiredBy
+		},
+		func(pack *pipPackage) []*pipPackage {
+			return pack.dependencies
+		}, onReady)
+	return nil
+}
+
+// run collects packages on threads workers once all of their dependents are collected,
+// the one heading the longest remaining chain of dependencies first, see jobQueue.run
+func (project *pipProject) run(threads int, start func(pack *pipPackage, slot int), finish func(pack *pipPackage)) error {
+	if project.jobs == nil {
+		return errNotConstructed
+	}
+	return project.jobs.run(threads, start, finish)
+}
@@ -0,0 +1,255 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/report"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// TestCompiler pretends to run the tests of a project after it is built, by the runner they are discovered for:
+// cargo runs test binaries one after another with their tests in parallel, and stops at the first binary that fails,
+// go runs packages in parallel with their tests one after another, pytest runs everything one after another,
+// and ctest runs all tests in parallel
+type TestCompiler struct {
+	project  *testProject
+	slots    chan int // free slots, a test runs once it takes one
+	bar      progressbar.ProgressBar
+	threads  int
+	recorder *report.Recorder
+
+	lock   *sync.Mutex
+	failed int // number of failed tests of the last run
+}
+
+// a flaky test fails at this rate
+const testFlakyRate = 0.5
+
+// exit status of each runner when tests failed
+var testExitCodes = map[string]int{"cargo": 101, "go": 1, "ctest": 8, "pytest": 1}
+
+func NewTestCompiler(path string, config *util.Config, sourceType SourceType, threads int) (*TestCompiler, error) {
+	if threads <= 0 {
+		return nil, errors.New("TestCompiler: threads should be a positive number")
+	}
+	project, err := newTestProject(path, config, sourceType)
+	if err != nil {
+		return nil, err
+	}
+	slots := make(chan int, threads)
+	for i := range threads {
+		slots <- i
+	}
+	return &TestCompiler{
+		project: project,
+		slots:   slots,
+		threads: threads,
+		lock:    new(sync.Mutex),
+	}, nil
+}
+
+// SetFailures makes tests matching any glob of failing fail, and those matching flaky fail at random,
+// globs are matched against names reported by the runner, the qualified names and the function names of tests,
+// a glob that matches no test is an error
+func (compiler *TestCompiler) SetFailures(failing, flaky []string) error {
+	for _, pattern := range append(slices.Clone(failing), flaky...) {
+		for _, segment := range strings.Split(pattern, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("invalid glob %q: %w", pattern, err)
+			}
+		}
+	}
+	matched := make(map[string]bool)
+	matches := func(test *testCase, patterns []string) bool {
+		found := false
+		for _, pattern := range patterns {
+			if util.MatchGlob(pattern, test.name) || util.MatchGlob(pattern, test.id) || util.MatchGlob(pattern, test.function()) {
+				matched[pattern] = true
+				found = true
+			}
+		}
+		return found
+	}
+	tests := compiler.project.tests()
+	for _, test := range tests {
+		test.failing = matches(test, failing)
+		test.flaky = matches(test, flaky)
+	}
+	for _, pattern := range append(slices.Clone(failing), flaky...) {
+		if !matched[pattern] {
+			return fmt.Errorf("glob %q matches none of the %d tests of %s", pattern, len(tests), compiler.project.runner)
+		}
+	}
+	return nil
+}
+
+// ExitCode returns the exit status of the runner of the last run, 0 if all tests passed
+func (compiler *TestCompiler) ExitCode() int {
+	compiler.lock.Lock()
+	defer compiler.lock.Unlock()
+	if compiler.failed == 0 {
+		return 0
+	}
+	return testExitCodes[compiler.project.runner]
+}
+
+// runTest runs a test in slot
+func (compiler *TestCompiler) runTest(test *testCase, slot int) {
+	if compiler.start(test, slot) {
+		compiler.finish(test)
+	}
+}
+
+// start starts a test in slot, an ignored test is reported without running, and false is returned
+func (compiler *TestCompiler) start(test *testCase, slot int) bool {
+	if test.ignored {
+		if asFresh, ok := compiler.bar.(progressbar.FreshTaskHandler); ok {
+			asFresh.TaskFresh(test.String())
+		} else {
+			compiler.bar.TaskStart(test.String())
+			compiler.bar.TaskComplete(test.String())
+		}
+		return false
+	}
+	compiler.recorder.Start(test, test.String(), slot)
+	compiler.bar.TaskStart(test.String())
+	return true
+}
+
+// finish waits until a started test ends, and reports whether it passed
+func (compiler *TestCompiler) finish(test *testCase) {
+	ms := max(util.GetRandomFromDistribution(test.ms, test.ms/4), 0.1)
+	time.Sleep(time.Duration(ms * float64(time.Millisecond)))
+	compiler.recorder.Complete(test)
+
+	if test.failing || test.flaky && rand.Float64() < testFlakyRate {
+		compiler.lock.Lock()
+		compiler.failed++
+		compiler.lock.Unlock()
+		if asTest, ok := compiler.bar.(*progressbar.TestProgressBar); ok {
+			asTest.TestFailed(test.String())
+		}
+	}
+	compiler.bar.TaskComplete(test.String())
+}
+
+// runParallel runs tests at the same time as far as slots allow, tests are started in order
+func (compiler *TestCompiler) runParallel(tests []*testCase) {
+	wg := new(sync.WaitGroup)
+	for _, test := range tests {
+		slot := <-compiler.slots
+		if !compiler.start(test, slot) {
+			compiler.slots <- slot
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			compiler.finish(test)
+			compiler.slots <- slot
+		}()
+	}
+	wg.Wait()
+}
+
+func (compiler *TestCompiler) Run() {
+	compiler.failed = 0
+	project := compiler.project
+
+	compiler.bar.Prologue()
+
+	compiler.recorder.Begin(compiler.threads)
+	for _, test := range project.tests() {
+		if !test.ignored {
+			compiler.recorder.Ready(test)
+		}
+	}
+
+	switch project.runner {
+	case "cargo":
+		for _, suite := range project.suites {
+			compiler.runParallel(suite.tests)
+			if compiler.ExitCode() != 0 {
+				break
+			}
+		}
+	case "go":
+		wg := new(sync.WaitGroup)
+		for _, suite := range project.suites {
+			slot := <-compiler.slots
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, test := range suite.tests {
+					compiler.runTest(test, slot)
+				}
+				compiler.slots <- slot
+			}()
+		}
+		wg.Wait()
+	case "pytest":
+		for _, test := range project.tests() {
+			compiler.runTest(test, 0)
+		}
+	default:
+		compiler.runParallel(project.tests())
+	}
+
+	compiler.recorder.Finish()
+
+	compiler.bar.Epilogue()
+}
+
+func (compiler *TestCompiler) SetRecorder(recorder *report.Recorder) {
+	compiler.recorder = recorder
+}
+
+func (compiler *TestCompiler) SetProgressBar(bar progressbar.ProgressBar) {
+	compiler.bar = bar
+
+	var totalTasks []string
+	for _, test := range compiler.project.tests() {
+		totalTasks = append(totalTasks, test.String())
+	}
+	compiler.bar.SetTotalTasks(totalTasks)
+
+	if asTest, ok := compiler.bar.(*progressbar.TestProgressBar); ok {
+		var tests []progressbar.TestCase
+		for _, test := range compiler.project.tests() {
+			tests = append(tests, progressbar.TestCase{
+				Task:    test.String(),
+				Name:    test.name,
+				Suite:   test.suite.name,
+				Package: test.suite.pkg,
+				File:    test.file,
+				Line:    test.line,
+				Ignored: test.ignored,
+			})
+		}
+		asTest.SetTests(compiler.project.runner, compiler.project.name, tests)
+	}
+}
+
+func (compiler *TestCompiler) DumpConfig(path string, compression util.Compression) error {
+	b, err := compiler.project.dumpConfig()
+	if err != nil {
+		return err
+	}
+	return util.DumpConfigFile(path, &util.Config{
+		CompilerType:        "test",
+		Compression:         compression,
+		UncompressedContent: b,
+		Metadata: util.ConfigMetadata{
+			Source: compiler.project.name,
+			Tasks:  compiler.project.len(),
+		},
+	})
+}
@@ -0,0 +1,660 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// testProject is the tests of a directory, discovered from the sources for one test runner
+type testProject struct {
+	runner      string // cargo, go, ctest or pytest
+	name        string // package, module, cmake project or rootdir
+	suites      []*testSuite
+	constructed bool
+}
+
+// testSuite is the tests reported together: a test binary of cargo, a package of go, a file of pytest,
+// or all tests of ctest
+type testSuite struct {
+	name  string // cargo: source of the target like src/lib.rs, go: import path, pytest: file, ctest: empty
+	pkg   string // cargo: package of the target
+	tests []*testCase
+}
+
+type testCase struct {
+	name    string // as reported by the runner, e.g. net::tests::parse, TestParse, tests/test_api.py::test_get
+	file    string // slash-separated path relative to root
+	line    int
+	ignored bool    // #[ignore], @pytest.mark.skip or a disabled ctest, reported without running
+	ms      float64 // expected duration
+	id      string  // unique among tests of the project, the task name
+	suite   *testSuite
+	failing bool
+	flaky   bool
+}
+
+func (test *testCase) String() string {
+	return test.id
+}
+
+// function returns the name of the function of a test, e.g. parse of net::tests::parse
+func (test *testCase) function() string {
+	return test.name[strings.LastIndex(test.name, ":")+1:]
+}
+
+// runners in the order they are detected, a directory is tested by the first one that finds tests
+var testRunners = []string{"cargo", "go", "ctest", "pytest"}
+
+// median duration of a test of each runner in milliseconds, ctest runs whole executables
+var testMedianMs = map[string]float64{"cargo": 2, "go": 4, "ctest": 120, "pytest": 6}
+
+// directories that never contain tests of the project
+var testSkippedDirs = []string{"target", "vendor", "node_modules", "venv", "__pycache__", "site-packages", "build", "dist", "testdata"}
+
+// content of test config, tests are listed by suite in the order they are reported
+//
+//	{"runner": "cargo", "name": "foo", "suites": [{"name": "src/lib.rs", "package": "foo",
+//	 "tests": [{"name": "net::tests::parse", "file": "src/net.rs", "line": 42, "ms": 1.7}]}]}
+type configTestProject struct {
+	Runner string            `json:"runner"`
+	Name   string            `json:"name"`
+	Suites []configTestSuite `json:"suites"`
+}
+
+type configTestSuite struct {
+	Name    string           `json:"name,omitempty"`
+	Package string           `json:"package,omitempty"`
+	Tests   []configTestCase `json:"tests"`
+}
+
+type configTestCase struct {
+	Name    string  `json:"name"`
+	File    string  `json:"file,omitempty"`
+	Line    int     `json:"line,omitempty"`
+	Ignored bool    `json:"ignored,omitempty"`
+	Ms      float64 `json:"ms"`
+}
+
+func newTestProject(path string, config *util.Config, sourceType SourceType) (*testProject, error) {
+	project := new(testProject)
+	switch sourceType {
+	case SourceTypeDir:
+		err := project.parseDirectory(path)
+		if err != nil {
+			return nil, err
+		}
+	case SourceTypeConfig:
+		err := project.parseConfig(config)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("testProject: unknown sourceType " + strconv.Itoa(int(sourceType)))
+	}
+	project.link()
+	project.constructed = true
+	return project, nil
+}
+
+// parseDirectory discovers tests of root with each runner, the first one that finds any runs the tests,
+// tests found by the others are not run, which is warned
+func (project *testProject) parseDirectory(root string) error {
+	root = filepath.Clean(root)
+	name := filepath.Base(root)
+	if abs, err := filepath.Abs(root); err == nil {
+		name = filepath.Base(abs)
+	}
+	var skipped []string
+	for _, runner := range testRunners {
+		found := &testProject{runner: runner, name: name}
+		var err error
+		switch runner {
+		case "cargo":
+			err = found.discoverCargo(root)
+		case "go":
+			err = found.discoverGo(root)
+		case "ctest":
+			err = found.discoverCtest(root)
+		case "pytest":
+			err = found.discoverPytest(root)
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case found.len() == 0:
+		case project.runner != "":
+			skipped = append(skipped, fmt.Sprintf("%s (%d)", runner, found.len()))
+		default:
+			project.runner, project.name = found.runner, found.name
+			project.suites = slices.DeleteFunc(found.suites, func(suite *testSuite) bool {
+				return len(suite.tests) == 0
+			})
+		}
+	}
+	if project.runner == "" {
+		return fmt.Errorf("no tests of cargo, go, ctest or pytest found in %s", root)
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: only tests of %s are run, tests found by %s are skipped\n", project.runner, strings.Join(skipped, ", "))
+	}
+	return nil
+}
+
+// walkTestFiles calls visit with every regular file within root, by its slash-separated path relative to root,
+// hidden directories and those of build outputs and dependencies are skipped
+func walkTestFiles(root string, visit func(rel string) error) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if rel != "." && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || slices.Contains(testSkippedDirs, name)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return visit(filepath.ToSlash(rel))
+	})
+}
+
+// owner returns the closest directory of dirs that contains the file rel, "." is the root
+func owner[T any](dirs map[string]T, rel string) (string, bool) {
+	for dir := path.Dir(rel); ; dir = path.Dir(dir) {
+		if _, ok := dirs[dir]; ok {
+			return dir, true
+		}
+		if dir == "." {
+			return "", false
+		}
+	}
+}
+
+// testDuration makes up the expected duration of a test, log-normal around the median of the runner
+func (project *testProject) testDuration() float64 {
+	ms := math.Exp(util.GetRandomFromDistribution(math.Log(testMedianMs[project.runner]), 1.4))
+	return math.Round(min(ms, 30000)*10) / 10
+}
+
+// addTest adds a test to suite, a test defined again replaces the former one, like a python function does
+func (project *testProject) addTest(suite *testSuite, name, file string, line int, ignored bool) {
+	suite.tests = slices.DeleteFunc(suite.tests, func(test *testCase) bool {
+		return test.name == name
+	})
+	test := &testCase{name: name, file: file, line: line, ignored: ignored}
+	if !ignored {
+		test.ms = project.testDuration()
+	}
+	suite.tests = append(suite.tests, test)
+}
+
+var (
+	rustModRegexp      = regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?mod\s+(\w+)\s*\{`)
+	rustFnRegexp       = regexp.MustCompile(`^\s*(?:#\[[^\]]*\]\s*)*(?:pub(?:\([^)]*\))?\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?fn\s+(\w+)`)
+	rustTestAttrRegexp = regexp.MustCompile(`#\[(?:\w+::)?test\b`)
+	rustIgnoreRegexp   = regexp.MustCompile(`#\[ignore\b`)
+	rustLiteralRegexp  = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)'`)
+)
+
+// discoverCargo finds #[test] functions of every package, a test is named by its module path within the crate,
+// which is a target: the library, a binary, or an integration test of tests/
+func (project *testProject) discoverCargo(root string) error {
+	packages := make(map[string]string) // directory of Cargo.toml of a package -> name
+	var sources []string
+	err := walkTestFiles(root, func(rel string) error {
+		switch {
+		case path.Base(rel) == "Cargo.toml":
+			var manifest struct {
+				Package struct {
+					Name string `toml:"name"`
+				} `toml:"package"`
+			}
+			b, err := os.ReadFile(filepath.Join(root, rel))
+			if err != nil {
+				return err
+			}
+			if toml.Unmarshal(b, &manifest) == nil && manifest.Package.Name != "" {
+				packages[path.Dir(rel)] = manifest.Package.Name
+			}
+		case strings.HasSuffix(rel, ".rs"):
+			sources = append(sources, rel)
+		}
+		return nil
+	})
+	if err != nil || len(packages) == 0 {
+		return err
+	}
+	if name, ok := packages["."]; ok {
+		project.name = name
+	}
+
+	suites := make(map[[2]string]*testSuite) // package directory, target source
+	for _, rel := range sources {
+		dir, ok := owner(packages, rel)
+		if !ok {
+			continue
+		}
+		inner := strings.TrimPrefix(rel, dir+"/")
+		if dir == "." {
+			inner = rel
+		}
+		hasLib := slices.Contains(sources, path.Join(dir, "src/lib.rs"))
+		target, module, ok := cargoTarget(inner, hasLib)
+		if !ok {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(root, rel))
+		if err != nil {
+			return err
+		}
+		tests := scanRustTests(string(b))
+		if len(tests) == 0 {
+			continue
+		}
+		suite := suites[[2]string{dir, target}]
+		if suite == nil {
+			suite = &testSuite{name: target, pkg: packages[dir]}
+			suites[[2]string{dir, target}] = suite
+			project.suites = append(project.suites, suite)
+		}
+		for _, test := range tests {
+			name := test.name
+			if module != "" {
+				name = module + "::" + name
+			}
+			project.addTest(suite, name, rel, test.line, test.ignored)
+		}
+	}
+
+	// like cargo: package by package, the library first, then binaries and integration tests, tests sorted by name
+	order := func(target string) int {
+		switch {
+		case target == "src/lib.rs":
+			return 0
+		case strings.HasPrefix(target, "src/"):
+			return 1
+		default:
+			return 2
+		}
+	}
+	slices.SortStableFunc(project.suites, func(a, b *testSuite) int {
+		if a.pkg != b.pkg {
+			return strings.Compare(a.pkg, b.pkg)
+		}
+		if order(a.name) != order(b.name) {
+			return order(a.name) - order(b.name)
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	for _, suite := range project.suites {
+		slices.SortStableFunc(suite.tests, func(a, b *testCase) int {
+			return strings.Compare(a.name, b.name)
+		})
+	}
+	return nil
+}
+
+// cargoTarget returns the source of the target that a file within a package is compiled into,
+// and the module path of the file within the target
+func cargoTarget(inner string, hasLib bool) (target, module string, ok bool) {
+	parts := strings.Split(inner, "/")
+	modulePath := func(parts []string) string {
+		last := strings.TrimSuffix(parts[len(parts)-1], ".rs")
+		parts = append(slices.Clone(parts[:len(parts)-1]), last)
+		if last == "mod" || last == "lib" || last == "main" {
+			parts = parts[:len(parts)-1]
+		}
+		return strings.Join(parts, "::")
+	}
+	switch {
+	case parts[0] == "tests" && len(parts) == 2:
+		return inner, "", true
+	case parts[0] != "src" || len(parts) < 2:
+		return "", "", false
+	case parts[1] == "bin" && len(parts) == 3:
+		return inner, "", true
+	case parts[1] == "bin" && len(parts) > 3:
+		return "src/bin/" + parts[2] + "/main.rs", modulePath(parts[3:]), true
+	case inner == "src/main.rs" || !hasLib:
+		return "src/main.rs", modulePath(parts[1:]), true
+	default:
+		return "src/lib.rs", modulePath(parts[1:]), true
+	}
+}
+
+type rustTest struct {
+	name    string // path within the file, e.g. tests::parse
+	line    int
+	ignored bool
+}
+
+// scanRustTests finds #[test] functions of a rust source line by line, inline modules are followed by braces
+func scanRustTests(src string) []rustTest {
+	type module struct {
+		name  string
+		depth int // depth of braces outside the module
+	}
+	var tests []rustTest
+	var modules []module
+	depth := 0
+	test, ignored := false, false
+	for i, line := range strings.Split(src, "\n") {
+		if comment := strings.Index(line, "//"); comment >= 0 {
+			line = line[:comment]
+		}
+		code := rustLiteralRegexp.ReplaceAllString(line, `""`)
+		if m := rustModRegexp.FindStringSubmatch(code); m != nil {
+			modules = append(modules, module{name: m[1], depth: depth})
+		}
+		test = test || rustTestAttrRegexp.MatchString(code)
+		ignored = ignored || rustIgnoreRegexp.MatchString(code)
+		if m := rustFnRegexp.FindStringSubmatch(code); m != nil {
+			if test {
+				var names []string
+				for _, module := range modules {
+					names = append(names, module.name)
+				}
+				tests = append(tests, rustTest{name: strings.Join(append(names, m[1]), "::"), line: i + 1, ignored: ignored})
+			}
+			test, ignored = false, false
+		}
+		depth += strings.Count(code, "{") - strings.Count(code, "}")
+		for len(modules) > 0 && depth <= modules[len(modules)-1].depth {
+			modules = modules[:len(modules)-1]
+		}
+	}
+	return tests
+}
+
+var (
+	goModuleRegexp = regexp.MustCompile(`(?m)^module\s+"?([^"\s]+)"?`)
+	goTestRegexp   = regexp.MustCompile(`^func (Test\w*)\(\s*\w*\s+\*testing\.T\s*\)`)
+)
+
+// discoverGo finds TestXxx functions of _test.go files, by the import path of their package
+func (project *testProject) discoverGo(root string) error {
+	modules := make(map[string]string) // directory of go.mod -> module path
+	var sources []string
+	err := walkTestFiles(root, func(rel string) error {
+		switch {
+		case path.Base(rel) == "go.mod":
+			b, err := os.ReadFile(filepath.Join(root, rel))
+			if err != nil {
+				return err
+			}
+			if m := goModuleRegexp.FindSubmatch(b); m != nil {
+				modules[path.Dir(rel)] = string(m[1])
+			}
+		case strings.HasSuffix(rel, "_test.go"):
+			sources = append(sources, rel)
+		}
+		return nil
+	})
+	if err != nil || len(modules) == 0 {
+		return err
+	}
+	if module, ok := modules["."]; ok {
+		project.name = module
+	}
+
+	suites := make(map[string]*testSuite)
+	for _, rel := range sources {
+		dir, ok := owner(modules, rel)
+		if !ok {
+			continue
+		}
+		importPath := modules[dir]
+		if pkg := path.Dir(rel); pkg != dir {
+			importPath += "/" + strings.TrimPrefix(pkg, dir+"/")
+			if dir == "." {
+				importPath = modules[dir] + "/" + pkg
+			}
+		}
+		b, err := os.ReadFile(filepath.Join(root, rel))
+		if err != nil {
+			return err
+		}
+		for i, line := range strings.Split(string(b), "\n") {
+			m := goTestRegexp.FindStringSubmatch(line)
+			// TestXxx, where Xxx does not start with a lower case letter
+			if m == nil || len(m[1]) > 4 && unicode.IsLower(rune(m[1][4])) {
+				continue
+			}
+			suite := suites[importPath]
+			if suite == nil {
+				suite = &testSuite{name: importPath}
+				suites[importPath] = suite
+				project.suites = append(project.suites, suite)
+			}
+			project.addTest(suite, m[1], rel, i+1, false)
+		}
+	}
+	slices.SortStableFunc(project.suites, func(a, b *testSuite) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return nil
+}
+
+// discoverCtest finds add_test() of CMakeLists.txt and the directories it adds
+func (project *testProject) discoverCtest(root string) error {
+	name, tests, err := parseCMakeTests(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		project.name = name
+	}
+	suite := new(testSuite)
+	project.suites = []*testSuite{suite}
+	for _, test := range tests {
+		project.addTest(suite, test.name, test.file, test.line, test.disabled)
+	}
+	return nil
+}
+
+var (
+	pyDefRegexp   = regexp.MustCompile(`^(\s*)(?:async\s+)?def\s+(test\w*)\s*\(`)
+	pyClassRegexp = regexp.MustCompile(`^class\s+(Test\w*)\s*[(:]`)
+	pySkipRegexp  = regexp.MustCompile(`^\s*@pytest\.mark\.skip(?:if)?\b`)
+)
+
+// discoverPytest finds test functions of test_*.py and *_test.py files, and test methods of their Test classes,
+// named by node ids like tests/test_api.py::TestUser::test_get
+func (project *testProject) discoverPytest(root string) error {
+	err := walkTestFiles(root, func(rel string) error {
+		base := path.Base(rel)
+		if !strings.HasSuffix(base, ".py") || !strings.HasPrefix(base, "test_") && !strings.HasSuffix(base, "_test.py") {
+			return nil
+		}
+		b, err := os.ReadFile(filepath.Join(root, rel))
+		if err != nil {
+			return err
+		}
+		suite := &testSuite{name: rel}
+		class, body := "", "" // the Test class and the indentation of its body
+		skip := false
+		for i, line := range strings.Split(string(b), "\n") {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			if indent == "" {
+				class = ""
+			}
+			if class != "" && body == "" {
+				body = indent
+			}
+			if pySkipRegexp.MatchString(line) {
+				skip = true
+				continue
+			}
+			if m := pyClassRegexp.FindStringSubmatch(line); m != nil {
+				class, body, skip = m[1], "", false
+				continue
+			}
+			if m := pyDefRegexp.FindStringSubmatch(line); m != nil {
+				switch {
+				case m[1] == "":
+					project.addTest(suite, rel+"::"+m[2], rel, i+1, skip)
+				case class != "" && m[1] == body:
+					project.addTest(suite, rel+"::"+class+"::"+m[2], rel, i+1, skip)
+				}
+				skip = false
+			}
+		}
+		project.suites = append(project.suites, suite)
+		return nil
+	})
+	return err
+}
+
+// len returns the number of tests
+func (project *testProject) len() int {
+	n := 0
+	for _, suite := range project.suites {
+		n += len(suite.tests)
+	}
+	return n
+}
+
+// tests returns all tests in the order they are reported
+func (project *testProject) tests() []*testCase {
+	var tests []*testCase
+	for _, suite := range project.suites {
+		tests = append(tests, suite.tests...)
+	}
+	return tests
+}
+
+// link points tests to their suites, and gives them unique ids qualified by the crate, package or file
+func (project *testProject) link() {
+	seen := make(map[string]bool)
+	for _, suite := range project.suites {
+		for _, test := range suite.tests {
+			test.suite = suite
+			id := test.name
+			switch project.runner {
+			case "cargo":
+				id = cargoTestCrate(suite) + "::" + test.name
+			case "go":
+				id = suite.name + "." + test.name
+			}
+			if seen[id] {
+				id += " (" + suite.name + ")"
+			}
+			seen[id] = true
+			test.id = id
+		}
+	}
+}
+
+// cargoTestCrate returns the crate name of the test binary of a suite, e.g. foo_bar for the library of foo-bar,
+// api for tests/api.rs
+func cargoTestCrate(suite *testSuite) string {
+	name := suite.pkg
+	switch {
+	case strings.HasPrefix(suite.name, "tests/"), strings.HasPrefix(suite.name, "src/bin/") && strings.Count(suite.name, "/") == 2:
+		name = strings.TrimSuffix(path.Base(suite.name), ".rs")
+	case strings.HasPrefix(suite.name, "src/bin/"):
+		name = path.Base(path.Dir(suite.name))
+	}
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+func (project *testProject) parseConfig(config *util.Config) error {
+	if config == nil {
+		return errors.New("testProject: config is nil")
+	}
+	raw := new(configTestProject)
+	err := config.Decode(raw)
+	if err != nil {
+		return err
+	}
+	err = raw.validate()
+	if err != nil {
+		return err
+	}
+	project.runner = raw.Runner
+	project.name = raw.Name
+	for _, s := range raw.Suites {
+		suite := &testSuite{name: s.Name, pkg: s.Package}
+		for _, t := range s.Tests {
+			suite.tests = append(suite.tests, &testCase{name: t.Name, file: t.File, line: t.Line, ignored: t.Ignored, ms: t.Ms})
+		}
+		project.suites = append(project.suites, suite)
+	}
+	return nil
+}
+
+func (raw *configTestProject) validate() error {
+	if !slices.Contains(testRunners, raw.Runner) {
+		return fmt.Errorf("malformed config: unknown test runner %q", raw.Runner)
+	}
+	if len(raw.Suites) == 0 {
+		return errors.New("malformed config: no tests")
+	}
+	for i, suite := range raw.Suites {
+		switch {
+		case raw.Runner == "cargo" && (suite.Name == "" || suite.Package == ""):
+			return fmt.Errorf("malformed config: suite %d should name its target and package", i)
+		case raw.Runner == "go" && suite.Name == "":
+			return fmt.Errorf("malformed config: suite %d has no import path", i)
+		case len(suite.Tests) == 0:
+			return fmt.Errorf("malformed config: suite %d has no tests", i)
+		}
+		seen := make(map[string]bool)
+		for j, test := range suite.Tests {
+			switch {
+			case test.Name == "":
+				return fmt.Errorf("malformed config: test %d of suite %d has no name", j, i)
+			case seen[test.Name]:
+				return fmt.Errorf("malformed config: test %s is listed more than once", test.Name)
+			case test.Ms < 0 || math.IsNaN(test.Ms) || math.IsInf(test.Ms, 0):
+				return fmt.Errorf("malformed config: test %s has invalid duration %v", test.Name, test.Ms)
+			}
+			seen[test.Name] = true
+		}
+	}
+	return nil
+}
+
+func (project *testProject) dumpConfig() ([]byte, error) {
+	if !project.constructed {
+		return nil, errNotConstructed
+	}
+	raw := &configTestProject{Runner: project.runner, Name: project.name}
+	for _, suite := range project.suites {
+		s := configTestSuite{Name: suite.name, Package: suite.pkg}
+		for _, test := range suite.tests {
+			s.Tests = append(s.Tests, configTestCase{Name: test.name, File: test.file, Line: test.line, Ignored: test.ignored, Ms: test.ms})
+		}
+		raw.Suites = append(raw.Suites, s)
+	}
+	return json.Marshal(raw)
+}
@@ -0,0 +1,99 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// ValidateConfig checks that the content of config can be loaded by the compiler of its type,
+// returns the number of compiling tasks within it
+func ValidateConfig(config *util.Config) (int, error) {
+	switch config.CompilerType {
+	case "cxx":
+		dep, err := newCXXDep("", config, SourceTypeConfig, util.TraverseOptions{})
+		if err != nil {
+			return 0, err
+		}
+		return dep.len(), nil
+	case "cargo":
+		project, err := newCargoProject("", config, SourceTypeConfig)
+		if err != nil {
+			return 0, err
+		}
+		return len(project.packages), nil
+	case "node":
+		project, err := newNodeProject("", config, SourceTypeConfig)
+		if err != nil {
+			return 0, err
+		}
+		return len(project.packages), nil
+	case "bundle":
+		project, err := newBundleProject("", config, SourceTypeConfig, util.TraverseOptions{})
+		if err != nil {
+			return 0, err
+		}
+		return len(project.modules), nil
+	case "pip":
+		project, err := newPipProject("", config, SourceTypeConfig)
+		if err != nil {
+			return 0, err
+		}
+		return len(project.packages), nil
+	case "gradle", "maven":
+		project, err := newJvmProject(config.CompilerType, "", config, SourceTypeConfig)
+		if err != nil {
+			return 0, err
+		}
+		return len(project.tasks), nil
+	case "bazel":
+		workspace, err := newBazelWorkspace("", config, SourceTypeConfig)
+		if err != nil {
+			return 0, err
+		}
+		return len(workspace.actions), nil
+	case "meson":
+		project, err := newMesonProject("", config, SourceTypeConfig, util.TraverseOptions{})
+		if err != nil {
+			return 0, err
+		}
+		return project.sources.len(), nil
+	case "test":
+		project, err := newTestProject("", config, SourceTypeConfig)
+		if err != nil {
+			return 0, err
+		}
+		return project.len(), nil
+	case "docker":
+		build, err := newDockerBuild("", config, SourceTypeConfig)
+		if err != nil {
+			return 0, err
+		}
+		return len(build.vertices), nil
+	case "latex":
+		document, err := newLatexDocument("", config, SourceTypeConfig, util.TraverseOptions{})
+		if err != nil {
+			return 0, err
+		}
+		return len(document.files) + len(document.bibliography), nil
+	case util.CompilerTypeMulti:
+		stages, err := config.Stages()
+		if err != nil {
+			return 0, err
+		}
+		total := 0
+		for i, stage := range stages {
+			tasks, err := ValidateConfig(stage)
+			if err != nil {
+				return 0, fmt.Errorf("stage %d (%s): %w", i, stage.CompilerType, err)
+			}
+			if stage.Version >= 2 && stage.Metadata.Tasks != tasks {
+				return 0, fmt.Errorf("stage %d (%s): metadata says %d tasks, but there are %d", i, stage.CompilerType, stage.Metadata.Tasks, tasks)
+			}
+			total += tasks
+		}
+		return total, nil
+	default:
+		return 0, fmt.Errorf("unknown compiler type %s", config.CompilerType)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cc "github.com/rizutazu/fake-compiler/compiler"
+	"github.com/rizutazu/fake-compiler/util"
+	"github.com/spf13/cobra"
+)
+
+// config files under examples/ are shipped within the binary, named as <name>_<compiler type>, generate.go next to them is not
+//
+//go:embed examples/*_*
+var examplesFS embed.FS
+
+type example struct {
+	name string
+	file string
+}
+
+func listExamples() []example {
+	entries, err := examplesFS.ReadDir("examples")
+	if err != nil {
+		log.Fatal(err)
+	}
+	var examples []example
+	for _, entry := range entries {
+		name := entry.Name()
+		if i := strings.LastIndex(name, "_"); i > 0 {
+			name = name[:i]
+		}
+		examples = append(examples, example{name: name, file: path.Join("examples", entry.Name())})
+	}
+	return examples
+}
+
+// findExample finds the example whose name is or uniquely starts with name
+func findExample(name string) (example, error) {
+	var matches []example
+	for _, e := range listExamples() {
+		if e.name == name {
+			return e, nil
+		}
+		if strings.HasPrefix(e.name, name) {
+			matches = append(matches, e)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return example{}, fmt.Errorf("no example named %s, see \"fake-compiler examples list\"", name)
+	case 1:
+		return matches[0], nil
+	default:
+		var names []string
+		for _, e := range matches {
+			names = append(names, e.name)
+		}
+		return example{}, fmt.Errorf("example name %s is ambiguous: %s", name, strings.Join(names, ", "))
+	}
+}
+
+func (e example) config() (*util.Config, error) {
+	b, err := examplesFS.ReadFile(e.file)
+	if err != nil {
+		return nil, err
+	}
+	config, err := util.ParseConfigData(b)
+	if err != nil {
+		return nil, fmt.Errorf("example %s: %w", e.name, err)
+	}
+	return config, nil
+}
+
+var examplesCmd = &cobra.Command{
+	Use:   "examples",
+	Short: "example config files shipped within the binary",
+	Long:  `example config files shipped within the binary, run one of them by "run --example name"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cmd.Help(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var examplesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list example config files",
+	Run: func(cmd *cobra.Command, args []string) {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "NAME\tTYPE\tTASKS\tESTIMATED (%d THREADS)\n", threads)
+		for _, e := range listExamples() {
+			config, err := e.config()
+			if err != nil {
+				log.Fatal(err)
+			}
+			compiler, err := cc.New(config.CompilerType, "", config, cc.SourceTypeConfig, threads, util.TraverseOptions{})
+			if err != nil {
+				log.Fatal(err)
+			}
+			tasks, err := cc.ValidateConfig(config)
+			if err != nil {
+				log.Fatal(err)
+			}
+			estimated := "-"
+			if asEstimator, ok := compiler.(cc.Estimator); ok {
+				estimated = "~" + asEstimator.Estimate().Round(time.Second).String()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", e.name, config.CompilerType, tasks, estimated)
+		}
+		if err := w.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	examplesListCmd.Flags().IntVarP(&threads, "threads", "t", 16, "number of threads the duration is estimated with")
+	examplesCmd.AddCommand(examplesListCmd)
+}
@@ -0,0 +1,786 @@
+//go:build ignore
+
+// generate.go builds the synthesized example configs: llvm_cxx, chromium_cxx, rustc_cargo, tokio_cargo and
+// go-monorepo_bazel. Each of them is generated by "gen" from a tree shaped like the project it is named after:
+// directory layout, file names and sizes, workspace members and dependency graphs are made up by a seeded random
+// generator, so that the configs are the same every time. Files are sparse, the trees take little space.
+// The trees are built in a temporary directory, which is replaced by -root in the paths the configs record,
+// e.g. paths of cargo workspace members. The version recorded as the generator is set by -ldflags, see util.Version
+//
+// Run it from the root of the repository, then rebuild:
+//
+//	go run examples/generate.go [-work dir] [-root dir] [-version version] [-keep]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	workDir = flag.String("work", filepath.Join(os.TempDir(), "fake-compiler-examples"), "directory the trees are built in")
+	rootDir = flag.String("root", "/home/rizu/git_dir", "directory the trees are recorded in, paths of cargo workspace members are shown by the build")
+	version = flag.String("version", "", "version of the generator recorded in the configs, default: git describe --tags --always")
+	keep    = flag.Bool("keep", false, "keep the trees after the configs are generated")
+)
+
+func main() {
+	flag.Parse()
+	if _, err := os.Stat("go.mod"); err != nil {
+		log.Fatal("run it from the root of the repository: go run examples/generate.go")
+	}
+	work, err := filepath.Abs(*workDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *version == "" {
+		out, err := exec.Command("git", "describe", "--tags", "--always").Output()
+		if err != nil {
+			log.Fatalf("git describe: %s, set -version", err)
+		}
+		*version = strings.TrimSpace(string(out))
+	}
+	err = os.MkdirAll(work, 0755)
+	if err != nil {
+		log.Fatal(err)
+	}
+	binary := filepath.Join(work, "fake-compiler")
+	run("go", "build", "-ldflags", "-X github.com/rizutazu/fake-compiler/util.Version="+*version, "-o", binary, ".")
+
+	examples := []struct {
+		name     string // <name>_<compiler type>
+		dir      string
+		compiler string
+		build    func(t *tree)
+	}{
+		{"llvm_cxx", "llvm-project", "cxx", llvm},
+		{"chromium_cxx", "chromium", "cxx", chromium},
+		{"rustc_cargo", "rust", "cargo", rustc},
+		{"tokio_cargo", "tokio", "cargo", tokio},
+		{"go-monorepo_bazel", "go-monorepo", "bazel", goMonorepo},
+	}
+	for i, e := range examples {
+		root := filepath.Join(work, e.dir)
+		if err := os.RemoveAll(root); err != nil {
+			log.Fatal(err)
+		}
+		t := &tree{root: root, rng: rand.New(rand.NewPCG(42, uint64(i)))}
+		e.build(t)
+		fmt.Printf("%s: %d files\n", e.name, t.files)
+
+		// the config is moved to -root through its document
+		config := filepath.Join(work, e.name)
+		document := config + ".json"
+		run(binary, "gen", "-C", e.compiler, "-d", root, "-o", config, "--force")
+		run(binary, "export", "-c", config, "-o", document)
+		b, err := os.ReadFile(document)
+		if err != nil {
+			log.Fatal(err)
+		}
+		b = []byte(strings.ReplaceAll(string(b), `"`+work+"/", `"`+*rootDir+"/"))
+		err = os.WriteFile(document, b, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		run(binary, "import", document, "-o", filepath.Join("examples", e.name), "--compression", "gzip:9")
+
+		for _, path := range []string{config, document} {
+			if err := os.Remove(path); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if !*keep {
+			if err := os.RemoveAll(root); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if err := os.Remove(binary); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(name string, args ...string) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Fatalf("%s %s: %s", filepath.Base(name), strings.Join(args, " "), err)
+	}
+}
+
+// tree writes files below root, names are picked by rng
+type tree struct {
+	root  string
+	rng   *rand.Rand
+	files int
+}
+
+// file creates a sparse file of size
+func (t *tree) file(rel string, size int64) {
+	p := filepath.Join(t.root, rel)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		log.Fatal(err)
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	t.files++
+}
+
+func (t *tree) write(rel, content string) {
+	p := filepath.Join(t.root, rel)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// size draws from a log-normal distribution around median, in bytes
+func (t *tree) size(median float64, sigma float64) int64 {
+	return max(int64(median*math.Exp(sigma*t.rng.NormFloat64())), 64)
+}
+
+func (t *tree) pick(words []string) string {
+	return words[t.rng.IntN(len(words))]
+}
+
+// between returns a number in [lo, hi]
+func (t *tree) between(lo, hi int) int {
+	return lo + t.rng.IntN(hi-lo+1)
+}
+
+// area is a directory of the tree and the number of sources below it, which are spread over subs if there are any
+type area struct {
+	dir   string
+	count int
+	subs  []string
+}
+
+// sources names sources of a directory, each call returns a new name
+type sources struct {
+	name   func() string
+	median float64 // median size
+	sigma  float64
+}
+
+// fill creates count sources in dir, spread over subdirectories: the given ones, or random ones named by sub
+// down to depth levels if subs is empty
+func (t *tree) fill(dir string, count int, subs []string, depth int, sub func() string, src sources) {
+	if len(subs) == 0 && depth > 0 && count > 60 {
+		n := t.between(2, min(count/25, 12))
+		for len(subs) < n {
+			if name := sub(); !slices.Contains(subs, name) {
+				subs = append(subs, name)
+			}
+		}
+	}
+	if len(subs) == 0 {
+		seen := make(map[string]bool)
+		for range count {
+			name := src.name()
+			for tries := 0; seen[name] && tries < 8; tries++ {
+				name = src.name()
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			t.file(filepath.Join(dir, name), t.size(src.median, src.sigma))
+		}
+		return
+	}
+	// a share of the sources stays in dir, the rest goes to subdirectories with random weights
+	own := count / (len(subs) + 3)
+	t.fill(dir, own, nil, 0, sub, src)
+	weights := make([]float64, len(subs))
+	total := 0.0
+	for i := range weights {
+		weights[i] = 0.2 + t.rng.ExpFloat64()
+		total += weights[i]
+	}
+	rest := count - own
+	for i, s := range subs {
+		n := int(float64(rest) * weights[i] / total)
+		t.fill(filepath.Join(dir, s), max(n, 1), nil, depth-1, sub, src)
+	}
+}
+
+// llvm -----------------------------------------------------------------------
+
+var camelWords = []string{"Alias", "Analysis", "Arg", "Asm", "Attribute", "Basic", "Block", "Branch", "Builder", "Call",
+	"Canonicalize", "Cast", "Check", "Combine", "Constant", "Context", "Debug", "Decl", "Dependence", "Diag", "Dominator",
+	"Dwarf", "Emitter", "Expand", "Expr", "Fold", "Frame", "Function", "Global", "Hoist", "Inline", "Info", "Instr",
+	"Instruction", "Intrinsic", "Layout", "Legalizer", "Live", "Loop", "Lower", "Lowering", "Machine", "Memory", "Merge",
+	"Metadata", "Module", "Object", "Operand", "Opt", "Parser", "Pass", "Pattern", "Phi", "Printer", "Profile", "Reader",
+	"Register", "Reloc", "Rewrite", "Scalar", "Schedule", "Section", "Select", "Sema", "Sink", "Split", "Stack", "Stmt",
+	"Symbol", "Table", "Target", "Template", "Type", "Unroll", "Utils", "Value", "Vector", "Verifier", "Writer"}
+
+func (t *tree) camel(prefix, suffix, ext string) func() string {
+	return func() string {
+		name := prefix + t.pick(camelWords)
+		if t.rng.IntN(3) > 0 {
+			name += t.pick(camelWords)
+		}
+		return name + suffix + ext
+	}
+}
+
+func llvm(t *tree) {
+	t.write("CMakeLists.txt", `cmake_minimum_required(VERSION 3.20.0)
+project(LLVM VERSION 19.1.7 LANGUAGES C CXX ASM)
+find_package(Threads REQUIRED)
+find_package(ZLIB)
+find_package(LibXml2 2.5.3)
+find_package(Python3 3.8 REQUIRED COMPONENTS Interpreter)
+include(CheckIncludeFile)
+check_include_file(dlfcn.h HAVE_DLFCN_H)
+check_include_file(sys/mman.h HAVE_SYS_MMAN_H)
+check_include_file(valgrind/valgrind.h HAVE_VALGRIND_VALGRIND_H)
+check_symbol_exists(pthread_getname_np pthread.h HAVE_PTHREAD_GETNAME_NP)
+check_symbol_exists(mallinfo2 malloc.h HAVE_MALLINFO2)
+check_type_size(int64_t INT64_T)
+`)
+
+	cpp := sources{name: t.camel("", "", ".cpp"), median: 14000, sigma: 1.0}
+	tests := sources{name: t.camel("", "Test", ".cpp"), median: 9000, sigma: 0.8}
+	sub := func() string { return t.pick(camelWords) }
+	for _, a := range []area{
+		{"llvm/lib", 2600, []string{"Analysis", "AsmParser", "BinaryFormat", "Bitcode/Reader", "Bitcode/Writer", "CodeGen",
+			"CodeGen/SelectionDAG", "CodeGen/GlobalISel", "CodeGen/AsmPrinter", "DebugInfo/DWARF", "DebugInfo/PDB",
+			"DebugInfo/CodeView", "Demangle", "ExecutionEngine/Orc", "ExecutionEngine/JITLink", "IR", "LTO", "Linker", "MC",
+			"MC/MCParser", "Object", "ObjectYAML", "Option", "Passes", "ProfileData", "Support", "TableGen", "TargetParser",
+			"Transforms/Scalar", "Transforms/IPO", "Transforms/InstCombine", "Transforms/Instrumentation",
+			"Transforms/Utils", "Transforms/Vectorize", "Transforms/Coroutines", "Transforms/ObjCARC"}},
+		{"llvm/tools", 300, []string{"llc", "lli", "opt", "llvm-ar", "llvm-as", "llvm-dis", "llvm-link", "llvm-nm",
+			"llvm-objdump", "llvm-readobj", "llvm-profdata", "llvm-cov", "llvm-mca", "llvm-dwarfdump", "llvm-symbolizer",
+			"llvm-config", "bugpoint", "dsymutil", "llvm-reduce", "llvm-objcopy"}},
+		{"llvm/utils/TableGen", 120, nil},
+		{"clang/lib", 1500, []string{"AST", "ASTMatchers", "Analysis", "APINotes", "Basic", "CodeGen", "CodeGen/Targets",
+			"CrossTU", "Driver", "Driver/ToolChains", "Edit", "ExtractAPI", "Format", "Frontend", "Index", "InstallAPI",
+			"Interpreter", "Lex", "Parse", "Rewrite", "Sema", "Serialization", "StaticAnalyzer/Core",
+			"StaticAnalyzer/Checkers", "StaticAnalyzer/Frontend", "Tooling", "Tooling/Syntax"}},
+		{"clang/tools", 120, []string{"driver", "clang-format", "libclang", "c-index-test", "clang-scan-deps", "clang-repl",
+			"clang-offload-bundler", "clang-installapi"}},
+		{"clang-tools-extra", 800, []string{"clangd", "clang-tidy", "clang-include-fixer", "clang-doc", "include-cleaner",
+			"clang-query", "clang-reorder-fields"}},
+		{"lld", 160, []string{"ELF", "COFF", "MachO", "wasm", "Common", "MinGW"}},
+		{"mlir/lib", 1800, []string{"IR", "Dialect/Affine", "Dialect/Arith", "Dialect/Func", "Dialect/GPU", "Dialect/LLVMIR",
+			"Dialect/Linalg", "Dialect/MemRef", "Dialect/SCF", "Dialect/SPIRV", "Dialect/Tensor", "Dialect/Tosa",
+			"Dialect/Vector", "Dialect/SparseTensor", "Dialect/Bufferization", "Dialect/OpenMP", "Dialect/Transform",
+			"Conversion", "Transforms", "Analysis", "Pass", "Parser", "Support", "Target", "Interfaces", "Rewrite", "CAPI"}},
+		{"lldb/source", 1400, []string{"API", "Breakpoint", "Commands", "Core", "DataFormatters", "Expression", "Host/common",
+			"Interpreter", "Symbol", "Target", "Utility", "Plugins/ABI", "Plugins/ObjectFile", "Plugins/Process",
+			"Plugins/SymbolFile", "Plugins/TypeSystem", "Plugins/Language", "Plugins/Platform", "Plugins/DynamicLoader"}},
+		{"flang/lib", 350, []string{"Common", "Decimal", "Evaluate", "Frontend", "Lower", "Optimizer", "Parser", "Semantics"}},
+		{"flang/runtime", 100, nil},
+		{"bolt/lib", 150, []string{"Core", "Passes", "Profile", "Rewrite", "Target", "Utils"}},
+		{"polly/lib", 150, []string{"Analysis", "CodeGen", "Exchange", "Support", "Transform"}},
+		{"libcxx/src", 80, nil},
+		{"libcxxabi/src", 25, nil},
+		{"openmp/runtime/src", 50, nil},
+	} {
+		t.fill(a.dir, a.count, a.subs, 1, sub, cpp)
+	}
+
+	// every backend has its own directory, files are prefixed by the target
+	for _, target := range []string{"X86", "AArch64", "ARM", "AMDGPU", "RISCV", "PowerPC", "Mips", "SystemZ",
+		"WebAssembly", "NVPTX", "Hexagon", "LoongArch", "Sparc", "BPF", "Lanai", "MSP430", "VE", "XCore", "AVR", "CSKY",
+		"M68k", "ARC"} {
+		dir := "llvm/lib/Target/" + target
+		n := t.between(40, 220)
+		if target == "X86" || target == "AArch64" || target == "AMDGPU" || target == "RISCV" {
+			n += 120
+		}
+		src := sources{name: t.camel(target, "", ".cpp"), median: 18000, sigma: 1.1}
+		t.fill(dir, n, nil, 0, sub, src)
+		for _, s := range []string{"MCTargetDesc", "AsmParser", "Disassembler", "TargetInfo"} {
+			t.fill(dir+"/"+s, t.between(1, 20), nil, 0, sub, src)
+		}
+	}
+
+	for _, a := range []area{
+		{"llvm/unittests", 1200, []string{"ADT", "Support", "IR", "CodeGen", "Analysis", "Transforms", "ExecutionEngine",
+			"MC", "Object", "ProfileData", "Frontend", "Passes"}},
+		{"clang/unittests", 400, []string{"AST", "ASTMatchers", "Basic", "Driver", "Format", "Frontend", "Lex", "Sema",
+			"Tooling", "StaticAnalyzer"}},
+		{"mlir/unittests", 150, []string{"IR", "Dialect", "Pass", "Support", "Interfaces"}},
+	} {
+		t.fill(a.dir, a.count, a.subs, 0, sub, tests)
+	}
+
+	// compiler-rt is written in c, c++ and assembly
+	snake := func(prefix, ext string) func() string {
+		return func() string {
+			name := prefix + t.pick(snakeWords)
+			if t.rng.IntN(2) == 0 {
+				name += "_" + t.pick(snakeWords)
+			}
+			return name + ext
+		}
+	}
+	t.fill("compiler-rt/lib/builtins", 300, nil, 0, sub, sources{name: snake("", ".c"), median: 1500, sigma: 0.7})
+	for _, arch := range []string{"x86_64", "i386", "aarch64", "arm", "riscv"} {
+		t.fill("compiler-rt/lib/builtins/"+arch, t.between(6, 30), nil, 0, sub, sources{name: snake("", ".S"), median: 1200, sigma: 0.5})
+	}
+	t.fill("compiler-rt/lib/profile", 15, nil, 0, sub, sources{name: snake("InstrProfiling", ".c"), median: 8000, sigma: 0.8})
+	for _, s := range []string{"sanitizer_common", "asan", "tsan/rtl", "msan", "ubsan", "hwasan", "lsan", "xray", "fuzzer",
+		"memprof", "dfsan", "interception", "scudo/standalone"} {
+		prefix := strings.Split(s, "/")[0] + "_"
+		t.fill("compiler-rt/lib/"+s, t.between(5, 120), nil, 0, sub, sources{name: snake(prefix, ".cpp"), median: 10000, sigma: 0.9})
+	}
+	t.fill("libunwind/src", 5, nil, 0, sub, sources{name: snake("Unwind", ".S"), median: 6000, sigma: 0.6})
+}
+
+// chromium -------------------------------------------------------------------
+
+var snakeWords = []string{"accessibility", "audio", "autofill", "bookmark", "browser", "buffer", "cache", "channel",
+	"client", "context", "controller", "cookie", "data", "delegate", "device", "dialog", "dom", "download", "element",
+	"event", "extension", "factory", "file", "font", "frame", "gpu", "handler", "history", "host", "http", "image",
+	"input", "layer", "layout", "loader", "manager", "media", "message", "metrics", "model", "navigation", "network",
+	"node", "observer", "page", "paint", "permission", "policy", "prefs", "profile", "provider", "proxy", "quic",
+	"registry", "render", "request", "resource", "scheduler", "script", "service", "session", "socket", "storage",
+	"stream", "style", "surface", "sync", "tab", "task", "thread", "token", "tracker", "url", "util", "video", "view",
+	"web", "widget", "window", "worker"}
+
+var chromiumSuffixes = []string{"", "", "", "", "_impl", "_impl", "_util", "_factory", "_unittest", "_unittest",
+	"_browsertest", "_linux", "_test_util"}
+
+func chromium(t *tree) {
+	src := sources{
+		name: func() string {
+			name := t.pick(snakeWords) + "_" + t.pick(snakeWords)
+			if t.rng.IntN(3) == 0 {
+				name += "_" + t.pick(snakeWords)
+			}
+			return name + t.pick(chromiumSuffixes) + ".cc"
+		},
+		median: 7000,
+		sigma:  1.0,
+	}
+	sub := func() string { return t.pick(snakeWords) }
+	for _, a := range []area{
+		{"base", 900, []string{"allocator", "containers", "files", "json", "memory", "message_loop", "metrics", "numerics",
+			"process", "strings", "synchronization", "task", "threading", "time", "trace_event", "types"}},
+		{"build", 40, nil},
+		{"net", 1300, []string{"base", "cert", "cookies", "disk_cache", "dns", "http", "proxy_resolution", "quic", "socket",
+			"spdy", "ssl", "url_request", "websockets"}},
+		{"content/browser", 2800, nil},
+		{"content", 1200, []string{"renderer", "common", "public", "child", "gpu", "utility", "app", "shell", "test"}},
+		{"chrome/browser", 7500, []string{"ui/views", "ui/webui", "ui/tabs", "ui/omnibox", "extensions", "ash",
+			"profiles", "sync", "download", "history", "password_manager", "autofill", "safe_browsing", "policy", "signin",
+			"metrics", "search", "permissions", "media", "notifications", "net", "prefs", "sessions", "themes",
+			"web_applications", "printing", "devtools", "apps", "enterprise", "optimization_guide"}},
+		{"chrome", 1400, []string{"renderer", "common", "test", "installer", "updater", "app", "utility", "services"}},
+		{"third_party/blink/renderer/core", 3500, []string{"css", "dom", "editing", "events", "exported", "fetch", "frame",
+			"html", "input", "inspector", "layout", "loader", "page", "paint", "script", "style", "svg", "timing",
+			"workers", "xml"}},
+		{"third_party/blink/renderer/modules", 2200, []string{"accessibility", "bluetooth", "canvas", "credentialmanagement",
+			"encryptedmedia", "filesystem", "gamepad", "indexeddb", "mediastream", "peerconnection", "payments",
+			"permissions", "push_messaging", "service_worker", "storage", "webaudio", "webgl", "webgpu", "websockets",
+			"xr"}},
+		{"third_party/blink/renderer/platform", 1000, nil},
+		{"third_party/blink", 300, []string{"common", "public"}},
+		{"components", 7000, []string{"autofill", "password_manager", "sync", "history", "bookmarks", "omnibox",
+			"safe_browsing", "signin", "policy", "metrics", "variations", "viz", "download", "content_settings",
+			"search_engines", "translate", "feature_engagement", "optimization_guide", "performance_manager",
+			"segmentation_platform", "sessions", "storage_monitor", "ukm", "user_manager", "webapps", "exo", "cast",
+			"network_session_configurator", "subresource_filter", "payments", "permissions", "prefs", "paint_preview",
+			"offline_pages", "leveldb_proto", "invalidation", "gcm_driver", "favicon", "dom_distiller", "crash"}},
+		{"ui", 3000, []string{"views", "gfx", "base", "gl", "ozone", "events", "accessibility", "aura", "compositor",
+			"display", "color", "message_center", "native_theme", "shell_dialogs", "touch_selection", "latency"}},
+		{"services", 1800, []string{"network", "device", "service_manager", "audio", "video_capture", "tracing", "viz",
+			"data_decoder", "storage", "shape_detection", "screen_ai", "on_device_model", "resource_coordinator"}},
+		{"v8/src", 1600, []string{"compiler", "objects", "heap", "builtins", "codegen", "wasm", "runtime", "interpreter",
+			"parsing", "execution", "maglev", "baseline", "snapshot", "ic", "inspector", "debug", "api", "regexp",
+			"profiler", "strings", "ast", "diagnostics"}},
+		{"gpu", 700, []string{"command_buffer", "config", "ipc", "vulkan"}},
+		{"media", 1500, []string{"audio", "base", "capture", "cdm", "filters", "formats", "gpu", "mojo", "renderers",
+			"video", "webrtc"}},
+		{"cc", 900, []string{"animation", "base", "input", "layers", "metrics", "paint", "raster", "scheduler", "tiles",
+			"trees"}},
+		{"mojo", 300, []string{"core", "public/cpp/bindings", "public/cpp/system", "public/cpp/base"}},
+		{"storage", 150, []string{"browser", "common"}},
+		{"device", 500, []string{"bluetooth", "fido", "gamepad", "vr"}},
+		{"extensions", 1200, []string{"browser", "common", "renderer", "shell"}},
+		{"third_party/skia/src", 700, []string{"core", "gpu", "effects", "pdf", "shaders", "text", "utils", "codec"}},
+		{"third_party/webrtc", 1300, []string{"api", "call", "common_audio", "media", "modules", "p2p", "pc", "rtc_base",
+			"video"}},
+		{"third_party/angle/src", 700, []string{"common", "compiler", "libANGLE", "libGLESv2"}},
+		{"ash", 3500, nil},
+		{"chromeos", 1000, nil},
+		{"ipc", 80, nil},
+		{"sql", 30, nil},
+		{"url", 40, nil},
+		{"crypto", 30, nil},
+		{"sandbox", 150, []string{"linux", "policy"}},
+		{"printing", 150, []string{"backend", "common"}},
+		{"pdf", 200, nil},
+		{"remoting", 700, []string{"base", "client", "codec", "host", "protocol", "signaling"}},
+		{"headless", 150, nil},
+		{"google_apis", 200, []string{"gaia", "gcm", "drive", "calendar"}},
+		{"gin", 50, nil},
+		{"tools", 300, []string{"gn", "ipc_fuzzer", "traffic_annotation", "v8_context_snapshot"}},
+	} {
+		t.fill(a.dir, a.count, a.subs, 2, sub, src)
+	}
+}
+
+// cargo ----------------------------------------------------------------------
+
+// crates.io packages, roughly the lower ones first: packages are picked as dependencies of later ones
+var registryCrates = []string{"cfg-if 1.0.0", "libc 0.2.161", "autocfg 1.4.0", "version_check 0.9.5",
+	"unicode-ident 1.0.13", "proc-macro2 1.0.89", "quote 1.0.37", "syn 2.0.85", "syn 1.0.109", "memchr 2.7.4",
+	"once_cell 1.20.2", "bitflags 2.6.0", "bitflags 1.3.2", "itoa 1.0.11", "ryu 1.0.18", "serde_derive 1.0.214",
+	"serde 1.0.214", "serde_json 1.0.132", "smallvec 1.13.2", "scopeguard 1.2.0", "lock_api 0.4.12",
+	"parking_lot_core 0.9.10", "parking_lot 0.12.3", "either 1.13.0", "itertools 0.12.1", "hashbrown 0.15.0",
+	"hashbrown 0.14.5", "equivalent 1.0.1", "indexmap 2.6.0", "aho-corasick 1.1.3", "regex-syntax 0.8.5",
+	"regex-automata 0.4.8", "regex 1.11.1", "log 0.4.22", "lazy_static 1.5.0", "pin-project-lite 0.2.15",
+	"tracing-core 0.1.32", "tracing-attributes 0.1.27", "tracing 0.1.40", "sharded-slab 0.1.7",
+	"thread_local 1.1.8", "nu-ansi-term 0.50.1", "tracing-log 0.2.0", "tracing-subscriber 0.3.18",
+	"tracing-tree 0.3.1", "rustc-hash 1.1.0", "rustc-hash 2.0.0", "stable_deref_trait 1.2.0", "arrayvec 0.7.6",
+	"thin-vec 0.2.13", "tempfile 3.13.0", "fastrand 2.1.1", "rustix 0.38.38", "linux-raw-sys 0.4.14",
+	"errno 0.3.9", "getrandom 0.2.15", "rand_core 0.6.4", "ppv-lite86 0.2.20", "rand_chacha 0.3.1", "rand 0.8.5",
+	"rand_xoshiro 0.6.0", "crc32fast 1.4.2", "adler2 2.0.0", "miniz_oxide 0.8.0", "flate2 1.0.34",
+	"object 0.36.5", "gimli 0.31.1", "addr2line 0.24.2", "rustc-demangle 0.1.24", "backtrace 0.3.74",
+	"cc 1.1.31", "shlex 1.3.0", "jobserver 0.1.32", "libloading 0.8.5", "memmap2 0.2.3", "ar_archive_writer 0.4.2",
+	"wasm-encoder 0.219.1", "wasmparser 0.219.1", "leb128 0.2.5", "semver 1.0.23", "unicode-width 0.1.14",
+	"unicode-normalization 0.1.24", "unicode-properties 0.1.3", "unicode-script 0.5.7",
+	"unicode-security 0.1.1", "tinyvec 1.8.0", "tinyvec_macros 0.1.1", "annotate-snippets 0.11.4",
+	"anstyle 1.0.10", "termcolor 1.4.1", "termize 0.1.1", "fluent-bundle 0.15.3", "fluent-syntax 0.11.1",
+	"fluent-langneg 0.13.0", "intl-memoizer 0.5.2", "intl_pluralrules 7.0.2", "unic-langid 0.9.5",
+	"unic-langid-impl 0.9.5", "unic-langid-macros 0.9.5", "tinystr 0.7.6", "self_cell 1.0.4",
+	"type-map 0.5.0", "elsa 1.10.0", "icu_list 1.5.0", "icu_locid 1.5.0", "icu_provider 1.5.0",
+	"yoke 0.7.4", "zerovec 0.10.4", "zerofrom 0.1.4", "writeable 0.5.5", "displaydoc 0.2.5",
+	"synstructure 0.13.1", "measureme 11.0.1", "perf-event-open-sys 3.0.0", "polonius-engine 0.13.0",
+	"datafrog 2.0.1", "ena 0.14.3", "odht 0.3.1", "indexmap 1.9.3", "crossbeam-utils 0.8.20",
+	"crossbeam-epoch 0.9.18", "crossbeam-deque 0.8.5", "crossbeam-channel 0.5.13", "rayon-core 1.12.1",
+	"rayon 1.10.0", "num_cpus 1.16.0", "jemalloc-sys 0.5.4+5.3.0-patched", "tikv-jemalloc-sys 0.6.0+5.3.0-1-ge13ca993e8ccb9ba9847cc330696e02839f328f7",
+	"pulldown-cmark 0.11.3", "pulldown-cmark-escape 0.11.0", "unicase 2.8.0", "sha1 0.10.6", "sha2 0.10.8",
+	"md-5 0.10.6", "digest 0.10.7", "block-buffer 0.10.4", "crypto-common 0.1.6", "generic-array 0.14.7",
+	"typenum 1.17.0", "cpufeatures 0.2.14", "hex 0.4.3", "thiserror 1.0.65", "thiserror-impl 1.0.65",
+	"anyhow 1.0.91", "clap 4.5.20", "clap_builder 4.5.20", "clap_derive 4.5.18", "clap_lex 0.7.2",
+	"strsim 0.11.1", "anstream 0.6.17", "anstyle-parse 0.2.6", "anstyle-query 1.1.2", "utf8parse 0.2.2",
+	"colorchoice 1.0.3", "is_terminal_polyfill 1.70.1", "heck 0.5.0", "toml 0.8.19", "toml_edit 0.22.22",
+	"toml_datetime 0.6.8", "serde_spanned 0.6.8", "winnow 0.6.20", "walkdir 2.5.0", "same-file 1.0.6",
+	"glob 0.3.1", "ignore 0.4.23", "globset 0.4.15", "bstr 1.10.0", "home 0.5.9", "dirs 5.0.1",
+	"dirs-sys 0.4.1", "option-ext 0.2.0", "opener 0.7.2", "url 2.5.2", "form_urlencoded 1.2.1",
+	"percent-encoding 2.3.1", "idna 0.5.0", "unicode-bidi 0.3.17", "time 0.3.36", "time-core 0.1.2",
+	"time-macros 0.2.18", "deranged 0.3.11", "powerfmt 0.2.0", "num-conv 0.1.0", "chrono 0.4.38",
+	"iana-time-zone 0.1.61", "num-traits 0.2.19", "num-integer 0.1.46", "bytes 1.8.0", "mio 1.0.2",
+	"socket2 0.5.7", "signal-hook-registry 1.4.2", "slab 0.4.9", "futures-core 0.3.31", "futures-sink 0.3.31",
+	"futures-channel 0.3.31", "futures-task 0.3.31", "futures-io 0.3.31", "futures-macro 0.3.31",
+	"futures-util 0.3.31", "futures-executor 0.3.31", "futures 0.3.31", "pin-utils 0.1.0",
+	"async-stream 0.3.6", "async-stream-impl 0.3.6", "mockall 0.13.0", "mockall_derive 0.13.0",
+	"predicates 3.1.2", "predicates-core 1.0.8", "predicates-tree 1.0.11", "downcast 0.11.0",
+	"fragile 2.0.0", "difflib 0.4.0", "float-cmp 0.9.0", "normalize-line-endings 0.3.0", "termtree 0.4.1",
+	"loom 0.7.2", "generator 0.8.3", "scoped-tls 1.0.1", "proptest 1.5.0", "rand_xorshift 0.3.0",
+	"rusty-fork 0.3.0", "wait-timeout 0.2.0", "quick-error 1.2.3", "unarray 0.1.4", "bit-set 0.5.3",
+	"bit-vec 0.6.3", "criterion 0.5.1", "ciborium 0.2.2", "ciborium-io 0.2.2", "ciborium-ll 0.2.2",
+	"half 2.4.1", "plotters 0.3.7", "plotters-backend 0.3.7", "plotters-svg 0.3.7", "tinytemplate 1.2.1",
+	"cast 0.3.0", "oorandom 11.1.4", "anes 0.1.6", "is-terminal 0.4.13", "hermit-abi 0.4.0",
+	"trybuild 1.0.101", "target-triple 0.1.3", "httparse 1.9.5", "httpdate 1.0.3", "http 1.1.0",
+	"http-body 1.0.1", "hyper 1.5.0", "want 0.3.1", "try-lock 0.2.5", "tower-service 0.3.3",
+	"tokio 1.41.0", "tokio-macros 2.4.0"}
+
+// crate is a package of Cargo.lock, dependencies refer to other packages by "name version"
+type crate struct {
+	name, version string
+	member        string // directory of workspace member, empty for packages from the registry
+	dependencies  []string
+}
+
+// id is how Cargo.lock refers to a package
+func (c *crate) id() string {
+	return c.name + " " + c.version
+}
+
+// dependOn adds n random dependencies among candidates, each picked at most once
+func (t *tree) dependOn(c *crate, candidates []*crate, n int) {
+	for range n {
+		if len(candidates) == 0 {
+			return
+		}
+		dep := candidates[t.rng.IntN(len(candidates))]
+		if dep == c || slices.Contains(c.dependencies, dep.id()) {
+			continue
+		}
+		c.dependencies = append(c.dependencies, dep.id())
+	}
+}
+
+// registry returns the first n crates of the registry, with dependencies among the ones before them
+func (t *tree) registry(n int) []*crate {
+	var crates []*crate
+	for _, spec := range registryCrates[:n] {
+		name, version, _ := strings.Cut(spec, " ")
+		c := &crate{name: name, version: version}
+		t.dependOn(c, crates[max(len(crates)-60, 0):], t.between(0, 5))
+		crates = append(crates, c)
+	}
+	return crates
+}
+
+// writeWorkspace writes Cargo.toml of the workspace and its members, and Cargo.lock of all crates
+func (t *tree) writeWorkspace(crates []*crate) {
+	var members []string
+	for _, c := range crates {
+		if c.member != "" {
+			members = append(members, c.member)
+			t.write(c.member+"/Cargo.toml", fmt.Sprintf("[package]\nname = %q\nversion = %q\nedition = \"2021\"\n", c.name, c.version))
+			t.file(c.member+"/src/lib.rs", t.size(20000, 1.0))
+		}
+	}
+	var b strings.Builder
+	b.WriteString("[workspace]\nresolver = \"2\"\nmembers = [\n")
+	for _, m := range members {
+		fmt.Fprintf(&b, "  %q,\n", m)
+	}
+	b.WriteString("]\n")
+	t.write("Cargo.toml", b.String())
+
+	// versions are only written for names that have several of them, like cargo does
+	versions := make(map[string]int)
+	for _, c := range crates {
+		versions[c.name]++
+	}
+	b.Reset()
+	b.WriteString("# This file is automatically @generated by Cargo.\n# It is not intended for manual editing.\nversion = 3\n")
+	sorted := slices.Clone(crates)
+	slices.SortFunc(sorted, func(a, b *crate) int { return strings.Compare(a.id(), b.id()) })
+	for _, c := range sorted {
+		fmt.Fprintf(&b, "\n[[package]]\nname = %q\nversion = %q\n", c.name, c.version)
+		if c.member == "" {
+			b.WriteString("source = \"registry+https://github.com/rust-lang/crates.io-index\"\n")
+		}
+		if len(c.dependencies) > 0 {
+			deps := slices.Clone(c.dependencies)
+			for i, dep := range deps {
+				if name, _, _ := strings.Cut(dep, " "); versions[name] == 1 {
+					deps[i] = name
+				}
+			}
+			slices.Sort(deps)
+			b.WriteString("dependencies = [\n")
+			for _, dep := range deps {
+				fmt.Fprintf(&b, " %q,\n", dep)
+			}
+			b.WriteString("]\n")
+		}
+	}
+	t.write("Cargo.lock", b.String())
+}
+
+var rustcCrates = []string{"rustc_arena", "rustc_graphviz", "rustc_index_macros", "rustc_index", "rustc_serialize",
+	"rustc_macros", "rustc_fs_util", "rustc_log", "rustc_data_structures", "rustc_span", "rustc_ast_ir", "rustc_abi",
+	"rustc_lexer", "rustc_type_ir_macros", "rustc_type_ir", "rustc_error_codes", "rustc_error_messages",
+	"rustc_fluent_macro", "rustc_lint_defs", "rustc_target", "rustc_errors", "rustc_feature", "rustc_ast",
+	"rustc_ast_pretty", "rustc_parse_format", "rustc_hir", "rustc_session", "rustc_attr", "rustc_hir_pretty",
+	"rustc_query_system", "rustc_parse", "rustc_expand", "rustc_middle", "rustc_infer", "rustc_next_trait_solver",
+	"rustc_transmute", "rustc_trait_selection", "rustc_ty_utils", "rustc_traits", "rustc_pattern_analysis",
+	"rustc_mir_dataflow", "rustc_const_eval", "rustc_symbol_mangling", "rustc_sanitizers", "rustc_metadata",
+	"rustc_ast_lowering", "rustc_ast_passes", "rustc_builtin_macros", "rustc_resolve", "rustc_hir_analysis",
+	"rustc_hir_typeck", "rustc_lint", "rustc_borrowck", "rustc_mir_build", "rustc_mir_transform",
+	"rustc_monomorphize", "rustc_privacy", "rustc_passes", "rustc_incremental", "rustc_query_impl",
+	"rustc_codegen_ssa", "rustc_llvm", "rustc_codegen_llvm", "rustc_smir", "stable_mir", "rustc_interface",
+	"rustc_driver_impl", "rustc_driver", "rustc-main"}
+
+var rustcTools = []string{"tidy", "compiletest", "linkchecker", "rustbook", "lint-docs", "jsondocck", "html-checker",
+	"error_index_generator", "rust-installer", "build-manifest", "remote-test-client", "remote-test-server",
+	"unstable-book-gen", "collect-license-metadata", "generate-copyright", "suggest-tests", "opt-dist",
+	"coverage-dump", "rustdoc", "rustdoc-tool", "clippy_utils", "clippy_lints", "clippy", "rustfmt-nightly", "miri",
+	"cargo-miri"}
+
+func rustc(t *tree) {
+	crates := t.registry(len(registryCrates) - 60)
+	var compiler []*crate
+	for _, name := range rustcCrates {
+		dir := "compiler/" + name
+		if name == "rustc-main" {
+			dir = "compiler/rustc"
+		}
+		c := &crate{name: name, version: "0.0.0", member: dir}
+		// compiler crates depend on a handful of the ones below them, and some of the registry
+		t.dependOn(c, compiler, min(len(compiler), t.between(2, 12)))
+		t.dependOn(c, crates, t.between(1, 6))
+		compiler = append(compiler, c)
+	}
+	driver := compiler[len(compiler)-2]
+	for _, name := range rustcTools {
+		c := &crate{name: name, version: "0.1.0", member: "src/tools/" + name}
+		if strings.HasPrefix(name, "rustdoc") || strings.HasPrefix(name, "clippy") || strings.HasPrefix(name, "miri") {
+			c.dependencies = append(c.dependencies, driver.id())
+			t.dependOn(c, compiler, t.between(4, 10))
+		}
+		t.dependOn(c, crates, t.between(2, 10))
+		compiler = append(compiler, c)
+	}
+	t.writeWorkspace(append(crates, compiler...))
+}
+
+var tokioMembers = []string{"tokio-macros", "tokio", "tokio-stream", "tokio-util", "tokio-test", "tests-build",
+	"tests-integration", "examples", "benches", "stress-test"}
+
+func tokio(t *tree) {
+	// tokio of the registry is replaced by the workspace member
+	var crates []*crate
+	for _, c := range t.registry(len(registryCrates)) {
+		if c.name != "tokio" && c.name != "tokio-macros" {
+			crates = append(crates, c)
+		}
+	}
+	// tokio depends on few crates, its tests and benches pull in the rest
+	crates = crates[:t.between(140, 170)]
+	var members []*crate
+	for _, name := range tokioMembers {
+		c := &crate{name: name, version: "0.0.0", member: name}
+		switch name {
+		case "tokio":
+			c.version = "1.41.1"
+		case "tokio-macros":
+			c.version = "2.4.0"
+		case "tokio-stream":
+			c.version = "0.1.16"
+		case "tokio-util":
+			c.version = "0.7.12"
+		case "tokio-test":
+			c.version = "0.4.4"
+		}
+		for _, m := range members {
+			if m.name == "tokio" || m.name == "tokio-macros" || t.rng.IntN(2) == 0 {
+				c.dependencies = append(c.dependencies, m.id())
+			}
+		}
+		t.dependOn(c, crates, t.between(3, 12))
+		members = append(members, c)
+	}
+	t.writeWorkspace(append(crates, members...))
+}
+
+// bazel ----------------------------------------------------------------------
+
+var goServices = []string{"auth", "billing", "catalog", "checkout", "gateway", "identity", "inventory", "ledger",
+	"notification", "orders", "payments", "pricing", "recommendation", "search", "shipping", "users", "analytics",
+	"audit", "scheduler", "storage", "media", "reviews", "fraud", "support"}
+
+var goWords = []string{"cache", "client", "config", "db", "errors", "events", "grpc", "handler", "health", "httputil",
+	"kafka", "log", "metrics", "middleware", "model", "queue", "ratelimit", "repository", "retry", "server", "service",
+	"store", "telemetry", "testutil", "tracing", "validate", "worker"}
+
+func goMonorepo(t *tree) {
+	t.write("MODULE.bazel", `module(name = "monorepo", version = "0.1.0")
+
+bazel_dep(name = "rules_go", version = "0.50.1")
+bazel_dep(name = "gazelle", version = "0.39.1")
+bazel_dep(name = "rules_proto", version = "6.0.2")
+bazel_dep(name = "protobuf", version = "28.3")
+`)
+	t.write("BUILD.bazel", "load(\"@gazelle//:def.bzl\", \"gazelle\")\n\n# gazelle:prefix example.com/monorepo\ngazelle(name = \"gazelle\")\n")
+
+	// pkg is a package with a BUILD file, deps are labels of the libraries it imports
+	type pkg struct {
+		dir  string
+		name string
+	}
+	label := func(p pkg) string { return "//" + p.dir + ":" + p.name }
+	var shared []pkg
+	goPackage := func(dir string, deps []pkg, binary bool) pkg {
+		name := filepath.Base(dir)
+		var files []string
+		for range t.between(1, 8) {
+			files = append(files, t.pick(goWords)+".go")
+		}
+		slices.Sort(files)
+		files = slices.Compact(files)
+		for _, f := range files {
+			t.file(dir+"/"+f, t.size(4000, 0.9))
+			if t.rng.IntN(2) == 0 {
+				t.file(dir+"/"+strings.TrimSuffix(f, ".go")+"_test.go", t.size(3000, 0.9))
+			}
+		}
+		var labels []string
+		for _, d := range deps {
+			labels = append(labels, fmt.Sprintf("%q", label(d)))
+		}
+		slices.Sort(labels)
+		labels = slices.Compact(labels)
+		var b strings.Builder
+		b.WriteString("load(\"@rules_go//go:def.bzl\", \"go_binary\", \"go_library\", \"go_test\")\n\n")
+		fmt.Fprintf(&b, "go_library(\n    name = %q,\n    srcs = glob([\"*.go\"], exclude = [\"*_test.go\"]),\n    importpath = \"example.com/monorepo/%s\",\n    visibility = [\"//visibility:public\"],\n    deps = [%s],\n)\n",
+			name, dir, strings.Join(labels, ", "))
+		fmt.Fprintf(&b, "\ngo_test(\n    name = \"%s_test\",\n    srcs = glob([\"*_test.go\"]),\n    deps = [\":%s\"],\n)\n", name, name)
+		if binary {
+			fmt.Fprintf(&b, "\ngo_binary(\n    name = \"%s_bin\",\n    deps = [\":%s\"],\n)\n", name, name)
+		}
+		t.write(dir+"/BUILD.bazel", b.String())
+		return pkg{dir: dir, name: name}
+	}
+	some := func(from []pkg, n int) []pkg {
+		var picked []pkg
+		for range n {
+			if len(from) > 0 {
+				picked = append(picked, from[t.rng.IntN(len(from))])
+			}
+		}
+		return picked
+	}
+
+	// libraries shared by every service, each imports a few of the ones before it
+	for _, w := range goWords {
+		shared = append(shared, goPackage("pkg/"+w, some(shared, t.between(0, 4)), false))
+	}
+	// every service has its api generated from protobuf, internal packages and a server
+	for _, s := range goServices {
+		proto := "api/" + s + "/v1"
+		t.file(proto+"/"+s+".proto", t.size(6000, 0.6))
+		t.write(proto+"/BUILD.bazel", fmt.Sprintf(`load("@rules_proto//proto:defs.bzl", "proto_library")
+load("@rules_go//proto:def.bzl", "go_proto_library")
+
+proto_library(
+    name = "%[1]s_proto",
+    srcs = ["%[1]s.proto"],
+    visibility = ["//visibility:public"],
+)
+
+go_proto_library(
+    name = "%[1]s_go_proto",
+    compilers = ["@rules_go//proto:go_grpc"],
+    importpath = "example.com/monorepo/%[2]s",
+    proto = ":%[1]s_proto",
+    visibility = ["//visibility:public"],
+    deps = [":%[1]s_proto"],
+)
+`, s, proto))
+		api := pkg{dir: proto, name: s + "_go_proto"}
+		var internal []pkg
+		for range t.between(3, 9) {
+			dir := "services/" + s + "/internal/" + t.pick(goWords)
+			if slices.ContainsFunc(internal, func(p pkg) bool { return p.dir == dir }) {
+				continue
+			}
+			deps := append(some(shared, t.between(1, 5)), some(internal, t.between(0, 3))...)
+			internal = append(internal, goPackage(dir, append(deps, api), false))
+		}
+		goPackage("services/"+s+"/cmd/server", append(internal, some(shared, 3)...), true)
+	}
+	for _, tool := range []string{"migrate", "seed", "codegen", "lint", "release"} {
+		goPackage("tools/"+tool, some(shared, t.between(2, 6)), true)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/rizutazu/fake-compiler/util"
+	"github.com/spf13/cobra"
+)
+
+var documentFormat string
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "convert config file to an editable json or yaml document",
+	Long: `convert config file generated by "gen" to a human-editable json or yaml document, which can be converted back
+by "import" subcommand`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := util.ParseConfigFile(configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		format, err := util.ParseDocumentFormat(documentFormat, outputPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		b, err := util.ExportConfig(config, format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if outputPath == "" {
+			_, err = os.Stdout.Write(b)
+		} else {
+			err = util.WriteFileAtomic(outputPath, 0644, func(w io.Writer) error {
+				_, err := w.Write(b)
+				return err
+			})
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVarP(&configPath, "config", "c", "", "path of compiler config")
+	exportCmd.Flags().StringVarP(&outputPath, "output", "o", "", "document output path, default: stdout")
+	exportCmd.Flags().StringVar(&documentFormat, "format", "", "document format: json, yaml, default: guessed by output extension, json for stdout")
+	_ = exportCmd.MarkFlagRequired("config")
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/rizutazu/fake-compiler/util"
 	"github.com/spf13/cobra"
 )
 
@@ -14,23 +19,79 @@ var genCmd = &cobra.Command{
 	Long: `iterate through given directory by given compiler type, and then generate corresponding config file, which 
 can be used for generating fake compile logs, so that the directory is no longer needed`,
 	Run: func(cmd *cobra.Command, args []string) {
+		c, err := util.ParseCompression(compression)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = checkOutputPath(outputPath, dirPath)
+		if err != nil {
+			log.Fatal(err)
+		}
 		compiler, err := parseCmd()
 		if err != nil {
 			log.Fatal(err)
 		}
-		err = compiler.DumpConfig(outputPath)
+		err = setNestedBuilds(compiler)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = compiler.DumpConfig(outputPath, c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		info, err := os.Stat(outputPath)
 		if err != nil {
 			log.Fatal(err)
 		}
-		info, _ := os.Stat(outputPath)
 		fmt.Printf("Output: %s\nType: %s\nSize: %.1f KiB\n", outputPath, compilerType, float64(info.Size())/1024)
 	},
 }
 
+// checkOutputPath refuses to overwrite an existing file unless --force is given,
+// and refuses output within the scanned directory, which would be scanned by the next gen
+func checkOutputPath(output, dir string) error {
+	info, err := os.Stat(output)
+	switch {
+	case err == nil && info.IsDir():
+		return fmt.Errorf("output path %s is a directory", output)
+	case err == nil && !force:
+		return fmt.Errorf("output file %s already exists, use --force to overwrite it", output)
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	// compare real paths, the output file may not exist yet
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	realDir, err = filepath.Abs(realDir)
+	if err != nil {
+		return err
+	}
+	outputDir, err := filepath.EvalSymlinks(filepath.Dir(output))
+	if err != nil {
+		return err
+	}
+	realOutput, err := filepath.Abs(filepath.Join(outputDir, filepath.Base(output)))
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(realDir, realOutput)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("output path %s is inside the scanned directory %s", output, dir)
+	}
+	return nil
+}
+
 func init() {
 	genCmd.Flags().StringVarP(&compilerType, "compiler", "C", "", "specified compiler type")
 	genCmd.Flags().StringVarP(&dirPath, "dir", "d", "", "path of directory to compile")
+	addTraverseFlags(genCmd)
+	addNestFlag(genCmd)
 	genCmd.Flags().StringVarP(&outputPath, "output", "o", "", "config file output path")
+	addCompressionFlag(genCmd)
+	genCmd.Flags().BoolVar(&force, "force", false, "overwrite the output file if it exists")
 	_ = genCmd.MarkFlagRequired("compiler")
 	_ = genCmd.MarkFlagRequired("dir")
 	_ = genCmd.MarkFlagRequired("output")
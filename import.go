@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	cc "github.com/rizutazu/fake-compiler/compiler"
+	"github.com/rizutazu/fake-compiler/util"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import document",
+	Short: "convert an edited json or yaml document back to config file",
+	Long: `convert a json or yaml document produced by "export" subcommand back to config file, the content is validated
+by its compiler type before the config file is written`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := os.ReadFile(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		format, err := util.ParseDocumentFormat(documentFormat, args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		config, err := util.ImportConfig(b, format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// the task count is derived from the content, which may have been edited
+		config.Metadata.Tasks, err = cc.ValidateConfig(config)
+		if err != nil {
+			log.Fatalf("%s: %s", args[0], err)
+		}
+		config.Compression, err = util.ParseCompression(compression)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = util.DumpConfigFile(outputPath, config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Output: %s\nType: %s\n", outputPath, config.CompilerType)
+	},
+}
+
+func init() {
+	importCmd.Flags().StringVarP(&outputPath, "output", "o", "", "config file output path")
+	importCmd.Flags().StringVar(&documentFormat, "format", "", "document format: json, yaml, default: guessed by extension")
+	addCompressionFlag(importCmd)
+	_ = importCmd.MarkFlagRequired("output")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	cc "github.com/rizutazu/fake-compiler/compiler"
+	"github.com/rizutazu/fake-compiler/util"
+	"github.com/spf13/cobra"
+)
+
+var inspectTree bool
+var inspectGraph bool
+var inspectJSON bool
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "show what is inside a config file",
+	Long: `print the header of a config file generated by "gen" and a summary of its compiling tasks: the size distribution
+of sources for cxx, the workspace members and the dependency graph for cargo`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := util.ParseConfigFile(configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if inspectJSON {
+			content, err := config.Content()
+			if err != nil {
+				log.Fatal(err)
+			}
+			var out bytes.Buffer
+			err = json.Indent(&out, content, "", "  ")
+			if err != nil {
+				log.Fatal(err)
+			}
+			out.WriteByte('\n')
+			_, err = out.WriteTo(os.Stdout)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		compiler, err := cc.New(config.CompilerType, "", config, cc.SourceTypeConfig, threads, util.TraverseOptions{})
+		if err != nil {
+			log.Fatal(err)
+		}
+		switch {
+		case inspectTree:
+			asTree, ok := compiler.(cc.TreeInspector)
+			if !ok {
+				log.Fatal("--tree is only supported by cxx, meson and bundle config")
+			}
+			fmt.Print(asTree.SourceTree())
+		case inspectGraph:
+			asCargo, ok := compiler.(*cc.CargoCompiler)
+			if !ok {
+				log.Fatal("--graph is only supported by cargo config")
+			}
+			fmt.Print(asCargo.DependencyGraph())
+		default:
+			printConfigHeader(config)
+			if asInspector, ok := compiler.(cc.Inspector); ok {
+				fmt.Println()
+				fmt.Print(asInspector.Describe())
+			}
+		}
+	},
+}
+
+func printConfigHeader(config *util.Config) {
+	fmt.Printf("File:        %s\n", configPath)
+	fmt.Printf("Version:     %d\n", config.Version)
+	fmt.Printf("Type:        %s\n", config.CompilerType)
+	fmt.Printf("Compression: %s\n", config.Compression)
+	if config.Version < 2 {
+		return
+	}
+	metadata := config.Metadata
+	fmt.Printf("Source:      %s\n", metadata.Source)
+	fmt.Printf("Created:     %s\n", metadata.Created.Local().Format(time.RFC3339))
+	fmt.Printf("Generator:   %s\n", metadata.Generator)
+	fmt.Printf("Tasks:       %d\n", metadata.Tasks)
+}
+
+func init() {
+	inspectCmd.Flags().StringVarP(&configPath, "config", "c", "", "path of compiler config")
+	inspectCmd.Flags().BoolVar(&inspectTree, "tree", false, "show sources as a directory tree, cxx, meson and bundle only")
+	inspectCmd.Flags().BoolVar(&inspectGraph, "graph", false, "show the dependency graph of workspace members, cargo only")
+	inspectCmd.Flags().BoolVar(&inspectJSON, "json", false, "dump the decoded content as json")
+	_ = inspectCmd.MarkFlagRequired("config")
+	inspectCmd.MarkFlagsMutuallyExclusive("tree", "graph", "json")
+}
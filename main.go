@@ -1,8 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"github.com/rizutazu/fake-compiler/progressbar"
 	"log"
+	"strings"
 
 	cc "github.com/rizutazu/fake-compiler/compiler"
 	"github.com/rizutazu/fake-compiler/util"
@@ -11,22 +13,62 @@ import (
 )
 
 // exclusive:
-// run -c configPath
+// run -c configPath [-c configPath]...
 // run -d dirPath
+// run --example name
 
 // persistent:
-// run -t threads -C compiler -p progressbar
+// run -t threads -C compiler -p progressbar --timings --report path --changed files -v
+// run --cmake-compiler "ID VERSION" | --detect-compiler
+// run --test --fail-tests globs --flaky-tests globs
+// run --tag image --push
 
 // persistent:
-// gen -C compiler -d dirPath -o output path
+// gen -C compiler -d dirPath -o output path --compression algorithm:level --force
+
+// inspect -c configPath --tree --graph --json
+// export -c configPath -o document --format json|yaml
+// import document -o configPath --format json|yaml
+// validate configPath...
+// examples list -t threads
+// merge configPath... -o output path
+// scenario file
+
+// persistent, directory only:
+// run/gen --git mode --include glob --exclude glob --max-depth n --symlinks policy --walk-workers n
+
+// docker only:
+// run/gen --nest text=configPath
 
 var configPath string
+var configPaths []string
+var exampleName string
 var dirPath string
 var threads int
 var compilerType string
 
 var barType string
 var outputPath string
+var timings bool
+var reportPath string
+var changed string
+var verbose bool
+var gitMode string
+var includeGlobs []string
+var excludeGlobs []string
+var maxDepth int
+var symlinks string
+var walkWorkers int
+var compression string
+var force bool
+var cmakeCompiler string
+var detectCompiler bool
+var runTests bool
+var failTests []string
+var flakyTests []string
+var nestedBuilds []string
+var imageTag string
+var pushImage bool
 
 var rootCmd = &cobra.Command{
 	Use:   "fake-compiler",
@@ -41,6 +83,28 @@ var rootCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(genCmd)
+	rootCmd.AddCommand(inspectCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(examplesCmd)
+	rootCmd.AddCommand(mergeCmd)
+	rootCmd.AddCommand(scenarioCmd)
+}
+
+// flags that control how a directory is traversed, shared by run and gen
+func addTraverseFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&gitMode, "git", "none", "how git metadata is honoured: none, ignore (honour .gitignore), tracked (files in git index only)")
+	cmd.Flags().StringSliceVar(&includeGlobs, "include", nil, "only include files whose path matches the glob, \"**\" matches any directories")
+	cmd.Flags().StringSliceVar(&excludeGlobs, "exclude", nil, "exclude files and directories whose path matches the glob")
+	cmd.Flags().IntVar(&maxDepth, "max-depth", 0, "skip directories deeper than it, 0 means unlimited")
+	cmd.Flags().StringVar(&symlinks, "symlinks", "follow-safe", "how symlinks are handled: follow-safe (follow, visit each directory once), follow, ignore")
+	cmd.Flags().IntVar(&walkWorkers, "walk-workers", 0, "max number of directories read at the same time, 0 means number of CPUs")
+}
+
+// flag of how written config files are compressed, shared by gen, import and merge
+func addCompressionFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&compression, "compression", "gzip", "compression of config file: gzip, zlib, flate or none, optionally followed by level, e.g. gzip:9, zlib:fast")
 }
 
 func main() {
@@ -54,9 +118,21 @@ func parseCmd() (cc.Compiler, error) {
 	var bar progressbar.ProgressBar
 	var config *util.Config
 	var t cc.SourceType
+	var options util.TraverseOptions
 	var err error
-	if configPath != "" {
-		config, err = util.ParseConfigFile(configPath)
+	if exampleName != "" {
+		e, err := findExample(exampleName)
+		if err != nil {
+			return nil, err
+		}
+		config, err = e.config()
+		if err != nil {
+			return nil, err
+		}
+		compilerType = config.CompilerType
+		t = cc.SourceTypeConfig
+	} else if len(configPaths) > 0 {
+		config, err = parseConfigFiles(configPaths)
 		if err != nil {
 			return nil, err
 		}
@@ -68,34 +144,120 @@ func parseCmd() (cc.Compiler, error) {
 			log.Fatal(err)
 		}
 		t = cc.SourceTypeDir
-	}
-
-	switch compilerType {
-	case "cxx":
-		c, err = cc.NewCXXCompiler(dirPath, config, t, threads)
+		options.GitMode, err = util.ParseGitMode(gitMode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.Symlinks, err = util.ParseSymlinkPolicy(symlinks)
 		if err != nil {
 			log.Fatal(err)
 		}
-	case "cargo":
-		c, err = cc.NewCargoCompiler(dirPath, config, t, threads)
+		options.Include = includeGlobs
+		options.Exclude = excludeGlobs
+		options.MaxDepth = maxDepth
+		options.Workers = walkWorkers
+	}
+
+	c, err = cc.New(compilerType, dirPath, config, t, threads, options)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// stages of multi-stage build have their own bars, in the style of each stage unless specified
+	if asMulti, ok := c.(*cc.MultiCompiler); ok {
+		err = asMulti.SetStageProgressBars(func(stageType string) (progressbar.ProgressBar, error) {
+			if barType != "" {
+				return newProgressBar(barType)
+			}
+			return newProgressBar(stageType)
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
-	default:
-		log.Fatalf("unknown compiler type %s\n", compilerType)
+		return c, nil
 	}
 
 	if barType == "" {
 		barType = compilerType
 	}
-	switch barType {
-	case "cxx":
-		bar = progressbar.NewCMakeProgressBar()
-	case "cargo":
-		bar = progressbar.NewCargoProgressBar()
-	default:
-		log.Fatalf("unknown bar type %s\n", barType)
+	bar, err = newProgressBar(barType)
+	if err != nil {
+		log.Fatal(err)
 	}
 	c.SetProgressBar(bar)
 	return c, nil
 }
+
+func newProgressBar(barType string) (progressbar.ProgressBar, error) {
+	bar, err := progressbar.New(barType)
+	if err != nil {
+		return nil, err
+	}
+	if asCargo, ok := bar.(*progressbar.CargoProgressBar); ok {
+		asCargo.SetVerbose(verbose)
+	}
+	if asCmake, ok := bar.(*progressbar.CmakeProgressBar); ok {
+		switch {
+		case detectCompiler:
+			toolchain, err := progressbar.DetectCmakeToolchain()
+			if err != nil {
+				return nil, err
+			}
+			asCmake.SetToolchain(toolchain)
+		case cmakeCompiler != "":
+			toolchain, err := progressbar.ParseCmakeToolchain(cmakeCompiler)
+			if err != nil {
+				return nil, err
+			}
+			asCmake.SetToolchain(toolchain)
+		}
+	}
+	return bar, nil
+}
+
+// setNestedBuilds makes RUN steps of docker compiler run the builds of --nest, each of them is "text=configPath"
+func setNestedBuilds(c cc.Compiler) error {
+	if len(nestedBuilds) == 0 {
+		return nil
+	}
+	asDocker, ok := c.(*cc.DockerCompiler)
+	if !ok {
+		return fmt.Errorf("--nest is only supported by docker compiler")
+	}
+	for _, nested := range nestedBuilds {
+		text, path, found := strings.Cut(nested, "=")
+		if !found || text == "" || path == "" {
+			return fmt.Errorf("--nest %s: should be text=configPath, e.g. \"cargo build=app_cargo.cfg\"", nested)
+		}
+		config, err := util.ParseConfigFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		err = asDocker.SetNested(text, config)
+		if err != nil {
+			return fmt.Errorf("--nest %s: %w", nested, err)
+		}
+	}
+	return nil
+}
+
+// flag of builds nested in RUN steps of docker compiler, shared by run and gen
+func addNestFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&nestedBuilds, "nest", nil, "docker compiler only, RUN steps whose command contains text run the build of a config instead, e.g. \"cargo build=app_cargo.cfg\", can be given several times")
+}
+
+// parseConfigFiles parses config files, several of them are merged into a multi-stage build
+func parseConfigFiles(paths []string) (*util.Config, error) {
+	var configs []*util.Config
+	for _, path := range paths {
+		config, err := util.ParseConfigFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		configs = append(configs, config)
+	}
+	if len(configs) == 1 {
+		return configs[0], nil
+	}
+	return util.MergeConfigs(configs)
+}
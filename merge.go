@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	cc "github.com/rizutazu/fake-compiler/compiler"
+	"github.com/rizutazu/fake-compiler/util"
+	"github.com/spf13/cobra"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge config_file... -o output",
+	Short: "merge config files into a multi-stage build",
+	Long: `merge config files into one config of a multi-stage build, stages are built in the given order, each with its
+own progress bar. E.g. C++ third-party libraries built by cxx, then a Rust workspace built by cargo`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var configs []*util.Config
+		for _, path := range args {
+			config, err := util.ParseConfigFile(path)
+			if err != nil {
+				log.Fatalf("%s: %s", path, err)
+			}
+			configs = append(configs, config)
+		}
+		config, err := util.MergeConfigs(configs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.Metadata.Tasks, err = cc.ValidateConfig(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.Compression, err = util.ParseCompression(compression)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = util.DumpConfigFile(outputPath, config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stages, err := config.Stages()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Output: %s\nType: %s\nStages: %d\n", outputPath, config.CompilerType, len(stages))
+	},
+}
+
+func init() {
+	mergeCmd.Flags().StringVarP(&outputPath, "output", "o", "", "config file output path")
+	addCompressionFlag(mergeCmd)
+	_ = mergeCmd.MarkFlagRequired("output")
+}
@@ -0,0 +1,241 @@
+package progressbar
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/util"
+	"golang.org/x/term"
+)
+
+// BazelProgressBar mimics `bazel build`, tasks are progress messages of actions like "Compiling src/foo.cc",
+// tasks of other compilers are shown as compiled. Fresh tasks are remote cache hits
+type BazelProgressBar struct {
+	tasks     int
+	complete  int
+	hits      int
+	running   []bazelRunning // in the order of start
+	targets   []string
+	status    string // shown instead of the action count before execution
+	startTime time.Time
+	stop      chan struct{} // closed by Epilogue, stops the ticking of elapsed time
+	stopped   chan struct{}
+	lock      *sync.Mutex
+}
+
+type bazelRunning struct {
+	task  string
+	start time.Time
+}
+
+// bazelActionsShown is the default of --ui_actions_shown
+const bazelActionsShown = 8
+
+// mnemonics that start progress messages of actions, other tasks are shown after "Compiling"
+var bazelMnemonics = []string{"Compiling", "Linking", "Building", "GoCompilePkg", "GoLink", "Generating", "Executing", "Testing"}
+
+func NewBazelProgressBar() *BazelProgressBar {
+	return &BazelProgressBar{
+		lock: new(sync.Mutex),
+	}
+}
+
+func (bar *BazelProgressBar) SetTotalTasks(tasks []string) {
+	bar.tasks = len(tasks)
+}
+
+// SetTargets sets labels of targets to build, e.g. //src/main:app
+func (bar *BazelProgressBar) SetTargets(targets []string) {
+	bar.targets = targets
+}
+
+func (bar *BazelProgressBar) TaskStart(task string) {
+	bar.lock.Lock()
+	bar.running = append(bar.running, bazelRunning{task: task, start: time.Now()})
+	bar.render()
+	bar.lock.Unlock()
+}
+
+func (bar *BazelProgressBar) TaskComplete(task string) {
+	bar.lock.Lock()
+	if i := slices.IndexFunc(bar.running, func(r bazelRunning) bool { return r.task == task }); i >= 0 {
+		bar.running = slices.Delete(bar.running, i, i+1)
+	}
+	bar.complete++
+	bar.render()
+	bar.lock.Unlock()
+}
+
+// TaskFresh counts a remote cache hit as complete, it never runs
+func (bar *BazelProgressBar) TaskFresh(task string) {
+	bar.lock.Lock()
+	bar.complete++
+	bar.hits++
+	bar.render()
+	bar.lock.Unlock()
+}
+
+func (bar *BazelProgressBar) Prologue() {
+	bar.startTime = time.Now()
+	bar.stop = make(chan struct{})
+	bar.stopped = make(chan struct{})
+	if len(bar.targets) == 0 {
+		bar.targets = []string{"//:all"}
+	}
+	packages := make(map[string]bool)
+	for _, target := range bar.targets {
+		pkg, _, _ := strings.Cut(target, ":")
+		packages[pkg] = true
+	}
+	// configured targets include toolchains and implicit dependencies
+	configured := len(bar.targets)*3 + 100 + rand.IntN(200)
+
+	id := make([]byte, 16)
+	for i := range id {
+		id[i] = byte(rand.IntN(256))
+	}
+	fmt.Printf("\u001B[32mINFO: \u001B[0mInvocation ID: %x-%x-%x-%x-%x\n", id[:4], id[4:6], id[6:8], id[8:10], id[10:])
+	go bar.tick()
+
+	bar.enter("Computing main repo mapping: ")
+	time.Sleep(time.Duration(util.GetRandomUniformDistribution(100, 300)) * time.Millisecond)
+	steps := 10
+	for i := range steps {
+		bar.enter(fmt.Sprintf("Analyzing: %s (%d packages loaded, %d targets configured)",
+			bazelTargets(bar.targets), len(packages)*(i+1)/steps, configured*(i+1)/steps))
+		time.Sleep(time.Duration(util.GetRandomUniformDistribution(30, 120)) * time.Millisecond)
+	}
+
+	bar.lock.Lock()
+	fmt.Printf("\u001B[0J\u001B[32mINFO: \u001B[0mAnalyzed %s (%d packages loaded, %d targets configured).\n", bazelTargets(bar.targets), len(packages), configured)
+	if len(bar.targets) == 1 {
+		fmt.Printf("\u001B[32mINFO: \u001B[0mFound 1 target...\n")
+	} else {
+		fmt.Printf("\u001B[32mINFO: \u001B[0mFound %d targets...\n", len(bar.targets))
+	}
+	bar.status = ""
+	bar.render()
+	bar.lock.Unlock()
+}
+
+func (bar *BazelProgressBar) Epilogue() {
+	close(bar.stop)
+	<-bar.stopped
+	util.PrintLinesAtBottom(nil) // clear progress bar at ending
+
+	if len(bar.targets) == 1 && bar.targets[0] != "//:all" {
+		pkg, name, _ := strings.Cut(strings.TrimPrefix(bar.targets[0], "//"), ":")
+		fmt.Printf("Target %s up-to-date:\n  bazel-bin/%s\n", bar.targets[0], strings.TrimPrefix(pkg+"/"+name, "/"))
+	}
+	elapsed := time.Since(bar.startTime)
+	// the critical path is made up, it is shorter than the build, which also waits for free workers
+	critical := elapsed.Seconds() * util.GetRandomUniformDistribution(0.55, 0.9)
+	fmt.Printf("\u001B[32mINFO: \u001B[0mElapsed time: %.3fs, Critical Path: %.2fs\n", elapsed.Seconds(), critical)
+
+	// symlink trees of runfiles and the like are internal
+	internal := len(bar.targets)
+	total := bar.tasks + internal
+	var kinds []string
+	if bar.hits > 0 {
+		kinds = append(kinds, fmt.Sprintf("%d remote cache hit", bar.hits))
+	}
+	kinds = append(kinds, fmt.Sprintf("%d internal", internal))
+	if bar.tasks > bar.hits {
+		kinds = append(kinds, fmt.Sprintf("%d linux-sandbox", bar.tasks-bar.hits))
+	}
+	fmt.Printf("\u001B[32mINFO: \u001B[0m%d processes: %s.\n", total, strings.Join(kinds, ", "))
+	fmt.Printf("\u001B[32mINFO: \u001B[0mBuild completed successfully, %d total actions\n", total)
+}
+
+// enter shows status before execution
+func (bar *BazelProgressBar) enter(status string) {
+	bar.lock.Lock()
+	bar.status = status
+	bar.render()
+	bar.lock.Unlock()
+}
+
+// tick redraws elapsed time of running actions until Epilogue
+func (bar *BazelProgressBar) tick() {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	defer close(bar.stopped)
+	for {
+		select {
+		case <-bar.stop:
+			return
+		case <-ticker.C:
+			bar.lock.Lock()
+			bar.render()
+			bar.lock.Unlock()
+		}
+	}
+}
+
+func (bar *BazelProgressBar) render() {
+
+	// [1,234 / 5,678] 32 actions running
+	//     Compiling src/foo.cc; 3s linux-sandbox
+	//     Linking src/libfoo.a; 0s linux-sandbox
+
+	width, _, err := term.GetSize(0)
+	if err != nil {
+		return
+	}
+	var lines []string
+	switch {
+	case bar.status != "":
+		content := []rune(bar.status)
+		if len(content) > width-1 {
+			content = content[:max(width-1, 0)]
+		}
+		lines = append(lines, "\u001B[32m"+string(content)+"\u001B[0m")
+	case len(bar.running) == 0:
+		lines = append(lines, fmt.Sprintf("\u001B[32m[%s / %s]\u001B[0m checking cached actions", bazelNumber(bar.complete), bazelNumber(bar.tasks)))
+	case len(bar.running) == 1:
+		progress := fmt.Sprintf("[%s / %s]", bazelNumber(bar.complete), bazelNumber(bar.tasks))
+		lines = append(lines, "\u001B[32m"+progress+"\u001B[0m "+bar.action(bar.running[0], width-len(progress)-1))
+	default:
+		lines = append(lines, fmt.Sprintf("\u001B[32m[%s / %s]\u001B[0m %d actions running", bazelNumber(bar.complete), bazelNumber(bar.tasks), len(bar.running)))
+		for _, r := range bar.running[:min(len(bar.running), bazelActionsShown)] {
+			lines = append(lines, "    "+bar.action(r, width-4))
+		}
+	}
+	util.PrintLinesAtBottom(lines)
+}
+
+// action formats a running action within width, e.g. Compiling src/foo.cc; 3s linux-sandbox
+func (bar *BazelProgressBar) action(r bazelRunning, width int) string {
+	message := r.task
+	if mnemonic, _, _ := strings.Cut(message, " "); !slices.Contains(bazelMnemonics, mnemonic) {
+		message = "Compiling " + message
+	}
+	suffix := fmt.Sprintf("; %ds linux-sandbox", int(time.Since(r.start).Seconds()))
+	content := []rune(message)
+	if len(content)+len(suffix) > width-1 {
+		content = content[:max(width-1-len(suffix), 0)]
+	}
+	return string(content) + suffix
+}
+
+// bazelTargets returns e.g. "target //src:main" or "12 targets"
+func bazelTargets(targets []string) string {
+	if len(targets) == 1 {
+		return "target " + targets[0]
+	}
+	return strconv.Itoa(len(targets)) + " targets"
+}
+
+// bazelNumber formats n with thousands separators, e.g. 1,234
+func bazelNumber(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
@@ -0,0 +1,92 @@
+package progressbar
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Module is a source module of a bundle, Path is slash-separated and relative to the project root, e.g. src/main.ts
+type Module struct {
+	Path string
+	Size int64
+}
+
+// BundleBar is implemented by bars of bundlers, which print the assets emitted from modules at the end
+type BundleBar interface {
+	// SetModules sets all modules of the project, including those taken from the cache
+	SetModules(modules []Module)
+}
+
+// chunk is a group of modules emitted as one script, and a stylesheet if any module has styles
+type chunk struct {
+	name    string // empty for the entry chunk, which is named by the bundler
+	scripts int64  // summed size of modules
+	styles  int64  // estimated size of styles within single file components
+	modules int
+}
+
+// directories whose entries are lazy-loaded routes, each of them is split into its own chunk
+var routeDirs = []string{"pages", "views", "routes"}
+
+// splitChunks groups modules into the entry chunk and a chunk per route, the entry chunk comes first
+func splitChunks(modules []Module) []*chunk {
+	entry := new(chunk)
+	routes := make(map[string]*chunk)
+	for _, module := range modules {
+		c := entry
+		// src/pages/About.vue, src/pages/user/Profile.vue
+		segments := strings.Split(module.Path, "/")
+		if len(segments) >= 3 && slices.Contains(routeDirs, segments[1]) {
+			name := strings.TrimSuffix(segments[2], path.Ext(segments[2]))
+			if routes[name] == nil {
+				routes[name] = &chunk{name: name}
+			}
+			c = routes[name]
+		}
+		c.scripts += module.Size
+		if path.Ext(module.Path) == ".vue" {
+			// <template>, <script> and <style> of a single file component
+			c.styles += module.Size * 15 / 100
+		}
+		c.modules++
+	}
+	chunks := []*chunk{entry}
+	for _, name := range slices.Sorted(maps.Keys(routes)) {
+		chunks = append(chunks, routes[name])
+	}
+	return chunks
+}
+
+// minified size of scripts and styles of the chunk, types and whitespaces are stripped
+func (c *chunk) minifiedScripts() int64 {
+	return (c.scripts - c.styles) * 45 / 100
+}
+
+func (c *chunk) minifiedStyles() int64 {
+	return c.styles * 80 / 100
+}
+
+// gzipped size of minified scripts and styles
+func gzipScripts(size int64) int64 {
+	return size * 31 / 100
+}
+
+func gzipStyles(size int64) int64 {
+	return size * 22 / 100
+}
+
+// contentHash returns a hash of the chunk that stays the same across builds of the same sources,
+// in hex for webpack, or base64 for vite
+func (c *chunk) contentHash(name string, base64Hash bool) string {
+	sum := sha256.Sum256([]byte(name + "\x00" + strconv.FormatInt(c.scripts, 10) + "\x00" + strconv.Itoa(c.modules)))
+	if base64Hash {
+		return base64.RawURLEncoding.EncodeToString(sum[:])[:8]
+	}
+	return hex.EncodeToString(sum[:])[:8]
+}
@@ -16,6 +16,7 @@ type CargoProgressBar struct {
 	onGoingPackages map[string]int    // name of packages that are compiling now
 	complete        int               // accumulative count of packages that already started the compilation
 	followNameRule  bool              // whether tasks will follow "name version" structure
+	verbose         bool              // whether print fresh packages
 	startTime       *time.Time
 	lock            *sync.Mutex
 }
@@ -73,6 +74,29 @@ func (bar *CargoProgressBar) TaskComplete(task string) {
 	bar.lock.Unlock()
 }
 
+// TaskFresh counts an up-to-date package as complete, printed in verbose mode only
+func (bar *CargoProgressBar) TaskFresh(task string) {
+	bar.lock.Lock()
+	if bar.startTime == nil {
+		t := time.Now()
+		bar.startTime = &t
+	}
+	bar.complete++
+	if bar.verbose {
+		path, ok := bar.targetMapping[task]
+		if ok {
+			task += fmt.Sprintf(" (%s)", path)
+		}
+		fmt.Printf("\u001B[2K\u001B[1;32m       Fresh\u001B[0m %s\n", task)
+	}
+	bar.renderBar()
+	bar.lock.Unlock()
+}
+
+func (bar *CargoProgressBar) SetVerbose(verbose bool) {
+	bar.verbose = verbose
+}
+
 func (bar *CargoProgressBar) SetTargets(mapping map[string]string) {
 	bar.targetMapping = mapping
 }
@@ -2,7 +2,8 @@ package progressbar
 
 import (
 	"fmt"
-	"strings"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -11,6 +12,8 @@ import (
 
 type CmakeProgressBar struct {
 	targetName        string
+	project           *CmakeProject // nil if unknown, the target is configured as a C and C++ project
+	toolchain         CmakeToolchain
 	onGoingTasks      map[string]int
 	finishedTaskCount int
 	taskCount         int
@@ -52,22 +55,7 @@ func (bar *CmakeProgressBar) TaskComplete(task string) {
 }
 
 func (bar *CmakeProgressBar) Prologue() {
-	_lines := `-- The C compiler identification is GNU 11.4.5
--- The CXX compiler identification is GNU 11.4.5
--- Detecting C compiler ABI info
--- Detecting C compiler ABI info - done
--- Check for working C compiler: /usr/bin/cc - skipped
--- Detecting C compile features
--- Detecting C compile features - done
--- Detecting CXX compiler ABI info
--- Detecting CXX compiler ABI info - done
--- Check for working CXX compiler: /usr/bin/c++ - skipped
--- Detecting CXX compile features
--- Detecting CXX compile features - done
--- Configuring done (%.1fs)
--- Generating done (%.1fs)`
-
-	lines := strings.Split(_lines, "\n")
+	lines := bar.ConfigureLog()
 
 	sleepTimes := make([]int, len(lines))
 	for i := range len(lines) {
@@ -77,20 +65,65 @@ func (bar *CmakeProgressBar) Prologue() {
 	}
 
 	for i, line := range lines {
-		if i == len(lines)-2 {
-			fmt.Printf(line+"\n", float64(util.Sum(sleepTimes[:i]))/1000)
-		} else if i == len(lines)-1 {
-			fmt.Printf(line+"\n", float64(sleepTimes[i])/1000)
-		} else {
-			fmt.Println(line)
-		}
+		fmt.Println("-- " + line)
 		time.Sleep(time.Millisecond * time.Duration(sleepTimes[i]))
 	}
+	fmt.Printf("-- Configuring done (%.1fs)\n", float64(util.Sum(sleepTimes))/1000)
+	generating := max(int(util.GetRandomFromDistribution(420/4.2, 42)), 0)
+	time.Sleep(time.Millisecond * time.Duration(generating))
+	fmt.Printf("-- Generating done (%.1fs)\n", float64(generating)/1000)
+	if cwd, err := os.Getwd(); err == nil {
+		fmt.Println("-- Build files have been written to: " + filepath.Join(cwd, "build"))
+	}
 
 	time.Sleep(time.Millisecond * 420)
 
 }
 
+// ConfigureLog returns lines of configuring the project without the leading "-- ": compilers of its languages,
+// then the packages and checks
+func (bar *CmakeProgressBar) ConfigureLog() []string {
+	toolchain := bar.toolchain
+	project := bar.project
+	if project == nil {
+		project = &CmakeProject{Name: bar.targetName, Languages: []string{"C", "CXX"}}
+	}
+
+	var lines []string
+	for _, language := range project.Languages {
+		switch language {
+		case "C", "CXX":
+			lines = append(lines, fmt.Sprintf("The %s compiler identification is %s %s", language, toolchain.ID, toolchain.Version))
+		case "ASM":
+			lines = append(lines, "The ASM compiler identification is "+toolchain.ID, "Found assembler: "+toolchain.CC)
+		}
+	}
+	for _, language := range project.Languages {
+		path := toolchain.CC
+		if language == "CXX" {
+			path = toolchain.CXX
+		} else if language != "C" {
+			continue
+		}
+		lines = append(lines,
+			fmt.Sprintf("Detecting %s compiler ABI info", language),
+			fmt.Sprintf("Detecting %s compiler ABI info - done", language),
+			fmt.Sprintf("Check for working %s compiler: %s - skipped", language, path),
+			fmt.Sprintf("Detecting %s compile features", language),
+			fmt.Sprintf("Detecting %s compile features - done", language))
+	}
+	for _, probe := range project.Probes {
+		lines = append(lines, probe.log()...)
+	}
+	return lines
+}
+
+// Link prints relinking the target, which an incremental build does before Epilogue if any source is rebuilt
+func (bar *CmakeProgressBar) Link() {
+	fmt.Printf("[100%%] \u001B[32m\u001B[1mLinking CXX executable %s\u001B[0m\n", bar.targetName)
+	time.Sleep(time.Millisecond * time.Duration(max(util.GetRandomFromDistribution(420, 42), 0)))
+}
+
 func (bar *CmakeProgressBar) Epilogue() {
 	fmt.Println("[100%] Built target", bar.targetName)
 }
@@ -99,8 +132,19 @@ func (bar *CmakeProgressBar) SetTargetName(name string) {
 	bar.targetName = name
 }
 
+// SetProject sets the project read from CMakeLists.txt, which is configured by Prologue
+func (bar *CmakeProgressBar) SetProject(project CmakeProject) {
+	bar.project = &project
+}
+
+// SetToolchain sets the compilers identified by Prologue
+func (bar *CmakeProgressBar) SetToolchain(toolchain CmakeToolchain) {
+	bar.toolchain = toolchain
+}
+
 func NewCMakeProgressBar() *CmakeProgressBar {
 	return &CmakeProgressBar{
+		toolchain:    DefaultCmakeToolchain,
 		onGoingTasks: make(map[string]int),
 		lock:         new(sync.Mutex),
 	}
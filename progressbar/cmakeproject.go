@@ -0,0 +1,193 @@
+package progressbar
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// CmakeProject is what cmake reports while configuring a project
+type CmakeProject struct {
+	Name      string
+	Version   string
+	Languages []string // e.g. C, CXX, ASM
+	Probes    []CmakeProbe
+}
+
+// CmakeProbe is a package found or a check performed while configuring, in the order of CMakeLists.txt
+type CmakeProbe struct {
+	Kind     string   // package, pkgconfig, include, symbol, size or compiles
+	Name     string   // the package, the prefix of pkg_check_modules, or the result variable of a check
+	Subjects []string // components of package, modules of pkgconfig, headers, the symbol (and the library), type or flag checked
+	Versions []string // the found version of package, or one per module of pkgconfig
+	Found    bool
+}
+
+// CmakeToolchain is the compilers identified by cmake
+type CmakeToolchain struct {
+	ID      string // e.g. GNU, Clang
+	Version string
+	CC      string // path of the C compiler
+	CXX     string // path of the C++ compiler
+}
+
+var DefaultCmakeToolchain = CmakeToolchain{ID: "GNU", Version: "11.4.5", CC: "/usr/bin/cc", CXX: "/usr/bin/c++"}
+
+// packages that are programs, found in /usr/bin
+var cmakePrograms = map[string]string{
+	"Git":       "git",
+	"Doxygen":   "doxygen",
+	"Perl":      "perl",
+	"BISON":     "bison",
+	"FLEX":      "flex",
+	"PkgConfig": "pkg-config",
+	"Python":    "python3",
+	"Python3":   "python3",
+}
+
+// libraries of packages found by find modules, the others are lib<name>.so
+var cmakeLibraries = map[string]string{
+	"OpenSSL":  "libcrypto.so",
+	"ZLIB":     "libz.so",
+	"LibXml2":  "libxml2.so",
+	"BZip2":    "libbz2.so",
+	"LibLZMA":  "liblzma.so",
+	"CURL":     "libcurl.so",
+	"SQLite3":  "libsqlite3.so",
+	"Protobuf": "libprotobuf.so",
+}
+
+// packages found by their config files
+var cmakeConfigPackages = []string{"Boost", "GTest", "fmt", "spdlog", "Eigen3", "Qt5", "Qt6", "nlohmann_json", "absl", "benchmark"}
+
+// log returns lines of cmake's messages of the probe, without the leading "-- "
+func (probe CmakeProbe) log() []string {
+	subjects := strings.Join(probe.Subjects, ", ")
+	result := func(found, failed string) string {
+		if probe.Found {
+			return found
+		}
+		return failed
+	}
+	switch probe.Kind {
+	case "package":
+		return probe.packageLog()
+	case "pkgconfig":
+		modules := "module '" + probe.Subjects[0] + "'"
+		if len(probe.Subjects) > 1 {
+			modules = "modules '" + strings.Join(probe.Subjects, ";") + "'"
+		}
+		lines := []string{"Checking for " + modules}
+		for i, module := range probe.Subjects {
+			if probe.Found {
+				lines = append(lines, fmt.Sprintf("  Found %s, version %s", module, probe.Versions[i]))
+			} else {
+				lines = append(lines, fmt.Sprintf("  Package '%s', required by 'virtual:world', not found", module))
+			}
+		}
+		return lines
+	case "include":
+		looking := "Looking for " + subjects
+		if len(probe.Subjects) > 1 {
+			looking = "Looking for include files " + subjects
+		}
+		return []string{looking, looking + result(" - found", " - not found")}
+	case "symbol":
+		looking := "Looking for " + probe.Subjects[0]
+		if len(probe.Subjects) > 1 {
+			looking += " in " + probe.Subjects[1]
+		}
+		return []string{looking, looking + result(" - found", " - not found")}
+	case "size":
+		return []string{"Check size of " + subjects, "Check size of " + subjects + result(" - done", " - failed")}
+	default:
+		return []string{"Performing Test " + probe.Name, "Performing Test " + probe.Name + result(" - Success", " - Failed")}
+	}
+}
+
+func (probe CmakeProbe) packageLog() []string {
+	name := probe.Name
+	if !probe.Found {
+		upper := strings.ToUpper(name)
+		return []string{fmt.Sprintf("Could NOT find %s (missing: %s_LIBRARY %s_INCLUDE_DIR)", name, upper, upper)}
+	}
+	version := ""
+	if len(probe.Versions) > 0 && probe.Versions[0] != "" {
+		version = fmt.Sprintf(" (found version \"%s\")", probe.Versions[0])
+	}
+	components := ""
+	if len(probe.Subjects) > 0 {
+		components = " found components: " + strings.Join(probe.Subjects, " ")
+	}
+	switch {
+	case name == "Threads":
+		return []string{"Performing Test CMAKE_HAVE_LIBC_PTHREAD", "Performing Test CMAKE_HAVE_LIBC_PTHREAD - Success", "Found Threads: TRUE"}
+	case name == "OpenMP":
+		return []string{"Found OpenMP_C: -fopenmp" + version, "Found OpenMP_CXX: -fopenmp" + version, "Found OpenMP: TRUE" + version + components}
+	case cmakePrograms[name] != "":
+		return []string{fmt.Sprintf("Found %s: /usr/bin/%s%s%s", name, cmakePrograms[name], version, components)}
+	case slices.Contains(cmakeConfigPackages, name):
+		dir := name
+		if name == "Boost" && version != "" {
+			dir += "-" + probe.Versions[0]
+		}
+		return []string{fmt.Sprintf("Found %s: /usr/lib/x86_64-linux-gnu/cmake/%s/%sConfig.cmake%s%s", name, dir, name, version, components)}
+	default:
+		library, ok := cmakeLibraries[name]
+		if !ok {
+			library = "lib" + strings.ToLower(name) + ".so"
+		}
+		return []string{fmt.Sprintf("Found %s: /usr/lib/x86_64-linux-gnu/%s%s%s", name, library, version, components)}
+	}
+}
+
+// ParseCmakeToolchain parses compiler identification like "Clang 18.1.3", compilers are at their default paths
+func ParseCmakeToolchain(s string) (CmakeToolchain, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return CmakeToolchain{}, fmt.Errorf("compiler should be identified as \"ID VERSION\", e.g. \"Clang 18.1.3\", got %q", s)
+	}
+	return CmakeToolchain{ID: fields[0], Version: fields[1], CC: DefaultCmakeToolchain.CC, CXX: DefaultCmakeToolchain.CXX}, nil
+}
+
+var cmakeVersionRegexp = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+// DetectCmakeToolchain identifies the compiler by running `cc --version`, like cmake does
+func DetectCmakeToolchain() (CmakeToolchain, error) {
+	toolchain := DefaultCmakeToolchain
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		return toolchain, err
+	}
+	toolchain.CC = cc
+	if cxx, err := exec.LookPath("c++"); err == nil {
+		toolchain.CXX = cxx
+	}
+	out, err := exec.Command(cc, "--version").Output()
+	if err != nil {
+		return toolchain, fmt.Errorf("%s --version: %w", cc, err)
+	}
+	first, _, _ := strings.Cut(string(out), "\n")
+
+	// e.g. "Ubuntu clang version 18.1.3 (1ubuntu1)", "Apple clang version 15.0.0 (clang-1500.3.9.4)"
+	if _, after, ok := strings.Cut(first, "clang version "); ok {
+		toolchain.ID = "Clang"
+		if strings.HasPrefix(first, "Apple") {
+			toolchain.ID = "AppleClang"
+		}
+		toolchain.Version = cmakeVersionRegexp.FindString(after)
+		return toolchain, nil
+	}
+	// e.g. "cc (Ubuntu 13.2.0-23ubuntu4) 13.2.0", "gcc (GCC) 14.1.1 20240522"
+	if strings.Contains(string(out), "Free Software Foundation") {
+		toolchain.ID = "GNU"
+		if i := strings.LastIndex(first, ")"); i >= 0 {
+			toolchain.Version = cmakeVersionRegexp.FindString(first[i:])
+		}
+		return toolchain, nil
+	}
+	return toolchain, errors.New("cannot identify the compiler by " + first)
+}
@@ -0,0 +1,403 @@
+package progressbar
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/util"
+	"golang.org/x/term"
+)
+
+// DockerProgressBar mimics BuildKit of `docker build`: tasks are vertices like "[builder 4/9] RUN cargo build --release",
+// shown by the tty view redrawn in place, which collapses vertices that are done once it is taller than the terminal,
+// or by the output of `--progress=plain` if stdin is not a terminal. Fresh tasks are CACHED
+type DockerProgressBar struct {
+	build    DockerBuild
+	total    int
+	vertices []*dockerVertexState // in the order they start
+	byTask   map[string]*dockerVertexState
+	done     int
+	begin    time.Time
+	plain    bool
+	last     *dockerVertexState // vertex of the last line of plain output
+	stop     chan struct{}      // closed by Epilogue, stops the redrawing of the tty view
+	stopped  chan struct{}
+	lock     *sync.Mutex
+}
+
+// DockerBuild describes the build, for the statuses of vertices that transfer files and export the image
+type DockerBuild struct {
+	Dockerfile int64  // size of the Dockerfile
+	Context    int64  // size of the build context
+	Image      string // fully qualified, e.g. docker.io/library/app:latest
+	Push       bool   // the image is pushed after it is exported
+}
+
+type dockerVertexState struct {
+	task     string
+	id       int // #1 of plain output, in the order vertices start
+	start    time.Time
+	elapsed  time.Duration
+	done     bool
+	cached   bool
+	statuses []*dockerStatus
+	logs     []string // the last lines of output, only those of a running vertex are shown
+}
+
+// dockerStatus is a line below a vertex, e.g. => => transferring context: 45.67kB
+type dockerStatus struct {
+	name     string
+	offset   time.Duration // since the vertex starts
+	duration time.Duration
+	open     bool    // lasts until the vertex is done
+	size     int64   // bytes downloaded, shown as progress
+	speed    float64 // bytes per second
+	late     bool    // only shown once the vertex is done
+}
+
+// BuildKit shows this many lines of output of a running vertex
+const dockerLogLines = 6
+
+func NewDockerProgressBar() *DockerProgressBar {
+	return &DockerProgressBar{
+		build:  DockerBuild{Image: "docker.io/library/app:latest"},
+		byTask: make(map[string]*dockerVertexState),
+		lock:   new(sync.Mutex),
+	}
+}
+
+func (bar *DockerProgressBar) SetTotalTasks(tasks []string) {
+	bar.total = len(tasks)
+}
+
+// SetBuild sets the sizes of files transferred to BuildKit and the image built
+func (bar *DockerProgressBar) SetBuild(build DockerBuild) {
+	bar.build = build
+}
+
+func (bar *DockerProgressBar) TaskStart(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	vertex := bar.vertex(task)
+	vertex.start = time.Now()
+	vertex.statuses = bar.statuses(task)
+	if bar.plain {
+		bar.switchTo(vertex)
+	}
+}
+
+func (bar *DockerProgressBar) TaskComplete(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	vertex := bar.vertex(task)
+	vertex.elapsed = time.Since(vertex.start)
+	vertex.done = true
+	bar.done++
+	if !bar.plain {
+		return
+	}
+	bar.switchTo(vertex)
+	for _, status := range vertex.statuses {
+		line := status.name + status.progress(vertex.elapsed-status.offset, true)
+		if elapsed := status.elapsed(vertex); elapsed >= 50*time.Millisecond {
+			line += fmt.Sprintf(" %.1fs", elapsed.Seconds())
+		}
+		fmt.Printf("#%d %s done\n", vertex.id, line)
+	}
+	fmt.Printf("#%d DONE %.1fs\n", vertex.id, vertex.elapsed.Seconds())
+}
+
+// TaskFresh shows a vertex that hits the cache as CACHED
+func (bar *DockerProgressBar) TaskFresh(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	vertex := bar.vertex(task)
+	vertex.start = time.Now()
+	vertex.cached = true
+	vertex.done = true
+	bar.done++
+	if bar.plain {
+		bar.switchTo(vertex)
+		fmt.Printf("#%d CACHED\n", vertex.id)
+	}
+}
+
+// TaskLog adds a line of output of a running vertex, e.g. that of RUN
+func (bar *DockerProgressBar) TaskLog(task, line string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	vertex := bar.vertex(task)
+	if bar.plain {
+		bar.switchTo(vertex)
+		fmt.Printf("#%d %.3f %s\n", vertex.id, time.Since(vertex.start).Seconds(), line)
+		return
+	}
+	vertex.logs = append(vertex.logs, line)
+	if len(vertex.logs) > dockerLogLines {
+		vertex.logs = vertex.logs[len(vertex.logs)-dockerLogLines:]
+	}
+}
+
+func (bar *DockerProgressBar) Prologue() {
+	bar.begin = time.Now()
+	bar.stop = make(chan struct{})
+	bar.stopped = make(chan struct{})
+	if _, _, err := term.GetSize(0); err != nil {
+		bar.plain = true
+		close(bar.stopped)
+		fmt.Printf("#0 building with \"default\" instance using docker driver\n")
+		return
+	}
+	go bar.tick()
+}
+
+func (bar *DockerProgressBar) Epilogue() {
+	close(bar.stop)
+	<-bar.stopped
+	if bar.plain {
+		return
+	}
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	width, _, _ := term.GetSize(0)
+	util.PrintLinesAtBottom(nil)
+	fmt.Println(strings.Join(bar.frame(width, math.MaxInt, true), "\n"))
+}
+
+// vertex returns the state of task, which is added in the order of start
+func (bar *DockerProgressBar) vertex(task string) *dockerVertexState {
+	vertex, ok := bar.byTask[task]
+	if !ok {
+		vertex = &dockerVertexState{task: task, id: len(bar.vertices) + 1, start: time.Now()}
+		bar.vertices = append(bar.vertices, vertex)
+		bar.byTask[task] = vertex
+	}
+	return vertex
+}
+
+// switchTo prints the name of vertex before its lines of plain output, unless they follow the last ones of it
+func (bar *DockerProgressBar) switchTo(vertex *dockerVertexState) {
+	if bar.last == vertex {
+		return
+	}
+	if bar.last != nil {
+		fmt.Println()
+	}
+	bar.last = vertex
+	fmt.Printf("#%d %s\n", vertex.id, vertex.task)
+}
+
+// statuses makes up the lines shown below a vertex by its name
+func (bar *DockerProgressBar) statuses(task string) []*dockerStatus {
+	fixed := func(name string, offset, duration time.Duration) *dockerStatus {
+		return &dockerStatus{name: name, offset: offset, duration: duration}
+	}
+	randomDuration := func(lower, upper float64) time.Duration {
+		return time.Duration(util.GetRandomUniformDistribution(lower, upper) * float64(time.Second))
+	}
+	switch {
+	case task == "[internal] load build definition from Dockerfile":
+		return []*dockerStatus{{name: "transferring dockerfile: " + dockerSize(bar.build.Dockerfile), open: true}}
+	case task == "[internal] load .dockerignore":
+		return []*dockerStatus{{name: "transferring context: 2B", open: true}}
+	case task == "[internal] load build context":
+		return []*dockerStatus{{name: "transferring context: " + dockerSize(bar.build.Context), open: true}}
+	case task == "exporting to image":
+		digest := func() string {
+			return "sha256:" + dockerHex(32)
+		}
+		if !bar.build.Push {
+			return []*dockerStatus{
+				{name: "exporting layers", open: true},
+				{name: "writing image " + digest(), duration: randomDuration(0, 0.04), late: true},
+				{name: "naming to " + bar.build.Image, duration: randomDuration(0, 0.04), late: true},
+			}
+		}
+		layers := randomDuration(0.2, 1.5)
+		return []*dockerStatus{
+			fixed("exporting layers", 0, layers),
+			fixed("exporting manifest "+digest(), layers, randomDuration(0, 0.04)),
+			fixed("exporting config "+digest(), layers, randomDuration(0, 0.04)),
+			fixed("naming to "+bar.build.Image, layers, randomDuration(0, 0.04)),
+			{name: "pushing layers", offset: layers, open: true},
+			{name: "pushing manifest for " + bar.build.Image + "@" + digest(), duration: randomDuration(0.3, 1.2), late: true},
+		}
+	}
+	// pulling a base image: FROM docker.io/library/rust:1.77@sha256:...
+	_, image, found := strings.Cut(task, "FROM ")
+	if !found || !strings.Contains(image, "@sha256:") {
+		return nil
+	}
+	resolve := randomDuration(0, 0.1)
+	statuses := []*dockerStatus{fixed("resolve "+image, 0, resolve)}
+	var extracting []*dockerStatus
+	for range rand.IntN(5) + 2 {
+		layer := "sha256:" + dockerHex(32)
+		size := int64(math.Exp(util.GetRandomUniformDistribution(math.Log(1e3), math.Log(8e7))))
+		statuses = append(statuses, &dockerStatus{name: layer, offset: resolve, open: true, size: size, speed: util.GetRandomUniformDistribution(15e6, 60e6)})
+		extracting = append(extracting, &dockerStatus{name: "extracting " + layer, duration: time.Duration(float64(size) / 80e6 * float64(time.Second)), late: true})
+	}
+	return append(statuses, extracting...)
+}
+
+// elapsed returns the time status took or has taken so far, 0 if it has not started
+func (status *dockerStatus) elapsed(vertex *dockerVertexState) time.Duration {
+	if status.late {
+		return status.duration
+	}
+	since := time.Since(vertex.start)
+	if vertex.done {
+		since = vertex.elapsed
+	}
+	since = max(since-status.offset, 0)
+	switch {
+	case status.open:
+		return since
+	case vertex.done:
+		return status.duration
+	default:
+		return min(since, status.duration)
+	}
+}
+
+// progress returns the progress of a download after elapsed, e.g. " 12.58MB / 49.56MB", empty for other statuses
+func (status *dockerStatus) progress(elapsed time.Duration, done bool) string {
+	if status.size == 0 {
+		return ""
+	}
+	current := min(int64(elapsed.Seconds()*status.speed), status.size)
+	if done {
+		current = status.size
+	}
+	return " " + dockerSize(current) + " / " + dockerSize(status.size)
+}
+
+// tick redraws the tty view until Epilogue
+func (bar *DockerProgressBar) tick() {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	defer close(bar.stopped)
+	for {
+		select {
+		case <-bar.stop:
+			return
+		case <-ticker.C:
+			bar.lock.Lock()
+			width, height, err := term.GetSize(0)
+			if err == nil {
+				util.PrintLinesAtBottom(bar.frame(width, height-1, false))
+			}
+			bar.lock.Unlock()
+		}
+	}
+}
+
+// frame renders the tty view within width and height, by dropping the vertices done first
+//
+//	[+] Building 42.3s (17/23)                                              docker:default
+//	 => [internal] load build definition from Dockerfile                              0.0s
+//	 => => transferring dockerfile: 1.23kB                                            0.0s
+//	 => CACHED [builder 2/6] WORKDIR /app                                             0.0s
+//	 => [builder 4/6] RUN cargo build --release                                      12.3s
+//	 => => #    Compiling serde v1.0.197
+func (bar *DockerProgressBar) frame(width, height int, final bool) []string {
+	width = max(width-1, 20)
+	color, reset := "", ""
+	header := fmt.Sprintf("[+] Building %.1fs (%d/%d)", time.Since(bar.begin).Seconds(), bar.done, bar.total)
+	if final {
+		header += " FINISHED"
+		color, reset = "\u001B[34m", "\u001B[0m"
+	}
+	if driver := "docker:default"; len(header)+1+len(driver) <= width {
+		header += strings.Repeat(" ", width-len(header)-len(driver)) + driver
+	}
+
+	var blocks [][]string
+	for _, vertex := range bar.vertices {
+		blocks = append(blocks, bar.block(vertex, width))
+	}
+	lines := 1
+	for _, block := range blocks {
+		lines += len(block)
+	}
+	for i := 0; i < len(bar.vertices) && lines > height; i++ {
+		if bar.vertices[i].done {
+			lines -= len(blocks[i])
+			blocks[i] = nil
+		}
+	}
+
+	frame := []string{color + header + reset}
+	for _, block := range blocks {
+		frame = append(frame, block...)
+	}
+	return frame
+}
+
+// block renders vertex followed by its statuses, and the output of a running one
+func (bar *DockerProgressBar) block(vertex *dockerVertexState, width int) []string {
+	color, reset := "", ""
+	if vertex.done {
+		color, reset = "\u001B[34m", "\u001B[0m"
+	}
+	elapsed := time.Since(vertex.start)
+	if vertex.done {
+		elapsed = vertex.elapsed
+	}
+	name := vertex.task
+	if vertex.cached {
+		name = "CACHED " + name
+	}
+	lines := []string{color + dockerAlign(" => "+name, elapsed, width) + reset}
+	since := elapsed
+	for _, status := range vertex.statuses {
+		if (status.late || since < status.offset) && !vertex.done {
+			continue
+		}
+		text := " => => " + status.name + status.progress(since-status.offset, vertex.done || !status.open && since >= status.offset+status.duration)
+		lines = append(lines, color+dockerAlign(text, status.elapsed(vertex), width)+reset)
+	}
+	if !vertex.done {
+		for _, log := range vertex.logs {
+			line := []rune(" => => # " + log)
+			lines = append(lines, string(line[:min(len(line), width)]))
+		}
+	}
+	return lines
+}
+
+// dockerAlign pads text to put the elapsed time at the right of width, text is cut if it is too long
+func dockerAlign(text string, elapsed time.Duration, width int) string {
+	timer := fmt.Sprintf("%.1fs", elapsed.Seconds())
+	content := []rune(text)
+	if len(content) > width-len(timer)-1 {
+		content = content[:max(width-len(timer)-1, 0)]
+	}
+	return fmt.Sprintf("%-*s %s", width-len(timer)-1, string(content), timer)
+}
+
+// dockerSize formats size like docker, e.g. 2B, 1.234kB, 49.56MB
+func dockerSize(size int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	value := float64(size)
+	i := 0
+	for value >= 1000 && i < len(units)-1 {
+		value /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.4g%s", value, units[i])
+}
+
+// dockerHex returns n random bytes in hex
+func dockerHex(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(rand.IntN(256))
+	}
+	return hex.EncodeToString(b)
+}
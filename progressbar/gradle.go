@@ -0,0 +1,246 @@
+package progressbar
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/util"
+	"golang.org/x/term"
+)
+
+// GradleProgressBar mimics the rich console of gradle, tasks are task paths like :app:compileKotlin
+//
+// the bottom of the output is the progress line followed by a line for each worker, showing its task
+type GradleProgressBar struct {
+	tasks      int
+	actionable int
+	complete   int
+	modules    map[string]*JvmModule
+	order      []string // module paths, in the order they are configured
+	workers    []string // task of each worker, "" if idle
+	phase      string   // INITIALIZING, CONFIGURING or EXECUTING
+	done       float64  // progress of the current phase, in [0, 1]
+	status     []string // shown instead of workers before execution
+	startTime  time.Time
+	stop       chan struct{} // closed by Epilogue, stops the ticking of elapsed time
+	stopped    chan struct{}
+	lock       *sync.Mutex
+}
+
+const (
+	gradleVersion  = "8.10.2"
+	gradleBarWidth = 13
+)
+
+// lifecycle tasks do no work, they are not counted as actionable
+var gradleLifecycleTasks = []string{"classes", "preBuild", "assembleDebug", "assemble", "build"}
+
+func NewGradleProgressBar() *GradleProgressBar {
+	return &GradleProgressBar{
+		modules: make(map[string]*JvmModule),
+		lock:    new(sync.Mutex),
+	}
+}
+
+func (bar *GradleProgressBar) SetTotalTasks(tasks []string) {
+	bar.tasks = len(tasks)
+	bar.actionable = 0
+	for _, task := range tasks {
+		module, name := jvmTaskOf(task)
+		if !slices.Contains(gradleLifecycleTasks, name) {
+			bar.actionable++
+		}
+		if bar.modules[module] == nil {
+			bar.modules[module] = jvmModuleOf(module)
+			bar.order = append(bar.order, module)
+		}
+	}
+}
+
+func (bar *GradleProgressBar) SetModules(modules []JvmModule) {
+	bar.order = nil
+	for _, module := range modules {
+		bar.modules[module.Path] = &module
+		bar.order = append(bar.order, module.Path)
+	}
+}
+
+func (bar *GradleProgressBar) TaskStart(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	i := 0
+	for i < len(bar.workers) && bar.workers[i] != "" {
+		i++
+	}
+	if i == len(bar.workers) {
+		bar.workers = append(bar.workers, "")
+	}
+	bar.workers[i] = task
+	bar.render()
+}
+
+func (bar *GradleProgressBar) TaskComplete(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	for i := range bar.workers {
+		if bar.workers[i] == task {
+			bar.workers[i] = ""
+			break
+		}
+	}
+	bar.complete++
+	bar.done = float64(bar.complete) / float64(max(bar.tasks, 1))
+
+	// javac notes are the usual output of a task, the rich console prints the output of a task under its name
+	path, name := jvmTaskOf(task)
+	module := bar.module(path)
+	if (name == "compileJava" || name == "compileDebugJavaWithJavac") && !module.Kotlin && module.Sources > 0 && rand.IntN(6) == 0 {
+		fmt.Printf("\u001B[0J\u001B[1m> Task %s\u001B[m\nNote: Some input files use unchecked or unsafe operations.\nNote: Recompile with -Xlint:unchecked for details.\n\n", task)
+	}
+	bar.render()
+}
+
+func (bar *GradleProgressBar) Prologue() {
+	bar.startTime = time.Now()
+	bar.stop = make(chan struct{})
+	bar.stopped = make(chan struct{})
+	go bar.tick()
+
+	if rand.IntN(3) == 0 {
+		bar.lock.Lock()
+		fmt.Println("\u001B[0JStarting a Gradle Daemon (subsequent builds will be faster)")
+		bar.lock.Unlock()
+		bar.enter("INITIALIZING", 0, "> Starting Daemon")
+		time.Sleep(time.Duration(util.GetRandomUniformDistribution(1500, 3000)) * time.Millisecond)
+	}
+	bar.enter("INITIALIZING", 0, "> Evaluating settings")
+	time.Sleep(time.Duration(util.GetRandomUniformDistribution(200, 500)) * time.Millisecond)
+	for i, path := range bar.order {
+		status := "> root project"
+		if path != ":" {
+			status = "> project " + path
+		}
+		bar.enter("CONFIGURING", float64(i)/float64(len(bar.order)), status)
+		time.Sleep(time.Duration(util.GetRandomUniformDistribution(30, 120)) * time.Millisecond)
+	}
+	bar.enter("CONFIGURING", 1, "> Resolve dependencies of :compileClasspath")
+	time.Sleep(time.Duration(util.GetRandomUniformDistribution(100, 300)) * time.Millisecond)
+	bar.enter("EXECUTING", 0)
+}
+
+func (bar *GradleProgressBar) Epilogue() {
+	close(bar.stop)
+	<-bar.stopped
+	util.PrintLinesAtBottom(nil) // clear progress bar at ending
+
+	if rand.IntN(2) == 0 {
+		fmt.Printf("\nDeprecated Gradle features were used in this build, making it incompatible with Gradle 9.0.\n\n")
+		fmt.Printf("You can use '--warning-mode all' to show the individual deprecation warnings and determine if they come from your own scripts or plugins.\n\n")
+		fmt.Printf("For more on this, please refer to https://docs.gradle.org/%s/userguide/command_line_interface.html#sec:command_line_warnings in the Gradle documentation.\n", gradleVersion)
+	}
+	fmt.Printf("\n\u001B[32;1mBUILD SUCCESSFUL\u001B[m in %s\n", gradleDuration(time.Since(bar.startTime)))
+	if bar.actionable == 1 {
+		fmt.Printf("1 actionable task: 1 executed\n")
+	} else {
+		fmt.Printf("%d actionable tasks: %d executed\n", bar.actionable, bar.actionable)
+	}
+}
+
+// enter moves to the phase of the build, status lines are shown until execution
+func (bar *GradleProgressBar) enter(phase string, done float64, status ...string) {
+	bar.lock.Lock()
+	bar.phase, bar.done, bar.status = phase, done, status
+	bar.render()
+	bar.lock.Unlock()
+}
+
+// tick redraws the elapsed time until Epilogue
+func (bar *GradleProgressBar) tick() {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	defer close(bar.stopped)
+	for {
+		select {
+		case <-bar.stop:
+			return
+		case <-ticker.C:
+			bar.lock.Lock()
+			bar.render()
+			bar.lock.Unlock()
+		}
+	}
+}
+
+func (bar *GradleProgressBar) render() {
+
+	// <=====--------> 42% EXECUTING [1m 3s]
+	// > :app:compileKotlin
+	// > IDLE
+
+	width, _, err := term.GetSize(0)
+	if err != nil {
+		return
+	}
+	filled := min(int(bar.done*gradleBarWidth), gradleBarWidth)
+	status := fmt.Sprintf("> %d%% %s [%s]", int(bar.done*100), bar.phase, gradleDuration(time.Since(bar.startTime)))
+	line := "<" + strings.Repeat("=", filled) + strings.Repeat("-", gradleBarWidth-filled) + status
+	if len(line) < width {
+		line = "\u001B[1m<\u001B[32m" + strings.Repeat("=", filled) + "\u001B[39m" + strings.Repeat("-", gradleBarWidth-filled) + status + "\u001B[m"
+	} else {
+		line = string([]rune(line)[:max(width-1, 0)])
+	}
+	lines := []string{line}
+
+	workers := bar.status
+	if bar.phase == "EXECUTING" {
+		workers = nil
+		for _, task := range bar.workers {
+			if task == "" {
+				workers = append(workers, "> IDLE")
+			} else {
+				workers = append(workers, "> "+task)
+			}
+		}
+	}
+	for _, worker := range workers {
+		content := []rune(worker)
+		if len(content) > width-1 {
+			content = content[:max(width-1, 0)]
+		}
+		if worker == "> IDLE" {
+			lines = append(lines, "\u001B[2m"+string(content)+"\u001B[m")
+		} else {
+			lines = append(lines, string(content))
+		}
+	}
+	util.PrintLinesAtBottom(lines)
+}
+
+func (bar *GradleProgressBar) module(path string) *JvmModule {
+	module, ok := bar.modules[path]
+	if !ok {
+		module = jvmModuleOf(path)
+		bar.modules[path] = module
+	}
+	return module
+}
+
+// gradleDuration formats d like gradle, e.g. 450ms, 12s, 1m 3s, 1h 2m 5s
+func gradleDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	seconds := int(d.Seconds())
+	switch {
+	case seconds >= 3600:
+		return fmt.Sprintf("%dh %dm %ds", seconds/3600, seconds/60%60, seconds%60)
+	case seconds >= 60:
+		return fmt.Sprintf("%dm %ds", seconds/60, seconds%60)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
+}
@@ -7,3 +7,8 @@ type ProgressBar interface {
 	Prologue()
 	Epilogue()
 }
+
+// FreshTaskHandler is implemented by bars that can show up-to-date tasks, which are skipped by the compiler
+type FreshTaskHandler interface {
+	TaskFresh(task string)
+}
@@ -0,0 +1,56 @@
+package progressbar
+
+import "strings"
+
+// JvmModule is a gradle project or a maven module, tasks of a module are named after its path, e.g. :app:compileKotlin
+type JvmModule struct {
+	Path        string // gradle project path like :core:data, or maven artifactId
+	Name        string
+	Group       string
+	Version     string
+	Packaging   string // jar, war, pom, or apk and aar for android modules
+	Dir         string // relative to the root
+	Kotlin      bool
+	Sources     int
+	TestSources int
+	Resources   int
+}
+
+// JvmBar is implemented by bars of gradle and maven, which print details of modules
+type JvmBar interface {
+	// SetModules sets all modules of the build, in the order they are built
+	SetModules(modules []JvmModule)
+}
+
+// jvmTaskOf splits a task into its module path and name, e.g. :core:data:jar -> :core:data and jar
+func jvmTaskOf(task string) (module, name string) {
+	i := strings.LastIndex(task, ":")
+	if i < 0 {
+		return task, task
+	}
+	module, name = task[:i], task[i+1:]
+	if module == "" {
+		module = ":"
+	}
+	return module, name
+}
+
+// jvmModuleOf makes up a module known only by its path
+func jvmModuleOf(path string) *JvmModule {
+	name := path[strings.LastIndex(path, ":")+1:]
+	if name == "" {
+		name = "root"
+	}
+	dir := strings.ReplaceAll(strings.Trim(path, ":"), ":", "/")
+	if dir == "" {
+		dir = "."
+	}
+	return &JvmModule{
+		Path:      path,
+		Name:      name,
+		Group:     "com.example",
+		Version:   "1.0-SNAPSHOT",
+		Packaging: "jar",
+		Dir:       dir,
+	}
+}
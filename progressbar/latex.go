@@ -0,0 +1,736 @@
+package progressbar
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LatexProgressBar mimics `latexmk -pdf`: the chatty log of pdflatex, where every file read is opened by
+// `(./chapters/intro.tex` and every page shipped out is counted by `[12]`, with lines wrapped at 79 columns like TeX,
+// and bibtex or biber between the runs of pdflatex. Tasks of other compilers are shown as files of one run of
+// pdflatex, a page each
+type LatexProgressBar struct {
+	document  LatexDocument
+	tasks     map[string]latexTaskRef
+	driven    bool // pages are shipped out by ShipOut, otherwise one at the end of every task
+	run       int  // index of the current run, -1 before the first one
+	pdflatex  int  // runs of pdflatex started
+	bibtex    bool // whether the bibliography has been processed
+	page      int  // pages shipped out in the current run
+	shipped   map[string]int
+	pending   []LatexImage // images waiting for the next page
+	open      []int        // depths of files that are not closed yet
+	loaded    map[string]bool
+	column    int
+	finished  int    // tasks of the current run
+	undefined [2]int // citations and references undefined in the current run
+	lock      *sync.Mutex
+}
+
+// LatexDocument is what latexmk runs over a document
+type LatexDocument struct {
+	Name     string // job name, e.g. main
+	Class    string
+	Packages []string // packages of TeX Live, local ones are files
+	BibStyle string
+	Toc      bool
+	Runs     []LatexRun
+}
+
+// LatexRun is a run of pdflatex, bibtex or biber, Files are those read by Tasks in the same order
+type LatexRun struct {
+	Program string
+	Tasks   []string
+	Files   []LatexFile
+}
+
+type LatexFile struct {
+	Path       string
+	Kind       string // tex, sty, cls or bib
+	Size       int64
+	Lines      int
+	Depth      int
+	Pages      int
+	Images     []LatexImage
+	Citations  []LatexReference
+	References []LatexReference
+	Entries    int // of a .bib database
+}
+
+type LatexImage struct {
+	Path string
+	Size int64
+}
+
+// LatexReference is a key cited or referenced at Line, Defined if a .bib database or \label defines it,
+// it is undefined until then anyway
+type LatexReference struct {
+	Key     string
+	Line    int
+	Defined bool
+}
+
+type latexTaskRef struct {
+	run   int
+	index int
+}
+
+// TeX breaks lines of the terminal at max_print_line
+const latexMaxPrintLine = 79
+
+const latexTexmf = "/usr/share/texlive/texmf-dist/"
+
+// files of packages under tex/ of TeX Live and the files they load, latex/<name>/<name>.sty for the others
+var latexPackages = map[string]struct {
+	path     string
+	requires []string
+}{
+	"graphicx":             {"latex/graphics/graphicx.sty", []string{"keyval", "graphics"}},
+	"graphics":             {"latex/graphics/graphics.sty", []string{"trig", "graphics.cfg", "pdftex.def"}},
+	"keyval":               {"latex/graphics/keyval.sty", nil},
+	"trig":                 {"latex/graphics/trig.sty", nil},
+	"graphics.cfg":         {"latex/graphics-cfg/graphics.cfg", nil},
+	"pdftex.def":           {"latex/graphics-def/pdftex.def", nil},
+	"color":                {"latex/graphics/color.sty", []string{"color.cfg", "pdftex.def", "mathcolor.ltx"}},
+	"color.cfg":            {"latex/graphics-cfg/color.cfg", nil},
+	"mathcolor.ltx":        {"latex/graphics/mathcolor.ltx", nil},
+	"xcolor":               {"latex/xcolor/xcolor.sty", []string{"color.cfg", "pdftex.def", "mathcolor.ltx"}},
+	"amsmath":              {"latex/amsmath/amsmath.sty", []string{"amstext", "amsbsy", "amsopn"}},
+	"amstext":              {"latex/amsmath/amstext.sty", []string{"amsgen"}},
+	"amsgen":               {"latex/amsmath/amsgen.sty", nil},
+	"amsbsy":               {"latex/amsmath/amsbsy.sty", nil},
+	"amsopn":               {"latex/amsmath/amsopn.sty", nil},
+	"amssymb":              {"latex/amsfonts/amssymb.sty", []string{"amsfonts"}},
+	"amsfonts":             {"latex/amsfonts/amsfonts.sty", nil},
+	"amsthm":               {"latex/amscls/amsthm.sty", nil},
+	"hyperref":             {"latex/hyperref/hyperref.sty", []string{"iftex", "keyval", "kvsetkeys", "kvdefinekeys", "pdfescape", "hycolor", "nameref", "url", "bitset", "hpdftex.def"}},
+	"iftex":                {"generic/iftex/iftex.sty", nil},
+	"kvsetkeys":            {"latex/kvsetkeys/kvsetkeys.sty", nil},
+	"kvdefinekeys":         {"generic/kvdefinekeys/kvdefinekeys.sty", nil},
+	"pdfescape":            {"generic/pdfescape/pdfescape.sty", []string{"ltxcmds", "pdftexcmds"}},
+	"ltxcmds":              {"generic/ltxcmds/ltxcmds.sty", nil},
+	"pdftexcmds":           {"generic/pdftexcmds/pdftexcmds.sty", []string{"infwarerr"}},
+	"infwarerr":            {"generic/infwarerr/infwarerr.sty", nil},
+	"hycolor":              {"latex/hycolor/hycolor.sty", nil},
+	"nameref":              {"latex/hyperref/nameref.sty", []string{"refcount", "gettitlestring", "kvoptions"}},
+	"refcount":             {"latex/refcount/refcount.sty", nil},
+	"gettitlestring":       {"generic/gettitlestring/gettitlestring.sty", nil},
+	"kvoptions":            {"latex/kvoptions/kvoptions.sty", nil},
+	"url":                  {"latex/url/url.sty", nil},
+	"bitset":               {"generic/bitset/bitset.sty", []string{"bigintcalc"}},
+	"bigintcalc":           {"generic/bigintcalc/bigintcalc.sty", nil},
+	"hpdftex.def":          {"latex/hyperref/hpdftex.def", []string{"rerunfilecheck"}},
+	"rerunfilecheck":       {"latex/rerunfilecheck/rerunfilecheck.sty", nil},
+	"geometry":             {"latex/geometry/geometry.sty", []string{"keyval", "iftex", "ifvtex"}},
+	"ifvtex":               {"generic/iftex/ifvtex.sty", nil},
+	"tikz":                 {"latex/pgf/frontendlayer/tikz.sty", []string{"pgf", "pgffor"}},
+	"pgf":                  {"latex/pgf/basiclayer/pgf.sty", []string{"pgfrcs", "pgfcore"}},
+	"pgfrcs":               {"latex/pgf/utilities/pgfrcs.sty", nil},
+	"pgfcore":              {"latex/pgf/basiclayer/pgfcore.sty", []string{"graphicx", "pgfsys", "xcolor"}},
+	"pgfsys":               {"latex/pgf/systemlayer/pgfsys.sty", nil},
+	"pgffor":               {"latex/pgf/utilities/pgffor.sty", []string{"pgfkeys"}},
+	"pgfkeys":              {"latex/pgf/utilities/pgfkeys.sty", nil},
+	"inputenc":             {"latex/base/inputenc.sty", nil},
+	"fontenc":              {"latex/base/fontenc.sty", []string{"t1enc.def"}},
+	"t1enc.def":            {"latex/base/t1enc.def", nil},
+	"lmodern":              {"latex/lm/lmodern.sty", nil},
+	"babel":                {"generic/babel/babel.sty", []string{"txtbabel.def", "english.ldf"}},
+	"txtbabel.def":         {"generic/babel/txtbabel.def", nil},
+	"english.ldf":          {"generic/babel-english/english.ldf", nil},
+	"natbib":               {"latex/natbib/natbib.sty", nil},
+	"biblatex":             {"latex/biblatex/biblatex.sty", []string{"pdftexcmds", "etoolbox", "kvoptions", "logreq", "url", "blx-dm.def", "biblatex.cfg"}},
+	"etoolbox":             {"latex/etoolbox/etoolbox.sty", nil},
+	"logreq":               {"latex/logreq/logreq.sty", []string{"logreq.def"}},
+	"logreq.def":           {"latex/logreq/logreq.def", nil},
+	"blx-dm.def":           {"latex/biblatex/blx-dm.def", nil},
+	"biblatex.cfg":         {"latex/biblatex/biblatex.cfg", nil},
+	"booktabs":             {"latex/booktabs/booktabs.sty", nil},
+	"listings":             {"latex/listings/listings.sty", []string{"keyval", "lstmisc", "listings.cfg"}},
+	"lstmisc":              {"latex/listings/lstmisc.sty", nil},
+	"listings.cfg":         {"latex/listings/listings.cfg", nil},
+	"caption":              {"latex/caption/caption.sty", []string{"caption3"}},
+	"caption3":             {"latex/caption/caption3.sty", nil},
+	"subcaption":           {"latex/caption/subcaption.sty", []string{"caption"}},
+	"cleveref":             {"latex/cleveref/cleveref.sty", nil},
+	"siunitx":              {"latex/siunitx/siunitx.sty", []string{"translations"}},
+	"translations":         {"latex/translations/translations.sty", nil},
+	"microtype":            {"latex/microtype/microtype.sty", []string{"keyval", "etoolbox", "microtype-pdftex.def", "microtype.cfg"}},
+	"microtype-pdftex.def": {"latex/microtype/microtype-pdftex.def", nil},
+	"microtype.cfg":        {"latex/microtype/microtype.cfg", nil},
+	"algorithm":            {"latex/algorithms/algorithm.sty", []string{"float", "ifthen"}},
+	"algorithmic":          {"latex/algorithms/algorithmic.sty", []string{"ifthen", "keyval"}},
+	"algpseudocode":        {"latex/algorithmicx/algpseudocode.sty", []string{"ifthen", "algorithmicx"}},
+	"algorithmicx":         {"latex/algorithmicx/algorithmicx.sty", nil},
+	"ifthen":               {"latex/base/ifthen.sty", nil},
+	"float":                {"latex/float/float.sty", nil},
+	"array":                {"latex/tools/array.sty", nil},
+	"tabularx":             {"latex/tools/tabularx.sty", []string{"array"}},
+	"xspace":               {"latex/tools/xspace.sty", nil},
+	"calc":                 {"latex/tools/calc.sty", nil},
+	"verbatim":             {"latex/tools/verbatim.sty", nil},
+	"csquotes":             {"latex/csquotes/csquotes.sty", []string{"etoolbox", "keyval", "csquotes.def", "csquotes.cfg"}},
+	"csquotes.def":         {"latex/csquotes/csquotes.def", nil},
+	"csquotes.cfg":         {"latex/csquotes/csquotes.cfg", nil},
+}
+
+// files of common classes under tex/ of TeX Live, their banners and the size options they load
+var latexClasses = map[string][3]string{
+	"article": {"latex/base/article.cls", "Document Class: article 2023/05/17 v1.4n Standard LaTeX document class", "latex/base/size10.clo"},
+	"report":  {"latex/base/report.cls", "Document Class: report 2023/05/17 v1.4n Standard LaTeX document class", "latex/base/size10.clo"},
+	"book":    {"latex/base/book.cls", "Document Class: book 2023/05/17 v1.4n Standard LaTeX document class", "latex/base/bk10.clo"},
+	"beamer":  {"latex/beamer/beamer.cls", "Document Class: beamer 2024/01/06 v3.71 A class for typesetting presentations", ""},
+}
+
+// words of the lines that are too wide
+var latexWords = []string{"the", "of", "results", "method", "which", "proposed", "performance", "approach", "data", "model",
+	"analysis", "shown", "however", "distribution", "respectively", "significantly", "corresponding", "implementation"}
+
+func NewLatexProgressBar() *LatexProgressBar {
+	return &LatexProgressBar{
+		run:  -1,
+		lock: new(sync.Mutex),
+	}
+}
+
+// SetTotalTasks makes a document of a run of pdflatex reading the tasks, until SetDocument is called
+func (bar *LatexProgressBar) SetTotalTasks(tasks []string) {
+	run := LatexRun{Program: "pdflatex", Tasks: tasks}
+	for _, task := range tasks {
+		run.Files = append(run.Files, LatexFile{Path: task, Kind: "tex", Depth: 1})
+	}
+	bar.document = LatexDocument{Name: "main", Class: "article", Runs: []LatexRun{run}}
+	bar.driven = false
+	bar.index()
+}
+
+// SetDocument sets the runs over the document, pages of its files are shipped out by ShipOut
+func (bar *LatexProgressBar) SetDocument(document LatexDocument) {
+	bar.document = document
+	bar.driven = true
+	bar.index()
+}
+
+func (bar *LatexProgressBar) index() {
+	bar.tasks = make(map[string]latexTaskRef)
+	for i, run := range bar.document.Runs {
+		for j, task := range run.Tasks {
+			bar.tasks[task] = latexTaskRef{run: i, index: j}
+		}
+	}
+}
+
+// file returns the file read by task and its run, tasks not known are files of the current run
+func (bar *LatexProgressBar) file(task string) (*LatexFile, int) {
+	if ref, ok := bar.tasks[task]; ok {
+		return &bar.document.Runs[ref.run].Files[ref.index], ref.run
+	}
+	return &LatexFile{Path: task, Kind: "tex", Depth: 1}, max(bar.run, 0)
+}
+
+func (bar *LatexProgressBar) TaskStart(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	file, run := bar.file(task)
+	if run != bar.run {
+		bar.startRun(run)
+	}
+	switch bar.document.Runs[bar.run].Program {
+	case "bibtex":
+		bar.print(fmt.Sprintf("Database file #%d: %s\n", bar.finished+1, file.Path))
+	case "biber":
+		bar.print(fmt.Sprintf("INFO - Looking for bibtex file './%s' for section 0\n", file.Path))
+		bar.print("INFO - LaTeX decoding ...\n")
+		bar.print(fmt.Sprintf("INFO - Found BibTeX data source './%s'\n", file.Path))
+	default:
+		// local classes and packages are shown in the preamble of the main file
+		if !bar.driven || (file.Kind != "cls" && file.Kind != "sty") {
+			bar.openFile(file)
+		}
+	}
+}
+
+// ShipOut ships out the next page of the file read by task, with the warnings of its lines
+func (bar *LatexProgressBar) ShipOut(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	file, _ := bar.file(task)
+	k := bar.shipped[task]
+	bar.shipped[task]++
+	pages := max(file.Pages, k+1)
+	bar.warn(file, k*file.Lines/pages, (k+1)*file.Lines/pages)
+	bar.boxes(file, k, k*file.Lines/pages, (k+1)*file.Lines/pages)
+	bar.pending = append(bar.pending, file.Images[k*len(file.Images)/pages:(k+1)*len(file.Images)/pages]...)
+	bar.shipPage()
+}
+
+func (bar *LatexProgressBar) TaskComplete(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	file, _ := bar.file(task)
+	if bar.document.Runs[bar.run].Program == "pdflatex" {
+		if bar.driven {
+			// lines after the last page, and images of files without pages go to the next page
+			k := bar.shipped[task]
+			from := file.Lines
+			if file.Pages > 0 {
+				from = k * file.Lines / file.Pages
+			}
+			if k == 0 {
+				from = 0
+				bar.pending = append(bar.pending, file.Images...)
+			}
+			bar.warn(file, from, file.Lines)
+		} else {
+			bar.shipPage()
+		}
+	}
+	bar.finished++
+	if bar.finished == len(bar.document.Runs[bar.run].Tasks) {
+		bar.endRun()
+	}
+}
+
+func (bar *LatexProgressBar) Prologue() {
+	bar.print("Rc files read:\n  NONE\n")
+	bar.print("Latexmk: This is Latexmk, John Collins, 7 Jan. 2023. Version 4.79.\n")
+}
+
+func (bar *LatexProgressBar) Epilogue() {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	if bar.undefined == [2]int{} {
+		return
+	}
+	bar.print("Latexmk: Summary of warnings from last run of *latex:\n")
+	if bar.undefined[0] > 0 {
+		bar.print(fmt.Sprintf("  Latex failed to resolve %d citation(s)\n", bar.undefined[0]))
+	}
+	if bar.undefined[1] > 0 {
+		bar.print(fmt.Sprintf("  Latex failed to resolve %d reference(s)\n", bar.undefined[1]))
+	}
+}
+
+// startRun prints how latexmk starts the run and the banner of its program
+func (bar *LatexProgressBar) startRun(run int) {
+	bar.run = run
+	bar.finished = 0
+	program := bar.document.Runs[run].Program
+	name := bar.document.Name
+
+	number, reason := 0, name+".tex"
+	for _, r := range bar.document.Runs[:run+1] {
+		if r.Program == program {
+			number++
+		}
+	}
+	rule, command := "pdflatex", fmt.Sprintf(`pdflatex  -recorder  "%s.tex"`, name)
+	switch {
+	case program != "pdflatex":
+		rule, command, reason = program+" "+name, fmt.Sprintf(`%s  "%s"`, program, name), name+".aux"
+		if program == "biber" {
+			reason = name + ".bcf"
+		}
+	case run > 0 && bar.document.Runs[run-1].Program != "pdflatex":
+		reason = name + ".bbl"
+	case run > 0:
+		reason = name + ".aux"
+	}
+	bar.print(fmt.Sprintf("Latexmk: applying rule '%s'...\n", rule))
+	bar.print(fmt.Sprintf("Rule '%s':  File changes, etc:\n   Changed files, or newly in use since previous run(s):\n      %s\n", rule, reason))
+	bar.print(fmt.Sprintf("------------\nRun number %d of rule '%s'\n------------\n", number, rule))
+	bar.print(fmt.Sprintf("------------\nRunning '%s'\n------------\n", command))
+
+	switch program {
+	case "bibtex":
+		style := bar.document.BibStyle
+		if style == "" {
+			style = "plain"
+		}
+		bar.print("This is BibTeX, Version 0.99d (TeX Live 2023)\n")
+		bar.print(fmt.Sprintf("The top-level auxiliary file: %s.aux\nThe style file: %s.bst\n", name, style))
+	case "biber":
+		bar.print("INFO - This is Biber 2.19\n")
+		bar.print(fmt.Sprintf("INFO - Logfile is '%s.blg'\nINFO - Reading '%s.bcf'\n", name, name))
+		bar.print(fmt.Sprintf("INFO - Found %d citekeys in bib section 0\nINFO - Processing section 0\n", len(bar.cited(false))))
+	default:
+		bar.pdflatex++
+		bar.page = 0
+		bar.shipped = make(map[string]int)
+		bar.pending = nil
+		bar.open = nil
+		bar.loaded = make(map[string]bool)
+		bar.undefined = [2]int{}
+		bar.print("This is pdfTeX, Version 3.141592653-2.6-1.40.25 (TeX Live 2023) (preloaded format=pdflatex)\n")
+		bar.write(" restricted \\write18 enabled.\nentering extended mode\n")
+	}
+}
+
+// endRun prints how the run ends, and what latexmk finds after a run of pdflatex
+func (bar *LatexProgressBar) endRun() {
+	name := bar.document.Name
+	switch bar.document.Runs[bar.run].Program {
+	case "bibtex":
+		missing := bar.cited(true)
+		for _, key := range missing {
+			bar.print(fmt.Sprintf("Warning--I didn't find a database entry for \"%s\"\n", key))
+		}
+		switch len(missing) {
+		case 0:
+		case 1:
+			bar.print("(There was 1 warning)\n")
+		default:
+			bar.print(fmt.Sprintf("(There were %d warnings)\n", len(missing)))
+		}
+		bar.bibtex = true
+		return
+	case "biber":
+		missing := bar.cited(true)
+		for _, key := range missing {
+			bar.print(fmt.Sprintf("WARN - I didn't find a database entry for '%s' (section 0)\n", key))
+		}
+		bar.print("INFO - Overriding locale 'en-US' defaults 'normalization = NFD' with 'normalization = prenormalized'\n")
+		bar.print("INFO - Overriding locale 'en-US' defaults 'variable = shifted' with 'variable = non-ignorable'\n")
+		bar.print("INFO - Sorting list 'nty/global//global/global/global' of type 'entry' with template 'nty' and locale 'en-US'\n")
+		bar.print("INFO - No sort tailoring available for locale 'en-US'\n")
+		bar.print(fmt.Sprintf("INFO - Writing '%s.bbl' with encoding 'UTF-8'\nINFO - Output to %s.bbl\n", name, name))
+		if len(missing) > 0 {
+			bar.print(fmt.Sprintf("INFO - WARNINGS: %d\n", len(missing)))
+		}
+		bar.bibtex = true
+		return
+	}
+
+	// the main file stays open until the end
+	for len(bar.open) > 0 && bar.open[len(bar.open)-1] > 0 {
+		bar.write(")")
+		bar.open = bar.open[:len(bar.open)-1]
+	}
+	if bib := bar.bibliography(); bib != "" && bar.bibtex {
+		bar.openName("./" + name + ".bbl")
+		bar.shipPage()
+		bar.write(")")
+	} else if bib != "" {
+		bar.newline()
+		bar.write(fmt.Sprintf("No file %s.bbl.\n", name))
+	}
+	bar.openName("./" + name + ".aux")
+	bar.write(")")
+	next := ""
+	if bar.run+1 < len(bar.document.Runs) {
+		next = bar.document.Runs[bar.run+1].Program
+	}
+	if bar.undefined != [2]int{} {
+		bar.warning("LaTeX Warning: There were undefined references.")
+	}
+	if next == "pdflatex" {
+		bar.warning("LaTeX Warning: Label(s) may have changed. Rerun to get cross-references right.")
+	}
+	for range bar.open {
+		bar.write(" )")
+	}
+	bar.open = nil
+	bar.newline()
+	bar.write("(see the transcript file for additional information)")
+	fonts, size := bar.fonts()
+	for _, font := range fonts {
+		bar.write(font)
+	}
+	bar.newline()
+	pages := fmt.Sprintf("%d pages", bar.page)
+	if bar.page == 1 {
+		pages = "1 page"
+	}
+	bar.write(fmt.Sprintf("Output written on %s.pdf (%s, %d bytes).\n", name, pages, size+int64(bar.page)*4096))
+	bar.write(fmt.Sprintf("Transcript written on %s.log.\n", name))
+
+	bar.print(fmt.Sprintf("Latexmk: Getting log file '%s.log'\n", name))
+	bar.print(fmt.Sprintf("Latexmk: Examining '%s.fls'\nLatexmk: Examining '%s.log'\n", name, name))
+	if next == "bibtex" || next == "biber" {
+		bar.print("Latexmk: Found bibliography file(s):\n")
+		for _, file := range bar.document.Runs[bar.run+1].Files {
+			bar.print("  ./" + file.Path + "\n")
+		}
+	}
+	bar.print(fmt.Sprintf("Latexmk: Log file says output to '%s.pdf'\n", name))
+}
+
+// fonts returns the fonts embedded into the pdf, and the size of them and the images
+func (bar *LatexProgressBar) fonts() ([]string, int64) {
+	var fonts []string
+	switch {
+	case slices.Contains(bar.document.Packages, "lmodern"):
+		for _, font := range []string{"lmbx10", "lmbx12", "lmmi10", "lmr10", "lmr12", "lmr17", "lmri10", "lmsy10"} {
+			fonts = append(fonts, "<"+latexTexmf+"fonts/type1/public/lm/"+font+".pfb>")
+		}
+	case slices.Contains(bar.document.Packages, "fontenc"):
+		fonts = append(fonts, "{"+latexTexmf+"fonts/enc/dvips/cm-super/cm-super-t1.enc}")
+		for _, font := range []string{"sfbx1000", "sfbx1200", "sfrm1000", "sfrm1200", "sfti1000"} {
+			fonts = append(fonts, "</usr/share/texmf/fonts/type1/public/cm-super/"+font+".pfb>")
+		}
+	default:
+		for _, font := range []string{"cmbx10", "cmbx12", "cmmi10", "cmr10", "cmr12", "cmr17", "cmsy10", "cmti10"} {
+			fonts = append(fonts, "<"+latexTexmf+"fonts/type1/public/amsfonts/cm/"+font+".pfb>")
+		}
+	}
+	size := int64(len(fonts)) * 21000
+	for _, file := range bar.document.Runs[0].Files {
+		for _, image := range file.Images {
+			size += image.Size
+		}
+	}
+	return fonts, size
+}
+
+// openFile prints the file opened by pdflatex, files that are not deeper than it are closed before
+func (bar *LatexProgressBar) openFile(file *LatexFile) {
+	for len(bar.open) > 0 && bar.open[len(bar.open)-1] >= file.Depth {
+		bar.write(")")
+		bar.open = bar.open[:len(bar.open)-1]
+	}
+	bar.openName("./" + file.Path)
+	bar.open = append(bar.open, file.Depth)
+	if file.Depth > 0 || !bar.driven {
+		return
+	}
+
+	// the main file loads the format, the class and packages in its preamble
+	bar.write("\nLaTeX2e <2023-11-01> patch level 1\nL3 programming layer <2024-02-20>\n")
+	local := make(map[string][]string)
+	for _, f := range bar.document.Runs[bar.run].Files {
+		local[f.Kind] = append(local[f.Kind], f.Path)
+	}
+	for _, path := range local["cls"] {
+		bar.openName("./" + path)
+		bar.write(")")
+	}
+	if len(local["cls"]) == 0 {
+		class := bar.document.Class
+		if info, ok := latexClasses[class]; ok {
+			bar.openName(latexTexmf + "tex/" + info[0])
+			bar.write("\n" + info[1] + "\n")
+			if info[2] != "" {
+				bar.openName(latexTexmf + "tex/" + info[2])
+				bar.write(")")
+			}
+		} else {
+			bar.openName(latexTexmf + "tex/latex/" + class + "/" + class + ".cls")
+		}
+		bar.write(")")
+	}
+	for _, name := range bar.document.Packages {
+		bar.load(name)
+	}
+	for _, path := range local["sty"] {
+		bar.openName("./" + path)
+		bar.write(")")
+	}
+	bar.openName(latexTexmf + "tex/latex/l3backend/l3backend-pdftex.def")
+	bar.write(")")
+	if bar.pdflatex == 1 {
+		bar.newline()
+		bar.write(fmt.Sprintf("No file %s.aux.\n", bar.document.Name))
+	} else {
+		bar.openName("./" + bar.document.Name + ".aux")
+		bar.write(")")
+	}
+	if bar.loaded["graphicx"] {
+		bar.openName(latexTexmf + "tex/context/base/mkii/supp-pdf.mkii")
+		bar.write("\n[Loading MPS to PDF converter (version 2006.09.02).]\n)")
+		bar.openName(latexTexmf + "tex/latex/epstopdf-pkg/epstopdf-base.sty")
+		bar.openName(latexTexmf + "tex/latex/latexconfig/epstopdf-sys.cfg")
+		bar.write("))")
+	}
+	if bar.document.Toc {
+		if bar.pdflatex == 1 {
+			bar.newline()
+			bar.write(fmt.Sprintf("No file %s.toc.\n", bar.document.Name))
+		} else {
+			bar.openName("./" + bar.document.Name + ".toc")
+			bar.write(")")
+		}
+	}
+}
+
+// load prints a package of TeX Live and the files it loads, which are loaded once
+func (bar *LatexProgressBar) load(name string) {
+	if bar.loaded[name] {
+		return
+	}
+	bar.loaded[name] = true
+	p, ok := latexPackages[name]
+	if !ok {
+		p.path = "latex/" + name + "/" + name + ".sty"
+	}
+	bar.openName(latexTexmf + "tex/" + p.path)
+	for _, required := range p.requires {
+		bar.load(required)
+	}
+	bar.write(")")
+}
+
+// warn prints warnings of citations and references in lines (from, to] of file
+func (bar *LatexProgressBar) warn(file *LatexFile, from, to int) {
+	natbib := slices.Contains(bar.document.Packages, "natbib")
+	for _, citation := range file.Citations {
+		if citation.Line <= from || citation.Line > to || citation.Defined && bar.bibtex {
+			continue
+		}
+		bar.undefined[0]++
+		text := fmt.Sprintf("Citation `%s' on page %d undefined on input line %d.", citation.Key, bar.page+1, citation.Line)
+		if natbib {
+			bar.warning("Package natbib Warning: " + text)
+		} else {
+			bar.warning("LaTeX Warning: " + text)
+		}
+	}
+	for _, reference := range file.References {
+		if reference.Line <= from || reference.Line > to || reference.Defined && bar.pdflatex > 1 {
+			continue
+		}
+		bar.undefined[1]++
+		bar.warning(fmt.Sprintf("LaTeX Warning: Reference `%s' on page %d undefined on input line %d.", reference.Key, bar.page+1, reference.Line))
+	}
+}
+
+// boxes prints overfull and underfull boxes of the k-th page of file within lines (from, to],
+// which are the same in every run
+func (bar *LatexProgressBar) boxes(file *LatexFile, k, from, to int) {
+	h := fnv.New64a()
+	h.Write([]byte(file.Path))
+	r := rand.New(rand.NewPCG(h.Sum64(), uint64(k)))
+	font := `\OT1/cmr/m/n/10`
+	switch {
+	case slices.Contains(bar.document.Packages, "lmodern"):
+		font = `\T1/lmr/m/n/10`
+	case slices.Contains(bar.document.Packages, "fontenc"):
+		font = `\T1/cmr/m/n/10`
+	}
+	words := func() string {
+		s := make([]string, 4+r.IntN(6))
+		for i := range s {
+			s[i] = latexWords[r.IntN(len(latexWords))]
+		}
+		return strings.Join(s, " ")
+	}
+	start := from + 1 + r.IntN(max(to-from, 1))
+	end := start + r.IntN(3)
+	switch x := r.Float64(); {
+	case x < 0.15:
+		wide := strconv.FormatFloat(float64(r.IntN(2000000)+1)/100000, 'f', -1, 64)
+		bar.newline()
+		bar.write(fmt.Sprintf("Overfull \\hbox (%spt too wide) in paragraph at lines %d--%d\n", wide, start, end))
+		bar.write(fmt.Sprintf("[]%s %s|\n []\n\n", font, words()))
+	case x < 0.22:
+		bar.newline()
+		bar.write(fmt.Sprintf("Underfull \\hbox (badness %d) in paragraph at lines %d--%d\n", 1000+r.IntN(9001), start, end))
+		bar.write(fmt.Sprintf("[]%s %s\n []\n\n", font, words()))
+	}
+}
+
+// shipPage prints the counter of the next page with the images on it, the first page of a run loads the font map
+func (bar *LatexProgressBar) shipPage() {
+	bar.page++
+	n := strconv.Itoa(bar.page)
+	if bar.column > latexMaxPrintLine-9 {
+		bar.write("\n")
+	} else if bar.column > 0 {
+		bar.write(" ")
+	}
+	bar.write("[" + n)
+	if bar.page == 1 {
+		bar.write("{/var/lib/texmf/fonts/map/pdftex/updmap/pdftex.map}")
+	}
+	for _, image := range bar.pending {
+		bar.openToken("<./" + image.Path + ">")
+	}
+	bar.pending = nil
+	bar.write("]")
+}
+
+// cited returns the keys cited by the document in order, only those not in the bibliography if missing
+func (bar *LatexProgressBar) cited(missing bool) []string {
+	var keys []string
+	for _, run := range bar.document.Runs {
+		if run.Program != "pdflatex" {
+			continue
+		}
+		for _, file := range run.Files {
+			for _, citation := range file.Citations {
+				if !slices.Contains(keys, citation.Key) && (!missing || !citation.Defined) {
+					keys = append(keys, citation.Key)
+				}
+			}
+		}
+		break
+	}
+	return keys
+}
+
+// openName prints ( and name of a file opened, on a new line if it does not fit like TeX
+func (bar *LatexProgressBar) openName(name string) {
+	bar.openToken("(" + name)
+}
+
+func (bar *LatexProgressBar) openToken(token string) {
+	if bar.column+len(token) > latexMaxPrintLine-1 {
+		bar.write("\n")
+	} else if bar.column > 0 {
+		bar.write(" ")
+	}
+	bar.write(token)
+}
+
+// warning prints a warning surrounded by empty lines
+// bibliography returns the program which processes the bibliography, if any
+func (bar *LatexProgressBar) bibliography() string {
+	for _, run := range bar.document.Runs {
+		if run.Program != "pdflatex" {
+			return run.Program
+		}
+	}
+	return ""
+}
+
+func (bar *LatexProgressBar) warning(text string) {
+	bar.newline()
+	bar.write("\n" + text + "\n\n")
+}
+
+func (bar *LatexProgressBar) newline() {
+	if bar.column > 0 {
+		bar.write("\n")
+	}
+}
+
+// print prints s as it is, for output of latexmk, bibtex and biber
+func (bar *LatexProgressBar) print(s string) {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		bar.column = len(s) - i - 1
+	} else {
+		bar.column += len(s)
+	}
+	fmt.Print(s)
+}
+
+// write prints s, lines are broken at max_print_line like TeX
+func (bar *LatexProgressBar) write(s string) {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			bar.column = 0
+		} else {
+			if bar.column == latexMaxPrintLine {
+				b.WriteByte('\n')
+				bar.column = 0
+			}
+			bar.column++
+		}
+		b.WriteByte(s[i])
+	}
+	fmt.Print(b.String())
+}
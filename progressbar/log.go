@@ -0,0 +1,70 @@
+package progressbar
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LogProgressBar writes tasks as lines of plain output in the style of a compiler, for builds nested in another one,
+// e.g. within RUN of docker. Styles are cargo (`   Compiling serde v1.0.197`), cxx (`[ 42%] Building CXX object ...`),
+// and the task as is for the others
+type LogProgressBar struct {
+	style   string
+	target  string // cxx: the target linked at last
+	log     func(line string)
+	total   int
+	started int
+	begin   time.Time
+	lock    *sync.Mutex
+}
+
+// NewLogProgressBar creates a bar that writes lines by log, which may be nil to discard them
+func NewLogProgressBar(style, target string, log func(line string)) *LogProgressBar {
+	if log == nil {
+		log = func(string) {}
+	}
+	if target == "" {
+		target = "app"
+	}
+	return &LogProgressBar{style: style, target: target, log: log, lock: new(sync.Mutex)}
+}
+
+func (bar *LogProgressBar) SetTotalTasks(tasks []string) {
+	bar.total = len(tasks)
+}
+
+func (bar *LogProgressBar) TaskStart(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	bar.started++
+	switch bar.style {
+	case "cargo":
+		bar.log("   Compiling " + task)
+	case "cxx":
+		// 100% is left to linking
+		bar.log(fmt.Sprintf("[%3d%%] Building CXX object %s", min(bar.started*100/max(bar.total, 1), 99), task))
+	default:
+		bar.log(task)
+	}
+}
+
+func (bar *LogProgressBar) TaskComplete(task string) {
+}
+
+func (bar *LogProgressBar) Prologue() {
+	bar.begin = time.Now()
+	if bar.style == "cargo" {
+		bar.log("    Updating crates.io index")
+	}
+}
+
+func (bar *LogProgressBar) Epilogue() {
+	switch bar.style {
+	case "cargo":
+		bar.log(fmt.Sprintf("    Finished `release` profile [optimized] target(s) in %.2fs", time.Since(bar.begin).Seconds()))
+	case "cxx":
+		bar.log("[100%] Linking CXX executable " + bar.target)
+		bar.log("[100%] Built target " + bar.target)
+	}
+}
@@ -0,0 +1,274 @@
+package progressbar
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MavenProgressBar mimics `mvn install`, tasks are goals of modules like core:compile
+//
+// a goal is printed when it completes, under the header of its module, then the reactor summary is printed in Epilogue
+type MavenProgressBar struct {
+	modules   map[string]*JvmModule
+	order     []string // module paths, in the order of the reactor
+	remaining map[string]int
+	headed    map[string]bool // whether the header of the module is printed
+	started   map[string]time.Time
+	finished  map[string]time.Time
+	startTime time.Time
+	lock      *sync.Mutex
+}
+
+// mavenWidth is the width of separators and aligned columns of maven logs
+const mavenWidth = 72
+
+// mavenGoals are the plugin executions of tasks
+var mavenGoals = map[string]string{
+	"resources":           "resources:3.3.1:resources (default-resources)",
+	"kotlin-compile":      "kotlin:1.9.24:compile (compile)",
+	"compile":             "compiler:3.13.0:compile (default-compile)",
+	"testResources":       "resources:3.3.1:testResources (default-testResources)",
+	"kotlin-test-compile": "kotlin:1.9.24:test-compile (test-compile)",
+	"testCompile":         "compiler:3.13.0:testCompile (default-testCompile)",
+	"test":                "surefire:3.2.5:test (default-test)",
+	"jar":                 "jar:3.4.1:jar (default-jar)",
+	"war":                 "war:3.4.0:war (default-war)",
+	"install":             "install:3.1.2:install (default-install)",
+}
+
+func NewMavenProgressBar() *MavenProgressBar {
+	return &MavenProgressBar{
+		modules:   make(map[string]*JvmModule),
+		remaining: make(map[string]int),
+		headed:    make(map[string]bool),
+		started:   make(map[string]time.Time),
+		finished:  make(map[string]time.Time),
+		lock:      new(sync.Mutex),
+	}
+}
+
+func (bar *MavenProgressBar) SetTotalTasks(tasks []string) {
+	for _, task := range tasks {
+		module, _ := jvmTaskOf(task)
+		if bar.modules[module] == nil {
+			bar.modules[module] = jvmModuleOf(module)
+			bar.order = append(bar.order, module)
+		}
+		bar.remaining[module]++
+	}
+}
+
+func (bar *MavenProgressBar) SetModules(modules []JvmModule) {
+	bar.order = nil
+	for _, module := range modules {
+		bar.modules[module.Path] = &module
+		bar.order = append(bar.order, module.Path)
+	}
+}
+
+func (bar *MavenProgressBar) TaskStart(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	module, _ := jvmTaskOf(task)
+	if _, ok := bar.started[module]; !ok {
+		bar.started[module] = time.Now()
+	}
+}
+
+func (bar *MavenProgressBar) TaskComplete(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	path, name := jvmTaskOf(task)
+	module := bar.module(path)
+	s := strings.Builder{}
+	if !bar.headed[path] {
+		// the header is printed along with the first goal, so that it is not separated from goals of the module
+		bar.headed[path] = true
+		coordinates := "< " + module.Group + ":" + module.Path + " >"
+		index := fmt.Sprintf("[%d/%d]", bar.index(path)+1, len(bar.order))
+		pom := mavenPom(module.Dir)
+		mavenLog(&s, "")
+		mavenLog(&s, mavenCenter(coordinates, '-'))
+		building := "Building " + module.Name + " " + module.Version
+		mavenLog(&s, "\u001B[1m"+building+"\u001B[m"+strings.Repeat(" ", max(mavenWidth-len(building)-len(index), 1))+index)
+		mavenLog(&s, "  from "+pom)
+		mavenLog(&s, mavenCenter("[ "+module.Packaging+" ]", '-'))
+	}
+	goal, ok := mavenGoals[name]
+	if !ok {
+		goal = name + " (default-" + name + ")"
+	}
+	plugin, execution, _ := strings.Cut(goal, " ")
+	mavenLog(&s, "")
+	mavenLog(&s, fmt.Sprintf("\u001B[1m--- \u001B[0;32m%s\u001B[m \u001B[1m%s\u001B[m @ \u001B[36m%s\u001B[0;1m ---\u001B[m", plugin, execution, module.Path))
+	for _, line := range bar.details(module, name) {
+		mavenLog(&s, line)
+	}
+	fmt.Print(s.String())
+
+	bar.remaining[path]--
+	if bar.remaining[path] <= 0 {
+		bar.finished[path] = time.Now()
+	}
+}
+
+// details returns the log lines of goal name of module
+func (bar *MavenProgressBar) details(module *JvmModule, name string) []string {
+	target := path.Join(module.Dir, "target")
+	artifact := module.Path + "-" + module.Version
+	compiling := func(sources int, classes string) []string {
+		switch {
+		case module.Kotlin:
+			return []string{"Nothing to compile - all classes are up to date."}
+		case sources == 0:
+			return []string{"No sources to compile"}
+		default:
+			return []string{
+				"Recompiling the module because of changed source code.",
+				fmt.Sprintf("Compiling %d source %s with javac [debug target 17] to %s", sources, mavenPlural(sources, "file"), classes),
+			}
+		}
+	}
+	switch name {
+	case "resources":
+		if module.Resources == 0 {
+			return []string{"skip non existing resourceDirectory " + path.Join(module.Dir, "src/main/resources")}
+		}
+		return []string{fmt.Sprintf("Copying %d %s from src/main/resources to target/classes", module.Resources, mavenPlural(module.Resources, "resource"))}
+	case "testResources":
+		return []string{"skip non existing resourceDirectory " + path.Join(module.Dir, "src/test/resources")}
+	case "kotlin-compile", "kotlin-test-compile":
+		if (name == "kotlin-compile" && module.Sources == 0) || (name == "kotlin-test-compile" && module.TestSources == 0) {
+			return []string{"No sources found skipping Kotlin compile"}
+		}
+		return nil
+	case "compile":
+		return compiling(module.Sources, "target/classes")
+	case "testCompile":
+		return compiling(module.TestSources, "target/test-classes")
+	case "test":
+		if module.TestSources == 0 {
+			return []string{"No tests to run."}
+		}
+		return []string{"Tests are skipped."}
+	case "jar":
+		return []string{"Building jar: " + path.Join(target, artifact+".jar")}
+	case "war":
+		return []string{
+			"Packaging webapp",
+			fmt.Sprintf("Assembling webapp [%s] in [%s]", module.Path, path.Join(target, artifact)),
+			"Processing war project",
+			"Building war: " + path.Join(target, artifact+".war"),
+		}
+	case "install":
+		repository := path.Join("/root/.m2/repository", strings.ReplaceAll(module.Group, ".", "/"), module.Path, module.Version)
+		lines := []string{fmt.Sprintf("Installing %s to %s", mavenPom(module.Dir), path.Join(repository, artifact+".pom"))}
+		if module.Packaging != "pom" {
+			file := artifact + "." + module.Packaging
+			lines = append(lines, fmt.Sprintf("Installing %s to %s", path.Join(target, file), path.Join(repository, file)))
+		}
+		return lines
+	default:
+		return nil
+	}
+}
+
+func (bar *MavenProgressBar) Prologue() {
+	bar.startTime = time.Now()
+	s := strings.Builder{}
+	mavenLog(&s, "Scanning for projects...")
+	if len(bar.order) > 1 {
+		mavenLog(&s, strings.Repeat("-", mavenWidth))
+		mavenLog(&s, "Reactor Build Order:")
+		mavenLog(&s, "")
+		for _, path := range bar.order {
+			module := bar.module(path)
+			packaging := "[" + module.Packaging + "]"
+			mavenLog(&s, module.Name+strings.Repeat(" ", max(mavenWidth-len(module.Name)-len(packaging), 1))+packaging)
+		}
+	}
+	fmt.Print(s.String())
+}
+
+func (bar *MavenProgressBar) Epilogue() {
+	s := strings.Builder{}
+	mavenLog(&s, "")
+	if len(bar.order) > 1 {
+		root := bar.module(bar.order[0])
+		mavenLog(&s, strings.Repeat("-", mavenWidth))
+		mavenLog(&s, "Reactor Summary for "+root.Name+" "+root.Version+":")
+		mavenLog(&s, "")
+		for _, path := range bar.order {
+			module := bar.module(path)
+			elapsed := bar.finished[path].Sub(bar.started[path])
+			result := fmt.Sprintf(" \u001B[1;32mSUCCESS\u001B[m [%7.3f s]", elapsed.Seconds())
+			// the width of result, without escape sequences
+			dots := max(mavenWidth-len(module.Name)-len(" SUCCESS [  0.000 s]")-1, 2)
+			mavenLog(&s, module.Name+" "+strings.Repeat(".", dots)+result)
+		}
+	}
+	mavenLog(&s, strings.Repeat("-", mavenWidth))
+	mavenLog(&s, "\u001B[1;32mBUILD SUCCESS\u001B[m")
+	mavenLog(&s, strings.Repeat("-", mavenWidth))
+	mavenLog(&s, "Total time:  "+mavenDuration(time.Since(bar.startTime)))
+	mavenLog(&s, "Finished at: "+time.Now().Format("2006-01-02T15:04:05-07:00"))
+	mavenLog(&s, strings.Repeat("-", mavenWidth))
+	fmt.Print(s.String())
+}
+
+func (bar *MavenProgressBar) module(path string) *JvmModule {
+	module, ok := bar.modules[path]
+	if !ok {
+		module = jvmModuleOf(path)
+		bar.modules[path] = module
+	}
+	return module
+}
+
+func (bar *MavenProgressBar) index(path string) int {
+	for i, p := range bar.order {
+		if p == path {
+			return i
+		}
+	}
+	return len(bar.order) - 1
+}
+
+// mavenLog writes line with the INFO level
+func mavenLog(s *strings.Builder, line string) {
+	s.WriteString("[\u001B[1;34mINFO\u001B[m] " + line + "\n")
+}
+
+// mavenCenter pads s on both sides with c, to the width of maven logs
+func mavenCenter(s string, c rune) string {
+	left := max(mavenWidth-len(s), 0) / 2
+	right := max(mavenWidth-len(s)-left, 0)
+	return strings.Repeat(string(c), left) + s + strings.Repeat(string(c), right)
+}
+
+// mavenDuration formats d like maven, e.g. 3.456 s, 01:03 min
+func mavenDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.3f s", d.Seconds())
+	}
+	seconds := int(d.Seconds())
+	if seconds >= 3600 {
+		return fmt.Sprintf("%02d:%02d h", seconds/3600, seconds/60%60)
+	}
+	return fmt.Sprintf("%02d:%02d min", seconds/60, seconds%60)
+}
+
+func mavenPlural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+// mavenPom returns the pom of the module in dir
+func mavenPom(dir string) string {
+	return path.Join(dir, "pom.xml")
+}
@@ -0,0 +1,241 @@
+package progressbar
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/util"
+	"golang.org/x/term"
+)
+
+// MesonProgressBar mimics `meson setup builddir` followed by `meson compile -C builddir`, which runs ninja.
+// Tasks are object files like src/foo.c.o, tasks of other compilers are shown as custom commands
+type MesonProgressBar struct {
+	project  MesonProject
+	tasks    int
+	finished int
+	started  bool // whether any task has started, targets are not relinked otherwise
+	buildDir string
+	tty      bool
+	lock     *sync.Mutex
+}
+
+// MesonProject is what meson reports of a project while configuring it
+type MesonProject struct {
+	Name         string
+	Version      string
+	Languages    []string // e.g. c, cpp
+	Dependencies []MesonDependency
+	Programs     []string
+	Targets      []MesonTarget // objects are compiled into the first one
+}
+
+type MesonDependency struct {
+	Name     string
+	Version  string // empty for dependencies without one, e.g. threads
+	Required bool
+}
+
+type MesonTarget struct {
+	Kind string // executable, library, shared_library, static_library, both_libraries or shared_module
+	Name string
+}
+
+// compilers found for languages, and their linkers
+var mesonCompilers = map[string][2]string{
+	"c":      {"C compiler for the host machine: \u001B[1mcc\u001B[0m (gcc 13.2.0 \"cc (GCC) 13.2.0\")", "C linker for the host machine: \u001B[1mcc\u001B[0m ld.bfd 2.42"},
+	"cpp":    {"C++ compiler for the host machine: \u001B[1mc++\u001B[0m (gcc 13.2.0 \"c++ (GCC) 13.2.0\")", "C++ linker for the host machine: \u001B[1mc++\u001B[0m ld.bfd 2.42"},
+	"objc":   {"Objective-C compiler for the host machine: \u001B[1mcc\u001B[0m (gcc 13.2.0 \"cc (GCC) 13.2.0\")", "Objective-C linker for the host machine: \u001B[1mcc\u001B[0m ld.bfd 2.42"},
+	"rust":   {"Rust compiler for the host machine: \u001B[1mrustc -C linker=cc\u001B[0m (rustc 1.77.2)", "Rust linker for the host machine: \u001B[1mrustc -C linker=cc\u001B[0m ld.bfd 2.42"},
+	"vala":   {"Vala compiler for the host machine: \u001B[1mvalac\u001B[0m (valac 0.56.16)", ""},
+	"cython": {"Cython compiler for the host machine: \u001B[1mcython\u001B[0m (cython 3.0.8)", ""},
+}
+
+// dependencies that are not looked up by pkg-config
+var mesonBuiltinDependencies = []string{"threads", "dl", "openmp"}
+
+func NewMesonProgressBar() *MesonProgressBar {
+	return &MesonProgressBar{
+		lock: new(sync.Mutex),
+	}
+}
+
+func (bar *MesonProgressBar) SetTotalTasks(tasks []string) {
+	bar.tasks = len(tasks)
+}
+
+// SetProject sets the project reported while configuring
+func (bar *MesonProgressBar) SetProject(project MesonProject) {
+	bar.project = project
+}
+
+func (bar *MesonProgressBar) TaskStart(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	bar.started = true
+	// like ninja, a started edge is only shown on smart terminals, finished ones are always shown
+	if bar.tty {
+		bar.status(bar.describe(task))
+	}
+}
+
+func (bar *MesonProgressBar) TaskComplete(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	bar.finished++
+	bar.status(bar.describe(task))
+}
+
+func (bar *MesonProgressBar) Prologue() {
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = "/tmp/" + bar.name()
+	}
+	bar.buildDir = filepath.Join(cwd, "builddir")
+	_, _, err = term.GetSize(0)
+	bar.tty = err == nil
+
+	project := bar.project
+	version := project.Version
+	if version == "" {
+		version = "undefined"
+	}
+	lines := []string{
+		"The Meson build system",
+		"Version: 1.4.1",
+		"Source dir: " + cwd,
+		"Build dir: " + bar.buildDir,
+		"Build type: native build",
+		"Project name: \u001B[1m" + bar.name() + "\u001B[0m",
+		"Project version: \u001B[1m" + version + "\u001B[0m",
+	}
+	for _, language := range project.Languages {
+		if found, ok := mesonCompilers[language]; ok {
+			lines = append(lines, found[0])
+			if found[1] != "" {
+				lines = append(lines, found[1])
+			}
+		}
+	}
+	lines = append(lines, "Host machine cpu family: x86_64", "Host machine cpu: x86_64")
+	pkgConfig := false
+	for _, dep := range project.Dependencies {
+		if !pkgConfig && !slices.Contains(mesonBuiltinDependencies, dep.Name) {
+			lines = append(lines, "Found pkg-config: \u001B[1;32mYES\u001B[0m (/usr/bin/pkg-config) 1.8.1")
+			pkgConfig = true
+		}
+		switch {
+		// optional dependencies are missing sometimes
+		case !dep.Required && rand.Float64() < 0.25:
+			lines = append(lines, fmt.Sprintf("Run-time dependency \u001B[1m%s\u001B[0m found: \u001B[1;31mNO\u001B[0m (tried pkgconfig and cmake)", dep.Name))
+		case dep.Version == "":
+			lines = append(lines, fmt.Sprintf("Run-time dependency \u001B[1m%s\u001B[0m found: \u001B[1;32mYES\u001B[0m", dep.Name))
+		default:
+			lines = append(lines, fmt.Sprintf("Run-time dependency \u001B[1m%s\u001B[0m found: \u001B[1;32mYES\u001B[0m %s", dep.Name, dep.Version))
+		}
+	}
+	for _, program := range project.Programs {
+		lines = append(lines, fmt.Sprintf("Program \u001B[1m%s\u001B[0m found: \u001B[1;32mYES\u001B[0m (/usr/bin/%s)", program, path.Base(program)))
+	}
+	lines = append(lines, fmt.Sprintf("Build targets in project: %d", max(len(project.Targets), 1)), "")
+	lines = append(lines, "Found ninja-1.11.1 at /usr/bin/ninja")
+
+	for _, line := range lines {
+		fmt.Println(line)
+		time.Sleep(time.Duration(max(util.GetRandomFromDistribution(60, 30), 0)) * time.Millisecond)
+	}
+	time.Sleep(time.Duration(util.GetRandomUniformDistribution(200, 600)) * time.Millisecond)
+
+	fmt.Println("\u001B[1mINFO:\u001B[0m autodetecting backend as ninja")
+	fmt.Println("\u001B[1mINFO:\u001B[0m calculating backend command to run: /usr/bin/ninja -C " + bar.buildDir)
+	fmt.Println("ninja: Entering directory `" + bar.buildDir + "'")
+}
+
+func (bar *MesonProgressBar) Epilogue() {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	if !bar.started {
+		fmt.Println("ninja: no work to do.")
+		return
+	}
+	targets := bar.project.Targets
+	if len(targets) == 0 {
+		targets = []MesonTarget{{Kind: "executable", Name: bar.name()}}
+	}
+	for _, target := range targets {
+		bar.finished++
+		link := "Linking target " + mesonOutput(target)
+		if target.Kind == "static_library" {
+			link = "Linking static target " + mesonOutput(target)
+		}
+		bar.status(link)
+		time.Sleep(time.Duration(max(util.GetRandomFromDistribution(420, 42), 0)) * time.Millisecond)
+	}
+	if bar.tty {
+		fmt.Println()
+	}
+}
+
+// status shows [finished/total] with the description, ninja overwrites the line on smart terminals,
+// eliding the middle of what is too long for the terminal
+func (bar *MesonProgressBar) status(description string) {
+	total := bar.tasks + max(len(bar.project.Targets), 1)
+	line := fmt.Sprintf("[%d/%d] %s", bar.finished, total, description)
+	if !bar.tty {
+		fmt.Println(line)
+		return
+	}
+	width, _, err := term.GetSize(0)
+	if err == nil && len(line) > width && width > 3 {
+		half := (width - 3) / 2
+		line = line[:half] + "..." + line[len(line)-(width-3-half):]
+	}
+	fmt.Print("\r" + line + "\u001B[K")
+}
+
+// describe returns ninja's description of a task, e.g. Compiling C object foo.p/src_main.c.o for /src/main.c.o
+func (bar *MesonProgressBar) describe(task string) string {
+	source, ok := strings.CutSuffix(task, ".o")
+	if !ok {
+		return "Generating " + task + " with a custom command"
+	}
+	language := "C"
+	switch path.Ext(source) {
+	case ".cpp", ".cc", ".cxx":
+		language = "C++"
+	}
+	target := MesonTarget{Kind: "executable", Name: bar.name()}
+	if len(bar.project.Targets) > 0 {
+		target = bar.project.Targets[0]
+	}
+	object := strings.ReplaceAll(strings.TrimLeft(source, "/"), "/", "_")
+	return fmt.Sprintf("Compiling %s object %s.p/%s.o", language, mesonOutput(target), object)
+}
+
+func (bar *MesonProgressBar) name() string {
+	if bar.project.Name == "" {
+		return "project"
+	}
+	return bar.project.Name
+}
+
+// mesonOutput returns the file built by a target, e.g. libfoo.so for shared_library('foo')
+func mesonOutput(target MesonTarget) string {
+	switch target.Kind {
+	case "static_library":
+		return "lib" + target.Name + ".a"
+	case "library", "shared_library", "both_libraries":
+		return "lib" + target.Name + ".so"
+	case "shared_module":
+		return target.Name + ".so"
+	default:
+		return target.Name
+	}
+}
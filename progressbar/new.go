@@ -0,0 +1,37 @@
+package progressbar
+
+import "fmt"
+
+// New creates a progress bar of given style: cxx, cargo, node, bundle (webpack), webpack, vite, pip, gradle, maven, bazel, meson, test, docker or latex
+func New(barType string) (ProgressBar, error) {
+	switch barType {
+	case "cxx":
+		return NewCMakeProgressBar(), nil
+	case "cargo":
+		return NewCargoProgressBar(), nil
+	case "node":
+		return NewNpmProgressBar(), nil
+	case "bundle", "webpack":
+		return NewWebpackProgressBar(), nil
+	case "vite":
+		return NewViteProgressBar(), nil
+	case "pip":
+		return NewPipProgressBar(), nil
+	case "gradle":
+		return NewGradleProgressBar(), nil
+	case "maven":
+		return NewMavenProgressBar(), nil
+	case "bazel":
+		return NewBazelProgressBar(), nil
+	case "meson":
+		return NewMesonProgressBar(), nil
+	case "test":
+		return NewTestProgressBar(), nil
+	case "docker":
+		return NewDockerProgressBar(), nil
+	case "latex":
+		return NewLatexProgressBar(), nil
+	default:
+		return nil, fmt.Errorf("unknown bar type %s", barType)
+	}
+}
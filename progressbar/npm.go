@@ -0,0 +1,271 @@
+package progressbar
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/util"
+	"golang.org/x/term"
+)
+
+// NpmProgressBar mimics the gauge and spinner of `npm install`, tasks are packages in the form of "name@version"
+type NpmProgressBar struct {
+	packages    []string
+	complete    int
+	onGoing     map[string][]time.Time // start time of installing packages
+	current     string                 // latest log line, shown after the spinner
+	projectName string
+	startTime   time.Time
+	frame       int
+	stop        chan struct{}
+	stopped     chan struct{}
+	lock        *sync.Mutex
+}
+
+var npmSpinner = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// well known deprecated packages, printed as `npm WARN deprecated` like npm does when resolving them
+var npmDeprecated = []struct {
+	name     string
+	maxMajor int // versions before it are deprecated, 0 for all versions
+	message  string
+}{
+	{"inflight", 0, "This module is not supported, and leaks memory. Do not use it. Check out lru-cache if you want a good and tested way to coalesce async requests by a key value, which is much more comprehensive and powerful."},
+	{"rimraf", 4, "Rimraf versions prior to v4 are no longer supported"},
+	{"glob", 9, "Glob versions prior to v9 are no longer supported"},
+	{"request", 0, "request has been deprecated, see https://github.com/request/request/issues/3142"},
+	{"uuid", 7, "Please upgrade  to version 7 or higher.  Older versions may use Math.random() in certain circumstances, which is known to be problematic.  See https://v8.dev/blog/math-random for details."},
+	{"sourcemap-codec", 0, "Please use @jridgewell/sourcemap-codec instead"},
+	{"@humanwhocodes/config-array", 0, "Use @eslint/config-array instead"},
+	{"@humanwhocodes/object-schema", 0, "Use @eslint/object-schema instead"},
+	{"abab", 0, "Use your platform's native atob() and btoa() methods instead"},
+	{"domexception", 0, "Use your platform's native DOMException instead"},
+	{"w3c-hr-time", 0, "Use your platform's native performance.now() and performance.timeOrigin."},
+}
+
+func NewNpmProgressBar() *NpmProgressBar {
+	return &NpmProgressBar{
+		onGoing: make(map[string][]time.Time),
+		lock:    new(sync.Mutex),
+	}
+}
+
+func (bar *NpmProgressBar) SetTotalTasks(tasks []string) {
+	bar.packages = tasks
+}
+
+// SetProjectName sets the name of the root package, shown while building the ideal tree
+func (bar *NpmProgressBar) SetProjectName(name string) {
+	bar.projectName = name
+}
+
+func (bar *NpmProgressBar) TaskStart(task string) {
+	bar.lock.Lock()
+	bar.onGoing[task] = append(bar.onGoing[task], time.Now())
+	name, version := splitNpmPackage(task)
+	bar.current = fmt.Sprintf("reify:%s: http fetch GET 200 %s", name, npmTarballURL(name, version))
+	bar.render()
+	bar.lock.Unlock()
+}
+
+func (bar *NpmProgressBar) TaskComplete(task string) {
+	bar.lock.Lock()
+	elapsed := time.Duration(0)
+	if starts := bar.onGoing[task]; len(starts) > 0 {
+		elapsed = time.Since(starts[0])
+		bar.onGoing[task] = starts[1:]
+		if len(bar.onGoing[task]) == 0 {
+			delete(bar.onGoing, task)
+		}
+	}
+	bar.complete++
+	name, _ := splitNpmPackage(task)
+	bar.current = fmt.Sprintf("reify:%s: timing reifyNode:node_modules/%s Completed in %dms", name, name, elapsed.Milliseconds())
+	bar.render()
+	bar.lock.Unlock()
+}
+
+func (bar *NpmProgressBar) Prologue() {
+	bar.startTime = time.Now()
+	bar.stop = make(chan struct{})
+	bar.stopped = make(chan struct{})
+	go bar.spin()
+
+	// resolve the ideal tree, deprecated packages are reported meanwhile
+	bar.setCurrent(fmt.Sprintf("idealTree:%s: sill idealTree buildDeps", bar.projectName))
+	var warnings []string
+	for _, task := range bar.packages {
+		name, version := splitNpmPackage(task)
+		for _, deprecated := range npmDeprecated {
+			if name != deprecated.name {
+				continue
+			}
+			major, err := strconv.Atoi(strings.Split(version, ".")[0])
+			if deprecated.maxMajor == 0 || (err == nil && major < deprecated.maxMajor) {
+				warnings = append(warnings, fmt.Sprintf("deprecated %s: %s", task, deprecated.message))
+			}
+		}
+	}
+	idealTree := time.Duration(util.GetRandomUniformDistribution(600, 1800)) * time.Millisecond
+	for _, warning := range warnings {
+		time.Sleep(idealTree / time.Duration(len(warnings)+1))
+		bar.lock.Lock()
+		fmt.Printf("\u001B[2Knpm \u001B[30;43mWARN\u001B[0m \u001B[35m%s\u001B[0m\n", warning)
+		bar.render()
+		bar.lock.Unlock()
+	}
+	time.Sleep(idealTree / time.Duration(len(warnings)+1))
+	bar.setCurrent(fmt.Sprintf("idealTree: timing idealTree Completed in %dms", time.Since(bar.startTime).Milliseconds()))
+	time.Sleep(time.Duration(util.GetRandomUniformDistribution(100, 300)) * time.Millisecond)
+}
+
+func (bar *NpmProgressBar) Epilogue() {
+	close(bar.stop)
+	<-bar.stopped
+	util.PrintSomethingAtBottom("") // clear progress bar at ending
+
+	added := len(bar.packages)
+	fmt.Printf("\u001B[2K\nadded %s, and audited %s in %s\n", npmPackages(added), npmPackages(added+1), npmDuration(time.Since(bar.startTime)))
+
+	if funding := added * rand.Intn(20) / 100; funding > 0 {
+		if funding == 1 {
+			fmt.Printf("\n1 package is looking for funding\n")
+		} else {
+			fmt.Printf("\n%d packages are looking for funding\n", funding)
+		}
+		fmt.Printf("  run `npm fund` for details\n")
+	}
+
+	severities := []struct {
+		name  string
+		color string
+		count int
+	}{
+		{"low", "", 0},
+		{"moderate", "\u001B[33m", 0},
+		{"high", "\u001B[31m", 0},
+		{"critical", "\u001B[35m", 0},
+	}
+	total := 0
+	var found []string // e.g. "3 moderate"
+	if rand.Intn(2) == 0 {
+		for i := range severities {
+			severity := &severities[i]
+			severity.count = rand.Intn(5 - i)
+			total += severity.count
+			if severity.count > 0 {
+				found = append(found, fmt.Sprintf("%d %s%s\u001B[0m", severity.count, severity.color, severity.name))
+			}
+		}
+	}
+	noun := "vulnerabilities"
+	if total == 1 {
+		noun = "vulnerability"
+	}
+	switch {
+	case total == 0:
+		fmt.Printf("\nfound \u001B[32m\u001B[1m0\u001B[0m vulnerabilities\n")
+		return
+	case len(found) == 1:
+		// e.g. 3 moderate severity vulnerabilities
+		fmt.Printf("\n%s severity %s\n", found[0], noun)
+	default:
+		// e.g. 8 vulnerabilities (2 low, 3 moderate, 2 high, 1 critical)
+		fmt.Printf("\n%d %s (%s)\n", total, noun, strings.Join(found, ", "))
+	}
+	if rand.Intn(2) == 0 {
+		fmt.Printf("\nTo address all issues, run:\n  npm audit fix\n")
+	} else {
+		fmt.Printf("\nTo address issues that do not require attention, run:\n  npm audit fix\n")
+		fmt.Printf("\nTo address all issues (including breaking changes), run:\n  npm audit fix --force\n")
+	}
+	fmt.Printf("\nRun `npm audit` for details.\n")
+}
+
+// spin redraws the spinner until Epilogue
+func (bar *NpmProgressBar) spin() {
+	ticker := time.NewTicker(80 * time.Millisecond)
+	defer ticker.Stop()
+	defer close(bar.stopped)
+	for {
+		select {
+		case <-bar.stop:
+			return
+		case <-ticker.C:
+			bar.lock.Lock()
+			bar.frame++
+			bar.render()
+			bar.lock.Unlock()
+		}
+	}
+}
+
+func (bar *NpmProgressBar) setCurrent(line string) {
+	bar.lock.Lock()
+	bar.current = line
+	bar.render()
+	bar.lock.Unlock()
+}
+
+func (bar *NpmProgressBar) render() {
+
+	// (##########⠂⠂⠂⠂⠂⠂⠂⠂) ⠙ reify:lodash: timing reifyNode:node_modules/lodash Completed in 12ms
+
+	width, _, err := term.GetSize(0)
+	if err != nil {
+		return
+	}
+	const gaugeWidth = 18
+	filled := 0
+	if len(bar.packages) > 0 {
+		filled = bar.complete * gaugeWidth / len(bar.packages)
+	}
+	gauge := "(" + strings.Repeat("#", filled) + strings.Repeat("⠂", gaugeWidth-filled) + ")"
+	content := []rune(fmt.Sprintf("%s %c %s", gauge, npmSpinner[bar.frame%len(npmSpinner)], bar.current))
+	if len(content) > width-1 {
+		content = content[:max(width-1, 0)]
+	}
+	util.PrintSomethingAtBottom(string(content))
+}
+
+// splitNpmPackage splits "name@version", the name may be scoped like "@babel/core"
+func splitNpmPackage(task string) (name, version string) {
+	i := strings.LastIndex(task, "@")
+	if i <= 0 {
+		return task, ""
+	}
+	return task[:i], task[i+1:]
+}
+
+// npmTarballURL returns the url of the tarball on the npm registry, e.g.
+// https://registry.npmjs.org/@babel/core/-/core-7.24.0.tgz
+func npmTarballURL(name, version string) string {
+	base := name[strings.LastIndex(name, "/")+1:]
+	return fmt.Sprintf("https://registry.npmjs.org/%s/-/%s-%s.tgz", name, base, version)
+}
+
+// npmDuration formats d like npm, e.g. 812ms, 38s, 2m
+func npmDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.0fs", d.Seconds())
+	case d < time.Hour:
+		return fmt.Sprintf("%.0fm", d.Minutes())
+	default:
+		return fmt.Sprintf("%.0fh", d.Hours())
+	}
+}
+
+// npmPackages returns e.g. "1 package", "2 packages"
+func npmPackages(n int) string {
+	if n == 1 {
+		return "1 package"
+	}
+	return strconv.Itoa(n) + " packages"
+}
@@ -0,0 +1,327 @@
+package progressbar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/util"
+	"golang.org/x/term"
+)
+
+// PipPackage is a package collected by pip
+type PipPackage struct {
+	Name        string
+	Version     string
+	Requirement string // shown after "Collecting", name==version if empty
+	From        string // what requires the package, e.g. requests==2.31.0->-r requirements.txt (line 4)
+	File        string // file name of the downloaded distribution, a sdist unless it ends with .whl
+	Size        int64
+}
+
+func (pack *PipPackage) String() string {
+	return pack.Name + "==" + pack.Version
+}
+
+func (pack *PipPackage) sdist() bool {
+	return !strings.HasSuffix(pack.File, ".whl")
+}
+
+// PipProgressBar mimics `pip install`, tasks are packages in the form of "name==version"
+//
+// a task starts by downloading the distribution, a sdist also prepares its metadata after TaskDownloaded,
+// then the download is printed when it completes. Sdists are built into wheels in Epilogue
+type PipProgressBar struct {
+	packages    map[string]*PipPackage
+	downloading map[string]time.Time // start time of ongoing downloads
+	downloaded  map[string]time.Duration
+	collected   []*PipPackage // in the order of completion
+	bytes       int64         // downloaded bytes and time, for the rate of ongoing downloads
+	elapsed     time.Duration
+	stop        chan struct{}
+	stopped     chan struct{}
+	lock        *sync.Mutex
+}
+
+const (
+	// assumed rate before any download completes, bytes per second
+	pipInitialRate = 5e6
+	pipBarWidth    = 40
+)
+
+var pipSpinner = []string{"-", "\\", "|", "/"}
+
+func NewPipProgressBar() *PipProgressBar {
+	return &PipProgressBar{
+		packages:    make(map[string]*PipPackage),
+		downloading: make(map[string]time.Time),
+		downloaded:  make(map[string]time.Duration),
+		lock:        new(sync.Mutex),
+	}
+}
+
+func (bar *PipProgressBar) SetTotalTasks(tasks []string) {
+	for _, task := range tasks {
+		if bar.packages[task] == nil {
+			bar.packages[task] = pipPackageOf(task)
+		}
+	}
+}
+
+// SetPackages sets details of packages, shown in the logs
+func (bar *PipProgressBar) SetPackages(packages []PipPackage) {
+	for _, pack := range packages {
+		bar.packages[pack.String()] = &pack
+	}
+}
+
+func (bar *PipProgressBar) TaskStart(task string) {
+	bar.lock.Lock()
+	bar.downloading[task] = time.Now()
+	bar.lock.Unlock()
+}
+
+// TaskDownloaded marks the end of downloading of task, a sdist then prepares its metadata
+func (bar *PipProgressBar) TaskDownloaded(task string) {
+	bar.lock.Lock()
+	bar.finishDownload(task)
+	bar.lock.Unlock()
+}
+
+func (bar *PipProgressBar) finishDownload(task string) {
+	start, ok := bar.downloading[task]
+	if !ok {
+		return
+	}
+	delete(bar.downloading, task)
+	elapsed := time.Since(start)
+	bar.downloaded[task] = elapsed
+	bar.bytes += bar.pack(task).Size
+	bar.elapsed += elapsed
+}
+
+func (bar *PipProgressBar) TaskComplete(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	bar.finishDownload(task)
+	pack := bar.pack(task)
+	bar.collected = append(bar.collected, pack)
+
+	requirement := pack.Requirement
+	if requirement == "" {
+		requirement = pack.String()
+	}
+	s := strings.Builder{}
+	s.WriteString("\u001B[2KCollecting " + requirement)
+	if pack.From != "" {
+		s.WriteString(" (from " + pack.From + ")")
+	}
+	fmt.Fprintf(&s, "\n  Downloading %s (%s)\n", pack.File, pipSize(pack.Size))
+	elapsed := max(bar.downloaded[task], time.Millisecond)
+	delete(bar.downloaded, task)
+	fmt.Fprintf(&s, "     %s\n", pipDownloadBar(pack.Size, pack.Size, float64(pack.Size)/elapsed.Seconds()))
+	if pack.sdist() {
+		s.WriteString("  Installing build dependencies ... done\n")
+		s.WriteString("  Getting requirements to build wheel ... done\n")
+		s.WriteString("  Preparing metadata (pyproject.toml) ... done\n")
+	}
+	fmt.Print(s.String())
+	bar.render()
+}
+
+func (bar *PipProgressBar) Prologue() {
+	bar.stop = make(chan struct{})
+	bar.stopped = make(chan struct{})
+	go bar.tick()
+}
+
+func (bar *PipProgressBar) Epilogue() {
+	close(bar.stop)
+	<-bar.stopped
+	util.PrintSomethingAtBottom("") // clear progress bar at ending
+
+	var sdists []*PipPackage
+	for _, pack := range bar.collected {
+		if pack.sdist() {
+			sdists = append(sdists, pack)
+		}
+	}
+	if len(sdists) > 0 {
+		var names []string
+		for _, pack := range sdists {
+			names = append(names, pack.Name)
+		}
+		fmt.Printf("Building wheels for collected packages: %s\n", strings.Join(names, ", "))
+		for _, pack := range sdists {
+			fmt.Printf("  Building wheel for %s (pyproject.toml) ... ", pack.Name)
+			// larger sdists carry more to compile
+			buildMs := max(util.GetRandomFromDistribution(800+float64(pack.Size)/2000, 300), 200)
+			for i := 0; float64(i)*125 < buildMs; i++ {
+				fmt.Print(pipSpinner[i%len(pipSpinner)] + "\b")
+				time.Sleep(125 * time.Millisecond)
+			}
+			fmt.Printf("done\n")
+			wheel := strings.ReplaceAll(pack.Name, "-", "_") + "-" + pack.Version + "-py3-none-any.whl"
+			sum := sha256.Sum256([]byte(wheel))
+			digest := hex.EncodeToString(sum[:])
+			fmt.Printf("  Created wheel for %s: filename=%s size=%d sha256=%s\n", pack.Name, wheel, pack.Size*13/10, digest)
+			fmt.Printf("  Stored in directory: /root/.cache/pip/wheels/%s/%s/%s\n", digest[:2], digest[2:4], digest[4:60])
+		}
+		fmt.Printf("Successfully built %s\n", strings.Join(names, " "))
+	}
+
+	// packages are collected from the top, and installed from the bottom
+	installed := slices.Clone(bar.collected)
+	slices.Reverse(installed)
+	var names []string
+	for _, pack := range installed {
+		names = append(names, pack.Name)
+	}
+	fmt.Printf("Installing collected packages: %s\n", strings.Join(names, ", "))
+	var totalSize int64
+	for _, pack := range installed {
+		totalSize += pack.Size
+	}
+	time.Sleep(time.Duration(float64(len(installed))*util.GetRandomUniformDistribution(20, 60)+float64(totalSize)/2e5) * time.Millisecond)
+
+	slices.SortFunc(installed, func(a, b *PipPackage) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	var versions []string
+	for _, pack := range installed {
+		versions = append(versions, pack.Name+"-"+pack.Version)
+	}
+	fmt.Printf("Successfully installed %s\n", strings.Join(versions, " "))
+}
+
+// tick redraws the ongoing download until Epilogue
+func (bar *PipProgressBar) tick() {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	defer close(bar.stopped)
+	for {
+		select {
+		case <-bar.stop:
+			return
+		case <-ticker.C:
+			bar.lock.Lock()
+			bar.render()
+			bar.lock.Unlock()
+		}
+	}
+}
+
+func (bar *PipProgressBar) render() {
+
+	// Downloading torch-2.4.1-cp312-cp312-manylinux1_x86_64.whl (797.1 MB) ━━━━━━━━━╸━━━━━━━━━━ 312.4/797.1 MB 11.2 MB/s eta 0:00:44
+
+	width, _, err := term.GetSize(0)
+	if err != nil {
+		return
+	}
+	if len(bar.downloading) == 0 {
+		util.PrintSomethingAtBottom("")
+		return
+	}
+	// the largest ongoing download is the one that is watched
+	var watched *PipPackage
+	var start time.Time
+	for task, t := range bar.downloading {
+		pack := bar.pack(task)
+		if watched == nil || pack.Size > watched.Size || (pack.Size == watched.Size && pack.Name < watched.Name) {
+			watched, start = pack, t
+		}
+	}
+	rate := float64(pipInitialRate)
+	if bar.elapsed > 0 {
+		rate = float64(bar.bytes) / bar.elapsed.Seconds()
+	}
+	done := min(int64(time.Since(start).Seconds()*rate), watched.Size*99/100)
+	// the file name is dropped if the line does not fit, the bar is about 40 columns wider than its numbers
+	prefix := fmt.Sprintf("Downloading %s (%s) ", watched.File, pipSize(watched.Size))
+	if len([]rune(prefix))+pipBarWidth+40 > width-1 {
+		prefix = ""
+	}
+	util.PrintSomethingAtBottom(prefix + pipDownloadBar(done, watched.Size, rate))
+}
+
+func (bar *PipProgressBar) pack(task string) *PipPackage {
+	pack, ok := bar.packages[task]
+	if !ok {
+		pack = pipPackageOf(task)
+		bar.packages[task] = pack
+	}
+	return pack
+}
+
+// pipPackageOf makes up the details of a package known only by its task name
+func pipPackageOf(task string) *PipPackage {
+	name, version, _ := strings.Cut(task, "==")
+	return &PipPackage{
+		Name:    name,
+		Version: version,
+		File:    strings.ReplaceAll(name, "-", "_") + "-" + version + "-py3-none-any.whl",
+		Size:    250e3,
+	}
+}
+
+// pipDownloadBar draws the download bar of pip, e.g.
+// ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━ 62.6/62.6 kB 4.1 MB/s eta 0:00:00
+func pipDownloadBar(done, total int64, rate float64) string {
+	s := strings.Builder{}
+	if done >= total {
+		s.WriteString("\u001B[38;2;114;156;31m" + strings.Repeat("━", pipBarWidth) + "\u001B[0m")
+	} else {
+		filled := int(float64(done) / float64(max(total, 1)) * pipBarWidth)
+		s.WriteString("\u001B[38;2;249;38;114m" + strings.Repeat("━", filled) + "╸\u001B[0m")
+		s.WriteString("\u001B[38;5;237m" + strings.Repeat("━", pipBarWidth-filled-1) + "\u001B[0m")
+	}
+	// the unit of done follows the unit of total
+	unit, scale := "bytes", 1.0
+	switch {
+	case total >= 1e9:
+		unit, scale = "GB", 1e9
+	case total >= 1e6:
+		unit, scale = "MB", 1e6
+	case total >= 1e3:
+		unit, scale = "kB", 1e3
+	}
+	fmt.Fprintf(&s, " \u001B[32m%.1f/%.1f %s\u001B[0m", float64(done)/scale, float64(total)/scale, unit)
+	fmt.Fprintf(&s, " \u001B[31m%s\u001B[0m", pipRate(rate))
+	eta := 0
+	if rate > 0 {
+		eta = int(math.Ceil(float64(total-done) / rate))
+	}
+	fmt.Fprintf(&s, " eta \u001B[36m%d:%02d:%02d\u001B[0m", eta/3600, eta/60%60, eta%60)
+	return s.String()
+}
+
+// pipSize formats size like pip, e.g. 512 bytes, 4.6 kB, 62 kB, 1.2 MB
+func pipSize(size int64) string {
+	switch {
+	case size > 1000*1000:
+		return fmt.Sprintf("%.1f MB", float64(size)/1000/1000)
+	case size > 10*1000:
+		return fmt.Sprintf("%d kB", size/1000)
+	case size > 1000:
+		return fmt.Sprintf("%.1f kB", float64(size)/1000)
+	default:
+		return fmt.Sprintf("%d bytes", size)
+	}
+}
+
+// pipRate formats transfer rate like rich, e.g. 4.1 MB/s
+func pipRate(rate float64) string {
+	units := []string{"bytes", "kB", "MB", "GB"}
+	i := 0
+	for rate >= 1000 && i < len(units)-1 {
+		rate /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.1f %s/s", rate, units[i])
+}
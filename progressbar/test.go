@@ -0,0 +1,263 @@
+package progressbar
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// TestProgressBar mimics a test runner run after the build: `cargo test`, `go test -v ./...`, `pytest` or `ctest`.
+// Tasks are tests, tasks of other compilers are reported as tests of cargo
+type TestProgressBar struct {
+	runner  string
+	project string
+	tests   map[string]*testState // by task
+	suites  []*testSuiteState
+	failed  []*testState // in the order they failed
+	begin   time.Time
+	width   int
+
+	// pytest writes outcomes of a file on a line
+	line   *testSuiteState // suite of the current line
+	column int
+	done   int
+	lock   *sync.Mutex
+}
+
+// TestCase is a test discovered from the sources
+type TestCase struct {
+	Task    string // the task of the test
+	Name    string // as reported by the runner, e.g. net::tests::parse, TestParse, tests/test_api.py::test_get
+	Suite   string // cargo: source of the target like src/lib.rs, go: import path, pytest: file, ctest: empty
+	Package string // cargo: package of the target
+	File    string
+	Line    int
+	Ignored bool
+}
+
+type testState struct {
+	TestCase
+	suite   *testSuiteState
+	index   int // 1-based, in the order of all tests
+	start   time.Time
+	elapsed time.Duration
+	started bool
+	failed  bool
+}
+
+type testSuiteState struct {
+	name    string
+	pkg     string
+	tests   []*testState
+	start   time.Time
+	started bool
+	done    int
+	failed  int
+	ignored int
+	output  []string // go prints the output of a package once it is done
+}
+
+func NewTestProgressBar() *TestProgressBar {
+	return &TestProgressBar{
+		runner: "cargo",
+		tests:  make(map[string]*testState),
+		lock:   new(sync.Mutex),
+	}
+}
+
+// SetTotalTasks makes every task a test of a single suite, until tests are set by SetTests
+func (bar *TestProgressBar) SetTotalTasks(tasks []string) {
+	var tests []TestCase
+	for _, task := range tasks {
+		tests = append(tests, TestCase{Task: task, Name: task, Suite: "src/lib.rs"})
+	}
+	bar.SetTests("cargo", "", tests)
+}
+
+// SetTests sets the runner whose output is mimicked: cargo, go, pytest or ctest, the name of the project,
+// and tests listed by suite in the order they are reported
+func (bar *TestProgressBar) SetTests(runner, project string, tests []TestCase) {
+	bar.runner = runner
+	bar.project = project
+	bar.tests = make(map[string]*testState)
+	bar.suites = nil
+	for i, test := range tests {
+		if len(bar.suites) == 0 || bar.suites[len(bar.suites)-1].name != test.Suite || bar.suites[len(bar.suites)-1].pkg != test.Package {
+			bar.suites = append(bar.suites, &testSuiteState{name: test.Suite, pkg: test.Package})
+		}
+		suite := bar.suites[len(bar.suites)-1]
+		state := &testState{TestCase: test, suite: suite, index: i + 1}
+		suite.tests = append(suite.tests, state)
+		bar.tests[test.Task] = state
+	}
+}
+
+// TestFailed marks a running test as failed, it is reported so when the task completes
+func (bar *TestProgressBar) TestFailed(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	if test, ok := bar.tests[task]; ok {
+		test.failed = true
+	}
+}
+
+func (bar *TestProgressBar) TaskStart(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	test := bar.test(task)
+	test.start = time.Now()
+	test.started = true
+	bar.suiteStart(test.suite)
+	if bar.runner == "ctest" {
+		bar.ctestStart(test)
+	}
+}
+
+func (bar *TestProgressBar) TaskComplete(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	test := bar.test(task)
+	if test.started {
+		test.elapsed = time.Since(test.start)
+	}
+	bar.complete(test)
+}
+
+// TaskFresh reports an ignored test, which never runs
+func (bar *TestProgressBar) TaskFresh(task string) {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	test := bar.test(task)
+	test.Ignored = true
+	bar.suiteStart(test.suite)
+	bar.complete(test)
+}
+
+func (bar *TestProgressBar) Prologue() {
+	bar.begin = time.Now()
+	bar.width = 80
+	if width, _, err := term.GetSize(0); err == nil && width > 0 {
+		bar.width = width
+	}
+	switch bar.runner {
+	case "cargo":
+		fmt.Printf("%s `test` profile [unoptimized + debuginfo] target(s) in %.2fs\n", cargoStatus("Finished"), 0.05+0.3*rand.Float64())
+	case "pytest":
+		fmt.Println(pytestSep("=", "\u001B[1mtest session starts\u001B[0m", len("test session starts"), bar.width))
+		fmt.Println("platform linux -- Python 3.12.3, pytest-8.3.2, pluggy-1.5.0")
+		fmt.Println("rootdir: " + cwd(bar.project))
+		fmt.Printf("\u001B[1mcollected %d items\u001B[0m\n\n", len(bar.tests))
+	case "ctest":
+		fmt.Println("Test project " + filepath.Join(cwd(bar.project), "build"))
+	}
+}
+
+func (bar *TestProgressBar) Epilogue() {
+	bar.lock.Lock()
+	defer bar.lock.Unlock()
+	switch bar.runner {
+	case "cargo":
+		bar.cargoSummary()
+	case "go":
+		bar.goSummary()
+	case "pytest":
+		bar.pytestSummary()
+	case "ctest":
+		bar.ctestSummary()
+	}
+}
+
+// test returns the test of a task, a task that is not a test is added to the last suite
+func (bar *TestProgressBar) test(task string) *testState {
+	test, ok := bar.tests[task]
+	if !ok {
+		if len(bar.suites) == 0 {
+			bar.suites = append(bar.suites, &testSuiteState{name: "src/lib.rs"})
+		}
+		suite := bar.suites[len(bar.suites)-1]
+		test = &testState{TestCase: TestCase{Task: task, Name: task, Suite: suite.name}, suite: suite, index: len(bar.tests) + 1}
+		suite.tests = append(suite.tests, test)
+		bar.tests[task] = test
+	}
+	return test
+}
+
+func (bar *TestProgressBar) suiteStart(suite *testSuiteState) {
+	if suite.started {
+		return
+	}
+	suite.started = true
+	suite.start = time.Now()
+	if bar.runner == "cargo" {
+		bar.cargoSuiteStart(suite)
+	}
+}
+
+func (bar *TestProgressBar) complete(test *testState) {
+	suite := test.suite
+	suite.done++
+	bar.done++
+	switch {
+	case test.Ignored:
+		suite.ignored++
+	case test.failed:
+		suite.failed++
+		bar.failed = append(bar.failed, test)
+	}
+	switch bar.runner {
+	case "cargo":
+		bar.cargoComplete(test)
+	case "go":
+		bar.goComplete(test)
+	case "pytest":
+		bar.pytestComplete(test)
+	case "ctest":
+		bar.ctestComplete(test)
+	}
+}
+
+// cwd returns the working directory, where the tests are supposed to run
+func cwd(project string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		if project == "" {
+			project = "project"
+		}
+		return "/tmp/" + project
+	}
+	return dir
+}
+
+// seconds formats a duration in seconds with given decimals, e.g. 0.02s
+func seconds(d time.Duration, decimals int) string {
+	return fmt.Sprintf("%.*fs", decimals, d.Seconds())
+}
+
+// sortedFailures returns failed tests in the order they are reported
+func (bar *TestProgressBar) sortedFailures() []*testState {
+	failed := slices.Clone(bar.failed)
+	slices.SortStableFunc(failed, func(a, b *testState) int {
+		return a.index - b.index
+	})
+	return failed
+}
+
+// shortName returns the name of a test without the file of pytest, e.g. TestUser.test_get
+func (test *testState) shortName() string {
+	if _, after, ok := strings.Cut(test.Name, "::"); ok && test.Suite != "" && strings.HasPrefix(test.Name, test.Suite+"::") {
+		return strings.ReplaceAll(after, "::", ".")
+	}
+	return test.Name
+}
+
+// line returns the line where the test is defined, failures are reported there, 1 if it is unknown
+func (test *testState) line() int {
+	return max(test.Line, 1)
+}
@@ -0,0 +1,430 @@
+package progressbar
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cargoStatus right-aligns a status of cargo in 12 columns, e.g. "     Running"
+func cargoStatus(status string) string {
+	return strings.Repeat(" ", max(12-len(status), 0)) + "\u001B[1;32m" + status + "\u001B[0m"
+}
+
+// cargoCrate returns the crate of the test binary of a suite, e.g. foo_bar for the library of foo-bar, api for tests/api.rs
+func (bar *TestProgressBar) cargoCrate(suite *testSuiteState) string {
+	name := suite.pkg
+	switch {
+	case strings.HasPrefix(suite.name, "tests/"), strings.HasPrefix(suite.name, "src/bin/") && strings.Count(suite.name, "/") == 2:
+		name = strings.TrimSuffix(path.Base(suite.name), ".rs")
+	case strings.HasPrefix(suite.name, "src/bin/"):
+		name = path.Base(path.Dir(suite.name))
+	}
+	if name == "" {
+		name = bar.project
+	}
+	if name == "" {
+		name = "project"
+	}
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+func (bar *TestProgressBar) cargoSuiteStart(suite *testSuiteState) {
+	crate := bar.cargoCrate(suite)
+	h := fnv.New64a()
+	h.Write([]byte(suite.pkg + "/" + suite.name))
+	target := suite.name
+	if !strings.HasPrefix(suite.name, "tests/") {
+		target = "unittests " + suite.name
+	}
+	fmt.Printf("%s %s (target/debug/deps/%s-%016x)\n\n", cargoStatus("Running"), target, crate, h.Sum64())
+	fmt.Printf("running %d %s\n", len(suite.tests), plural(len(suite.tests), "test"))
+}
+
+func (bar *TestProgressBar) cargoComplete(test *testState) {
+	status := "\u001B[32mok\u001B[0m"
+	switch {
+	case test.Ignored:
+		status = "\u001B[33mignored\u001B[0m"
+	case test.failed:
+		status = "\u001B[31mFAILED\u001B[0m"
+	}
+	fmt.Printf("test %s ... %s\n", test.Name, status)
+
+	suite := test.suite
+	if suite.done < len(suite.tests) {
+		return
+	}
+	result := "\u001B[32mok\u001B[0m"
+	if suite.failed > 0 {
+		result = "\u001B[31mFAILED\u001B[0m"
+		fmt.Print("\nfailures:\n\n")
+		var names []string
+		for _, failed := range bar.sortedFailures() {
+			if failed.suite != suite {
+				continue
+			}
+			names = append(names, failed.Name)
+			fmt.Printf("---- %s stdout ----\n", failed.Name)
+			for _, line := range cargoPanic(failed) {
+				fmt.Println(line)
+			}
+			if len(names) == 1 {
+				fmt.Println("note: run with `RUST_BACKTRACE=1` environment variable to display a backtrace")
+			}
+			fmt.Println()
+		}
+		fmt.Print("\nfailures:\n")
+		for _, name := range names {
+			fmt.Println("    " + name)
+		}
+	}
+	passed := suite.done - suite.failed - suite.ignored
+	fmt.Printf("\ntest result: %s. %d passed; %d failed; %d ignored; 0 measured; 0 filtered out; finished in %s\n\n",
+		result, passed, suite.failed, suite.ignored, seconds(time.Since(suite.start), 2))
+}
+
+// cargoPanic returns what a failed test prints, the message of its panic
+func cargoPanic(test *testState) []string {
+	file := test.File
+	if file == "" {
+		file = test.Suite
+	}
+	lines := []string{fmt.Sprintf("thread '%s' panicked at %s:%d:5:", test.Name, file, test.line())}
+	switch test.index % 3 {
+	case 0:
+		return append(lines, "assertion `left == right` failed", fmt.Sprintf("  left: %d", test.index%7), fmt.Sprintf(" right: %d", test.index%7+1))
+	case 1:
+		return append(lines, "called `Result::unwrap()` on an `Err` value: Os { code: 111, kind: ConnectionRefused, message: \"Connection refused\" }")
+	default:
+		return append(lines, "assertion failed: parsed.is_ok()")
+	}
+}
+
+// cargoSummary tells how to rerun the first suite with failed tests, cargo does not run the others,
+// otherwise runs doc tests of libraries
+func (bar *TestProgressBar) cargoSummary() {
+	packages := make(map[string]bool)
+	for _, suite := range bar.suites {
+		packages[suite.pkg] = true
+	}
+	for _, suite := range bar.suites {
+		if suite.failed == 0 {
+			continue
+		}
+		rerun := "--lib"
+		switch {
+		case strings.HasPrefix(suite.name, "tests/"):
+			rerun = "--test " + bar.cargoCrate(suite)
+		case suite.name != "src/lib.rs":
+			rerun = "--bin " + bar.cargoCrate(suite)
+		}
+		if len(packages) > 1 {
+			rerun = "-p " + suite.pkg + " " + rerun
+		}
+		fmt.Fprintf(os.Stderr, "\u001B[1;31merror\u001B[0m: test failed, to rerun pass `%s`\n", rerun)
+		return
+	}
+	for _, suite := range bar.suites {
+		if suite.name != "src/lib.rs" {
+			continue
+		}
+		fmt.Printf("%s %s\n\n", cargoStatus("Doc-tests"), bar.cargoCrate(suite))
+		fmt.Print("running 0 tests\n\n")
+		fmt.Print("test result: \u001B[32mok\u001B[0m. 0 passed; 0 failed; 0 ignored; 0 measured; 0 filtered out; finished in 0.00s\n\n")
+	}
+}
+
+// goComplete buffers the output of a test, the output of a package is printed once all of its tests are done,
+// like `go test -v` does for several packages
+func (bar *TestProgressBar) goComplete(test *testState) {
+	suite := test.suite
+	suite.output = append(suite.output, "=== RUN   "+test.Name)
+	switch {
+	case test.Ignored:
+		suite.output = append(suite.output, fmt.Sprintf("    %s: skipped", goLocation(test)), fmt.Sprintf("--- SKIP: %s (0.00s)", test.Name))
+	case test.failed:
+		suite.output = append(suite.output, "    "+goFailure(test), fmt.Sprintf("--- FAIL: %s (%s)", test.Name, seconds(test.elapsed, 2)))
+	default:
+		suite.output = append(suite.output, fmt.Sprintf("--- PASS: %s (%s)", test.Name, seconds(test.elapsed, 2)))
+	}
+	if suite.done < len(suite.tests) {
+		return
+	}
+	// the test binary is started before its first test, and exits after the last one
+	elapsed := seconds(time.Since(suite.start)+time.Duration(3+test.index%12)*time.Millisecond, 3)
+	if suite.failed > 0 {
+		suite.output = append(suite.output, "FAIL", fmt.Sprintf("FAIL\t%s\t%s", suite.name, elapsed))
+	} else {
+		suite.output = append(suite.output, "PASS", fmt.Sprintf("ok  \t%s\t%s", suite.name, elapsed))
+	}
+	for _, line := range suite.output {
+		fmt.Println(line)
+	}
+	suite.output = nil
+}
+
+// goLocation returns the position where a test reports, e.g. parse_test.go:42
+func goLocation(test *testState) string {
+	file := path.Base(test.File)
+	if test.File == "" {
+		file = "main_test.go"
+	}
+	return file + ":" + strconv.Itoa(test.line())
+}
+
+// goFailure returns what a failed test reports by t.Errorf or t.Fatalf
+func goFailure(test *testState) string {
+	switch test.index % 3 {
+	case 0:
+		return fmt.Sprintf("%s: got %d, want %d", goLocation(test), test.index%7, test.index%7+1)
+	case 1:
+		return fmt.Sprintf("%s: unexpected error: context deadline exceeded", goLocation(test))
+	default:
+		return fmt.Sprintf("%s: result mismatch (-want +got):\n          strings.Join({\n        - \t\"ok\",\n        + \t\"error\",\n          }, \"\")", goLocation(test))
+	}
+}
+
+// goSummary ends the output with FAIL if any package failed
+func (bar *TestProgressBar) goSummary() {
+	if len(bar.failed) > 0 {
+		fmt.Println("FAIL")
+	}
+}
+
+// pytestSep returns a line of width filled by sep with the title in the middle, whose visible length is given
+func pytestSep(sep, title string, visible, width int) string {
+	if title == "" {
+		return strings.Repeat(sep, width)
+	}
+	n := max((width-visible-2)/2, 1)
+	line := strings.Repeat(sep, n) + " " + title + " " + strings.Repeat(sep, n)
+	if 2*n+visible+3 <= width {
+		line += sep
+	}
+	return line
+}
+
+// pytestColor is the color of progress and the summary: red with failures, yellow with skipped tests, green otherwise
+func (bar *TestProgressBar) pytestColor() string {
+	skipped := false
+	for _, suite := range bar.suites {
+		skipped = skipped || suite.ignored > 0
+	}
+	switch {
+	case len(bar.failed) > 0:
+		return "\u001B[31m"
+	case skipped:
+		return "\u001B[33m"
+	default:
+		return "\u001B[32m"
+	}
+}
+
+// pytestComplete writes the outcome of a test after the file of it, the progress is written at the end of line
+func (bar *TestProgressBar) pytestComplete(test *testState) {
+	suite := test.suite
+	if bar.line != suite {
+		if bar.line != nil {
+			bar.pytestProgress()
+		}
+		name := suite.name
+		if name == "" {
+			name = "tests"
+		}
+		fmt.Print(name + " ")
+		bar.line = suite
+		bar.column = len(name) + 1
+	}
+	if bar.column+len(" [100%]") >= bar.width {
+		bar.pytestProgress()
+		bar.line = suite
+	}
+	switch {
+	case test.Ignored:
+		fmt.Print("\u001B[33ms\u001B[0m")
+	case test.failed:
+		fmt.Print("\u001B[31mF\u001B[0m")
+	default:
+		fmt.Print("\u001B[32m.\u001B[0m")
+	}
+	bar.column++
+	if suite.done == len(suite.tests) {
+		bar.pytestProgress()
+	}
+}
+
+func (bar *TestProgressBar) pytestProgress() {
+	progress := fmt.Sprintf("[%3d%%]", bar.done*100/max(len(bar.tests), 1))
+	fmt.Print(strings.Repeat(" ", max(bar.width-bar.column-len(progress), 1)) + bar.pytestColor() + progress + "\u001B[0m\n")
+	bar.line = nil
+	bar.column = 0
+}
+
+// pytestFailure returns the traceback of a failed test, and the short message of the error
+func pytestFailure(test *testState) ([]string, string) {
+	name := test.shortName()
+	args := ""
+	if strings.Contains(name, ".") {
+		args = "self"
+		name = name[strings.LastIndex(name, ".")+1:]
+	}
+	lines := []string{fmt.Sprintf("    def %s(%s):", name, args)}
+	var error string
+	switch test.index % 3 {
+	case 0:
+		lines = append(lines, "        result = compute(3)", ">       assert result == expected", "E       assert 3 == 4")
+		error = "AssertionError"
+	case 1:
+		lines = append(lines, "        response = client.get(\"/api/items\")", ">       assert response.status_code == 200",
+			"E       assert 404 == 200", "E        +  where 404 = <Response [404]>.status_code")
+		error = "AssertionError"
+	default:
+		lines = append(lines, "        payload = load_fixture(\"item.json\")", ">       assert payload[\"id\"] == 1", "E       KeyError: 'id'")
+		error = "KeyError"
+	}
+	var message string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "E ") && message == "" {
+			message = strings.TrimSpace(strings.TrimPrefix(line, "E"))
+		}
+	}
+	file := test.File
+	if file == "" {
+		file = test.Suite
+	}
+	lines = append(lines, "", fmt.Sprintf("\u001B[1;31m%s\u001B[0m:%d: %s", file, test.line(), error))
+	return lines, message
+}
+
+// pytestSummary writes tracebacks of failed tests and the summary line
+func (bar *TestProgressBar) pytestSummary() {
+	if bar.line != nil {
+		bar.pytestProgress()
+	}
+	fmt.Println()
+	failed := bar.sortedFailures()
+	if len(failed) > 0 {
+		fmt.Println(pytestSep("=", "FAILURES", len("FAILURES"), bar.width))
+		var short []string
+		for _, test := range failed {
+			name := test.shortName()
+			fmt.Println("\u001B[1;31m" + pytestSep("_", name, len(name), bar.width) + "\u001B[0m")
+			fmt.Println()
+			lines, message := pytestFailure(test)
+			for _, line := range lines {
+				fmt.Println(line)
+			}
+			short = append(short, fmt.Sprintf("\u001B[31mFAILED\u001B[0m %s - %s", test.Name, message))
+		}
+		title := "short test summary info"
+		fmt.Println("\u001B[36m" + pytestSep("=", title, len(title), bar.width) + "\u001B[0m")
+		for _, line := range short {
+			fmt.Println(line)
+		}
+	}
+
+	var counts []string
+	if len(failed) > 0 {
+		counts = append(counts, fmt.Sprintf("%d failed", len(failed)))
+	}
+	skipped := 0
+	for _, suite := range bar.suites {
+		skipped += suite.ignored
+	}
+	if passed := bar.done - len(failed) - skipped; passed > 0 {
+		counts = append(counts, fmt.Sprintf("%d passed", passed))
+	}
+	if skipped > 0 {
+		counts = append(counts, fmt.Sprintf("%d skipped", skipped))
+	}
+	if len(counts) == 0 {
+		counts = append(counts, "no tests ran")
+	}
+	elapsed := time.Since(bar.begin)
+	title := strings.Join(counts, ", ") + " in " + seconds(elapsed, 2)
+	if elapsed >= time.Minute {
+		s := int(elapsed.Seconds())
+		title += fmt.Sprintf(" (%d:%02d:%02d)", s/3600, s/60%60, s%60)
+	}
+	fmt.Println(bar.pytestColor() + pytestSep("=", "\u001B[1m"+title+"\u001B[22m", len(title), bar.width) + "\u001B[0m")
+}
+
+// ctestWidths returns the width of test numbers, and that of test names filled by dots
+func (bar *TestProgressBar) ctestWidths() (int, int) {
+	name := 30
+	for task := range bar.tests {
+		name = max(name, len(bar.tests[task].Name))
+	}
+	return len(strconv.Itoa(len(bar.tests))), name + 4
+}
+
+func (bar *TestProgressBar) ctestStart(test *testState) {
+	number, _ := bar.ctestWidths()
+	fmt.Printf("%sStart %*d: %s\n", strings.Repeat(" ", 2*number+2), number, test.index, test.Name)
+}
+
+func (bar *TestProgressBar) ctestComplete(test *testState) {
+	number, name := bar.ctestWidths()
+	dots := test.Name + " "
+	dots += strings.Repeat(".", max(name-len(dots), 0))
+	status := "   Passed"
+	switch {
+	case test.Ignored:
+		status = "***Not Run (Disabled)"
+	case test.failed:
+		status = "***Failed"
+	}
+	fmt.Printf("%*d/%d Test %*s: %s%s %7.2f sec\n", number, bar.done, len(bar.tests), number+1, "#"+strconv.Itoa(test.index), dots, status, test.elapsed.Seconds())
+}
+
+// ctestSummary reports the percentage of passed tests, and lists tests that failed or did not run
+func (bar *TestProgressBar) ctestSummary() {
+	var disabled []*testState
+	for _, suite := range bar.suites {
+		for _, test := range suite.tests {
+			if test.Ignored {
+				disabled = append(disabled, test)
+			}
+		}
+	}
+	total := len(bar.tests) - len(disabled)
+	failed := bar.sortedFailures()
+	percent := 100.0
+	if total > 0 {
+		percent = math.Round(float64(total-len(failed)) * 100 / float64(total))
+	}
+	if len(failed) > 0 && percent > 99 {
+		percent = 99
+	}
+	fmt.Printf("\n%.0f%% tests passed, %d tests failed out of %d\n\n", percent, len(failed), total)
+	fmt.Printf("Total Test time (real) = %7.2f sec\n", time.Since(bar.begin).Seconds())
+	if len(disabled) > 0 {
+		fmt.Print("\nThe following tests did not run:\n")
+		for _, test := range disabled {
+			fmt.Printf("\t%3d - %s (Disabled)\n", test.index, test.Name)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Print("\nThe following tests FAILED:\n")
+		for _, test := range failed {
+			fmt.Printf("\t%3d - %s (Failed)\n", test.index, test.Name)
+		}
+		fmt.Fprintln(os.Stderr, "Errors while running CTest")
+		fmt.Println("Output from these tests are in: " + filepath.Join(cwd(bar.project), "build/Testing/Temporary/LastTest.log"))
+		fmt.Println("Use \"--rerun-failed --output-on-failure\" to re-run the failed cases verbosely.")
+	}
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
@@ -0,0 +1,174 @@
+package progressbar
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/util"
+	"golang.org/x/term"
+)
+
+// ViteProgressBar mimics `vite build`, tasks are module paths like src/components/Button.vue
+type ViteProgressBar struct {
+	complete  int
+	current   string // latest started module
+	modules   []Module
+	startTime time.Time
+	lock      *sync.Mutex
+}
+
+const viteVersion = "5.4.8"
+
+// chunks larger than it are warned about, 500 kB
+const viteChunkSizeLimit = 500 * 1000
+
+func NewViteProgressBar() *ViteProgressBar {
+	return &ViteProgressBar{
+		lock: new(sync.Mutex),
+	}
+}
+
+func (bar *ViteProgressBar) SetTotalTasks(tasks []string) {
+	// vite does not know the number of modules in advance, only transformed ones are counted
+}
+
+func (bar *ViteProgressBar) SetModules(modules []Module) {
+	bar.modules = modules
+}
+
+func (bar *ViteProgressBar) TaskStart(task string) {
+	bar.lock.Lock()
+	bar.current = task
+	bar.render(fmt.Sprintf("transforming (%d) %s", bar.complete, bar.current))
+	bar.lock.Unlock()
+}
+
+func (bar *ViteProgressBar) TaskComplete(task string) {
+	bar.lock.Lock()
+	bar.complete++
+	bar.render(fmt.Sprintf("transforming (%d) %s", bar.complete, bar.current))
+	bar.lock.Unlock()
+}
+
+func (bar *ViteProgressBar) Prologue() {
+	bar.startTime = time.Now()
+	fmt.Printf("\u001B[36mvite v%s \u001B[32mbuilding for production...\u001B[39m\n", viteVersion)
+	time.Sleep(time.Duration(util.GetRandomUniformDistribution(100, 300)) * time.Millisecond)
+}
+
+func (bar *ViteProgressBar) Epilogue() {
+	util.PrintSomethingAtBottom("") // clear progress bar at ending
+	fmt.Printf("\u001B[32m✓\u001B[39m %d modules transformed.\n", bar.complete)
+
+	chunks := splitChunks(bar.modules)
+	for i := range chunks {
+		bar.render(fmt.Sprintf("rendering chunks (%d)...", i+1))
+		time.Sleep(time.Duration(util.GetRandomUniformDistribution(20, 60)) * time.Millisecond)
+	}
+	for i := range chunks {
+		bar.render(fmt.Sprintf("computing gzip size (%d)...", i+1))
+		time.Sleep(time.Duration(util.GetRandomUniformDistribution(5, 20)) * time.Millisecond)
+	}
+	util.PrintSomethingAtBottom("")
+
+	type asset struct {
+		name  string
+		size  int64
+		gzip  int64
+		color string
+	}
+	var styles, scripts []asset
+	for i, c := range chunks {
+		name := c.name
+		if i == 0 {
+			name = "index"
+		}
+		scripts = append(scripts, asset{
+			name:  "dist/assets/" + name + "-" + c.contentHash(name, true) + ".js",
+			size:  c.minifiedScripts(),
+			gzip:  gzipScripts(c.minifiedScripts()),
+			color: "\u001B[36m",
+		})
+		if c.styles > 0 {
+			styles = append(styles, asset{
+				name:  "dist/assets/" + name + "-" + c.contentHash(name+".css", true) + ".css",
+				size:  c.minifiedStyles(),
+				gzip:  gzipStyles(c.minifiedStyles()),
+				color: "\u001B[35m",
+			})
+		}
+	}
+	// like vite, each group is sorted by size, and html comes first
+	bySize := func(a, b asset) int {
+		return int(a.size - b.size)
+	}
+	slices.SortStableFunc(styles, bySize)
+	slices.SortStableFunc(scripts, bySize)
+	assets := []asset{{name: "dist/index.html", size: 460, gzip: 300, color: "\u001B[32m"}}
+	assets = append(assets, styles...)
+	assets = append(assets, scripts...)
+
+	nameWidth, sizeWidth := 0, 0
+	for _, a := range assets {
+		nameWidth = max(nameWidth, len(a.name))
+		sizeWidth = max(sizeWidth, len(viteSize(a.size)))
+	}
+	var big []asset
+	for _, a := range assets {
+		dir, file := a.name[:strings.LastIndex(a.name, "/")+1], a.name[strings.LastIndex(a.name, "/")+1:]
+		size := fmt.Sprintf("%*s", sizeWidth, viteSize(a.size))
+		if a.size > viteChunkSizeLimit {
+			big = append(big, a)
+			size = "\u001B[33m\u001B[1m" + size + "\u001B[22m\u001B[39m"
+		} else {
+			size = "\u001B[1m\u001B[2m" + size + "\u001B[22m"
+		}
+		fmt.Printf("\u001B[2m%s\u001B[22m%s%s%s\u001B[39m  %s kB\u001B[2m │ gzip: %s kB\u001B[22m\n",
+			dir, a.color, file, strings.Repeat(" ", nameWidth-len(a.name)), size, viteSize(a.gzip))
+	}
+	if len(big) > 0 {
+		fmt.Printf("\u001B[33m\n(!) Some chunks are larger than 500 kB after minification. Consider:\n" +
+			"- Using dynamic import() to code-split the application\n" +
+			"- Use build.rollupOptions.output.manualChunks to improve chunking: https://rollupjs.org/configuration-options/#output-manualchunks\n" +
+			"- Adjust chunk size limit for this warning via build.chunkSizeWarningLimit.\u001B[39m\n")
+	}
+	fmt.Printf("\u001B[32m✓ built in %s\u001B[39m\n", viteDuration(time.Since(bar.startTime)))
+}
+
+func (bar *ViteProgressBar) render(message string) {
+	width, _, err := term.GetSize(0)
+	if err != nil {
+		return
+	}
+	content := []rune(message)
+	if len(content) > width-1 {
+		content = content[:max(width-1, 0)]
+	}
+	util.PrintSomethingAtBottom(string(content))
+}
+
+// viteSize formats size in kB like vite, e.g. 0.46, 1,234.56
+func viteSize(size int64) string {
+	s := strconv.FormatFloat(float64(size)/1000, 'f', 2, 64)
+	integer, fraction, _ := strings.Cut(s, ".")
+	for i := len(integer) - 3; i > 0; i -= 3 {
+		integer = integer[:i] + "," + integer[i:]
+	}
+	return integer + "." + fraction
+}
+
+// viteDuration formats d like vite, e.g. 850ms, 12.34s, 1m 5s
+func viteDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	default:
+		return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+}
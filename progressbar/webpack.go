@@ -0,0 +1,297 @@
+package progressbar
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rizutazu/fake-compiler/util"
+	"golang.org/x/term"
+)
+
+// WebpackProgressBar mimics `webpack --progress`, tasks are module paths like src/components/Button.tsx
+type WebpackProgressBar struct {
+	tasks     int
+	complete  int
+	active    int
+	current   string // latest started module
+	modules   []Module
+	startTime time.Time
+	lock      *sync.Mutex
+}
+
+const webpackVersion = "5.94.0"
+
+// assets and entrypoints larger than it are [big], 244 KiB
+const webpackSizeLimit = 250000
+
+func NewWebpackProgressBar() *WebpackProgressBar {
+	return &WebpackProgressBar{
+		lock: new(sync.Mutex),
+	}
+}
+
+func (bar *WebpackProgressBar) SetTotalTasks(tasks []string) {
+	bar.tasks = len(tasks)
+}
+
+func (bar *WebpackProgressBar) SetModules(modules []Module) {
+	bar.modules = modules
+}
+
+func (bar *WebpackProgressBar) TaskStart(task string) {
+	bar.lock.Lock()
+	bar.active++
+	bar.current = task
+	bar.renderBuilding()
+	bar.lock.Unlock()
+}
+
+func (bar *WebpackProgressBar) TaskComplete(task string) {
+	bar.lock.Lock()
+	bar.active--
+	bar.complete++
+	bar.renderBuilding()
+	bar.lock.Unlock()
+}
+
+func (bar *WebpackProgressBar) Prologue() {
+	bar.startTime = time.Now()
+	bar.render("0% compiling")
+	time.Sleep(time.Duration(util.GetRandomUniformDistribution(100, 300)) * time.Millisecond)
+	bar.render("10% building 0/1 entries 0/0 dependencies 0/0 modules")
+	time.Sleep(time.Duration(util.GetRandomUniformDistribution(100, 300)) * time.Millisecond)
+}
+
+func (bar *WebpackProgressBar) Epilogue() {
+	chunks := splitChunks(bar.modules)
+	var minified int64
+	for _, c := range chunks {
+		minified += c.minifiedScripts()
+	}
+
+	// webpack spends most of the sealing time on minification
+	phases := []struct {
+		message string
+		ms      float64
+	}{
+		{"69% building dependencies", 50},
+		{"70% sealing finish module graph", 80},
+		{"71% sealing plugins", 30},
+		{"72% sealing dependencies optimization", 60},
+		{"75% sealing chunk graph", 80},
+		{"78% sealing module optimization", 60},
+		{"80% sealing chunk optimization", 40},
+		{"83% sealing module ids", 30},
+		{"85% sealing chunk ids", 30},
+		{"88% sealing code generation", float64(len(bar.modules)) / 4},
+		{"91% sealing asset processing TerserPlugin", float64(minified) / 1024 * 4},
+		{"92% sealing asset processing RealContentHashPlugin", 50},
+		{"95% emitting emit", 40},
+		{"98% emitting after emit", 20},
+		{"100%", 0},
+	}
+	for _, phase := range phases {
+		bar.render(phase.message)
+		time.Sleep(time.Duration(util.GetRandomUniformDistribution(0.7, 1.3)*phase.ms) * time.Millisecond)
+	}
+	util.PrintSomethingAtBottom("") // clear progress bar at ending
+
+	bar.printStats(chunks)
+}
+
+func (bar *WebpackProgressBar) printStats(chunks []*chunk) {
+	type asset struct {
+		name  string
+		chunk string
+		size  int64
+		js    bool
+	}
+	var assets []asset
+	var entrypoint []asset
+	for i, c := range chunks {
+		name := c.name
+		scripts := c.minifiedScripts()
+		if i == 0 {
+			name = "main"
+			scripts += webpackRuntime(len(chunks) > 1) / 2
+		}
+		js := asset{name: name + "." + c.contentHash(name, false) + ".js", chunk: name, size: scripts, js: true}
+		assets = append(assets, js)
+		var css asset
+		if c.styles > 0 {
+			css = asset{name: name + "." + c.contentHash(name+".css", false) + ".css", chunk: name, size: c.minifiedStyles()}
+			assets = append(assets, css)
+		}
+		if i == 0 {
+			if c.styles > 0 {
+				entrypoint = append(entrypoint, css)
+			}
+			entrypoint = append(entrypoint, js)
+		}
+	}
+
+	var big []asset
+	for _, a := range assets {
+		fmt.Printf("asset \u001B[1m\u001B[32m%s\u001B[39m\u001B[22m %s \u001B[1m\u001B[32m[emitted]\u001B[39m\u001B[22m \u001B[1m\u001B[32m[immutable]\u001B[39m\u001B[22m", a.name, webpackSize(a.size))
+		if a.js {
+			fmt.Printf(" \u001B[1m\u001B[32m[minimized]\u001B[39m\u001B[22m")
+		}
+		if a.size > webpackSizeLimit {
+			big = append(big, a)
+			fmt.Printf(" \u001B[1m\u001B[33m[big]\u001B[39m\u001B[22m")
+		}
+		fmt.Printf(" (name: %s)\n", a.chunk)
+	}
+	var entrySize int64
+	var entryFiles []string
+	for _, a := range entrypoint {
+		entrySize += a.size
+		entryFiles = append(entryFiles, fmt.Sprintf("\u001B[1m\u001B[32m%s\u001B[39m\u001B[22m %s", a.name, webpackSize(a.size)))
+	}
+	fmt.Printf("Entrypoint \u001B[1mmain\u001B[22m")
+	if entrySize > webpackSizeLimit {
+		fmt.Printf(" \u001B[1m\u001B[33m[big]\u001B[39m\u001B[22m")
+	}
+	fmt.Printf(" %s = %s\n", webpackSize(entrySize), strings.Join(entryFiles, " "))
+
+	runtimeModules := 4
+	if len(chunks) > 1 {
+		runtimeModules = 10
+	}
+	fmt.Printf("runtime modules %s %s\n", webpackSize(webpackRuntime(len(chunks) > 1)), webpackModules(runtimeModules))
+
+	// modules are grouped by top level directories under src/
+	var total int64
+	groups := make(map[string]*struct {
+		size    int64
+		modules int
+	})
+	var rootModules []Module
+	for _, module := range bar.modules {
+		total += module.Size
+		dir := path.Dir(module.Path)
+		if dir == "src" || dir == "." {
+			rootModules = append(rootModules, module)
+			continue
+		}
+		segments := strings.SplitN(dir, "/", 3)
+		group := strings.Join(segments[:min(2, len(segments))], "/")
+		if groups[group] == nil {
+			groups[group] = &struct {
+				size    int64
+				modules int
+			}{}
+		}
+		groups[group].size += module.Size
+		groups[group].modules++
+	}
+	fmt.Printf("cacheable modules %s\n", webpackSize(total))
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Printf("  modules by path \u001B[1m./%s/\u001B[22m %s %s\n", name, webpackSize(groups[name].size), webpackModules(groups[name].modules))
+	}
+	for _, module := range rootModules {
+		fmt.Printf("  \u001B[1m./%s\u001B[22m %s \u001B[1m\u001B[33m[built]\u001B[39m\u001B[22m \u001B[1m\u001B[33m[code generated]\u001B[39m\u001B[22m\n", module.Path, webpackSize(module.Size))
+	}
+
+	warnings := 0
+	warning := "\n\u001B[1m\u001B[33mWARNING\u001B[39m\u001B[22m in \u001B[1m%s\u001B[22m"
+	if len(big) > 0 {
+		warnings++
+		fmt.Printf(warning+": The following asset(s) exceed the recommended size limit (244 KiB).\nThis can impact web performance.\nAssets: \n", "asset size limit")
+		for _, a := range big {
+			fmt.Printf("  %s (%s)\n", a.name, webpackSize(a.size))
+		}
+	}
+	if entrySize > webpackSizeLimit {
+		warnings++
+		fmt.Printf(warning+": The following entrypoint(s) combined asset size exceeds the recommended limit (244 KiB). This can impact web performance.\nEntrypoints:\n  main (%s)\n", "entrypoint size limit", webpackSize(entrySize))
+		for _, a := range entrypoint {
+			fmt.Printf("      %s\n", a.name)
+		}
+	}
+	if warnings > 0 && len(chunks) == 1 {
+		warnings++
+		fmt.Printf(warning+": \nYou can limit the size of your bundles by using import() or require.ensure to lazy load some parts of your application.\nFor more info visit https://webpack.js.org/guides/code-splitting/\n", "webpack performance recommendations")
+	}
+
+	elapsed := time.Since(bar.startTime).Milliseconds()
+	switch warnings {
+	case 0:
+		fmt.Printf("\nwebpack %s compiled \u001B[1m\u001B[32msuccessfully\u001B[39m\u001B[22m in %d ms\n", webpackVersion, elapsed)
+	case 1:
+		fmt.Printf("\nwebpack %s compiled with \u001B[1m\u001B[33m1 warning\u001B[39m\u001B[22m in %d ms\n", webpackVersion, elapsed)
+	default:
+		fmt.Printf("\nwebpack %s compiled with \u001B[1m\u001B[33m%d warnings\u001B[39m\u001B[22m in %d ms\n", webpackVersion, warnings, elapsed)
+	}
+}
+
+func (bar *WebpackProgressBar) renderBuilding() {
+
+	// [webpack.Progress] 65% building 1203/1780 modules 4 active ./src/components/Button.tsx
+
+	// modules are discovered while building, the total grows as the build goes on
+	known := bar.complete + bar.active
+	if bar.tasks > 0 {
+		known += (bar.tasks - known) * bar.complete / bar.tasks
+	}
+	percent := 10
+	if known > 0 {
+		percent += 55 * bar.complete / known
+	}
+	current := bar.current
+	if !strings.HasPrefix(current, ".") && !strings.HasPrefix(current, "/") {
+		current = "./" + current
+	}
+	bar.render(fmt.Sprintf("%d%% building %d/%d modules %d active %s", percent, bar.complete, known, bar.active, current))
+}
+
+func (bar *WebpackProgressBar) render(message string) {
+	width, _, err := term.GetSize(0)
+	if err != nil {
+		return
+	}
+	content := []rune("[webpack.Progress] " + message)
+	if len(content) > width-1 {
+		content = content[:max(width-1, 0)]
+	}
+	util.PrintSomethingAtBottom(string(content))
+}
+
+// webpackRuntime returns the size of webpack runtime modules, which are larger if chunks are loaded lazily
+func webpackRuntime(lazy bool) int64 {
+	if lazy {
+		return 7035
+	}
+	return 1045
+}
+
+// webpackSize formats size like webpack, 3 significant digits, e.g. 312 KiB, 24.1 KiB, 1.2 MiB
+func webpackSize(size int64) string {
+	units := []string{"bytes", "KiB", "MiB", "GiB"}
+	value := float64(size)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(value, 'g', 3, 64), 64)
+	return strconv.FormatFloat(rounded, 'f', -1, 64) + " " + units[i]
+}
+
+// webpackModules returns e.g. "1 module", "2 modules"
+func webpackModules(n int) string {
+	if n == 1 {
+		return "1 module"
+	}
+	return strconv.Itoa(n) + " modules"
+}
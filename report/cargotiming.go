@@ -0,0 +1,206 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// CargoTimingInfo is the build information shown in the summary table of cargo-timing.html
+type CargoTimingInfo struct {
+	Targets    []string // "name version" of target packages
+	Profile    string
+	FreshUnits int
+	Rustc      string
+}
+
+var cargoTimingTemplate = template.Must(template.New("cargo-timing").Parse(`<html>
+<head>
+  <title>Cargo Build Timings — {{.Title}}</title>
+  <meta charset="utf-8">
+<style type="text/css">
+html {
+  font-family: sans-serif;
+}
+.canvas-container {
+  position: relative;
+  margin-top: 5px;
+  margin-bottom: 5px;
+}
+h1 {
+  border-bottom: 1px solid #c0c0c0;
+}
+.graph {
+  display: block;
+}
+.my-table {
+  margin-top: 20px;
+  margin-bottom: 20px;
+  border-collapse: collapse;
+  box-shadow: 0 5px 10px rgba(0, 0, 0, 0.1);
+}
+.my-table th {
+  color: #d5dde5;
+  background: #1b1e24;
+  border-bottom: 4px solid #9ea7af;
+  border-right: 1px solid #343a45;
+  font-size: 18px;
+  font-weight: 100;
+  padding: 12px;
+  text-align: left;
+  vertical-align: middle;
+}
+.my-table td {
+  background: #ffffff;
+  padding: 10px;
+  text-align: left;
+  vertical-align: middle;
+  font-weight: 300;
+  font-size: 14px;
+  border-right: 1px solid #C1C3D1;
+}
+.my-table tr:nth-child(odd) td {
+  background: #EBEBEB;
+}
+.summary-table td:first-child {
+  vertical-align: top;
+  text-align: right;
+}
+</style>
+</head>
+<body>
+
+<h1>Cargo Build Timings</h1>
+See <a href="https://doc.rust-lang.org/nightly/cargo/reference/timings.html">Documentation</a>
+
+<table class="my-table summary-table">
+<tr><td>Targets:</td><td>{{.Title}}</td></tr>
+<tr><td>Profile:</td><td>{{.Profile}}</td></tr>
+<tr><td>Fresh units:</td><td>{{.Fresh}}</td></tr>
+<tr><td>Dirty units:</td><td>{{.Dirty}}</td></tr>
+<tr><td>Total units:</td><td>{{.Total}}</td></tr>
+<tr><td>Max concurrency:</td><td>{{.MaxConcurrency}} (jobs={{.Jobs}} ncpu={{.NCPU}})</td></tr>
+<tr><td>Average parallelism:</td><td>{{printf "%.2f" .Average}}</td></tr>
+<tr><td>Build start:</td><td>{{.Start}}</td></tr>
+<tr><td>Total time:</td><td>{{.TotalTime}}</td></tr>
+<tr><td>rustc:</td><td>{{.Rustc}}</td></tr>
+</table>
+
+<h2>Unit graph</h2>
+<div class="canvas-container">{{.UnitGraph}}</div>
+
+<h2>Concurrency graph</h2>
+<div class="canvas-container">{{.ConcurrencyGraph}}</div>
+
+<table class="my-table">
+  <thead>
+    <tr>
+      <th></th>
+      <th>Unit</th>
+      <th>Total</th>
+      <th>Waited</th>
+    </tr>
+  </thead>
+  <tbody>
+{{range $i, $unit := .Units}}    <tr>
+      <td>{{$i}}.</td>
+      <td>{{$unit.Name}}</td>
+      <td>{{printf "%.1f" $unit.Duration.Seconds}}s</td>
+      <td>{{printf "%.1f" $unit.Wait.Seconds}}s</td>
+    </tr>
+{{end}}  </tbody>
+</table>
+</body>
+</html>
+`))
+
+// WriteCargoTimings writes a cargo-timing.html style report of the recorded build
+func WriteCargoTimings(w io.Writer, recorder *Recorder, info CargoTimingInfo) error {
+	units := recorder.Units()
+	maxConcurrency, average := recorder.Parallelism()
+	if info.Profile == "" {
+		info.Profile = "release"
+	}
+
+	return cargoTimingTemplate.Execute(w, map[string]any{
+		"Title":            strings.Join(info.Targets, ", "),
+		"Profile":          info.Profile,
+		"Fresh":            info.FreshUnits,
+		"Dirty":            len(units),
+		"Total":            len(units) + info.FreshUnits,
+		"MaxConcurrency":   maxConcurrency,
+		"Jobs":             recorder.Slots(),
+		"NCPU":             runtime.NumCPU(),
+		"Average":          average,
+		"Start":            recorder.BeginTime().UTC().Format(time.RFC3339),
+		"TotalTime":        fmt.Sprintf("%.1fs", recorder.Elapsed().Seconds()),
+		"Rustc":            info.Rustc,
+		"UnitGraph":        template.HTML(unitGraph(units, recorder.Elapsed())),
+		"ConcurrencyGraph": template.HTML(concurrencyGraph(recorder.Concurrency(), recorder.Elapsed())),
+		"Units":            units,
+	})
+}
+
+// unitGraph draws a gantt chart of all units as inline svg, one row per unit
+func unitGraph(units []Unit, elapsed time.Duration) string {
+	s := strings.Builder{}
+	height := len(units)*unitHeight + graphMargin
+	fmt.Fprintf(&s, `<svg class="graph" width="%d" height="%d" xmlns="http://www.w3.org/2000/svg">`+"\n", graphWidth+2*graphMargin, height)
+	writeTimeAxis(&s, elapsed, height-graphMargin)
+	for i, unit := range units {
+		x := graphMargin + scale(unit.Start, elapsed)
+		w := max(scale(unit.End, elapsed)-scale(unit.Start, elapsed), 1)
+		y := i * unitHeight
+		fmt.Fprintf(&s, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="#95cce8"><title>%s %.1fs</title></rect>`+"\n",
+			x, y+1, w, unitHeight-2, html.EscapeString(unit.Name), unit.Duration().Seconds())
+		fmt.Fprintf(&s, `<text x="%.1f" y="%d" font-size="11">%s %.1fs</text>`+"\n",
+			x+w+3, y+unitHeight-4, html.EscapeString(unit.Name), unit.Duration().Seconds())
+	}
+	s.WriteString("</svg>")
+	return s.String()
+}
+
+// concurrencyGraph draws the number of active/waiting/inactive units over time as inline svg
+func concurrencyGraph(points []Concurrency, elapsed time.Duration) string {
+	const height = 300
+	top := 1
+	for _, p := range points {
+		top = max(top, p.Active, p.Waiting, p.Inactive)
+	}
+	y := func(v int) float64 {
+		return float64(height) - float64(v)/float64(top)*float64(height-graphMargin)
+	}
+
+	s := strings.Builder{}
+	fmt.Fprintf(&s, `<svg class="graph" width="%d" height="%d" xmlns="http://www.w3.org/2000/svg">`+"\n", graphWidth+2*graphMargin, height+graphMargin)
+	writeTimeAxis(&s, elapsed, height)
+	series := []struct {
+		name  string
+		color string
+		value func(c Concurrency) int
+	}{
+		{"Waiting", "red", func(c Concurrency) int { return c.Waiting }},
+		{"Inactive", "blue", func(c Concurrency) int { return c.Inactive }},
+		{"Active", "green", func(c Concurrency) int { return c.Active }},
+	}
+	for i, line := range series {
+		var polyline []string
+		for j, p := range points {
+			x := graphMargin + scale(p.Time, elapsed)
+			if j > 0 {
+				// step graph: keep the previous value until this point
+				polyline = append(polyline, fmt.Sprintf("%.1f,%.1f", x, y(line.value(points[j-1]))))
+			}
+			polyline = append(polyline, fmt.Sprintf("%.1f,%.1f", x, y(line.value(p))))
+		}
+		fmt.Fprintf(&s, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`+"\n", line.color, strings.Join(polyline, " "))
+		fmt.Fprintf(&s, `<text x="%d" y="%d" font-size="12" fill="%s">%s</text>`+"\n", graphWidth-80, 15+i*15, line.color, line.name)
+	}
+	fmt.Fprintf(&s, `<text x="0" y="%.1f" font-size="11">%d</text>`+"\n", y(top)+4, top)
+	s.WriteString("</svg>")
+	return s.String()
+}
@@ -0,0 +1,206 @@
+package report
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Unit is the timing record of a single task
+//
+// all time points are offsets from the beginning of the build
+type Unit struct {
+	Name  string
+	Slot  int           // index of the worker that ran the task
+	Ready time.Duration // when all dependencies of the task were finished
+	Start time.Duration
+	End   time.Duration
+}
+
+func (unit Unit) Duration() time.Duration {
+	return unit.End - unit.Start
+}
+
+// Wait returns how long the task waited for a free worker after it was ready
+func (unit Unit) Wait() time.Duration {
+	return unit.Start - unit.Ready
+}
+
+// Recorder collects timing information of tasks during a build
+//
+// a nil *Recorder is valid and records nothing, so that compilers can call it unconditionally
+type Recorder struct {
+	lock    *sync.Mutex
+	begin   time.Time
+	elapsed time.Duration
+	slots   int
+	ready   map[any]time.Duration
+	running map[any]*Unit
+	units   []*Unit
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		lock:    new(sync.Mutex),
+		ready:   make(map[any]time.Duration),
+		running: make(map[any]*Unit),
+	}
+}
+
+// Begin marks the beginning of the build, slots: max number of tasks running at the same time.
+// Later calls keep the first beginning, so that stages of a multi-stage build share one timeline
+func (recorder *Recorder) Begin(slots int) {
+	if recorder == nil {
+		return
+	}
+	recorder.lock.Lock()
+	if recorder.begin.IsZero() {
+		recorder.begin = time.Now()
+	}
+	recorder.slots = max(recorder.slots, slots)
+	recorder.lock.Unlock()
+}
+
+// Ready marks the task identified by key as ready to run,
+// tasks that are never marked ready are considered ready since the beginning
+func (recorder *Recorder) Ready(key any) {
+	if recorder == nil {
+		return
+	}
+	recorder.lock.Lock()
+	recorder.ready[key] = time.Since(recorder.begin)
+	recorder.lock.Unlock()
+}
+
+func (recorder *Recorder) Start(key any, name string, slot int) {
+	if recorder == nil {
+		return
+	}
+	recorder.lock.Lock()
+	now := time.Since(recorder.begin)
+	unit := &Unit{Name: name, Slot: slot, Ready: recorder.ready[key], Start: now}
+	delete(recorder.ready, key)
+	recorder.running[key] = unit
+	recorder.units = append(recorder.units, unit)
+	recorder.lock.Unlock()
+}
+
+func (recorder *Recorder) Complete(key any) {
+	if recorder == nil {
+		return
+	}
+	recorder.lock.Lock()
+	unit, ok := recorder.running[key]
+	if ok {
+		unit.End = time.Since(recorder.begin)
+		delete(recorder.running, key)
+	}
+	recorder.lock.Unlock()
+}
+
+// Finish marks the end of the build
+func (recorder *Recorder) Finish() {
+	if recorder == nil {
+		return
+	}
+	recorder.lock.Lock()
+	recorder.elapsed = time.Since(recorder.begin)
+	recorder.lock.Unlock()
+}
+
+// Units returns a copy of all finished units, sorted by start time
+func (recorder *Recorder) Units() []Unit {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	var units []Unit
+	for _, unit := range recorder.units {
+		if unit.End != 0 {
+			units = append(units, *unit)
+		}
+	}
+	sort.SliceStable(units, func(i, j int) bool {
+		return units[i].Start < units[j].Start
+	})
+	return units
+}
+
+// Concurrency is the number of units in each state at a point of time
+type Concurrency struct {
+	Time     time.Duration
+	Active   int // running
+	Waiting  int // ready, but waiting for a free slot
+	Inactive int // waiting for dependencies
+}
+
+// Concurrency returns the concurrency at every point of time it changes
+func (recorder *Recorder) Concurrency() []Concurrency {
+	type event struct {
+		time                      time.Duration
+		active, waiting, inactive int
+	}
+	units := recorder.Units()
+	var events []event
+	for _, unit := range units {
+		events = append(events,
+			event{time: unit.Ready, waiting: 1, inactive: -1},
+			event{time: unit.Start, active: 1, waiting: -1},
+			event{time: unit.End, active: -1})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].time < events[j].time
+	})
+
+	result := []Concurrency{{Inactive: len(units)}}
+	for _, e := range events {
+		last := result[len(result)-1]
+		current := Concurrency{
+			Time:     e.time,
+			Active:   last.Active + e.active,
+			Waiting:  last.Waiting + e.waiting,
+			Inactive: last.Inactive + e.inactive,
+		}
+		if current.Time == last.Time {
+			result[len(result)-1] = current
+		} else {
+			result = append(result, current)
+		}
+	}
+	return result
+}
+
+// Elapsed returns the wall time of the build
+func (recorder *Recorder) Elapsed() time.Duration {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	return recorder.elapsed
+}
+
+// BeginTime returns when the build began
+func (recorder *Recorder) BeginTime() time.Time {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	return recorder.begin
+}
+
+// Slots returns the max number of tasks that may run at the same time
+func (recorder *Recorder) Slots() int {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	return recorder.slots
+}
+
+// Parallelism returns the achieved parallelism of the build:
+// max number of units running at the same time, and the average one (total unit time / wall time)
+func (recorder *Recorder) Parallelism() (maxConcurrency int, average float64) {
+	var total time.Duration
+	for _, unit := range recorder.Units() {
+		total += unit.Duration()
+	}
+	for _, c := range recorder.Concurrency() {
+		maxConcurrency = max(maxConcurrency, c.Active)
+	}
+	if elapsed := recorder.Elapsed(); elapsed > 0 {
+		average = float64(total) / float64(elapsed)
+	}
+	return
+}
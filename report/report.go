@@ -0,0 +1,207 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type jsonTask struct {
+	Name    string  `json:"name"`
+	Slot    int     `json:"slot"`
+	ReadyMs float64 `json:"ready_ms"`
+	StartMs float64 `json:"start_ms"`
+	EndMs   float64 `json:"end_ms"`
+	WaitMs  float64 `json:"wait_ms"`
+}
+
+type jsonReport struct {
+	Compiler           string     `json:"compiler"`
+	Threads            int        `json:"threads"`
+	Start              time.Time  `json:"start"`
+	ElapsedMs          float64    `json:"elapsed_ms"`
+	MaxConcurrency     int        `json:"max_concurrency"`
+	AverageParallelism float64    `json:"average_parallelism"`
+	Tasks              []jsonTask `json:"tasks"`
+}
+
+// Save writes the report of the recorded build to path, format is chosen by the extension: .json or .html
+func Save(path string, recorder *Recorder, compilerType string) error {
+	var write func(w io.Writer, recorder *Recorder, compilerType string) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		write = WriteJSON
+	case ".html", ".htm":
+		write = WriteHTML
+	default:
+		return errors.New("report: unknown format of " + path + ", should be .json or .html")
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(f, recorder, compilerType)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// WriteJSON writes every task of the recorded build as json
+func WriteJSON(w io.Writer, recorder *Recorder, compilerType string) error {
+	maxConcurrency, average := recorder.Parallelism()
+	r := jsonReport{
+		Compiler:           compilerType,
+		Threads:            recorder.Slots(),
+		Start:              recorder.BeginTime(),
+		ElapsedMs:          ms(recorder.Elapsed()),
+		MaxConcurrency:     maxConcurrency,
+		AverageParallelism: average,
+		Tasks:              []jsonTask{},
+	}
+	for _, unit := range recorder.Units() {
+		r.Tasks = append(r.Tasks, jsonTask{
+			Name:    unit.Name,
+			Slot:    unit.Slot,
+			ReadyMs: ms(unit.Ready),
+			StartMs: ms(unit.Start),
+			EndMs:   ms(unit.End),
+			WaitMs:  ms(unit.Wait()),
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<html>
+<head>
+  <title>Build Report — {{.Compiler}}</title>
+  <meta charset="utf-8">
+<style type="text/css">
+html {
+  font-family: sans-serif;
+}
+table {
+  border-collapse: collapse;
+}
+td {
+  padding: 4px 10px;
+  border-bottom: 1px solid #c0c0c0;
+}
+</style>
+</head>
+<body>
+
+<h1>Build Report</h1>
+
+<table>
+<tr><td>Compiler:</td><td>{{.Compiler}}</td></tr>
+<tr><td>Tasks:</td><td>{{.Tasks}}</td></tr>
+<tr><td>Threads:</td><td>{{.Threads}}</td></tr>
+<tr><td>Max concurrency:</td><td>{{.MaxConcurrency}}</td></tr>
+<tr><td>Average parallelism:</td><td>{{printf "%.2f" .Average}}</td></tr>
+<tr><td>Utilisation:</td><td>{{printf "%.1f" .Utilisation}}%</td></tr>
+<tr><td>Average wait:</td><td>{{printf "%.1f" .AverageWait}}ms</td></tr>
+<tr><td>Build start:</td><td>{{.Start}}</td></tr>
+<tr><td>Total time:</td><td>{{.TotalTime}}</td></tr>
+</table>
+
+<h2>Threads</h2>
+{{.Gantt}}
+
+<h2>Utilisation</h2>
+{{.UtilisationGraph}}
+
+</body>
+</html>
+`))
+
+// WriteHTML writes a gantt chart of every thread and a utilisation graph of the recorded build
+func WriteHTML(w io.Writer, recorder *Recorder, compilerType string) error {
+	units := recorder.Units()
+	slots := recorder.Slots()
+	maxConcurrency, average := recorder.Parallelism()
+	var wait time.Duration
+	for _, unit := range units {
+		wait += unit.Wait()
+	}
+	averageWait := 0.0
+	if len(units) > 0 {
+		averageWait = ms(wait) / float64(len(units))
+	}
+
+	return reportTemplate.Execute(w, map[string]any{
+		"Compiler":         compilerType,
+		"Tasks":            len(units),
+		"Threads":          slots,
+		"MaxConcurrency":   maxConcurrency,
+		"Average":          average,
+		"Utilisation":      average / float64(max(slots, 1)) * 100,
+		"AverageWait":      averageWait,
+		"Start":            recorder.BeginTime().UTC().Format(time.RFC3339),
+		"TotalTime":        fmt.Sprintf("%.1fs", recorder.Elapsed().Seconds()),
+		"Gantt":            template.HTML(threadGraph(units, slots, recorder.Elapsed())),
+		"UtilisationGraph": template.HTML(utilisationGraph(recorder.Concurrency(), slots, recorder.Elapsed())),
+	})
+}
+
+// threadGraph draws a gantt chart as inline svg, one row per thread
+func threadGraph(units []Unit, slots int, elapsed time.Duration) string {
+	colors := []string{"#95cce8", "#81d4a0", "#f4c27a", "#e89595", "#c095e8"}
+	s := strings.Builder{}
+	height := slots*unitHeight + graphMargin
+	fmt.Fprintf(&s, `<svg class="graph" width="%d" height="%d" xmlns="http://www.w3.org/2000/svg">`+"\n", graphWidth+2*graphMargin, height)
+	writeTimeAxis(&s, elapsed, height-graphMargin)
+	for slot := range slots {
+		fmt.Fprintf(&s, `<text x="0" y="%d" font-size="11">#%d</text>`+"\n", slot*unitHeight+unitHeight-4, slot)
+	}
+	for i, unit := range units {
+		x := graphMargin + scale(unit.Start, elapsed)
+		w := max(scale(unit.End, elapsed)-scale(unit.Start, elapsed), 0.5)
+		fmt.Fprintf(&s, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s"><title>%s: %.0fms, waited %.0fms</title></rect>`+"\n",
+			x, unit.Slot*unitHeight+1, w, unitHeight-2, colors[i%len(colors)],
+			html.EscapeString(unit.Name), ms(unit.Duration()), ms(unit.Wait()))
+	}
+	s.WriteString("</svg>")
+	return s.String()
+}
+
+// utilisationGraph draws the percentage of busy threads over time as inline svg
+func utilisationGraph(points []Concurrency, slots int, elapsed time.Duration) string {
+	const height = 200
+	y := func(active int) float64 {
+		return float64(height) - float64(active)/float64(max(slots, 1))*float64(height-graphMargin)
+	}
+
+	s := strings.Builder{}
+	fmt.Fprintf(&s, `<svg class="graph" width="%d" height="%d" xmlns="http://www.w3.org/2000/svg">`+"\n", graphWidth+2*graphMargin, height+graphMargin)
+	writeTimeAxis(&s, elapsed, height)
+	polygon := []string{fmt.Sprintf("%d,%d", graphMargin, height)}
+	for i, p := range points {
+		x := graphMargin + scale(p.Time, elapsed)
+		if i > 0 {
+			polygon = append(polygon, fmt.Sprintf("%.1f,%.1f", x, y(points[i-1].Active)))
+		}
+		polygon = append(polygon, fmt.Sprintf("%.1f,%.1f", x, y(p.Active)))
+	}
+	polygon = append(polygon, fmt.Sprintf("%d,%d", graphMargin+graphWidth, height))
+	fmt.Fprintf(&s, `<polygon fill="#81d4a0" stroke="green" points="%s"/>`+"\n", strings.Join(polygon, " "))
+	fmt.Fprintf(&s, `<text x="0" y="%.1f" font-size="11">100%%</text>`+"\n", y(slots)+4)
+	fmt.Fprintf(&s, `<text x="0" y="%d" font-size="11">0%%</text>`+"\n", height)
+	s.WriteString("</svg>")
+	return s.String()
+}
@@ -0,0 +1,28 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const graphWidth = 1000
+const graphMargin = 40
+const unitHeight = 16
+
+func writeTimeAxis(s *strings.Builder, elapsed time.Duration, y int) {
+	fmt.Fprintf(s, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`+"\n", graphMargin, y, graphMargin+graphWidth, y)
+	step := max(elapsed/10, time.Millisecond)
+	for t := time.Duration(0); t <= elapsed; t += step {
+		x := graphMargin + scale(t, elapsed)
+		fmt.Fprintf(s, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#c0c0c0"/>`+"\n", x, y, x, y+5)
+		fmt.Fprintf(s, `<text x="%.1f" y="%d" font-size="11" text-anchor="middle">%.1fs</text>`+"\n", x, y+18, t.Seconds())
+	}
+}
+
+func scale(t, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(t) / float64(elapsed) * graphWidth
+}
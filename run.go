@@ -1,8 +1,13 @@
 package main
 
 import (
-	"github.com/spf13/cobra"
 	"log"
+	"os"
+
+	cc "github.com/rizutazu/fake-compiler/compiler"
+	"github.com/rizutazu/fake-compiler/report"
+	"github.com/rizutazu/fake-compiler/util"
+	"github.com/spf13/cobra"
 )
 
 var runCmd = &cobra.Command{
@@ -15,17 +20,131 @@ subcommand and acts like a summary of a directory`,
 		if err != nil {
 			log.Fatal(err)
 		}
+		err = setNestedBuilds(compiler)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if imageTag != "" || pushImage {
+			asDocker, ok := compiler.(*cc.DockerCompiler)
+			if !ok {
+				log.Fatal("--tag and --push are only supported by docker compiler")
+			}
+			asDocker.SetImage(imageTag, pushImage)
+		}
+		if changed != "" {
+			asIncremental, ok := compiler.(cc.IncrementalCompiler)
+			if !ok {
+				log.Fatalf("--changed is not supported by %s compiler", compilerType)
+			}
+			files, err := util.ChangedFiles(changed, dirPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = asIncremental.SetChangedFiles(files)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		var recorder *report.Recorder
+		if reportPath != "" {
+			recorder = report.NewRecorder()
+			compiler.SetRecorder(recorder)
+		}
+		if timings {
+			asCargo, ok := compiler.(*cc.CargoCompiler)
+			if !ok {
+				log.Fatal("--timings is only supported by cargo compiler")
+			}
+			asCargo.SetTimings("cargo-timing.html")
+		}
+		if runTests {
+			if dirPath == "" {
+				log.Fatal("--test only runs over --dir, add a config of test compiler as a stage instead")
+			}
+			compiler, err = withTests(compiler, recorder)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if len(failTests) > 0 || len(flakyTests) > 0 {
+			asTester, ok := compiler.(cc.Tester)
+			if !ok {
+				log.Fatalf("--fail-tests and --flaky-tests are only supported by test compiler, or with --test")
+			}
+			err = asTester.SetFailures(failTests, flakyTests)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
 		compiler.Run()
+		if recorder != nil {
+			err = report.Save(reportPath, recorder, compilerType)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if asTester, ok := compiler.(cc.Tester); ok && asTester.ExitCode() != 0 {
+			os.Exit(asTester.ExitCode())
+		}
 	},
 }
 
+// buildAndTest runs the tests of the directory once the build is done
+type buildAndTest struct {
+	cc.Compiler
+	tests *cc.TestCompiler
+}
+
+func (c *buildAndTest) Run() {
+	c.Compiler.Run()
+	c.tests.Run()
+}
+
+func (c *buildAndTest) SetFailures(failing, flaky []string) error {
+	return c.tests.SetFailures(failing, flaky)
+}
+
+func (c *buildAndTest) ExitCode() int {
+	return c.tests.ExitCode()
+}
+
+// withTests follows the build by tests discovered from the same directory, shown by the test progress bar
+func withTests(build cc.Compiler, recorder *report.Recorder) (cc.Compiler, error) {
+	tests, err := cc.NewTestCompiler(dirPath, nil, cc.SourceTypeDir, threads)
+	if err != nil {
+		return nil, err
+	}
+	bar, err := newProgressBar("test")
+	if err != nil {
+		return nil, err
+	}
+	tests.SetProgressBar(bar)
+	tests.SetRecorder(recorder)
+	return &buildAndTest{Compiler: build, tests: tests}, nil
+}
+
 func init() {
 	runCmd.Flags().IntVarP(&threads, "threads", "t", 16, "number of threads")
 	runCmd.Flags().StringVarP(&compilerType, "compiler", "C", "", "specified compiler type")
 	runCmd.Flags().StringVarP(&barType, "progressbar", "p", "", "specified progressbar")
-	runCmd.Flags().StringVarP(&configPath, "config", "c", "", "path of compiler config")
+	runCmd.Flags().StringArrayVarP(&configPaths, "config", "c", nil, "path of compiler config, several of them are built one after another as stages")
 	runCmd.Flags().StringVarP(&dirPath, "dir", "d", "", "path of directory to compile")
+	runCmd.Flags().StringVar(&exampleName, "example", "", "name of example config shipped within the binary, a unique prefix is enough, see \"examples list\"")
+	addTraverseFlags(runCmd)
+	runCmd.Flags().BoolVar(&timings, "timings", false, "write cargo-timing.html report of the build, cargo compiler only")
+	runCmd.Flags().StringVar(&changed, "changed", "", "only rebuild what is affected by changed files: a git diff range, comma separated paths, or @file that lists paths")
+	runCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "verbose output, e.g. print fresh packages")
+	runCmd.Flags().StringVar(&reportPath, "report", "", "write timing report of every task to given path, .json or .html")
+	runCmd.Flags().StringVar(&cmakeCompiler, "cmake-compiler", "", "compiler identified by the configure log of cxx progress bar, e.g. \"Clang 18.1.3\", default: \"GNU 11.4.5\"")
+	runCmd.Flags().BoolVar(&detectCompiler, "detect-compiler", false, "identify the compiler of cxx progress bar by running \"cc --version\"")
+	runCmd.Flags().BoolVar(&runTests, "test", false, "run tests discovered from the directory after the build, by the first of cargo, go, ctest and pytest that finds any, tests of the other runners are skipped")
+	runCmd.Flags().StringSliceVar(&failTests, "fail-tests", nil, "tests that fail, globs matched against test names like \"net::tests::*\", \"TestParse*\" or \"tests/test_api.py::*\"")
+	runCmd.Flags().StringSliceVar(&flakyTests, "flaky-tests", nil, "tests that fail half of the time, globs like --fail-tests")
+	addNestFlag(runCmd)
+	runCmd.Flags().StringVar(&imageTag, "tag", "", "tag of the image built by docker compiler, e.g. user/app:1.0, default: name of the directory")
+	runCmd.Flags().BoolVar(&pushImage, "push", false, "push the image built by docker compiler after it is exported")
 	runCmd.MarkFlagsRequiredTogether("dir", "compiler")
-	runCmd.MarkFlagsMutuallyExclusive("config", "dir")
-	runCmd.MarkFlagsOneRequired("config", "dir")
+	runCmd.MarkFlagsMutuallyExclusive("cmake-compiler", "detect-compiler")
+	runCmd.MarkFlagsMutuallyExclusive("config", "dir", "example")
+	runCmd.MarkFlagsOneRequired("config", "dir", "example")
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/rizutazu/fake-compiler/scenario"
+	"github.com/rizutazu/fake-compiler/util"
+	"github.com/spf13/cobra"
+)
+
+var scenarioCmd = &cobra.Command{
+	Use:   "scenario file",
+	Short: "run a yaml scenario of several steps",
+	Long: `run a yaml scenario file, which lists steps such as git clone, configure, build, docker push and sleep, each
+of them may fail by chance. Exits with non-zero status if a step fails`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := scenario.Load(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		runner := &scenario.Runner{
+			LoadExample: func(name string) (*util.Config, error) {
+				e, err := findExample(name)
+				if err != nil {
+					return nil, err
+				}
+				return e.config()
+			},
+		}
+		err = runner.Run(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\u001B[1;31merror\u001B[0m: %s\n", err)
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,199 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	cc "github.com/rizutazu/fake-compiler/compiler"
+	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+// errFailed is returned by steps that fail on purpose, see `Step.Fail`
+var errFailed = errors.New("failed")
+
+// Runner runs scenarios, on top of compilers and progress bars
+type Runner struct {
+	// LoadExample loads the config of an example shipped within the binary, required by build steps with example
+	LoadExample func(name string) (*util.Config, error)
+}
+
+// Run runs the steps of scenario one after another, stops at the first failed step whose failure is not allowed
+func (runner *Runner) Run(scenario *Scenario) error {
+	for i := range scenario.Steps {
+		err := runner.runStep(scenario, &scenario.Steps[i])
+		if err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, &scenario.Steps[i], err)
+		}
+	}
+	return nil
+}
+
+func (runner *Runner) runStep(scenario *Scenario, step *Step) error {
+	fail := rand.Float64() < float64(step.Fail)
+	var err error
+	switch {
+	case step.GitClone != nil:
+		err = gitClone(step.GitClone, fail)
+	case step.Configure != nil:
+		err = configure(step.Configure, fail)
+	case step.Build != nil:
+		err = runner.build(scenario, step.Build, fail)
+	case step.Shell != nil:
+		err = shell(step.Shell, fail)
+	case step.DockerPush != nil:
+		err = dockerPush(step.DockerPush, fail)
+	case step.Sleep != nil:
+		time.Sleep(*step.Sleep)
+	case step.Echo != nil:
+		fmt.Println(*step.Echo)
+	case step.Parallel != nil:
+		err = runner.parallel(scenario, step.Parallel)
+	}
+	if fail && err == nil {
+		err = errFailed
+	}
+	if err != nil && step.AllowFailure {
+		fmt.Fprintf(os.Stderr, "\u001B[1;33mwarning\u001B[0m: step %s failed, but failure is allowed: %s\n", step, err)
+		return nil
+	}
+	return err
+}
+
+func (runner *Runner) parallel(scenario *Scenario, steps []Step) error {
+	wg := new(sync.WaitGroup)
+	errs := make([]error, len(steps))
+	for i := range steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := runner.runStep(scenario, &steps[i])
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", &steps[i], err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (runner *Runner) build(scenario *Scenario, build *BuildStep, fail bool) error {
+	threads := build.Threads
+	if threads == 0 {
+		threads = 16
+	}
+
+	var config *util.Config
+	var err error
+	compilerType := build.Compiler
+	sourceType := cc.SourceTypeConfig
+	dir := ""
+	switch {
+	case build.Example != "":
+		if runner.LoadExample == nil {
+			return errors.New("examples are not available")
+		}
+		config, err = runner.LoadExample(build.Example)
+	case len(build.Config) > 0:
+		var configs []*util.Config
+		for _, path := range build.Config {
+			c, err := util.ParseConfigFile(scenario.path(path))
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			configs = append(configs, c)
+		}
+		config = configs[0]
+		if len(configs) > 1 {
+			config, err = util.MergeConfigs(configs)
+		}
+	default:
+		sourceType = cc.SourceTypeDir
+		dir, err = util.FormatPathWithSlashEnding(scenario.path(build.Dir))
+	}
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		compilerType = config.CompilerType
+	}
+
+	compiler, err := cc.New(compilerType, dir, config, sourceType, threads, util.TraverseOptions{})
+	if err != nil {
+		return err
+	}
+	newBar := func(barType string) (progressbar.ProgressBar, error) {
+		if build.ProgressBar != "" {
+			barType = build.ProgressBar
+		}
+		bar, err := progressbar.New(barType)
+		if err != nil {
+			return nil, err
+		}
+		if asCargo, ok := bar.(*progressbar.CargoProgressBar); ok {
+			asCargo.SetVerbose(build.Verbose)
+		}
+		return bar, nil
+	}
+	if asMulti, ok := compiler.(*cc.MultiCompiler); ok {
+		err = asMulti.SetStageProgressBars(newBar)
+	} else {
+		var bar progressbar.ProgressBar
+		bar, err = newBar(compilerType)
+		if err == nil {
+			compiler.SetProgressBar(bar)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if build.Changed != "" {
+		asIncremental, ok := compiler.(cc.IncrementalCompiler)
+		if !ok {
+			return fmt.Errorf("changed is not supported by %s compiler", compilerType)
+		}
+		files, err := util.ChangedFiles(build.Changed, dir)
+		if err != nil {
+			return err
+		}
+		err = asIncremental.SetChangedFiles(files)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(build.FailTests) > 0 || len(build.FlakyTests) > 0 {
+		asTester, ok := compiler.(cc.Tester)
+		if !ok {
+			return fmt.Errorf("fail-tests and flaky-tests are not supported by %s compiler", compilerType)
+		}
+		err = asTester.SetFailures(build.FailTests, build.FlakyTests)
+		if err != nil {
+			return err
+		}
+	}
+
+	compiler.Run()
+	if asTester, ok := compiler.(cc.Tester); ok && asTester.ExitCode() != 0 {
+		return fmt.Errorf("tests failed, exit status %d", asTester.ExitCode())
+	}
+	if fail {
+		buildFailure(compilerType)
+		return errFailed
+	}
+	return nil
+}
+
+// path resolves p against the directory of the scenario file
+func (scenario *Scenario) path(p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(scenario.dir, p)
+}
@@ -0,0 +1,262 @@
+package scenario
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario is a list of steps run one after another, e.g. a whole CI job
+//
+// example:
+//
+//	name: release
+//	steps:
+//	  - git-clone: {url: https://github.com/example/app.git}
+//	  - configure: {project: app}
+//	  - build: {config: deps.cfg, threads: 32}
+//	    fail: 5%
+//	  - parallel:
+//	      - build: {example: router}
+//	      - sleep: 3s
+//	  - docker-push: {image: example/app:latest}
+type Scenario struct {
+	Name  string `yaml:"name"`
+	Steps []Step `yaml:"steps"`
+
+	dir string // directory of the scenario file, relative paths within steps are resolved against it
+}
+
+// Step is a single step of the scenario, exactly one of the actions should be set
+//
+// `Name` : shown when the step fails, default: the kind of the action
+//
+// `Fail` : probability that the step fails, e.g. "5%"
+//
+// `AllowFailure` : the scenario goes on if the step fails
+type Step struct {
+	Name         string      `yaml:"name"`
+	Fail         Probability `yaml:"fail"`
+	AllowFailure bool        `yaml:"allow-failure"`
+
+	GitClone   *GitCloneStep   `yaml:"git-clone"`
+	Configure  *ConfigureStep  `yaml:"configure"`
+	Build      *BuildStep      `yaml:"build"`
+	Shell      *ShellStep      `yaml:"shell"`
+	DockerPush *DockerPushStep `yaml:"docker-push"`
+	Sleep      *time.Duration  `yaml:"sleep"`
+	Echo       *string         `yaml:"echo"`
+	Parallel   []Step          `yaml:"parallel"` // steps run at the same time, the step fails if any of them fails
+}
+
+// GitCloneStep prints `git clone` of URL
+type GitCloneStep struct {
+	URL     string `yaml:"url"`
+	Objects int    `yaml:"objects"` // number of objects to receive, default: random
+}
+
+// ConfigureStep prints cmake-style configure logs
+type ConfigureStep struct {
+	Project  string `yaml:"project"`   // source directory of the project, default: current directory
+	BuildDir string `yaml:"build-dir"` // default: <project>/build
+}
+
+// BuildStep runs a compiler, over exactly one of Config, Example and Dir
+//
+// `Compiler` : compiler type, required by Dir
+//
+// `Config` : config file generated by "gen", or several of them as stages
+//
+// `ProgressBar` : style of progress bar, default: the style of the compiler
+type BuildStep struct {
+	Compiler    string     `yaml:"compiler"`
+	Config      StringList `yaml:"config"`
+	Example     string     `yaml:"example"`
+	Dir         string     `yaml:"dir"`
+	Threads     int        `yaml:"threads"` // default: 16
+	ProgressBar string     `yaml:"progressbar"`
+	Changed     string     `yaml:"changed"` // see "run --changed"
+	Verbose     bool       `yaml:"verbose"`
+	FailTests   StringList `yaml:"fail-tests"`  // see "run --fail-tests", the step fails if any test fails
+	FlakyTests  StringList `yaml:"flaky-tests"` // see "run --flaky-tests"
+}
+
+// ShellStep prints a command and its output line by line, within Duration in total
+type ShellStep struct {
+	Command  string        `yaml:"command"`
+	Output   []string      `yaml:"output"`
+	Duration time.Duration `yaml:"duration"`
+}
+
+// DockerPushStep prints `docker push` of Image
+type DockerPushStep struct {
+	Image  string `yaml:"image"`
+	Layers int    `yaml:"layers"` // default: random
+}
+
+// Probability is parsed from either a percentage like "5%" or a fraction like 0.05
+type Probability float64
+
+func (p *Probability) UnmarshalYAML(node *yaml.Node) error {
+	s := strings.TrimSpace(node.Value)
+	percent := strings.HasSuffix(s, "%")
+	s = strings.TrimSuffix(s, "%")
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid probability %q, should be like 5%% or 0.05", node.Line, node.Value)
+	}
+	if percent {
+		value /= 100
+	}
+	if value < 0 || value > 1 {
+		return fmt.Errorf("line %d: probability %q out of range [0, 1]", node.Line, node.Value)
+	}
+	*p = Probability(value)
+	return nil
+}
+
+// StringList is parsed from either a single string or a list of strings
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = StringList{node.Value}
+		return nil
+	}
+	var list []string
+	err := node.Decode(&list)
+	if err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// Load parses and validates the scenario file
+func Load(path string) (*Scenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	scenario := new(Scenario)
+	err = decoder.Decode(scenario)
+	if err != nil {
+		return nil, fmt.Errorf("scenario %s: %w", path, err)
+	}
+	scenario.dir = filepath.Dir(path)
+	err = scenario.validate()
+	if err != nil {
+		return nil, fmt.Errorf("scenario %s: %w", path, err)
+	}
+	return scenario, nil
+}
+
+func (scenario *Scenario) validate() error {
+	if len(scenario.Steps) == 0 {
+		return errors.New("no steps")
+	}
+	for i := range scenario.Steps {
+		err := scenario.Steps[i].validate()
+		if err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// kind returns the name of the action of the step
+func (step *Step) kind() string {
+	switch {
+	case step.GitClone != nil:
+		return "git-clone"
+	case step.Configure != nil:
+		return "configure"
+	case step.Build != nil:
+		return "build"
+	case step.Shell != nil:
+		return "shell"
+	case step.DockerPush != nil:
+		return "docker-push"
+	case step.Sleep != nil:
+		return "sleep"
+	case step.Echo != nil:
+		return "echo"
+	case step.Parallel != nil:
+		return "parallel"
+	default:
+		return ""
+	}
+}
+
+// String is the name of the step
+func (step *Step) String() string {
+	if step.Name != "" {
+		return step.Name
+	}
+	return step.kind()
+}
+
+func (step *Step) validate() error {
+	actions := 0
+	for _, set := range []bool{step.GitClone != nil, step.Configure != nil, step.Build != nil, step.Shell != nil,
+		step.DockerPush != nil, step.Sleep != nil, step.Echo != nil, step.Parallel != nil} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return fmt.Errorf("exactly one action should be set, got %d", actions)
+	}
+
+	switch {
+	case step.GitClone != nil:
+		if step.GitClone.URL == "" {
+			return errors.New("git-clone: url is required")
+		}
+	case step.Build != nil:
+		build := step.Build
+		sources := 0
+		for _, set := range []bool{len(build.Config) > 0, build.Example != "", build.Dir != ""} {
+			if set {
+				sources++
+			}
+		}
+		if sources != 1 {
+			return errors.New("build: exactly one of config, example and dir should be set")
+		}
+		if build.Dir != "" && build.Compiler == "" {
+			return errors.New("build: compiler is required by dir")
+		}
+		if build.Threads < 0 {
+			return errors.New("build: threads should be a positive number")
+		}
+	case step.Shell != nil:
+		if strings.TrimSpace(step.Shell.Command) == "" {
+			return errors.New("shell: command is required")
+		}
+	case step.DockerPush != nil:
+		if step.DockerPush.Image == "" {
+			return errors.New("docker-push: image is required")
+		}
+	case step.Parallel != nil:
+		if len(step.Parallel) == 0 {
+			return errors.New("parallel: no steps")
+		}
+		for i := range step.Parallel {
+			err := step.Parallel[i].validate()
+			if err != nil {
+				return fmt.Errorf("parallel step %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
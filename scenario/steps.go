@@ -0,0 +1,302 @@
+package scenario
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cc "github.com/rizutazu/fake-compiler/compiler"
+	"github.com/rizutazu/fake-compiler/progressbar"
+	"github.com/rizutazu/fake-compiler/util"
+)
+
+func gitClone(step *GitCloneStep, fail bool) error {
+	objects := step.Objects
+	if objects <= 0 {
+		objects = int(max(util.GetRandomFromDistribution(20000, 8000), 500))
+	}
+	name := strings.TrimSuffix(path.Base(strings.TrimRight(step.URL, "/")), ".git")
+	deltas := objects * 2 / 3
+	reused := objects - objects/20
+
+	fmt.Printf("Cloning into '%s'...\n", name)
+	time.Sleep(time.Duration(util.GetRandomUniformDistribution(300, 900)) * time.Millisecond)
+	fmt.Printf("remote: Enumerating objects: %d, done.\n", objects)
+	fmt.Printf("remote: Counting objects: 100%% (%d/%d), done.\n", objects/3, objects/3)
+	time.Sleep(time.Duration(util.GetRandomUniformDistribution(200, 600)) * time.Millisecond)
+	fmt.Printf("remote: Compressing objects: 100%% (%d/%d), done.\n", objects/5, objects/5)
+
+	// ~2 KiB per object, received at ~10 MiB/s
+	total := float64(objects) * util.GetRandomUniformDistribution(1.5, 2.5) / 1024
+	speed := util.GetRandomUniformDistribution(6, 14)
+	failAt := 101
+	if fail {
+		failAt = mrand.Intn(90) + 5
+	}
+	for percent := 0; percent <= 100; percent++ {
+		if percent == failAt {
+			fmt.Printf("\n")
+			fmt.Fprintf(os.Stderr, "error: RPC failed; curl 92 HTTP/2 stream 5 was not closed cleanly: CANCEL (err 8)\n")
+			fmt.Fprintf(os.Stderr, "error: %d bytes of body are still expected\n", int(total*float64(100-percent)/100*1024*1024))
+			fmt.Fprintf(os.Stderr, "fetch-pack: unexpected disconnect while reading sideband packet\n")
+			fmt.Fprintf(os.Stderr, "fatal: early EOF\n")
+			fmt.Fprintf(os.Stderr, "fatal: fetch-pack: invalid index-pack output\n")
+			return errFailed
+		}
+		received := total * float64(percent) / 100
+		fmt.Printf("\rReceiving objects: %3d%% (%d/%d), %s | %.2f MiB/s",
+			percent, objects*percent/100, objects, formatMiB(received), speed*util.GetRandomUniformDistribution(0.9, 1.1))
+		time.Sleep(time.Duration(total/speed*10) * time.Millisecond)
+	}
+	fmt.Printf(", done.\n")
+	fmt.Printf("remote: Total %d (delta %d), reused %d (delta %d), pack-reused %d\n", objects, deltas, reused, deltas-deltas/20, objects/10)
+	for percent := 0; percent <= 100; percent += 5 {
+		fmt.Printf("\rResolving deltas: %3d%% (%d/%d)", percent, deltas*percent/100, deltas)
+		time.Sleep(time.Duration(deltas/1000+5) * time.Millisecond)
+	}
+	fmt.Printf(", done.\n")
+	return nil
+}
+
+func formatMiB(mib float64) string {
+	if mib < 1 {
+		return fmt.Sprintf("%.2f KiB", mib*1024)
+	}
+	return fmt.Sprintf("%.2f MiB", mib)
+}
+
+func configure(step *ConfigureStep, fail bool) error {
+	buildDir := step.BuildDir
+	if buildDir == "" {
+		buildDir = filepath.Join(step.Project, "build")
+	}
+	if abs, err := filepath.Abs(buildDir); err == nil {
+		buildDir = abs
+	}
+	bar := progressbar.NewCMakeProgressBar()
+	project := step.Project
+	if project == "" {
+		project = "."
+	}
+	if abs, err := filepath.Abs(project); err == nil {
+		bar.SetTargetName(filepath.Base(abs))
+	}
+	// the same configure log as cxx builds, made up of CMakeLists.txt if there is one
+	info, err := cc.ReadCmakeProject(project)
+	if err == nil {
+		bar.SetProject(info)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "warning: skipped CMakeLists.txt: %s\n", err)
+	}
+	start := time.Now()
+	lines := bar.ConfigureLog()
+	failAt := len(lines)
+	if fail {
+		failAt = mrand.Intn(len(lines))
+	}
+	for _, line := range lines[:failAt] {
+		fmt.Printf("-- %s\n", line)
+		time.Sleep(time.Duration(util.GetRandomUniformDistribution(10, 120)) * time.Millisecond)
+	}
+	if fail {
+		fmt.Fprintf(os.Stderr, "CMake Error at CMakeLists.txt:%d (find_package):\n", mrand.Intn(40)+5)
+		fmt.Fprintf(os.Stderr, "  By not providing \"FindBoost.cmake\" in CMAKE_MODULE_PATH this project has\n")
+		fmt.Fprintf(os.Stderr, "  asked CMake to find a package configuration file provided by \"Boost\", but\n")
+		fmt.Fprintf(os.Stderr, "  CMake did not find one.\n\n")
+		fmt.Printf("-- Configuring incomplete, errors occurred!\n")
+		return errFailed
+	}
+	fmt.Printf("-- Configuring done (%.1fs)\n", time.Since(start).Seconds())
+	fmt.Printf("-- Generating done (0.0s)\n")
+	fmt.Printf("-- Build files have been written to: %s\n", buildDir)
+	return nil
+}
+
+// buildFailure prints the error of a failed build in the style of the compiler
+func buildFailure(compilerType string) {
+	switch compilerType {
+	case "cargo":
+		fmt.Fprintf(os.Stderr, "\u001B[1;31merror[E0308]\u001B[0m\u001B[1m: mismatched types\u001B[0m\n")
+		fmt.Fprintf(os.Stderr, "\u001B[1;31merror\u001B[0m\u001B[1m: could not compile due to 1 previous error\u001B[0m\n")
+	case "node":
+		fmt.Fprintf(os.Stderr, "npm ERR! code ECONNRESET\n")
+		fmt.Fprintf(os.Stderr, "npm ERR! syscall read\n")
+		fmt.Fprintf(os.Stderr, "npm ERR! errno ECONNRESET\n")
+		fmt.Fprintf(os.Stderr, "npm ERR! network request to https://registry.npmjs.org/ failed, reason: read ECONNRESET\n")
+		fmt.Fprintf(os.Stderr, "npm ERR! network This is a problem related to network connectivity.\n")
+		fmt.Fprintf(os.Stderr, "npm ERR! network In most cases you are behind a proxy or have bad network settings.\n\n")
+		fmt.Fprintf(os.Stderr, "npm ERR! A complete log of this run can be found in:\n")
+		now := time.Now().UTC()
+		fmt.Fprintf(os.Stderr, "npm ERR!     /root/.npm/_logs/%s%03dZ-debug-0.log\n", now.Format("2006-01-02T15_04_05_"), now.Nanosecond()/1e6)
+	case "pip":
+		fmt.Fprintf(os.Stderr, "  \u001B[1;31merror\u001B[0m: \u001B[1msubprocess-exited-with-error\u001B[0m\n\n")
+		fmt.Fprintf(os.Stderr, "  \u001B[31m×\u001B[0m \u001B[32mBuilding wheel for psycopg2 \u001B[0m\u001B[1;32m(\u001B[0m\u001B[32mpyproject.toml\u001B[0m\u001B[1;32m)\u001B[0m did not run successfully.\n")
+		fmt.Fprintf(os.Stderr, "  \u001B[31m│\u001B[0m exit code: \u001B[1;36m1\u001B[0m\n")
+		fmt.Fprintf(os.Stderr, "  \u001B[31m╰─>\u001B[0m Error: pg_config executable not found.\n\n")
+		fmt.Fprintf(os.Stderr, "  \u001B[1;35mnote\u001B[0m: This error originates from a subprocess, and is likely not a problem with pip.\n")
+		fmt.Fprintf(os.Stderr, "\u001B[1;31mERROR: Failed building wheel for psycopg2\u001B[0m\n")
+		fmt.Fprintf(os.Stderr, "\u001B[31mERROR: Failed to build installable wheels for some pyproject.toml based projects (psycopg2)\u001B[0m\n")
+	case "bundle":
+		fmt.Fprintf(os.Stderr, "\u001B[1m\u001B[31mERROR\u001B[39m\u001B[22m in \u001B[1m./src/main.ts\u001B[22m \u001B[1m\u001B[32m%d:%d-%d\u001B[39m\u001B[22m\n", mrand.Intn(60)+1, mrand.Intn(20)+1, mrand.Intn(20)+21)
+		fmt.Fprintf(os.Stderr, "\u001B[1m\u001B[31m[tsl] ERROR\u001B[39m\u001B[22m\n")
+		fmt.Fprintf(os.Stderr, "\u001B[1m\u001B[31m      TS2345: Argument of type 'string | undefined' is not assignable to parameter of type 'string'.\u001B[39m\u001B[22m\n\n")
+		fmt.Fprintf(os.Stderr, "webpack compiled with \u001B[1m\u001B[31m1 error\u001B[39m\u001B[22m\n")
+	case "gradle":
+		fmt.Fprintf(os.Stderr, "e: file:///src/main/kotlin/Main.kt:%d:%d Unresolved reference: viewModel\n\n", mrand.Intn(120)+1, mrand.Intn(40)+1)
+		fmt.Fprintf(os.Stderr, "\u001B[31mFAILURE: \u001B[39m\u001B[31mBuild failed with an exception.\u001B[39m\n\n")
+		fmt.Fprintf(os.Stderr, "* What went wrong:\nExecution failed for task ':app:compileDebugKotlin'.\n")
+		fmt.Fprintf(os.Stderr, "\u001B[33m> \u001B[39mA failure occurred while executing org.jetbrains.kotlin.compilerRunner.GradleCompilerRunnerWithWorkers$GradleKotlinCompilerWorkAction\n")
+		fmt.Fprintf(os.Stderr, "   \u001B[33m> \u001B[39mCompilation error. See log for more details\n\n")
+		fmt.Fprintf(os.Stderr, "\u001B[31;1mBUILD FAILED\u001B[0;39m in %ds\n", mrand.Intn(50)+10)
+	case "maven":
+		fmt.Fprintf(os.Stderr, "[\u001B[1;31mERROR\u001B[m] COMPILATION ERROR : \n")
+		fmt.Fprintf(os.Stderr, "[\u001B[1;31mERROR\u001B[m] /src/main/java/com/example/App.java:[%d,%d] cannot find symbol\n", mrand.Intn(120)+1, mrand.Intn(40)+1)
+		fmt.Fprintf(os.Stderr, "[\u001B[1;31mERROR\u001B[m]   symbol:   class Repository\n")
+		fmt.Fprintf(os.Stderr, "[\u001B[1;34mINFO\u001B[m] \u001B[1;31mBUILD FAILURE\u001B[m\n")
+		fmt.Fprintf(os.Stderr, "[\u001B[1;31mERROR\u001B[m] Failed to execute goal \u001B[32morg.apache.maven.plugins:maven-compiler-plugin:3.13.0:compile\u001B[m \u001B[1m(default-compile)\u001B[m on project \u001B[36mapp\u001B[m: \u001B[1;31mCompilation failure\u001B[m\n")
+	case "meson":
+		fmt.Fprintf(os.Stderr, "\u001B[31mFAILED: \u001B[0mapp.p/src_main.c.o\n")
+		fmt.Fprintf(os.Stderr, "cc -Iapp.p -I. -I.. -fdiagnostics-color=always -D_FILE_OFFSET_BITS=64 -Wall -Winvalid-pch -O0 -g -MD -MQ app.p/src_main.c.o -MF app.p/src_main.c.o.d -o app.p/src_main.c.o -c ../src/main.c\n")
+		fmt.Fprintf(os.Stderr, "../src/main.c:%d:%d: \u001B[1;31merror: \u001B[0m'config' undeclared (first use in this function)\n", mrand.Intn(200)+1, mrand.Intn(40)+1)
+		fmt.Fprintf(os.Stderr, "ninja: build stopped: subcommand failed.\n")
+	case "bazel":
+		line, column := mrand.Intn(80)+1, mrand.Intn(20)+1
+		fmt.Fprintf(os.Stderr, "src/main/foo.cc:%d:%d: error: 'Status' was not declared in this scope\n", mrand.Intn(200)+1, mrand.Intn(40)+1)
+		fmt.Fprintf(os.Stderr, "\u001B[31m\u001B[1mERROR: \u001B[0m/workspace/src/main/BUILD.bazel:%d:%d: Compiling src/main/foo.cc failed: (Exit 1): gcc failed: error executing CppCompile command (from target //src/main:foo) /usr/bin/gcc -c src/main/foo.cc -o bazel-out/k8-fastbuild/bin/src/main/_objs/foo/foo.pic.o\n", line, column)
+		fmt.Fprintf(os.Stderr, "\u001B[32mINFO: \u001B[0mElapsed time: %.3fs, Critical Path: %.2fs\n", util.GetRandomUniformDistribution(5, 60), util.GetRandomUniformDistribution(2, 5))
+		fmt.Fprintf(os.Stderr, "\u001B[31m\u001B[1mERROR: \u001B[0mBuild did NOT complete successfully\n")
+	case "docker":
+		fmt.Fprintf(os.Stderr, "Dockerfile:%d\n--------------------\n", mrand.Intn(20)+5)
+		fmt.Fprintf(os.Stderr, "  >>> RUN cargo build --release\n--------------------\n")
+		fmt.Fprintf(os.Stderr, "ERROR: failed to solve: process \"/bin/sh -c cargo build --release\" did not complete successfully: exit code: 101\n")
+	case "latex":
+		line := mrand.Intn(400) + 10
+		fmt.Fprintf(os.Stderr, "! Undefined control sequence.\nl.%d \\citep\n              {knuth84}\n", line)
+		fmt.Fprintf(os.Stderr, "Latexmk: Errors, so I did not complete making targets\n")
+		fmt.Fprintf(os.Stderr, "Collected error summary (may duplicate other messages):\n  pdflatex: Command for 'pdflatex' gave return code 1\n")
+	case "test":
+		// the test binary crashed, whatever the runner is
+		fmt.Fprintf(os.Stderr, "Segmentation fault (core dumped)\n")
+	default:
+		fmt.Fprintf(os.Stderr, "gmake[2]: *** [CMakeFiles/target.dir/build.make:%d: all] Error 1\n", mrand.Intn(900)+76)
+		fmt.Fprintf(os.Stderr, "gmake[1]: *** [CMakeFiles/Makefile2:83: CMakeFiles/target.dir/all] Error 2\n")
+		fmt.Fprintf(os.Stderr, "gmake: *** [Makefile:91: all] Error 2\n")
+	}
+}
+
+func shell(step *ShellStep, fail bool) error {
+	fmt.Printf("\u001B[1m$ %s\u001B[0m\n", step.Command)
+	lines := step.Output
+	if fail && len(lines) > 0 {
+		lines = lines[:mrand.Intn(len(lines))]
+	}
+	interval := time.Duration(0)
+	if len(lines) > 0 {
+		interval = step.Duration / time.Duration(len(lines))
+	} else {
+		time.Sleep(step.Duration)
+	}
+	for _, line := range lines {
+		time.Sleep(interval)
+		fmt.Println(line)
+	}
+	if fail {
+		fmt.Fprintf(os.Stderr, "%s: exited with status 1\n", strings.Fields(step.Command)[0])
+		return errFailed
+	}
+	return nil
+}
+
+func dockerPush(step *DockerPushStep, fail bool) error {
+	repository, tag := step.Image, "latest"
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository, tag = repository[:i], repository[i+1:]
+	}
+	// docker.io/library/name for official images, the first component is a registry if it looks like a host
+	first, _, found := strings.Cut(repository, "/")
+	switch {
+	case !found:
+		repository = "docker.io/library/" + repository
+	case !strings.ContainsAny(first, ".:") && first != "localhost":
+		repository = "docker.io/" + repository
+	}
+
+	layers := step.Layers
+	if layers <= 0 {
+		layers = mrand.Intn(8) + 3
+	}
+	type layer struct {
+		id     string
+		size   float64 // MB
+		pushed float64
+		exists bool
+	}
+	var all []*layer
+	for range layers {
+		all = append(all, &layer{
+			id:     randomHex(6),
+			size:   max(util.GetRandomFromDistribution(40, 30), 0.5),
+			exists: mrand.Intn(3) == 0,
+		})
+	}
+
+	fmt.Printf("The push refers to repository [%s]\n", repository)
+	for _, l := range all {
+		fmt.Printf("%s: Preparing\n", l.id)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if fail {
+		fmt.Fprintf(os.Stderr, "denied: requested access to the resource is denied\n")
+		return errFailed
+	}
+
+	// redraw all layers in place, a few of them are pushed at the same time
+	speed := util.GetRandomUniformDistribution(5, 15) // MB per tick per layer
+	for {
+		fmt.Printf("\u001B[%dA", len(all))
+		done := true
+		active := 0
+		for _, l := range all {
+			status := ""
+			switch {
+			case l.exists:
+				status = "Layer already exists"
+			case l.pushed >= l.size:
+				status = "Pushed"
+			case active >= 3:
+				status = "Waiting"
+				done = false
+			default:
+				active++
+				done = false
+				l.pushed = min(l.size, l.pushed+speed*util.GetRandomUniformDistribution(0.5, 1.5))
+				width := int(50 * l.pushed / l.size)
+				bar := strings.Repeat("=", width)
+				if width < 50 {
+					bar += ">" + strings.Repeat(" ", 49-width)
+				}
+				status = fmt.Sprintf("Pushing [%s] %6.1fMB/%.1fMB", bar, l.pushed, l.size)
+			}
+			fmt.Printf("\u001B[2K%s: %s\n", l.id, status)
+		}
+		if done {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	fmt.Printf("%s: digest: sha256:%s size: %d\n", tag, randomHex(32), 500+layers*210)
+	return nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,97 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ChangedFiles resolves the list of changed files described by spec, which is one of:
+//
+// a git diff range like "rev..rev" or "rev...rev", e.g. "HEAD~3..HEAD", resolved by `git diff --name-only --relative`
+// within dir, unless it is the path of an existing file, e.g. "a..b.c"
+//
+// "@path": a file that lists changed files, one per line, "@-" reads from stdin
+//
+// otherwise: comma separated paths
+//
+// the results are slash-separated paths relative to dir, absolute paths outside dir are dropped
+func ChangedFiles(spec, dir string) ([]string, error) {
+	var raw []string
+	switch {
+	case isGitRange(spec, dir):
+		cmd := exec.Command("git", "diff", "--name-only", "--relative", spec)
+		cmd.Dir = dir
+		stderr := new(bytes.Buffer)
+		cmd.Stderr = stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, errors.New("git diff " + spec + ": " + strings.TrimSpace(stderr.String()))
+		}
+		raw = strings.Split(string(out), "\n")
+	case strings.HasPrefix(spec, "@"):
+		var b []byte
+		var err error
+		if spec == "@-" {
+			b, err = io.ReadAll(os.Stdin)
+		} else {
+			b, err = os.ReadFile(spec[1:])
+		}
+		if err != nil {
+			return nil, err
+		}
+		raw = strings.Split(string(b), "\n")
+	default:
+		raw = strings.Split(spec, ",")
+	}
+
+	var files []string
+	for _, f := range raw {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if filepath.IsAbs(f) && dir != "" {
+			rel, err := filepath.Rel(dir, f)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				continue
+			}
+			f = rel
+		}
+		files = append(files, CleanRelativePath(f))
+	}
+	return files, nil
+}
+
+// a revision on both sides of the dots, e.g. "HEAD~3..HEAD" or "origin/main...HEAD", but not "../lib/foo.c"
+var gitRange = regexp.MustCompile(`^[^,\s]*[^,\s/.]\.\.\.?[^,\s/.][^,\s]*$`)
+
+// isGitRange reports whether spec is a git diff range rather than a path within dir
+func isGitRange(spec, dir string) bool {
+	if !gitRange.MatchString(spec) {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(dir, spec))
+	return err != nil
+}
+
+// CleanRelativePath converts p to a clean slash-separated path without leading "./" or "/"
+func CleanRelativePath(p string) string {
+	p = path.Clean(filepath.ToSlash(p))
+	p = strings.TrimPrefix(p, "/")
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+// IsPathWithin reports whether slash-separated path p is dir itself or lies within dir, "" is the root
+func IsPathWithin(p, dir string) bool {
+	return dir == "" || p == dir || strings.HasPrefix(p, dir+"/")
+}
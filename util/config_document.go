@@ -0,0 +1,183 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DocumentFormat is the format of a human-editable config document
+type DocumentFormat string
+
+const (
+	DocumentJSON DocumentFormat = "json"
+	DocumentYAML DocumentFormat = "yaml"
+)
+
+// ParseDocumentFormat parses "json" or "yaml", an empty string is guessed by the extension of path
+func ParseDocumentFormat(format, path string) (DocumentFormat, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			return DocumentYAML, nil
+		default:
+			return DocumentJSON, nil
+		}
+	}
+	switch DocumentFormat(format) {
+	case DocumentJSON, DocumentYAML:
+		return DocumentFormat(format), nil
+	case "yml":
+		return DocumentYAML, nil
+	default:
+		return "", fmt.Errorf("unknown document format %s, should be one of: json, yaml", format)
+	}
+}
+
+// ConfigDocument is the human-editable form of a config file, content is the uncompressed content as is
+//
+// json:
+//
+//	{
+//	  "type": "cargo",
+//	  "metadata": {"source": "router", ...},
+//	  "content": {"packages": [...], ...}
+//	}
+type ConfigDocument struct {
+	CompilerType string          `json:"type"`
+	Metadata     *ConfigMetadata `json:"metadata,omitempty"` // absent for format version 1
+	Content      json.RawMessage `json:"content"`
+}
+
+type yamlConfigDocument struct {
+	CompilerType string          `yaml:"type"`
+	Metadata     *ConfigMetadata `yaml:"metadata,omitempty"`
+	Content      yaml.Node       `yaml:"content"`
+}
+
+// ExportConfig converts config to a document of given format
+func ExportConfig(config *Config, format DocumentFormat) ([]byte, error) {
+	content, err := config.Content()
+	if err != nil {
+		return nil, err
+	}
+	var metadata *ConfigMetadata
+	if config.Version >= 2 {
+		metadata = &config.Metadata
+	}
+	switch format {
+	case DocumentJSON:
+		b, err := json.MarshalIndent(ConfigDocument{
+			CompilerType: config.CompilerType,
+			Metadata:     metadata,
+			Content:      content,
+		}, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	case DocumentYAML:
+		// json is valid yaml, parsing it as a node keeps the order of keys
+		doc := yamlConfigDocument{
+			CompilerType: config.CompilerType,
+			Metadata:     metadata,
+		}
+		var node yaml.Node
+		err := yaml.Unmarshal(content, &node)
+		if err != nil {
+			return nil, fmt.Errorf("config file: malformed content: %w", err)
+		}
+		if node.Kind == yaml.DocumentNode && len(node.Content) == 1 {
+			doc.Content = *node.Content[0]
+		}
+		blockStyle(&doc.Content)
+		b := new(bytes.Buffer)
+		encoder := yaml.NewEncoder(b)
+		encoder.SetIndent(2)
+		err = encoder.Encode(&doc)
+		if err != nil {
+			return nil, err
+		}
+		err = encoder.Close()
+		if err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown document format %s", format)
+	}
+}
+
+// blockStyle formats the node in block style, except for sequences of scalars, which stay in one line
+func blockStyle(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		node.Style = 0
+	case yaml.SequenceNode:
+		node.Style = yaml.FlowStyle
+		for _, child := range node.Content {
+			if child.Kind != yaml.ScalarNode {
+				node.Style = 0
+			}
+		}
+	default:
+		node.Style = 0
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// ImportConfig converts a document of given format back to config, the content is not validated against its compiler type
+func ImportConfig(b []byte, format DocumentFormat) (*Config, error) {
+	var doc ConfigDocument
+	switch format {
+	case DocumentJSON:
+		err := json.Unmarshal(b, &doc)
+		if err != nil {
+			return nil, fmt.Errorf("config document: %w", err)
+		}
+	case DocumentYAML:
+		var raw struct {
+			CompilerType string          `yaml:"type"`
+			Metadata     *ConfigMetadata `yaml:"metadata"`
+			Content      any             `yaml:"content"`
+		}
+		err := yaml.Unmarshal(b, &raw)
+		if err != nil {
+			return nil, fmt.Errorf("config document: %w", err)
+		}
+		doc.CompilerType = raw.CompilerType
+		doc.Metadata = raw.Metadata
+		doc.Content, err = json.Marshal(raw.Content)
+		if err != nil {
+			return nil, fmt.Errorf("config document: content: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown document format %s", format)
+	}
+
+	if doc.CompilerType == "" {
+		return nil, fmt.Errorf("config document: missing type")
+	}
+	if len(doc.Content) == 0 || string(doc.Content) == "null" {
+		return nil, fmt.Errorf("config document: missing content")
+	}
+	content := new(bytes.Buffer)
+	err := json.Compact(content, doc.Content)
+	if err != nil {
+		return nil, fmt.Errorf("config document: content: %w", err)
+	}
+	config := &Config{
+		CompilerType:        doc.CompilerType,
+		UncompressedContent: content.Bytes(),
+	}
+	if doc.Metadata != nil {
+		config.Metadata = *doc.Metadata
+	}
+	return config, nil
+}
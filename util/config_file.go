@@ -1,98 +1,467 @@
 package util
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
-const CONFIG_MAGIC = 0xfcfcfcfc
+const CONFIG_MAGIC = 0xfcfcfcfc           // format version 1, without version field
+const CONFIG_MAGIC_VERSIONED = 0xfcfcfcfd // format version 2 and later, followed by the version
+const CONFIG_VERSION = 3                  // latest format version this build can read and write
 
 // config file spec
 // everything in little-endian
+//
+// version 1:
+//
+//	magic        uint32 // CONFIG_MAGIC
+//	typeLength   uint32 // length of CompilerType, does NOT include NULL terminator
+//	CompilerType string // ascii string, does NOT have NULL terminator
+//	content      []byte // gzip compressed
+//
+// version 2:
+//
+//	magic        uint32 // CONFIG_MAGIC_VERSIONED
+//	version      uint32 // CONFIG_VERSION
+//	headerLength uint32 // length of header
+//	header       []byte // json of ConfigHeader
+//	content      []byte // compressed by ConfigHeader.Compression
+//
+// version 3: same layout as version 2, cxx content is in `format` 2 with a directory table,
+// which version 2 readers would read as a target without sources
+//
+// The layout of the content is up to the compiler type, which versions it by itself if needed, e.g. `format` of cxx
+//
+// The content of a parsed config is streamed from where it is parsed from by `Decode()` and `Content()`,
+// configs constructed in memory set `UncompressedContent` directly
 type Config struct {
-	magic               uint32 // should be const CONFIG_MAGIC
-	typeLength          uint32 // length of CompilerType, does NOT include NULL terminator
-	CompilerType        string // ascii string, does NOT have NULL terminator
-	UncompressedContent []byte // actually compressed in file
+	magic               uint32
+	Version             uint32
+	CompilerType        string
+	Compression         Compression
+	Checksum            string // "sha256:" + hex of UncompressedContent, empty for version 1
+	Metadata            ConfigMetadata
+	UncompressedContent []byte // actually compressed in file, nil until `Content()` is called for parsed configs
+
+	// where the content of a parsed config is streamed from
+	path   string // config file, the content starts at offset
+	offset int64
+	data   []byte // compressed content of a config parsed from memory
+}
+
+// ConfigHeader is the self-describing header of version 2
+type ConfigHeader struct {
+	CompilerType string         `json:"type"`
+	Compression  string         `json:"compression"`
+	Level        int            `json:"level,omitempty"` // compression level, 0 means default
+	Checksum     string         `json:"checksum"`
+	Metadata     ConfigMetadata `json:"metadata"`
 }
 
+// ConfigMetadata describes where a config comes from, empty for version 1
+type ConfigMetadata struct {
+	Source    string    `json:"source"`    // name of the directory the config is generated from
+	Created   time.Time `json:"created"`   // when the config is generated
+	Generator string    `json:"generator"` // "fake-compiler <version>" that generated the config
+	Tasks     int       `json:"tasks"`     // number of compiling tasks
+}
+
+const (
+	CompressionGzip  = "gzip"
+	CompressionZlib  = "zlib"
+	CompressionFlate = "flate"
+	CompressionNone  = "none"
+)
+
+// Compression is how the content of config file is compressed
+type Compression struct {
+	Algorithm string // one of CompressionGzip, CompressionZlib, CompressionFlate, CompressionNone, empty means gzip
+	Level     int    // 1 (fastest) to 9 (best), 0 means default, ignored by CompressionNone
+}
+
+// ParseCompression parses "algorithm" or "algorithm:level", level is 1-9, "fast", "best" or "default"
+func ParseCompression(spec string) (Compression, error) {
+	algorithm, level, found := strings.Cut(spec, ":")
+	c := Compression{Algorithm: algorithm}
+	switch algorithm {
+	case CompressionGzip, CompressionZlib, CompressionFlate:
+	case CompressionNone:
+		if found {
+			return Compression{}, errors.New("compression none has no level")
+		}
+	default:
+		return Compression{}, fmt.Errorf("unknown compression %s, should be one of: gzip, zlib, flate, none", algorithm)
+	}
+	if !found {
+		return c, nil
+	}
+	switch level {
+	case "fast":
+		c.Level = flate.BestSpeed
+	case "best":
+		c.Level = flate.BestCompression
+	case "default":
+		c.Level = 0
+	default:
+		l, err := strconv.Atoi(level)
+		if err != nil || l < flate.BestSpeed || l > flate.BestCompression {
+			return Compression{}, fmt.Errorf("invalid compression level %s, should be 1-9, fast, best or default", level)
+		}
+		c.Level = l
+	}
+	return c, nil
+}
+
+func (c Compression) String() string {
+	algorithm := c.Algorithm
+	if algorithm == "" {
+		algorithm = CompressionGzip
+	}
+	if c.Level == 0 || algorithm == CompressionNone {
+		return algorithm
+	}
+	return algorithm + ":" + strconv.Itoa(c.Level)
+}
+
+var errChecksumMismatch = errors.New("config file: checksum mismatch, the file is corrupted")
+
+// ParseConfigFile parses the header, the content is streamed from the file by `Decode()` or `Content()`,
+// which open the file again, so that nothing is left open
 func ParseConfigFile(path string) (*Config, error) {
-	b, err := os.ReadFile(path)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// not buffered, so that the position of the file is where the content starts
+	config, err := parseConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	config.offset, err = f.Seek(0, io.SeekCurrent)
 	if err != nil {
 		return nil, err
 	}
+	config.path = path
+	return config, nil
+}
+
+// ParseConfigData parses the content of a config file, e.g. an embedded one
+func ParseConfigData(b []byte) (*Config, error) {
 	if len(b) > 0xffffffff {
 		return nil, errors.New("config file: file size too large")
 	}
-	if len(b) < 8 {
+	r := bytes.NewReader(b)
+	config, err := parseConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	config.data = b[len(b)-r.Len():]
+	return config, nil
+}
+
+func parseConfig(r io.Reader) (*Config, error) {
+	buf := make([]byte, 8)
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
 		return nil, errors.New("config file: invalid format")
 	}
-	magic := binary.LittleEndian.Uint32(b)
-	if magic != CONFIG_MAGIC {
+	var config *Config
+	magic := binary.LittleEndian.Uint32(buf)
+	switch magic {
+	case CONFIG_MAGIC:
+		config, err = parseConfigV1(r, binary.LittleEndian.Uint32(buf[4:]))
+	case CONFIG_MAGIC_VERSIONED:
+		version := binary.LittleEndian.Uint32(buf[4:])
+		if version > CONFIG_VERSION {
+			return nil, fmt.Errorf("config file: format version %d is newer than the latest supported version %d, please upgrade fake-compiler", version, CONFIG_VERSION)
+		}
+		if version < 2 {
+			return nil, fmt.Errorf("config file: invalid format version %d", version)
+		}
+		config, err = parseConfigV2(r, version)
+	default:
 		return nil, errors.New("config file: magic does not match, make sure it is the config generated by fake-compiler")
 	}
-	typeLen := binary.LittleEndian.Uint32(b[4:])
-	if uint32(len(b)) < typeLen+8 {
+	if err != nil {
+		return nil, err
+	}
+	switch config.Compression.Algorithm {
+	case CompressionGzip, CompressionZlib, CompressionFlate, CompressionNone:
+	default:
+		return nil, fmt.Errorf("config file: unsupported compression %q, please upgrade fake-compiler", config.Compression.Algorithm)
+	}
+	return config, nil
+}
+
+func parseConfigV1(r io.Reader, typeLen uint32) (*Config, error) {
+	if typeLen > 0xff {
 		return nil, errors.New("config file: malformed compiler type")
 	}
-	typeByte := b[8 : 8+typeLen]
-	compressedContent := b[8+typeLen:]
-	w, err := gzip.NewReader(bytes.NewReader(compressedContent))
+	typeByte := make([]byte, typeLen)
+	_, err := io.ReadFull(r, typeByte)
 	if err != nil {
-		return nil, err
+		return nil, errors.New("config file: malformed compiler type")
 	}
-	uncompressedContent, err := io.ReadAll(w)
+	return &Config{
+		magic:        CONFIG_MAGIC,
+		Version:      1,
+		CompilerType: string(typeByte),
+		Compression:  Compression{Algorithm: CompressionGzip},
+	}, nil
+}
+
+// parseConfigV2 parses version 2 and later
+func parseConfigV2(r io.Reader, version uint32) (*Config, error) {
+	buf := make([]byte, 4)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
-		return nil, err
+		return nil, errors.New("config file: invalid format")
+	}
+	headerLen := binary.LittleEndian.Uint32(buf)
+	if headerLen > 1<<20 {
+		return nil, errors.New("config file: malformed header")
+	}
+	b := make([]byte, headerLen)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return nil, errors.New("config file: malformed header")
+	}
+	var header ConfigHeader
+	err = json.Unmarshal(b, &header)
+	if err != nil {
+		return nil, fmt.Errorf("config file: malformed header: %w", err)
 	}
 	return &Config{
-		magic:               CONFIG_MAGIC,
-		typeLength:          typeLen,
-		CompilerType:        string(typeByte),
-		UncompressedContent: uncompressedContent,
+		magic:        CONFIG_MAGIC_VERSIONED,
+		Version:      version,
+		CompilerType: header.CompilerType,
+		Compression:  Compression{Algorithm: header.Compression, Level: header.Level},
+		Checksum:     header.Checksum,
+		Metadata:     header.Metadata,
 	}, nil
 }
 
-// dump as config file
-func DumpConfigFile(path string, compilerType []byte, uncompressedContent []byte) error {
-	// open file
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+// contentStream decompresses the content of a parsed config, and computes the checksum along the way
+type contentStream struct {
+	reader io.Reader
+	hash   hash.Hash
+	file   *os.File // nil for configs parsed from memory
+}
+
+func (config *Config) openContent() (*contentStream, error) {
+	var r io.Reader
+	var file *os.File
+	switch {
+	case config.path != "":
+		f, err := os.Open(config.path)
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.Seek(config.offset, io.SeekStart)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		r, file = bufio.NewReader(f), f
+	case config.data != nil:
+		r = bytes.NewReader(config.data)
+	default:
+		return nil, errors.New("config file: no content")
+	}
+	var reader io.Reader
+	var err error
+	switch config.Compression.Algorithm {
+	case CompressionGzip:
+		reader, err = gzip.NewReader(r)
+	case CompressionZlib:
+		reader, err = zlib.NewReader(r)
+	case CompressionFlate:
+		reader = flate.NewReader(r)
+	default:
+		reader = r
+	}
 	if err != nil {
-		return err
+		if file != nil {
+			_ = file.Close()
+		}
+		return nil, fmt.Errorf("config file: malformed content: %w", err)
 	}
-	defer f.Close()
+	h := sha256.New()
+	return &contentStream{
+		reader: io.TeeReader(reader, h),
+		hash:   h,
+		file:   file,
+	}, nil
+}
 
-	buf := make([]byte, 4)
+// finish reads the rest of the content and verifies the checksum, if expected is not empty
+func (stream *contentStream) finish(expected string) error {
+	_, err := io.Copy(io.Discard, stream.reader)
+	if err != nil {
+		return fmt.Errorf("config file: malformed content: %w", err)
+	}
+	if expected != "" && "sha256:"+hex.EncodeToString(stream.hash.Sum(nil)) != expected {
+		return errChecksumMismatch
+	}
+	return nil
+}
+
+func (stream *contentStream) close() {
+	if stream.file != nil {
+		_ = stream.file.Close()
+	}
+}
 
-	// magic
-	binary.LittleEndian.PutUint32(buf, CONFIG_MAGIC)
-	_, err = f.Write(buf)
+// Decode decodes the json content into v, it can be called any number of times.
+// The content of a parsed config is decoded while being decompressed from the file, so that large configs
+// do not pause before the build starts, the checksum is verified once the whole content is read
+func (config *Config) Decode(v any) error {
+	if config.UncompressedContent != nil {
+		return json.Unmarshal(config.UncompressedContent, v)
+	}
+	stream, err := config.openContent()
 	if err != nil {
 		return err
 	}
+	defer stream.close()
+	err = json.NewDecoder(stream.reader).Decode(v)
+	finishErr := stream.finish(config.Checksum)
+	// a corrupted file is more likely the cause than a malformed one
+	if errors.Is(finishErr, errChecksumMismatch) || err == nil {
+		return finishErr
+	}
+	return err
+}
 
-	// typeLength
-	if len(compilerType) > 0xffffffff {
-		return errors.New("config file: compiler type is too large")
+// Content returns the uncompressed content, the content of a parsed config is decompressed and verified
+// on the first call, and kept in UncompressedContent
+func (config *Config) Content() ([]byte, error) {
+	if config.UncompressedContent != nil {
+		return config.UncompressedContent, nil
+	}
+	stream, err := config.openContent()
+	if err != nil {
+		return nil, err
+	}
+	defer stream.close()
+	content, err := io.ReadAll(stream.reader)
+	if err != nil {
+		return nil, fmt.Errorf("config file: malformed content: %w", err)
 	}
-	binary.LittleEndian.PutUint32(buf, uint32(len(compilerType)))
-	_, err = f.Write(buf)
+	err = stream.finish(config.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	config.UncompressedContent = content
+	return content, nil
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// DumpConfigFile dumps config as the latest format version, compressed by config.Compression,
+// creation time and generator of metadata are filled if empty. The file is replaced atomically, see WriteFileAtomic
+func DumpConfigFile(path string, config *Config) error {
+	content, err := config.Content()
 	if err != nil {
 		return err
 	}
-	// compilerType
-	_, err = f.Write(compilerType)
+	if config.Metadata.Created.IsZero() {
+		config.Metadata.Created = time.Now().UTC().Truncate(time.Second)
+	}
+	if config.Metadata.Generator == "" {
+		config.Metadata.Generator = "fake-compiler " + GeneratorVersion()
+	}
+	if config.Compression.Algorithm == "" {
+		config.Compression.Algorithm = CompressionGzip
+	}
+	config.Checksum = checksum(content)
+	config.Version = CONFIG_VERSION
+	config.magic = CONFIG_MAGIC_VERSIONED
+
+	header, err := json.Marshal(ConfigHeader{
+		CompilerType: config.CompilerType,
+		Compression:  config.Compression.Algorithm,
+		Level:        config.Compression.Level,
+		Checksum:     config.Checksum,
+		Metadata:     config.Metadata,
+	})
 	if err != nil {
 		return err
 	}
-	// CompressedContent
-	w := gzip.NewWriter(f)
-	defer w.Close()
-	_, err = w.Write(uncompressedContent)
+	if len(header) > 0xffffffff {
+		return errors.New("config file: header is too large")
+	}
 
-	return err
+	return WriteFileAtomic(path, 0644, func(w io.Writer) error {
+		buf := make([]byte, 12)
+		binary.LittleEndian.PutUint32(buf, CONFIG_MAGIC_VERSIONED)
+		binary.LittleEndian.PutUint32(buf[4:], CONFIG_VERSION)
+		binary.LittleEndian.PutUint32(buf[8:], uint32(len(header)))
+		_, err := w.Write(buf)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(header)
+		if err != nil {
+			return err
+		}
+		// CompressedContent
+		cw, err := compressor(w, config.Compression)
+		if err != nil {
+			return err
+		}
+		_, err = cw.Write(content)
+		if err != nil {
+			_ = cw.Close()
+			return err
+		}
+		// flushes the rest of compressed content
+		return cw.Close()
+	})
+}
+
+func compressor(w io.Writer, compression Compression) (io.WriteCloser, error) {
+	level := compression.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	switch compression.Algorithm {
+	case CompressionGzip:
+		return gzip.NewWriterLevel(w, level)
+	case CompressionZlib:
+		return zlib.NewWriterLevel(w, level)
+	case CompressionFlate:
+		return flate.NewWriter(w, level)
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	default:
+		return nil, fmt.Errorf("config file: unknown compression %s", compression.Algorithm)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
 }
@@ -0,0 +1,102 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CompilerTypeMulti is the compiler type of configs that consist of several stages, see MergeConfigs
+const CompilerTypeMulti = "multi"
+
+// content of multi config, stages are built one after another
+type multiConfigContent struct {
+	Stages []ConfigDocument `json:"stages"`
+}
+
+// MergeConfigs merges configs into a multi config, in which each config is a stage built after the previous ones.
+// Stages of multi configs are merged as is
+func MergeConfigs(configs []*Config) (*Config, error) {
+	var content multiConfigContent
+	var sources []string
+	tasks := 0
+	for _, config := range configs {
+		stages, err := config.Stages()
+		if err != nil {
+			return nil, err
+		}
+		for _, stage := range stages {
+			stageContent, err := stage.Content()
+			if err != nil {
+				return nil, err
+			}
+			doc := ConfigDocument{
+				CompilerType: stage.CompilerType,
+				Content:      stageContent,
+			}
+			if stage.Version >= 2 {
+				metadata := stage.Metadata
+				doc.Metadata = &metadata
+				tasks += metadata.Tasks
+			}
+			content.Stages = append(content.Stages, doc)
+		}
+		if config.Metadata.Source != "" {
+			sources = append(sources, config.Metadata.Source)
+		}
+	}
+	if len(content.Stages) == 0 {
+		return nil, errors.New("no config to merge")
+	}
+	b, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		CompilerType:        CompilerTypeMulti,
+		UncompressedContent: b,
+		Metadata: ConfigMetadata{
+			Source: strings.Join(sources, "+"),
+			Tasks:  tasks,
+		},
+	}, nil
+}
+
+// Stages returns the stages of multi config in order, or config itself for the others
+func (config *Config) Stages() ([]*Config, error) {
+	if config.CompilerType != CompilerTypeMulti {
+		return []*Config{config}, nil
+	}
+	// the content is kept, so that the config can be dumped again
+	b, err := config.Content()
+	if err != nil {
+		return nil, err
+	}
+	var content multiConfigContent
+	err = json.Unmarshal(b, &content)
+	if err != nil {
+		return nil, fmt.Errorf("malformed config: %w", err)
+	}
+	if len(content.Stages) == 0 {
+		return nil, errors.New("malformed config: no stages")
+	}
+	var stages []*Config
+	for i, doc := range content.Stages {
+		if doc.CompilerType == "" || doc.CompilerType == CompilerTypeMulti {
+			return nil, fmt.Errorf("malformed config: stage %d has invalid type %q", i, doc.CompilerType)
+		}
+		stage := &Config{
+			Version:             1,
+			CompilerType:        doc.CompilerType,
+			Compression:         config.Compression,
+			UncompressedContent: doc.Content,
+		}
+		if doc.Metadata != nil {
+			stage.Version = config.Version
+			stage.Metadata = *doc.Metadata
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
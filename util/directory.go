@@ -3,10 +3,11 @@ package util
 import (
 	"errors"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
-	"sync"
 )
 
 // Directory stores information about file architecture
@@ -30,6 +31,38 @@ type Directory struct {
 	filenameFilter *regexp.Regexp
 	ignoreEmptyDir bool
 	canRead        bool
+	options        *traverseOptions // shared by the whole tree
+	rel            string           // path relative to the root directory, slash-separated
+	ignore         ignoreRules      // gitignore rules that apply to the entries of this directory
+	depth          int              // 0 for the root directory
+}
+
+// TraverseOptions controls which files are visited by `Traverse()`
+//
+// `GitMode` : how git metadata is honoured, see `GitMode`
+//
+// `Include` : if not empty, only files whose path relative to the root directory matches one of these globs are kept
+//
+// `Exclude` : files and directories whose path relative to the root directory matches one of these globs are skipped
+//
+// `Workers` : max number of directories read at the same time, default: `runtime.NumCPU()`
+//
+// `MaxDepth` : directories deeper than it are skipped, direct subdirectories of the root are of depth 1, 0 means unlimited
+//
+// `Symlinks` : how symbolic links are handled, see `SymlinkPolicy`
+type TraverseOptions struct {
+	GitMode  GitMode
+	Include  []string
+	Exclude  []string
+	Workers  int
+	MaxDepth int
+	Symlinks SymlinkPolicy
+}
+
+type traverseOptions struct {
+	TraverseOptions
+	repoRoot string // worktree root of the git repository
+	repoRel  string // root directory relative to repoRoot
 }
 
 type File struct {
@@ -69,68 +102,296 @@ func NewDirectory(path, filenameFilter string, ignoreEmptyDir bool) (*Directory,
 		ignoreEmptyDir: ignoreEmptyDir,
 		isRoot:         true,
 		Complete:       false,
+		options:        new(traverseOptions),
 	}, nil
 }
 
+// SetOptions sets the options of `Traverse()`, must be called before it
+func (directory *Directory) SetOptions(options TraverseOptions) error {
+	for _, glob := range append(options.Include, options.Exclude...) {
+		err := validateGlob(glob)
+		if err != nil {
+			return err
+		}
+	}
+	directory.options = &traverseOptions{TraverseOptions: options}
+	return nil
+}
+
 // Traverse traverses the directory and store its file architecture information
 //
-// will error if provided `path` is not a directory or have no read permission
-func (directory *Directory) Traverse() error {
+// will error if provided `path` is not a directory or have no read permission.
+// Errors of paths within the directory do not stop the traversal, these paths are skipped and returned as `errs`
+func (directory *Directory) Traverse() (errs []*os.PathError, err error) {
 
 	info, err := os.Stat(directory.Path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !info.IsDir() {
-		return errors.New(directory.Path + " is not a directory")
+		return nil, errors.New(directory.Path + " is not a directory")
 	}
 
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	go directory.traverse(directory.Path, &wg)
-	wg.Wait()
-	return nil
-}
+	if directory.options.GitMode != GitModeNone {
+		root, gitDir, err := findGitDir(directory.Path)
+		if err != nil {
+			return nil, err
+		}
+		abs, err := filepath.Abs(directory.Path)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil {
+			return nil, err
+		}
+		directory.options.repoRoot = root
+		directory.options.repoRel = CleanRelativePath(rel)
 
-func (directory *Directory) traverse(path string, wg *sync.WaitGroup) {
-	defer wg.Done()
+		if directory.options.GitMode == GitModeTracked {
+			return nil, directory.traverseGitIndex(gitDir)
+		}
+		directory.ignore, err = loadIgnoreRules(root, gitDir, abs)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	clear(directory.SubDirs)
-	clear(directory.Files)
-	directory.Path = path
-	files, err := os.ReadDir(path)
-	if errors.Is(err, os.ErrPermission) {
-		directory.canRead = false
-	} else {
-		directory.canRead = true
+	w := newWalker(directory.options.Workers)
+	if id, ok := getFileID(info); ok {
+		w.visited[id] = true
 	}
-	for _, file := range files {
-		if file.IsDir() {
-			subDir := new(Directory)
-			subDir.filenameFilter = directory.filenameFilter
-			subDir.ignoreEmptyDir = directory.ignoreEmptyDir
-			directory.SubDirs = append(directory.SubDirs, subDir)
-			wg.Add(1)
-			if path[len(path)-1] == '/' {
-				go subDir.traverse(path+file.Name(), wg)
-			} else {
-				go subDir.traverse(path+"/"+file.Name(), wg)
+	w.run(directory)
+	return w.errs, nil
+}
+
+// visit reads the directory at directory.Path, files are appended immediately, subdirectories are returned
+// so that they are visited later by the walker
+func (directory *Directory) visit(w *walker) (subDirs []*Directory) {
+	dirPath := directory.Path
+	directory.SubDirs = nil
+	directory.Files = nil
+	directory.canRead = true
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		// entries read before the error are still kept
+		w.report(dirPath, "readdir", err)
+		if errors.Is(err, os.ErrPermission) {
+			directory.canRead = false
+		}
+	}
+	if directory.options.GitMode == GitModeIgnore {
+		own, err := parseIgnoreFile(filepath.Join(dirPath, ".gitignore"), directory.repoPath(directory.rel))
+		if err != nil {
+			w.report(filepath.Join(dirPath, ".gitignore"), "read", err)
+		} else if len(own) > 0 {
+			directory.ignore = append(slices.Clip(directory.ignore), own...)
+		}
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(dirPath, entry.Name())
+		rel := entry.Name()
+		if directory.rel != "" {
+			rel = directory.rel + "/" + entry.Name()
+		}
+
+		isDir := entry.IsDir()
+		isLink := entry.Type()&os.ModeSymlink != 0
+		var info os.FileInfo
+		if isLink {
+			if directory.options.Symlinks == SymlinkIgnore {
+				continue
 			}
-		} else {
-			if directory.filenameFilter == nil || (directory.filenameFilter != nil && directory.filenameFilter.Match([]byte(file.Name()))) {
-				stat, err := os.Stat(path + "/" + file.Name())
-				fileSize := int64(0)
-				if err != nil {
-					fileSize = 0
-				} else {
-					fileSize = stat.Size()
+			info, err = os.Stat(entryPath)
+			if err != nil {
+				w.report(entryPath, "follow", err)
+				continue
+			}
+			isDir = info.IsDir()
+		}
+
+		if !directory.accept(rel, isDir) {
+			continue
+		}
+		if isDir {
+			if directory.options.MaxDepth > 0 && directory.depth+1 > directory.options.MaxDepth {
+				continue
+			}
+			subDir := &Directory{
+				Path:           entryPath,
+				filenameFilter: directory.filenameFilter,
+				ignoreEmptyDir: directory.ignoreEmptyDir,
+				options:        directory.options,
+				rel:            rel,
+				ignore:         directory.ignore,
+				depth:          directory.depth + 1,
+			}
+			if directory.options.Symlinks == SymlinkFollowSafe {
+				if isLink {
+					// visited after all real directories, only if its target is not visited yet
+					w.deferLink(directory, subDir, info)
+					continue
 				}
-				directory.Files = append(directory.Files, File{Name: file.Name(),
-					Size: fileSize})
+				if info, err = entry.Info(); err == nil {
+					w.markVisited(info)
+				}
+			}
+			directory.SubDirs = append(directory.SubDirs, subDir)
+			subDirs = append(subDirs, subDir)
+			continue
+		}
+
+		if directory.filenameFilter != nil && !directory.filenameFilter.MatchString(entry.Name()) {
+			continue
+		}
+		if info == nil {
+			info, err = entry.Info()
+		}
+		fileSize := int64(0)
+		if err != nil {
+			w.report(entryPath, "stat", err)
+		} else {
+			fileSize = info.Size()
+		}
+		directory.Files = append(directory.Files, File{Name: entry.Name(), Size: fileSize})
+	}
+	directory.Complete = true
+	return
+}
+
+// repoPath converts path relative to the root directory to path relative to the repository root
+func (directory *Directory) repoPath(rel string) string {
+	if directory.options.repoRel == "" {
+		return rel
+	}
+	if rel == "" {
+		return directory.options.repoRel
+	}
+	return directory.options.repoRel + "/" + rel
+}
+
+// accept reports whether the entry at rel (relative to the root directory) should be visited
+func (directory *Directory) accept(rel string, isDir bool) bool {
+	options := directory.options
+	if options.GitMode != GitModeNone {
+		if isDir && path.Base(rel) == ".git" {
+			return false
+		}
+		if directory.ignore.ignored(directory.repoPath(rel), isDir) {
+			return false
+		}
+	}
+	for _, glob := range options.Exclude {
+		if MatchGlob(glob, rel) {
+			return false
+		}
+	}
+	if !isDir && len(options.Include) > 0 {
+		for _, glob := range options.Include {
+			if MatchGlob(glob, rel) {
+				return true
 			}
 		}
+		return false
 	}
+	return true
+}
+
+// NewDirectoryFromFiles constructs a complete `Directory` without reading the file system,
+// files are slash-separated paths relative to root, sizes are their sizes in the same order
+func NewDirectoryFromFiles(root string, files []string, sizes []int64) *Directory {
+	directory := &Directory{
+		Path:     root,
+		Complete: true,
+		isRoot:   true,
+		canRead:  true,
+		options:  new(traverseOptions),
+	}
+	getDir := directory.subDirGetter()
+	for i, f := range files {
+		f = CleanRelativePath(f)
+		d := getDir(CleanRelativePath(path.Dir(f)))
+		d.Files = append(d.Files, File{Name: path.Base(f), Size: sizes[i]})
+	}
+	return directory
+}
+
+// subDirGetter returns a function that gets the subdirectory at rel (relative to directory), creating it if not exist
+func (directory *Directory) subDirGetter() func(rel string) *Directory {
+	dirs := map[string]*Directory{"": directory}
+	var getDir func(rel string) *Directory
+	getDir = func(rel string) *Directory {
+		d, ok := dirs[rel]
+		if ok {
+			return d
+		}
+		parent := getDir(CleanRelativePath(path.Dir(rel)))
+		d = &Directory{
+			Path:           filepath.Join(parent.Path, path.Base(rel)),
+			Complete:       true,
+			filenameFilter: directory.filenameFilter,
+			ignoreEmptyDir: directory.ignoreEmptyDir,
+			canRead:        true,
+			options:        directory.options,
+			rel:            rel,
+			depth:          parent.depth + 1,
+		}
+		parent.SubDirs = append(parent.SubDirs, d)
+		dirs[rel] = d
+		return d
+	}
+	return getDir
+}
+
+// traverseGitIndex constructs the tree from files tracked in the git index instead of reading directories
+func (directory *Directory) traverseGitIndex(gitDir string) error {
+	entries, err := ReadGitIndex(gitDir)
+	if err != nil {
+		return err
+	}
+
+	directory.SubDirs = nil
+	directory.Files = nil
+	directory.canRead = true
 	directory.Complete = true
+	getDir := directory.subDirGetter()
+
+	for _, entry := range entries {
+		rel, ok := strings.CutPrefix(entry.Path, directory.options.repoRel)
+		if !ok {
+			continue
+		}
+		if directory.options.repoRel != "" {
+			// "dir/file" is within "dir", while "dir2/file" is not
+			rel, ok = strings.CutPrefix(rel, "/")
+			if !ok {
+				continue
+			}
+		}
+		// excluded directories
+		excluded := false
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if !directory.accept(dir, true) {
+				excluded = true
+				break
+			}
+		}
+		name := path.Base(rel)
+		if excluded || !directory.accept(rel, false) {
+			continue
+		}
+		if directory.filenameFilter != nil && !directory.filenameFilter.MatchString(name) {
+			continue
+		}
+		size := int64(entry.Size)
+		if stat, err := os.Stat(filepath.Join(directory.options.repoRoot, entry.Path)); err == nil {
+			size = stat.Size()
+		}
+		d := getDir(CleanRelativePath(path.Dir(rel)))
+		d.Files = append(d.Files, File{Name: name, Size: size})
+	}
+	return nil
 }
 
 // ├ ── │ └
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package util
+
+import "os"
+
+// fileID identifies a file on the system regardless of its path
+type fileID struct{}
+
+// getFileID is not supported, symlink loops are only bounded by `MaxDepth`
+func getFileID(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,221 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// GitMode specifies how git metadata is honoured when traversing a directory
+type GitMode int
+
+const (
+	GitModeNone    GitMode = iota // walk everything
+	GitModeIgnore                 // honour .gitignore, .git/info/exclude and nested .gitignore files
+	GitModeTracked                // only files tracked in the git index
+)
+
+func ParseGitMode(mode string) (GitMode, error) {
+	switch mode {
+	case "", "none":
+		return GitModeNone, nil
+	case "ignore":
+		return GitModeIgnore, nil
+	case "tracked":
+		return GitModeTracked, nil
+	default:
+		return GitModeNone, errors.New("unknown git mode " + mode + ", should be one of none, ignore, tracked")
+	}
+}
+
+// ignorePattern is a single line of a gitignore file
+type ignorePattern struct {
+	base     string // directory of the ignore file, relative to the repository root, "" for the root
+	pattern  string
+	negate   bool // "!pattern"
+	dirOnly  bool // "pattern/"
+	anchored bool // pattern contains a slash other than the trailing one, matches relative to base only
+}
+
+// ignoreRules is an ordered list of patterns, the last matching pattern decides
+type ignoreRules []ignorePattern
+
+// parseIgnoreFile reads patterns from a gitignore-format file, base is the directory it applies to,
+// relative to the repository root. A missing file has no pattern.
+func parseIgnoreFile(file, base string) (ignoreRules, error) {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rules ignoreRules
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// trailing spaces are ignored unless escaped
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+			line = line[:len(line)-1]
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{base: base}
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		p.pattern = strings.ReplaceAll(line, "\\ ", " ")
+		rules = append(rules, p)
+	}
+	return rules, scanner.Err()
+}
+
+// ignored reports whether p, a slash-separated path relative to the repository root, is ignored
+func (rules ignoreRules) ignored(p string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if !IsPathWithin(p, rule.base) || p == rule.base {
+			continue
+		}
+		sub := p
+		if rule.base != "" {
+			sub = p[len(rule.base)+1:]
+		}
+		var match bool
+		if rule.anchored {
+			match = MatchGlob(rule.pattern, sub)
+		} else {
+			match = MatchGlob(rule.pattern, path.Base(sub))
+		}
+		if match {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// MatchGlob reports whether slash-separated path p matches the glob pattern,
+// syntax of `path.Match` is extended by "**", which matches any number of directories
+func MatchGlob(pattern, p string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// try to match the rest of pattern at every position
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], segments[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		segments = segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// validateGlob reports whether pattern is a valid glob of `MatchGlob`
+func validateGlob(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return errors.New("invalid glob " + pattern + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// findGitDir looks for the repository that contains dir, returns its worktree root and git directory
+func findGitDir(dir string) (root, gitDir string, err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	for {
+		candidate := filepath.Join(dir, ".git")
+		info, err := os.Stat(candidate)
+		if err == nil {
+			if info.IsDir() {
+				return dir, candidate, nil
+			}
+			// worktree or submodule: ".git" is a file with "gitdir: path"
+			b, err := os.ReadFile(candidate)
+			if err != nil {
+				return "", "", err
+			}
+			gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir:")
+			if !ok {
+				return "", "", errors.New(candidate + ": malformed .git file")
+			}
+			gitDir = strings.TrimSpace(gitDir)
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(dir, gitDir)
+			}
+			return dir, gitDir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", errors.New("not a git repository (or any of the parent directories): " + dir)
+		}
+		dir = parent
+	}
+}
+
+// loadIgnoreRules loads .git/info/exclude and .gitignore files from the repository root down to dir (exclusive),
+// i.e. the rules that apply to dir before its own .gitignore
+func loadIgnoreRules(root, gitDir, dir string) (ignoreRules, error) {
+	rules, err := parseIgnoreFile(filepath.Join(gitDir, "info", "exclude"), "")
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return nil, err
+	}
+	rel = CleanRelativePath(rel)
+	if rel == "" {
+		return rules, nil
+	}
+	base := ""
+	for _, name := range strings.Split(rel, "/") {
+		r, err := parseIgnoreFile(filepath.Join(root, base, ".gitignore"), base)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r...)
+		base = path.Join(base, name)
+	}
+	return rules, nil
+}
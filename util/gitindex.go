@@ -0,0 +1,128 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitIndexEntry is a file tracked in the git index
+type GitIndexEntry struct {
+	Path string // slash-separated, relative to the repository root
+	Mode uint32
+	Size uint32 // size in worktree when the file was staged, truncated to 32 bits
+}
+
+// index file format: https://git-scm.com/docs/index-format
+const gitIndexSignature = "DIRC"
+
+// ReadGitIndex parses the index file of the git directory, entries are sorted by path as git does.
+// Conflicting entries (stage > 0) of the same path are merged, sparse directory entries are skipped.
+func ReadGitIndex(gitDir string) ([]GitIndexEntry, error) {
+	b, err := os.ReadFile(filepath.Join(gitDir, "index"))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 12 || string(b[:4]) != gitIndexSignature {
+		return nil, errors.New("git index: invalid signature")
+	}
+	version := binary.BigEndian.Uint32(b[4:])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("git index: unsupported version %d", version)
+	}
+	count := binary.BigEndian.Uint32(b[8:])
+	hashSize := gitHashSize(gitDir)
+
+	// ctime, mtime: 8 + 8, dev, ino, mode, uid, gid, size: 6 * 4, then object name and 16-bit flags
+	fixedSize := 40 + hashSize + 2
+	offset := 12
+	previous := ""
+	entries := make([]GitIndexEntry, 0, count)
+	for i := uint32(0); i < count; i++ {
+		start := offset
+		if offset+fixedSize > len(b) {
+			return nil, errors.New("git index: truncated entry")
+		}
+		mode := binary.BigEndian.Uint32(b[offset+24:])
+		size := binary.BigEndian.Uint32(b[offset+36:])
+		flags := binary.BigEndian.Uint16(b[offset+40+hashSize:])
+		offset += fixedSize
+		if flags&0x4000 != 0 { // extended flag, version 3+
+			if version < 3 {
+				return nil, errors.New("git index: extended flag in version 2")
+			}
+			offset += 2
+		}
+
+		var name string
+		if version == 4 {
+			// prefix compression: number of bytes to strip from previous name, then the NUL-terminated suffix
+			strip, n := gitIndexVarint(b[offset:])
+			if n == 0 || strip > uint64(len(previous)) {
+				return nil, errors.New("git index: malformed path prefix")
+			}
+			offset += n
+			end := bytes.IndexByte(b[offset:], 0)
+			if end < 0 {
+				return nil, errors.New("git index: truncated path")
+			}
+			name = previous[:len(previous)-int(strip)] + string(b[offset:offset+end])
+			offset += end + 1
+		} else {
+			end := bytes.IndexByte(b[offset:], 0)
+			if end < 0 {
+				return nil, errors.New("git index: truncated path")
+			}
+			name = string(b[offset : offset+end])
+			// 1-8 NUL bytes, entry length is padded to multiple of 8
+			offset = start + (offset-start+end+8)/8*8
+		}
+		previous = name
+
+		if mode&0o170000 == 0o040000 { // sparse directory
+			continue
+		}
+		if len(entries) > 0 && entries[len(entries)-1].Path == name { // unmerged stages
+			continue
+		}
+		entries = append(entries, GitIndexEntry{Path: name, Mode: mode, Size: size})
+	}
+	return entries, nil
+}
+
+// gitIndexVarint decodes the offset encoding of git, returns the value and the number of bytes read
+func gitIndexVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	c := b[0]
+	value := uint64(c & 0x7f)
+	n := 1
+	for c&0x80 != 0 {
+		if n >= len(b) {
+			return 0, 0
+		}
+		c = b[n]
+		n++
+		value = ((value + 1) << 7) | uint64(c&0x7f)
+	}
+	return value, n
+}
+
+// gitHashSize returns the size of object names of the repository, sha1 or sha256
+func gitHashSize(gitDir string) int {
+	b, err := os.ReadFile(filepath.Join(gitDir, "config"))
+	if err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			key, value, ok := strings.Cut(line, "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "objectformat") && strings.TrimSpace(value) == "sha256" {
+				return 32
+			}
+		}
+	}
+	return 20
+}
@@ -6,6 +6,7 @@ import (
 	"math"
 	"math/rand/v2"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -83,3 +84,22 @@ func PrintSomethingAtBottom(content string) {
 
 	fmt.Print(content)
 }
+
+// PrintLinesAtBottom draws lines right below the output, where the cursor is, and moves the cursor back to the first of them.
+// Unlike PrintSomethingAtBottom they follow the output, which should erase them with "\x1B[0J" before printing.
+// Lines should be narrower than the terminal, those beyond its height are dropped
+func PrintLinesAtBottom(lines []string) {
+	_, height, err := term.GetSize(0)
+	if err != nil {
+		return
+	}
+	lines = lines[:min(len(lines), max(height-1, 0))]
+	s := strings.Builder{}
+	s.WriteString("\x1B[0J") // Erase from cursor to end of screen
+	s.WriteString(strings.Join(lines, "\n"))
+	s.WriteString("\r")
+	if len(lines) > 1 {
+		fmt.Fprintf(&s, "\x1B[%dA", len(lines)-1) // Cursor up, scrolling is taken into account as lines move with it
+	}
+	fmt.Print(s.String())
+}
@@ -0,0 +1,18 @@
+package util
+
+import "runtime/debug"
+
+// Version of fake-compiler, can be set at build time:
+// go build -ldflags "-X github.com/rizutazu/fake-compiler/util.Version=v1.2.3"
+var Version = ""
+
+// GeneratorVersion returns Version if set, otherwise the module version recorded by `go install`, or "dev"
+func GeneratorVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
@@ -0,0 +1,150 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// SymlinkPolicy specifies how symbolic links are handled when traversing a directory
+type SymlinkPolicy int
+
+const (
+	SymlinkFollowSafe SymlinkPolicy = iota // default, follow symlinks, but never visit the same directory twice (detected by inode)
+	SymlinkFollow                          // follow symlinks, loops are only bounded by `MaxDepth`
+	SymlinkIgnore                          // skip symlinks
+)
+
+func ParseSymlinkPolicy(policy string) (SymlinkPolicy, error) {
+	switch policy {
+	case "", "follow-safe":
+		return SymlinkFollowSafe, nil
+	case "follow":
+		return SymlinkFollow, nil
+	case "ignore":
+		return SymlinkIgnore, nil
+	default:
+		return SymlinkFollowSafe, errors.New("unknown symlink policy " + policy + ", should be one of follow-safe, follow, ignore")
+	}
+}
+
+var errSymlinkLoop = errors.New("symlink points to a directory that is already visited")
+
+// walker visits directories with a bounded number of goroutines
+type walker struct {
+	lock    *sync.Mutex
+	cond    *sync.Cond
+	workers int
+	queue   []*Directory // directories waiting to be visited
+	pending int          // directories queued or being visited
+	visited map[fileID]bool
+	links   []deferredLink // symlinks to directories, SymlinkFollowSafe only
+	errs    []*os.PathError
+}
+
+type deferredLink struct {
+	parent *Directory
+	link   *Directory
+	info   os.FileInfo // of the link target
+}
+
+func newWalker(workers int) *walker {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	w := &walker{
+		lock:    new(sync.Mutex),
+		workers: workers,
+		visited: make(map[fileID]bool),
+	}
+	w.cond = sync.NewCond(w.lock)
+	return w
+}
+
+// run visits root and all of its subdirectories, returns after all of them are visited
+//
+// symlinks to directories are deferred until all real directories are visited,
+// so that a directory reachable both directly and via symlinks is always visited by its real path
+func (w *walker) run(root *Directory) {
+	w.queue = append(w.queue, root)
+	for len(w.queue) > 0 {
+		w.round()
+		links := w.links
+		w.links = nil
+		for _, l := range links {
+			if !w.markVisited(l.info) {
+				w.report(l.link.Path, "follow", errSymlinkLoop)
+				continue
+			}
+			l.parent.SubDirs = append(l.parent.SubDirs, l.link)
+			w.queue = append(w.queue, l.link)
+		}
+	}
+}
+
+// round visits everything in the queue, and whatever is found during the visit
+func (w *walker) round() {
+	w.pending = len(w.queue)
+	wg := sync.WaitGroup{}
+	for range w.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work()
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *walker) work() {
+	for {
+		w.lock.Lock()
+		for len(w.queue) == 0 && w.pending > 0 {
+			w.cond.Wait()
+		}
+		if w.pending == 0 {
+			w.lock.Unlock()
+			return
+		}
+		// LIFO: depth-first, keeps the queue short
+		directory := w.queue[len(w.queue)-1]
+		w.queue = w.queue[:len(w.queue)-1]
+		w.lock.Unlock()
+
+		subDirs := directory.visit(w)
+
+		w.lock.Lock()
+		w.queue = append(w.queue, subDirs...)
+		w.pending += len(subDirs) - 1
+		w.cond.Broadcast()
+		w.lock.Unlock()
+	}
+}
+
+func (w *walker) deferLink(parent, link *Directory, info os.FileInfo) {
+	w.lock.Lock()
+	w.links = append(w.links, deferredLink{parent: parent, link: link, info: info})
+	w.lock.Unlock()
+}
+
+func (w *walker) report(path, op string, err error) {
+	w.lock.Lock()
+	w.errs = append(w.errs, &os.PathError{Op: op, Path: path, Err: err})
+	w.lock.Unlock()
+}
+
+// markVisited marks the directory as visited, returns false if it was already visited
+func (w *walker) markVisited(info os.FileInfo) bool {
+	id, ok := getFileID(info)
+	if !ok {
+		return true
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.visited[id] {
+		return false
+	}
+	w.visited[id] = true
+	return true
+}
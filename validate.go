@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	cc "github.com/rizutazu/fake-compiler/compiler"
+	"github.com/rizutazu/fake-compiler/util"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate config_file...",
+	Short: "check that config files can be loaded",
+	Long: `check the format, checksum and content of config files, e.g. the dependency graph of cargo must be consistent and
+acyclic. Exits with non-zero status if any of them is invalid`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		failed := 0
+		for _, path := range args {
+			config, err := util.ParseConfigFile(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "FAIL %s: %s\n", path, err)
+				failed++
+				continue
+			}
+			tasks, err := cc.ValidateConfig(config)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "FAIL %s: %s\n", path, err)
+				failed++
+				continue
+			}
+			if config.Version >= 2 && config.Metadata.Tasks != tasks {
+				fmt.Fprintf(os.Stderr, "FAIL %s: metadata says %d tasks, but there are %d\n", path, config.Metadata.Tasks, tasks)
+				failed++
+				continue
+			}
+			fmt.Printf("ok   %s: %s, %d tasks\n", path, config.CompilerType, tasks)
+		}
+		if failed > 0 {
+			fmt.Fprintf(os.Stderr, "%d of %d config files are invalid\n", failed, len(args))
+			os.Exit(1)
+		}
+	},
+}